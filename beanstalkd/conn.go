@@ -0,0 +1,667 @@
+package beanstalkd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/internal/tcpserver"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxLineLength  = 224 // max length of a command line, see beanstalkd's protocol
+	maxTubeNameLen = 200 // max length of a tube name, see beanstalkd's protocol
+)
+
+// responses without arguments
+const (
+	respBadFormat      = "BAD_FORMAT"
+	respUnknownCommand = "UNKNOWN_COMMAND"
+	respInternalError  = "INTERNAL_ERROR"
+	respOutOfMemory    = "OUT_OF_MEMORY"
+	respExpectedCrlf   = "EXPECTED_CRLF"
+	respJobTooBig      = "JOB_TOO_BIG"
+	respNotFound       = "NOT_FOUND"
+	respTimedOut       = "TIMED_OUT"
+	respNotIgnored     = "NOT_IGNORED"
+	respDeleted        = "DELETED"
+	respReleased       = "RELEASED"
+	respBuried         = "BURIED"
+	respTouched        = "TOUCHED"
+	respPaused         = "PAUSED"
+	respKicked         = "KICKED"
+)
+
+// conn serves a client connection.
+type conn struct {
+	server   *Server
+	netConn  net.Conn
+	reader   *bufio.Reader
+	writer   *bufio.Writer
+	using    string          // the tube "put" commands go to
+	watching map[string]bool // tubes "reserve" commands take jobs from
+	reserved map[uint64]bool // ids of jobs reserved by the connection
+}
+
+func newConn(server *Server, netConn net.Conn) *conn {
+	return &conn{
+		server:   server,
+		netConn:  netConn,
+		reader:   bufio.NewReader(netConn),
+		writer:   bufio.NewWriter(netConn),
+		using:    DefaultTube,
+		watching: map[string]bool{DefaultTube: true},
+		reserved: make(map[uint64]bool),
+	}
+}
+
+// serve reads and executes commands until the connection is closed.
+func (c *conn) serve() {
+	defer c.close()
+	for {
+		line, err := tcpserver.ReadLine(c.reader, maxLineLength)
+		if err != nil {
+			if err == tcpserver.ErrorLineTooLong {
+				c.reply(respBadFormat)
+				c.writer.Flush()
+			}
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			c.reply(respUnknownCommand)
+		} else if fields[0] == "quit" {
+			return
+		} else {
+			c.server.countCommand(fields[0])
+			c.execute(fields[0], fields[1:])
+		}
+		if c.writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+// close re-queues jobs still reserved by the connection.
+func (c *conn) close() {
+	for id := range c.reserved {
+		if j := c.server.getJob(id); j != nil {
+			c.releaseJob(j, true)
+		}
+	}
+}
+
+func (c *conn) reply(format string, args ...interface{}) {
+	fmt.Fprintf(c.writer, format+"\r\n", args...)
+}
+
+// replyData writes a response line followed by a data block.
+func (c *conn) replyData(data []byte, format string, args ...interface{}) {
+	c.reply(format, args...)
+	c.writer.Write(data)
+	c.writer.WriteString("\r\n")
+}
+
+// replyYaml writes a "OK <bytes>" response followed by a YAML document.
+func (c *conn) replyYaml(yaml string) {
+	c.replyData([]byte(yaml), "OK %d", len(yaml))
+}
+
+// replyError maps an error returned by the queue to a response.
+func (c *conn) replyError(err error) {
+	if err == singu.ErrorQueueIsFull {
+		c.reply(respOutOfMemory)
+	} else {
+		c.reply(respInternalError)
+	}
+}
+
+type commandFunc func(c *conn, args []string)
+
+var commands = map[string]struct {
+	numArgs int
+	fn      commandFunc
+}{
+	"put":                  {4, (*conn).cmdPut},
+	"use":                  {1, (*conn).cmdUse},
+	"reserve":              {0, (*conn).cmdReserve},
+	"reserve-with-timeout": {1, (*conn).cmdReserveWithTimeout},
+	"delete":               {1, (*conn).cmdDelete},
+	"release":              {3, (*conn).cmdRelease},
+	"bury":                 {2, (*conn).cmdBury},
+	"touch":                {1, (*conn).cmdTouch},
+	"watch":                {1, (*conn).cmdWatch},
+	"ignore":               {1, (*conn).cmdIgnore},
+	"peek":                 {1, (*conn).cmdPeek},
+	"peek-ready":           {0, (*conn).cmdPeekReady},
+	"kick":                 {1, (*conn).cmdKick},
+	"kick-job":             {1, (*conn).cmdKickJob},
+	"stats":                {0, (*conn).cmdStats},
+	"stats-job":            {1, (*conn).cmdStatsJob},
+	"stats-tube":           {1, (*conn).cmdStatsTube},
+	"list-tubes":           {0, (*conn).cmdListTubes},
+	"list-tube-used":       {0, (*conn).cmdListTubeUsed},
+	"list-tubes-watched":   {0, (*conn).cmdListTubesWatched},
+	"pause-tube":           {2, (*conn).cmdPauseTube},
+}
+
+func (c *conn) execute(cmd string, args []string) {
+	command, ok := commands[cmd]
+	if !ok {
+		c.reply(respUnknownCommand)
+	} else if len(args) != command.numArgs {
+		c.reply(respBadFormat)
+	} else {
+		command.fn(c, args)
+	}
+}
+
+func parseJobId(s string) (uint64, bool) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	return id, err == nil
+}
+
+func isValidTubeName(tube string) bool {
+	return tube != "" && len(tube) <= maxTubeNameLen && tube[0] != '-'
+}
+
+// put <pri> <delay> <ttr> <bytes>
+func (c *conn) cmdPut(args []string) {
+	numBytes, err := strconv.Atoi(args[3])
+	if err != nil || numBytes < 0 {
+		c.reply(respBadFormat)
+		return
+	}
+	for _, arg := range args[:3] {
+		if _, err := strconv.ParseUint(arg, 10, 32); err != nil {
+			c.reply(respBadFormat)
+			return
+		}
+	}
+	if numBytes > c.server.config.MaxJobSize {
+		// discard the job's body
+		io.CopyN(ioutil.Discard, c.reader, int64(numBytes)+2)
+		c.reply(respJobTooBig)
+		return
+	}
+	data := make([]byte, numBytes+2)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return
+	}
+	if data[numBytes] != '\r' || data[numBytes+1] != '\n' {
+		c.reply(respExpectedCrlf)
+		return
+	}
+	queue, err := c.server.GetQueue(c.using)
+	if err != nil || queue == nil {
+		c.reply(respInternalError)
+		return
+	}
+	msg, err := queue.Queue(singu.NewQueueMessage(data[:numBytes]))
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	j := c.server.trackJob(c.using, msg.Id, stateReady, nil)
+	c.reply("INSERTED %d", j.id)
+}
+
+// use <tube>
+func (c *conn) cmdUse(args []string) {
+	if !isValidTubeName(args[0]) {
+		c.reply(respBadFormat)
+		return
+	}
+	c.using = args[0]
+	c.reply("USING %s", c.using)
+}
+
+// reserve
+func (c *conn) cmdReserve(_ []string) {
+	c.reserve(-1)
+}
+
+// reserve-with-timeout <seconds>
+func (c *conn) cmdReserveWithTimeout(args []string) {
+	seconds, err := strconv.Atoi(args[0])
+	if err != nil || seconds < 0 {
+		c.reply(respBadFormat)
+		return
+	}
+	c.reserve(time.Duration(seconds) * time.Second)
+}
+
+// reserve takes a job from one of the watched tubes, waiting up to timeout (forever if negative).
+func (c *conn) reserve(timeout time.Duration) {
+	tubes := make([]string, 0, len(c.watching))
+	for tube := range c.watching {
+		tubes = append(tubes, tube)
+	}
+	sort.Strings(tubes)
+	var tube string
+	var queue singu.IQueue
+	gone, stop := tcpserver.WatchDisconnect(c.netConn, c.reader)
+	msg, err := c.server.Poll(timeout, gone, func() (*singu.QueueMessage, error) {
+		for _, tube = range tubes {
+			var err error
+			if queue, err = c.server.GetQueue(tube); err == nil && queue != nil {
+				if msg, err := tcpserver.Take(queue); msg != nil || err != nil {
+					return msg, err
+				}
+			}
+		}
+		return nil, nil
+	})
+	stop()
+	select {
+	case <-gone:
+		// the client has disconnected while waiting, the job would be reserved for a dead connection
+		if msg != nil {
+			queue.Requeue(msg.Id, true)
+		}
+		return
+	default:
+	}
+	if err != nil {
+		c.replyError(err)
+	} else if msg != nil {
+		j := c.server.trackJob(tube, msg.Id, stateReserved, c)
+		c.reserved[j.id] = true
+		c.replyData(msg.Payload, "RESERVED %d %d", j.id, len(msg.Payload))
+	} else if !c.server.IsClosed() {
+		c.reply(respTimedOut)
+	}
+}
+
+// delete <id>
+func (c *conn) cmdDelete(args []string) {
+	id, ok := parseJobId(args[0])
+	if !ok {
+		c.reply(respBadFormat)
+		return
+	}
+	j := c.server.getJob(id)
+	queue, _ := c.server.GetQueue(tubeOf(j))
+	if j == nil || queue == nil || (j.state == stateReserved && j.reservedBy != c) {
+		c.reply(respNotFound)
+		return
+	}
+	if j.state == stateReady {
+		msg, err := queue.RemoveById(singu.QueueStorage, j.msgId)
+		if err != nil {
+			c.replyError(err)
+			return
+		}
+		if msg == nil {
+			// the job has been taken by another consumer
+			c.reply(respNotFound)
+			return
+		}
+	} else if j.state == stateReserved {
+		if err := queue.Finish(j.msgId); err != nil {
+			c.replyError(err)
+			return
+		}
+	}
+	delete(c.reserved, id)
+	c.server.forgetJob(id)
+	c.reply(respDeleted)
+}
+
+// release <id> <pri> <delay>
+func (c *conn) cmdRelease(args []string) {
+	id, ok := parseJobId(args[0])
+	if !ok {
+		c.reply(respBadFormat)
+		return
+	}
+	j := c.server.getJob(id)
+	if j == nil || j.state != stateReserved || j.reservedBy != c {
+		c.reply(respNotFound)
+		return
+	}
+	if err := c.releaseJob(j, false); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.reply(respReleased)
+}
+
+// releaseJob re-queues a reserved or buried job.
+func (c *conn) releaseJob(j *job, silent bool) error {
+	delete(c.reserved, j.id)
+	queue, _ := c.server.GetQueue(j.tube)
+	if queue == nil {
+		c.server.forgetJob(j.id)
+		return nil
+	}
+	if j.state == stateBuried {
+		msg, err := queue.Queue(j.msg)
+		if err != nil {
+			return err
+		}
+		c.server.updateJob(j.id, msg.Id, stateReady, nil)
+		return nil
+	}
+	msg, err := queue.Requeue(j.msgId, silent)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		// the message is no longer in ephemeral storage
+		c.server.forgetJob(j.id)
+		return nil
+	}
+	c.server.updateJob(j.id, msg.Id, stateReady, nil)
+	return nil
+}
+
+// bury <id> <pri>
+func (c *conn) cmdBury(args []string) {
+	id, ok := parseJobId(args[0])
+	if !ok {
+		c.reply(respBadFormat)
+		return
+	}
+	j := c.server.getJob(id)
+	if j == nil || j.state != stateReserved || j.reservedBy != c {
+		c.reply(respNotFound)
+		return
+	}
+	queue, _ := c.server.GetQueue(j.tube)
+	if queue == nil {
+		c.reply(respNotFound)
+		return
+	}
+	msg, err := queue.GetById(singu.EphemeralStorage, j.msgId)
+	if err == nil && msg != nil {
+		err = queue.Finish(j.msgId)
+	}
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	delete(c.reserved, id)
+	if msg == nil {
+		// the message is no longer in ephemeral storage
+		c.server.forgetJob(id)
+		c.reply(respNotFound)
+		return
+	}
+	c.server.buryJob(id, msg)
+	c.reply(respBuried)
+}
+
+// touch <id>
+func (c *conn) cmdTouch(args []string) {
+	id, ok := parseJobId(args[0])
+	if !ok {
+		c.reply(respBadFormat)
+		return
+	}
+	if j := c.server.getJob(id); j == nil || j.state != stateReserved || j.reservedBy != c {
+		c.reply(respNotFound)
+		return
+	}
+	c.reply(respTouched)
+}
+
+// watch <tube>
+func (c *conn) cmdWatch(args []string) {
+	if !isValidTubeName(args[0]) {
+		c.reply(respBadFormat)
+		return
+	}
+	c.watching[args[0]] = true
+	c.reply("WATCHING %d", len(c.watching))
+}
+
+// ignore <tube>
+func (c *conn) cmdIgnore(args []string) {
+	if c.watching[args[0]] && len(c.watching) == 1 {
+		c.reply(respNotIgnored)
+		return
+	}
+	delete(c.watching, args[0])
+	c.reply("WATCHING %d", len(c.watching))
+}
+
+// peek <id>
+func (c *conn) cmdPeek(args []string) {
+	id, ok := parseJobId(args[0])
+	if !ok {
+		c.reply(respBadFormat)
+		return
+	}
+	j := c.server.getJob(id)
+	queue, _ := c.server.GetQueue(tubeOf(j))
+	if j == nil || queue == nil {
+		c.reply(respNotFound)
+		return
+	}
+	if j.state == stateBuried {
+		c.replyData(j.msg.Payload, "FOUND %d %d", j.id, len(j.msg.Payload))
+		return
+	}
+	storage := singu.EphemeralStorage
+	if j.state == stateReady {
+		storage = singu.QueueStorage
+	}
+	msg, err := queue.GetById(storage, j.msgId)
+	if err != nil {
+		c.replyError(err)
+	} else if msg == nil {
+		c.reply(respNotFound)
+	} else {
+		c.replyData(msg.Payload, "FOUND %d %d", j.id, len(msg.Payload))
+	}
+}
+
+// peek-ready
+func (c *conn) cmdPeekReady(_ []string) {
+	queue, _ := c.server.GetQueue(c.using)
+	if queue == nil {
+		c.reply(respNotFound)
+		return
+	}
+	msgs, err := queue.Peek(1)
+	if err != nil {
+		c.replyError(err)
+	} else if len(msgs) == 0 {
+		c.reply(respNotFound)
+	} else {
+		j := c.server.trackJob(c.using, msgs[0].Id, stateReady, nil)
+		c.replyData(msgs[0].Payload, "FOUND %d %d", j.id, len(msgs[0].Payload))
+	}
+}
+
+// kick <bound>
+func (c *conn) cmdKick(args []string) {
+	bound, err := strconv.Atoi(args[0])
+	if err != nil || bound < 0 {
+		c.reply(respBadFormat)
+		return
+	}
+	count := 0
+	for _, j := range c.server.buriedJobs(c.using) {
+		if count >= bound {
+			break
+		}
+		if err := c.releaseJob(j, true); err != nil {
+			c.replyError(err)
+			return
+		}
+		count++
+	}
+	c.reply("KICKED %d", count)
+}
+
+// kick-job <id>
+func (c *conn) cmdKickJob(args []string) {
+	id, ok := parseJobId(args[0])
+	if !ok {
+		c.reply(respBadFormat)
+		return
+	}
+	j := c.server.getJob(id)
+	if j == nil || j.state != stateBuried {
+		c.reply(respNotFound)
+		return
+	}
+	if err := c.releaseJob(j, true); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.reply(respKicked)
+}
+
+// stats
+func (c *conn) cmdStats(_ []string) {
+	var ready, reserved, buried int
+	tubes := c.server.QueueNames()
+	for _, tube := range tubes {
+		r, rs, b := c.server.tubeStats(tube)
+		ready, reserved, buried = ready+r, reserved+rs, buried+b
+	}
+	s := c.server
+	s.lock.Lock()
+	stats := yamlMap{
+		{"current-jobs-ready", ready},
+		{"current-jobs-reserved", reserved},
+		{"current-jobs-buried", buried},
+		{"cmd-put", s.stats["put"]},
+		{"cmd-reserve", s.stats["reserve"]},
+		{"cmd-reserve-with-timeout", s.stats["reserve-with-timeout"]},
+		{"cmd-delete", s.stats["delete"]},
+		{"cmd-release", s.stats["release"]},
+		{"cmd-bury", s.stats["bury"]},
+		{"cmd-kick", s.stats["kick"]},
+		{"cmd-touch", s.stats["touch"]},
+		{"cmd-stats", s.stats["stats"]},
+		{"current-tubes", len(tubes)},
+		{"current-connections", s.NumConns()},
+		{"pid", os.Getpid()},
+		{"version", "singu"},
+		{"uptime", int(time.Since(s.startTime).Seconds())},
+	}
+	s.lock.Unlock()
+	c.replyYaml(stats.String())
+}
+
+// stats-job <id>
+func (c *conn) cmdStatsJob(args []string) {
+	id, ok := parseJobId(args[0])
+	if !ok {
+		c.reply(respBadFormat)
+		return
+	}
+	j := c.server.getJob(id)
+	if j == nil || !c.server.jobExists(j) {
+		c.reply(respNotFound)
+		return
+	}
+	c.replyYaml(yamlMap{
+		{"id", j.id},
+		{"tube", j.tube},
+		{"state", j.state},
+	}.String())
+}
+
+// stats-tube <tube>
+func (c *conn) cmdStatsTube(args []string) {
+	queue, _ := c.server.GetQueue(args[0])
+	if queue == nil {
+		c.reply(respNotFound)
+		return
+	}
+	ready, reserved, buried := c.server.tubeStats(args[0])
+	pause := 0
+	if queue.IsPaused() {
+		pause = 1
+	}
+	c.replyYaml(yamlMap{
+		{"name", args[0]},
+		{"current-jobs-ready", ready},
+		{"current-jobs-reserved", reserved},
+		{"current-jobs-buried", buried},
+		{"pause", pause},
+	}.String())
+}
+
+// list-tubes
+func (c *conn) cmdListTubes(_ []string) {
+	c.replyYaml(yamlList(c.server.QueueNames()))
+}
+
+// list-tube-used
+func (c *conn) cmdListTubeUsed(_ []string) {
+	c.reply("USING %s", c.using)
+}
+
+// list-tubes-watched
+func (c *conn) cmdListTubesWatched(_ []string) {
+	tubes := make([]string, 0, len(c.watching))
+	for tube := range c.watching {
+		tubes = append(tubes, tube)
+	}
+	sort.Strings(tubes)
+	c.replyYaml(yamlList(tubes))
+}
+
+// pause-tube <tube> <delay>
+func (c *conn) cmdPauseTube(args []string) {
+	delay, err := strconv.Atoi(args[1])
+	if err != nil || delay < 0 {
+		c.reply(respBadFormat)
+		return
+	}
+	queue, _ := c.server.GetQueue(args[0])
+	if queue == nil {
+		c.reply(respNotFound)
+		return
+	}
+	if err := c.server.pauseTube(queue, time.Duration(delay)*time.Second); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.reply(respPaused)
+}
+
+func tubeOf(j *job) string {
+	if j == nil {
+		return ""
+	}
+	return j.tube
+}
+
+// yamlMap is an ordered list of key-value pairs, rendered as a YAML dictionary.
+type yamlMap []struct {
+	key   string
+	value interface{}
+}
+
+func (m yamlMap) String() string {
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	for _, kv := range m {
+		fmt.Fprintf(&sb, "%s: %v\n", kv.key, kv.value)
+	}
+	return sb.String()
+}
+
+// yamlList renders a list of strings as a YAML list.
+func yamlList(items []string) string {
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	for _, item := range items {
+		fmt.Fprintf(&sb, "- %s\n", item)
+	}
+	return sb.String()
+}
@@ -0,0 +1,291 @@
+// Package beanstalkd implements a TCP server speaking the beanstalkd text protocol on top of singu queues,
+// so that existing beanstalkd clients and workers can use singu as a drop-in replacement.
+//
+// Protocol mapping:
+//	- Tubes are mapped to named queues (see Server.RegisterQueue and Config.QueueFactory).
+//	- put: IQueue.Queue. Priority, delay and TTR are accepted but ignored, messages are always taken in FIFO order.
+//	- reserve, reserve-with-timeout: IQueue.Take on watched tubes.
+//	- delete: IQueue.Finish for reserved jobs, IQueue.RemoveById for ready jobs.
+//	- release: IQueue.Requeue.
+//	- bury: IQueue.Finish, the job's message is held in memory by the server (so that it is not handed out again as an
+//	  orphan message) until the job is kicked (IQueue.Queue) or deleted. Buried jobs are lost if the server restarts.
+//	- touch: acknowledged, as singu has no time-to-run.
+//	- pause-tube: IQueue.Pause, the tube is resumed after the specified delay.
+//	- peek, peek-ready: IQueue.GetById and IQueue.Peek.
+//	- stats, stats-job, stats-tube, list-tubes, list-tube-used, list-tubes-watched, use, watch, ignore and quit are supported as well.
+//
+// Beanstalkd job ids are integers, the server assigns one to each message it sees and keeps the mapping in memory.
+// Jobs reserved by a connection are re-queued (silently) when the connection is closed. Jobs whose message has been
+// taken, finished or removed by other means than this server (e.g. through another front end) are forgotten.
+package beanstalkd
+
+import (
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/internal/tcpserver"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTube is the tube a connection uses and watches when it is opened
+	DefaultTube = "default"
+
+	// DefaultMaxJobSize is the default max size of a job's body, in bytes
+	DefaultMaxJobSize = 65535
+
+	// DefaultPollInterval is the default interval between two Take attempts while reserving
+	DefaultPollInterval = 100 * time.Millisecond
+)
+
+// pruneThreshold is the size of the job table the first pruning happens at.
+const pruneThreshold = 1024
+
+// Config holds the server's configurations.
+type Config struct {
+	// MaxJobSize is the max size of a job's body in bytes, default value is DefaultMaxJobSize.
+	MaxJobSize int
+
+	// PollInterval is the interval between two Take attempts while reserving, default value is DefaultPollInterval.
+	PollInterval time.Duration
+
+	// QueueFactory, if supplied, is called to create the queue of a tube that has not been registered.
+	// If nil, operations on unregistered tubes fail.
+	QueueFactory func(tube string) (singu.IQueue, error)
+}
+
+// NewServer creates a new Server instance.
+func NewServer(config Config) *Server {
+	if config.MaxJobSize <= 0 {
+		config.MaxJobSize = DefaultMaxJobSize
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	s := &Server{
+		config:    config,
+		jobs:      make(map[uint64]*job),
+		jobsByMsg: make(map[jobKey]uint64),
+		pruneAt:   pruneThreshold,
+		resumers:  make(map[string]*time.Timer),
+		startTime: time.Now(),
+	}
+	s.Server = tcpserver.New(tcpserver.Config{
+		PollInterval: config.PollInterval,
+		QueueFactory: config.QueueFactory,
+		Handler:      func(netConn net.Conn) { newConn(s, netConn).serve() },
+	})
+	return s
+}
+
+// Server serves registered singu.IQueue instances as beanstalkd tubes, each queue is served as the tube of the same
+// name (see RegisterQueue).
+type Server struct {
+	*tcpserver.Server
+	config Config
+
+	lastJobId uint64            // last assigned job id
+	jobs      map[uint64]*job   // known jobs, by job id
+	jobsByMsg map[jobKey]uint64 // job ids, by tube and message id
+	pruneAt   int               // size of the job table the next pruning happens at
+	pruning   bool              // true while pruneJobs is running
+
+	startTime time.Time
+	stats     map[string]int         // command counters
+	resumers  map[string]*time.Timer // timers resuming paused tubes
+	lock      sync.Mutex             // lock protecting jobs, stats and resumers
+}
+
+// job states
+const (
+	stateReady    = "ready"
+	stateReserved = "reserved"
+	stateBuried   = "buried"
+)
+
+// job tracks a message known to the server.
+type job struct {
+	id         uint64
+	tube       string
+	msgId      string
+	state      string
+	reservedBy *conn
+	buriedAt   time.Time
+	msg        *singu.QueueMessage // message of a buried job
+}
+
+type jobKey struct {
+	tube, msgId string
+}
+
+// trackJob returns the job of the message, assigning a new job id if the message has not been seen before.
+func (s *Server) trackJob(tube, msgId, state string, reservedBy *conn) *job {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := jobKey{tube, msgId}
+	j, ok := s.jobs[s.jobsByMsg[key]]
+	if !ok {
+		if len(s.jobs) >= s.pruneAt && !s.pruning {
+			s.pruning = true
+			go s.pruneJobs()
+		}
+		s.lastJobId++
+		j = &job{id: s.lastJobId, tube: tube, msgId: msgId}
+		s.jobs[j.id] = j
+		s.jobsByMsg[key] = j.id
+	}
+	j.state, j.reservedBy = state, reservedBy
+	return j
+}
+
+// jobExists returns true if the message of the job is still where the job's state says it is: in queue storage for ready
+// jobs, in ephemeral storage for reserved jobs. Buried jobs always exist, their messages are held by the server.
+func (s *Server) jobExists(j *job) bool {
+	if j.state == stateBuried {
+		return true
+	}
+	queue, _ := s.GetQueue(j.tube)
+	if queue == nil {
+		return false
+	}
+	storage := singu.EphemeralStorage
+	if j.state == stateReady {
+		storage = singu.QueueStorage
+	} else if !queue.IsEphemeralStorageEnabled() {
+		return true
+	}
+	msg, err := queue.GetById(storage, j.msgId)
+	return err != nil || msg != nil
+}
+
+// pruneJobs forgets ready jobs whose message has been taken or removed by other means than this server. Reserved jobs
+// are left to the connection that reserved them.
+//
+// Messages are looked up without holding s.lock, a job is forgotten only if it has not changed in the meantime.
+func (s *Server) pruneJobs() {
+	s.lock.Lock()
+	candidates := make([]job, 0)
+	for _, j := range s.jobs {
+		if j.state == stateReady {
+			candidates = append(candidates, *j)
+		}
+	}
+	s.lock.Unlock()
+
+	gone := make([]job, 0)
+	for _, j := range candidates {
+		if !s.jobExists(&j) {
+			gone = append(gone, j)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, g := range gone {
+		if j, ok := s.jobs[g.id]; ok && j.state == g.state && j.msgId == g.msgId {
+			delete(s.jobsByMsg, jobKey{j.tube, j.msgId})
+			delete(s.jobs, j.id)
+		}
+	}
+	s.pruneAt = 2*len(s.jobs) + pruneThreshold
+	s.pruning = false
+}
+
+// getJob returns a copy of the job with the specified id, or nil if there is no such job.
+func (s *Server) getJob(id uint64) *job {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		clone := *j
+		return &clone
+	}
+	return nil
+}
+
+// updateJob updates the job's state, and its message id which changes if the queue assigns new id on re-queue.
+func (s *Server) updateJob(id uint64, msgId, state string, reservedBy *conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		if msgId != j.msgId {
+			delete(s.jobsByMsg, jobKey{j.tube, j.msgId})
+			s.jobsByMsg[jobKey{j.tube, msgId}] = id
+			j.msgId = msgId
+		}
+		j.state, j.reservedBy, j.msg = state, reservedBy, nil
+	}
+}
+
+// buryJob marks the job as buried, the server holds its message until the job is kicked or deleted.
+func (s *Server) buryJob(id uint64, msg *singu.QueueMessage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		j.state, j.reservedBy, j.msg, j.buriedAt = stateBuried, nil, msg, time.Now()
+	}
+}
+
+// forgetJob removes the job from the server's job table.
+func (s *Server) forgetJob(id uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		delete(s.jobsByMsg, jobKey{j.tube, j.msgId})
+		delete(s.jobs, id)
+	}
+}
+
+// buriedJobs returns copies of buried jobs of the tube, in order of burial.
+func (s *Server) buriedJobs(tube string) []*job {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	result := make([]*job, 0)
+	for _, j := range s.jobs {
+		if j.tube == tube && j.state == stateBuried {
+			clone := *j
+			result = append(result, &clone)
+		}
+	}
+	sort.Slice(result, func(i, k int) bool { return result[i].buriedAt.Before(result[k].buriedAt) })
+	return result
+}
+
+// tubeStats returns the number of ready, reserved and buried jobs of the tube.
+func (s *Server) tubeStats(tube string) (ready, reserved, buried int) {
+	queue, _ := s.GetQueue(tube)
+	if queue == nil {
+		return 0, 0, 0
+	}
+	buried = len(s.buriedJobs(tube))
+	ready, _ = queue.QueueSize()
+	reserved, _ = queue.EphemeralSize()
+	return ready, reserved, buried
+}
+
+// pauseTube pauses the queue for the specified duration, a zero duration resumes the queue immediately.
+func (s *Server) pauseTube(queue singu.IQueue, delay time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if timer, ok := s.resumers[queue.Name()]; ok {
+		timer.Stop()
+		delete(s.resumers, queue.Name())
+	}
+	if delay <= 0 {
+		return queue.Resume()
+	}
+	if err := queue.Pause(); err != nil {
+		return err
+	}
+	s.resumers[queue.Name()] = time.AfterFunc(delay, func() { queue.Resume() })
+	return nil
+}
+
+func (s *Server) countCommand(cmd string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stats == nil {
+		s.stats = make(map[string]int)
+	}
+	s.stats[cmd]++
+}
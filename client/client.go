@@ -0,0 +1,402 @@
+// Package client contains queue implementation that talks to a singu server, see package github.com/btnguyen2k/singu/server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/server"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the default timeout of each request
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultMaxRetries is the default max number of retries of idempotent operations
+	DefaultMaxRetries = 2
+
+	// DefaultRetryInterval is the default interval between two retries
+	DefaultRetryInterval = 100 * time.Millisecond
+
+	// DefaultMaxIdleConns is the default max number of pooled idle connections to the server
+	DefaultMaxIdleConns = 16
+)
+
+// Config holds the remote queue's configurations.
+type Config struct {
+	// BaseUrl is the server's root url, e.g. http://localhost:8080
+	BaseUrl string
+
+	// AuthToken is sent to the server as bearer token, if not empty.
+	AuthToken string
+
+	// Timeout of each request, default value is DefaultTimeout. Long-polling duration is added on top of it for Take requests.
+	Timeout time.Duration
+
+	// MaxRetries is the max number of retries of idempotent operations, default value is DefaultMaxRetries. Negative value disables retries.
+	// Operations that are not idempotent (Queue, Take, Requeue, RemoveById, RequeueAllEphemeral) are never retried.
+	MaxRetries int
+
+	// RetryInterval is the interval between two retries, default value is DefaultRetryInterval.
+	RetryInterval time.Duration
+
+	// MaxIdleConns is the max number of pooled idle connections to the server, default value is DefaultMaxIdleConns.
+	// Ignored if HttpClient is supplied.
+	MaxIdleConns int
+
+	// TakeWait is the long-polling duration of Take: Take waits up to this duration for a message to become available.
+	// Zero means Take returns immediately.
+	TakeWait time.Duration
+
+	// HttpClient, if supplied, is used to send requests instead of a client created from the above configurations.
+	HttpClient *http.Client
+}
+
+// NewRemoteQueue creates a new RemoteQueue instance.
+//	- name: name of the queue on the server
+//	- config: client configurations
+func NewRemoteQueue(name string, config Config) singu.IQueue {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	} else if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+	if config.MaxIdleConns <= 0 {
+		config.MaxIdleConns = DefaultMaxIdleConns
+	}
+	httpClient := config.HttpClient
+	if httpClient == nil {
+		httpClient = &http.Client{Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         (&net.Dialer{Timeout: config.Timeout, KeepAlive: 30 * time.Second}).DialContext,
+			MaxIdleConns:        config.MaxIdleConns,
+			MaxIdleConnsPerHost: config.MaxIdleConns,
+			IdleConnTimeout:     90 * time.Second,
+		}}
+	}
+	return &RemoteQueue{
+		name:       name,
+		config:     config,
+		baseUrl:    strings.TrimSuffix(config.BaseUrl, "/") + "/queues/" + url.PathEscape(name),
+		httpClient: httpClient,
+	}
+}
+
+// RemoteQueue is queue implementation that forwards all operations to a queue served by a singu server.
+//	- Errors returned by the server are mapped back to singu's sentinel errors (e.g. singu.ErrorQueueIsFull), other errors are returned as *server.HttpError.
+type RemoteQueue struct {
+	name       string
+	config     Config
+	baseUrl    string       // url of the queue's endpoints
+	httpClient *http.Client // http client, with pooled connections
+
+	info     *server.QueueInfo // cached queue information, for static properties such as capacities
+	lockInfo sync.Mutex        // lock to avoid race condition
+}
+
+// request is a request to the server.
+type request struct {
+	method     string
+	path       string     // path relative to the queue's url
+	query      url.Values // query parameters
+	body       interface{}
+	idempotent bool          // can the request be retried?
+	wait       time.Duration // long-polling duration to add to the request's timeout
+}
+
+// call sends the request, retrying if it is idempotent, and decodes the response into result.
+// It returns false if the server responded with status 204 (no content).
+func (q *RemoteQueue) call(req request, result interface{}) (bool, error) {
+	var body []byte
+	if req.body != nil {
+		body, _ = json.Marshal(req.body)
+	}
+	maxRetries := 0
+	if req.idempotent {
+		maxRetries = q.config.MaxRetries
+	}
+	for attempt := 0; ; attempt++ {
+		hasContent, err, retryable := q.doCall(req, body, result)
+		if err == nil || !retryable || attempt >= maxRetries {
+			return hasContent, err
+		}
+		time.Sleep(q.config.RetryInterval)
+	}
+}
+
+func (q *RemoteQueue) doCall(req request, body []byte, result interface{}) (hasContent bool, err error, retryable bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), q.config.Timeout+req.wait)
+	defer cancel()
+	endpoint := q.baseUrl + req.path
+	if len(req.query) > 0 {
+		endpoint += "?" + req.query.Encode()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, endpoint, reqBody)
+	if err != nil {
+		return false, err, false
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	if q.config.AuthToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+q.config.AuthToken)
+	}
+	resp, err := q.httpClient.Do(httpReq)
+	if err != nil {
+		return false, err, true
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return false, nil, false
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err, true
+	}
+	if resp.StatusCode >= 300 {
+		return false, toError(resp.StatusCode, respBody), resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented && resp.StatusCode != http.StatusInsufficientStorage
+	}
+	if result != nil {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return false, err, false
+		}
+	}
+	return true, nil, false
+}
+
+// toError maps an error response to singu's sentinel error, or *server.HttpError if there is no corresponding sentinel.
+func toError(status int, body []byte) error {
+	errResp := server.ErrorResponse{}
+	if err := json.Unmarshal(body, &errResp); err != nil || errResp.Code == "" {
+		return &server.HttpError{Status: status, Code: server.CodeInternalError, Message: fmt.Sprintf("unexpected response (status %d): %s", status, string(body))}
+	}
+	if err := server.SentinelError(errResp.Code); err != nil {
+		return err
+	}
+	return &server.HttpError{Status: status, Code: errResp.Code, Message: errResp.Message}
+}
+
+func (q *RemoteQueue) callMessage(req request) (*singu.QueueMessage, error) {
+	msg := &singu.QueueMessage{}
+	if hasContent, err := q.call(req, msg); !hasContent || err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (q *RemoteQueue) callMessages(req request) ([]*singu.QueueMessage, error) {
+	msgs := make([]*singu.QueueMessage, 0)
+	if _, err := q.call(req, &msgs); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+func (q *RemoteQueue) callCount(req request) (int, error) {
+	result := server.CountResult{}
+	if _, err := q.call(req, &result); err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
+
+// Info fetches the queue's information from the server.
+func (q *RemoteQueue) Info() (*server.QueueInfo, error) {
+	info := &server.QueueInfo{}
+	if _, err := q.call(request{method: http.MethodGet, idempotent: true}, info); err != nil {
+		return nil, err
+	}
+	q.lockInfo.Lock()
+	defer q.lockInfo.Unlock()
+	q.info = info
+	return info, nil
+}
+
+// cachedInfo returns cached queue information, fetching it from the server if needed.
+func (q *RemoteQueue) cachedInfo() (*server.QueueInfo, error) {
+	q.lockInfo.Lock()
+	info := q.info
+	q.lockInfo.Unlock()
+	if info != nil {
+		return info, nil
+	}
+	return q.Info()
+}
+
+func storagePath(storage singu.StorageType, id string) string {
+	path := "/" + storage.String()
+	if id != "" {
+		path += "/" + url.PathEscape(id)
+	}
+	return path
+}
+
+// Name implements IQueue.Name
+func (q *RemoteQueue) Name() string {
+	return q.name
+}
+
+// QueueStorageCapacity implements IQueue.QueueStorageCapacity
+func (q *RemoteQueue) QueueStorageCapacity() (int, error) {
+	info, err := q.cachedInfo()
+	if err != nil {
+		return 0, err
+	}
+	return info.QueueCapacity, nil
+}
+
+// EphemeralStorageCapacity implements IQueue.EphemeralStorageCapacity
+func (q *RemoteQueue) EphemeralStorageCapacity() (int, error) {
+	info, err := q.cachedInfo()
+	if err != nil {
+		return 0, err
+	}
+	return info.EphemeralCapacity, nil
+}
+
+// IsEphemeralStorageEnabled implements IQueue.IsEphemeralStorageEnabled
+//	- false is returned if the queue information can not be fetched from the server.
+func (q *RemoteQueue) IsEphemeralStorageEnabled() bool {
+	info, err := q.cachedInfo()
+	return err == nil && info.EphemeralEnabled
+}
+
+// Queue implements IQueue.Queue
+func (q *RemoteQueue) Queue(msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	return q.callMessage(request{method: http.MethodPost, path: "/messages", body: msg})
+}
+
+// Requeue implements IQueue.Requeue
+func (q *RemoteQueue) Requeue(id string, silent bool) (*singu.QueueMessage, error) {
+	query := url.Values{"silent": {strconv.FormatBool(silent)}}
+	return q.callMessage(request{method: http.MethodPost, path: "/ephemeral/" + url.PathEscape(id) + "/requeue", query: query})
+}
+
+// Finish implements IQueue.Finish
+func (q *RemoteQueue) Finish(id string) error {
+	_, err := q.call(request{method: http.MethodPost, path: "/ephemeral/" + url.PathEscape(id) + "/finish", idempotent: true}, nil)
+	return err
+}
+
+// Take implements IQueue.Take
+//	- If Config.TakeWait is set, Take waits up to that duration for a message to become available.
+func (q *RemoteQueue) Take() (*singu.QueueMessage, error) {
+	req := request{method: http.MethodPost, path: "/take"}
+	if q.config.TakeWait > 0 {
+		req.query = url.Values{"wait": {q.config.TakeWait.String()}}
+		req.wait = q.config.TakeWait
+	}
+	return q.callMessage(req)
+}
+
+// OrphanMessages implements IQueue.OrphanMessages
+func (q *RemoteQueue) OrphanMessages(numSeconds, numMessages int) ([]*singu.QueueMessage, error) {
+	query := url.Values{"seconds": {strconv.Itoa(numSeconds)}, "limit": {strconv.Itoa(numMessages)}}
+	return q.callMessages(request{method: http.MethodGet, path: "/orphans", query: query, idempotent: true})
+}
+
+// QueueSize implements IQueue.QueueSize
+func (q *RemoteQueue) QueueSize() (int, error) {
+	info, err := q.Info()
+	if err != nil {
+		return 0, err
+	}
+	return info.QueueSize, nil
+}
+
+// EphemeralSize implements IQueue.EphemeralSize
+func (q *RemoteQueue) EphemeralSize() (int, error) {
+	info, err := q.Info()
+	if err != nil {
+		return 0, err
+	}
+	return info.EphemeralSize, nil
+}
+
+// Peek implements IQueue.Peek
+func (q *RemoteQueue) Peek(numMessages int) ([]*singu.QueueMessage, error) {
+	query := url.Values{"limit": {strconv.Itoa(numMessages)}}
+	return q.callMessages(request{method: http.MethodGet, path: "/peek", query: query, idempotent: true})
+}
+
+// Browse implements IQueue.Browse
+func (q *RemoteQueue) Browse(storage singu.StorageType, cursor string, numMessages int) ([]*singu.QueueMessage, string, error) {
+	query := url.Values{"cursor": {cursor}, "limit": {strconv.Itoa(numMessages)}}
+	result := server.BrowseResult{}
+	if _, err := q.call(request{method: http.MethodGet, path: storagePath(storage, ""), query: query, idempotent: true}, &result); err != nil {
+		return nil, "", err
+	}
+	return result.Messages, result.Cursor, nil
+}
+
+// GetById implements IQueue.GetById
+func (q *RemoteQueue) GetById(storage singu.StorageType, id string) (*singu.QueueMessage, error) {
+	return q.callMessage(request{method: http.MethodGet, path: storagePath(storage, id), idempotent: true})
+}
+
+// RemoveById implements IQueue.RemoveById
+func (q *RemoteQueue) RemoveById(storage singu.StorageType, id string) (*singu.QueueMessage, error) {
+	return q.callMessage(request{method: http.MethodDelete, path: storagePath(storage, id)})
+}
+
+// UpdatePayload implements IQueue.UpdatePayload
+func (q *RemoteQueue) UpdatePayload(storage singu.StorageType, id string, payload []byte) (*singu.QueueMessage, error) {
+	body := server.UpdatePayloadRequest{Payload: payload}
+	return q.callMessage(request{method: http.MethodPut, path: storagePath(storage, id), body: body, idempotent: true})
+}
+
+// PurgeQueueStorage implements IQueue.PurgeQueueStorage
+func (q *RemoteQueue) PurgeQueueStorage() (int, error) {
+	return q.callCount(request{method: http.MethodDelete, path: storagePath(singu.QueueStorage, "")})
+}
+
+// PurgeEphemeralStorage implements IQueue.PurgeEphemeralStorage
+func (q *RemoteQueue) PurgeEphemeralStorage() (int, error) {
+	return q.callCount(request{method: http.MethodDelete, path: storagePath(singu.EphemeralStorage, "")})
+}
+
+// RequeueAllEphemeral implements IQueue.RequeueAllEphemeral
+func (q *RemoteQueue) RequeueAllEphemeral(silent bool) (int, error) {
+	query := url.Values{"silent": {strconv.FormatBool(silent)}}
+	return q.callCount(request{method: http.MethodPost, path: "/requeue-all", query: query})
+}
+
+// Pause implements IQueue.Pause
+func (q *RemoteQueue) Pause() error {
+	_, err := q.call(request{method: http.MethodPost, path: "/pause", idempotent: true}, nil)
+	return err
+}
+
+// Resume implements IQueue.Resume
+func (q *RemoteQueue) Resume() error {
+	_, err := q.call(request{method: http.MethodPost, path: "/resume", idempotent: true}, nil)
+	return err
+}
+
+// IsPaused implements IQueue.IsPaused
+//	- false is returned if the queue information can not be fetched from the server.
+func (q *RemoteQueue) IsPaused() bool {
+	info, err := q.Info()
+	return err == nil && info.Paused
+}
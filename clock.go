@@ -0,0 +1,66 @@
+package singu
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts the source of current time used by queue implementations.
+//
+// Queue implementations should obtain timestamps (QueueTimestamp, TakenTimestamp, orphan checks, etc) from a Clock
+// instead of calling time.Now() directly, so that time-based behaviours can be tested deterministically.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+// Now implements Clock.Now
+func (c systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the Clock backed by time.Now(), used when no clock is specified.
+var SystemClock Clock = systemClock{}
+
+// ClockOrDefault returns the supplied clock, or SystemClock if the supplied one is nil.
+func ClockOrDefault(clock Clock) Clock {
+	if clock == nil {
+		return SystemClock
+	}
+	return clock
+}
+
+// NewFakeClock creates a new FakeClock instance whose current time is set to the specified value.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// FakeClock is a controllable Clock implementation, intended to be used in tests.
+//	- FakeClock's time never moves by itself, it only changes when Set or Advance is called.
+type FakeClock struct {
+	now  time.Time
+	lock sync.RWMutex
+}
+
+// Now implements Clock.Now
+func (c *FakeClock) Now() time.Time {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.now
+}
+
+// Set sets the clock's current time to the specified value.
+func (c *FakeClock) Set(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock's current time forward by the specified duration (or backward if d is negative).
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,181 @@
+// Command singu-server exposes singu queues over a REST API, see package github.com/btnguyen2k/singu/server,
+// and optionally over gRPC, see package github.com/btnguyen2k/singu/rpc,
+// the beanstalkd protocol, see package github.com/btnguyen2k/singu/beanstalkd,
+// the memcache protocol with Kestrel semantics, see package github.com/btnguyen2k/singu/kestrel,
+// the Redis protocol, see package github.com/btnguyen2k/singu/resp,
+// STOMP 1.2, see package github.com/btnguyen2k/singu/stomp,
+// and the Amazon SQS API, see package github.com/btnguyen2k/singu/sqs.
+//
+// Usage:
+//
+//	singu-server -listen :8080 -grpc-listen :9090 -resp-listen :6379 -stomp-listen :61613 -queues orders:leveldb,jobs:inmem -data ./data -tokens secret1,secret2
+//	singu-server -listen :8080 -beanstalkd-listen :11300 -kestrel-listen :22133 -sqs-listen :9324 -queues orders:leveldb,jobs:inmem -data ./data
+//
+// Queues are specified as a comma-separated list of <name>:<type> where type is either "inmem" or "leveldb".
+//
+// Auth tokens can also be supplied via environment variable SINGU_TOKENS. When tokens are set:
+//	- REST API and gRPC clients send a token as bearer token.
+//	- Redis clients send a token as password of the AUTH command (any username is accepted).
+//	- STOMP clients send a token as "passcode" header of the CONNECT frame (any login is accepted).
+//	- The beanstalkd and memcache protocols have no way to carry a token, and SQS requests are authenticated with AWS
+//	  SigV4 signatures which this server does not verify: singu-server refuses to start if any of them is enabled, so
+//	  that queues are never exposed without authentication.
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/beanstalkd"
+	"github.com/btnguyen2k/singu/kestrel"
+	"github.com/btnguyen2k/singu/leveldb"
+	"github.com/btnguyen2k/singu/resp"
+	"github.com/btnguyen2k/singu/rpc"
+	"github.com/btnguyen2k/singu/server"
+	"github.com/btnguyen2k/singu/sqs"
+	"github.com/btnguyen2k/singu/stomp"
+	"google.golang.org/grpc"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func splitList(list string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// authenticator returns a function accepting any of the tokens as password, or nil if there is no token.
+func authenticator(tokens []string) func(user, password string) bool {
+	if len(tokens) == 0 {
+		return nil
+	}
+	return func(_, password string) bool {
+		for _, token := range tokens {
+			if subtle.ConstantTimeCompare([]byte(password), []byte(token)) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func createQueue(spec, dataPath string) (singu.IQueue, error) {
+	tokens := strings.SplitN(spec, ":", 2)
+	name, queueType := tokens[0], "inmem"
+	if len(tokens) > 1 {
+		queueType = tokens[1]
+	}
+	switch queueType {
+	case "inmem":
+		return singu.NewInmemQueue(name, 0, false, 0), nil
+	case "leveldb":
+		queue := leveldb.NewLeveldbQueue(name, dataPath, 0, false, 0)
+		return queue, queue.(*leveldb.LeveldbQueue).Init()
+	}
+	return nil, fmt.Errorf("unknown queue type [%s] for queue [%s]", queueType, name)
+}
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	grpcListen := flag.String("grpc-listen", "", "address to listen on for gRPC, empty means gRPC is disabled")
+	beanstalkdListen := flag.String("beanstalkd-listen", "", "address to listen on for beanstalkd protocol, empty means beanstalkd protocol is disabled")
+	kestrelListen := flag.String("kestrel-listen", "", "address to listen on for memcache protocol, empty means memcache protocol is disabled")
+	respListen := flag.String("resp-listen", "", "address to listen on for Redis protocol, empty means Redis protocol is disabled")
+	stompListen := flag.String("stomp-listen", "", "address to listen on for STOMP, empty means STOMP is disabled")
+	sqsListen := flag.String("sqs-listen", "", "address to listen on for SQS API, empty means SQS API is disabled")
+	queues := flag.String("queues", "default:inmem", "comma-separated list of queues to expose, each in format <name>:<inmem|leveldb>")
+	dataPath := flag.String("data", "./data", "root directory to store LevelDB data")
+	tokens := flag.String("tokens", os.Getenv("SINGU_TOKENS"), "comma-separated list of accepted auth tokens, empty means no authentication")
+	maxWait := flag.Duration("max-wait", server.DefaultMaxWait, "upper limit of long-polling duration")
+	flag.Parse()
+
+	authTokens := splitList(*tokens)
+	if len(authTokens) > 0 {
+		for protocol, addr := range map[string]string{"beanstalkd": *beanstalkdListen, "memcache": *kestrelListen, "SQS": *sqsListen} {
+			if addr != "" {
+				log.Fatalf("%s front end does not authenticate clients, disable it or run without tokens", protocol)
+			}
+		}
+	}
+
+	srv := server.NewServer(server.Config{AuthTokens: authTokens, MaxWait: *maxWait})
+	rpcSrv := rpc.NewServer(rpc.Config{})
+	beanstalkdSrv := beanstalkd.NewServer(beanstalkd.Config{})
+	kestrelSrv := kestrel.NewServer(kestrel.Config{})
+	respSrv := resp.NewServer(resp.Config{Authenticate: authenticator(authTokens)})
+	stompSrv := stomp.NewServer(stomp.Config{Authenticate: authenticator(authTokens)})
+	sqsSrv := sqs.NewServer(sqs.Config{})
+	for _, spec := range splitList(*queues) {
+		queue, err := createQueue(spec, *dataPath)
+		if err != nil {
+			log.Fatalf("error creating queue [%s]: %s", spec, err)
+		}
+		srv.RegisterQueue(queue)
+		rpcSrv.RegisterQueue(queue)
+		beanstalkdSrv.RegisterQueue(queue)
+		kestrelSrv.RegisterQueue(queue)
+		respSrv.RegisterQueue(queue)
+		stompSrv.RegisterQueue(queue)
+		sqsSrv.RegisterQueue(queue)
+		log.Printf("registered queue [%s]", queue.Name())
+	}
+
+	if *grpcListen != "" {
+		listener, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			log.Fatalf("error listening on %s: %s", *grpcListen, err)
+		}
+		grpcServer := grpc.NewServer(rpc.AuthServerOptions(authTokens)...)
+		rpc.RegisterQueueServer(grpcServer, rpcSrv)
+		log.Printf("singu-server v%s listening on %s (gRPC)", singu.Version, *grpcListen)
+		go func() { log.Fatal(grpcServer.Serve(listener)) }()
+	}
+
+	if *beanstalkdListen != "" {
+		log.Printf("singu-server v%s listening on %s (beanstalkd)", singu.Version, *beanstalkdListen)
+		go func() { log.Fatal(beanstalkdSrv.ListenAndServe(*beanstalkdListen)) }()
+	}
+
+	if *kestrelListen != "" {
+		log.Printf("singu-server v%s listening on %s (memcache)", singu.Version, *kestrelListen)
+		go func() { log.Fatal(kestrelSrv.ListenAndServe(*kestrelListen)) }()
+	}
+
+	if *respListen != "" {
+		log.Printf("singu-server v%s listening on %s (Redis)", singu.Version, *respListen)
+		go func() { log.Fatal(respSrv.ListenAndServe(*respListen)) }()
+	}
+
+	if *stompListen != "" {
+		log.Printf("singu-server v%s listening on %s (STOMP)", singu.Version, *stompListen)
+		go func() { log.Fatal(stompSrv.ListenAndServe(*stompListen)) }()
+	}
+
+	if *sqsListen != "" {
+		sqsServer := &http.Server{
+			Addr:              *sqsListen,
+			Handler:           sqsSrv,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		log.Printf("singu-server v%s listening on %s (SQS)", singu.Version, *sqsListen)
+		go func() { log.Fatal(sqsServer.ListenAndServe()) }()
+	}
+
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("singu-server v%s listening on %s", singu.Version, *listen)
+	log.Fatal(httpServer.ListenAndServe())
+}
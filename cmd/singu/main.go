@@ -0,0 +1,521 @@
+// Command singu inspects and manipulates a LevelDB queue directly on disk.
+//
+// Usage:
+//
+//	singu -data ./data -queue orders [-json] [-create] <command> [command flags] [arguments]
+//
+// Commands:
+//	- stats                                        : queue size, ephemeral size, configured capacities and paused state
+//	- peek [-n <num>]                              : messages at the head of queue storage, see IQueue.Peek
+//	- enqueue [-lines]                             : enqueue stdin as one message, or one message per line with -lines
+//	- take                                         : take a message, see IQueue.Take
+//	- finish <id>...                               : see IQueue.Finish
+//	- requeue [-silent] <id>...                    : see IQueue.Requeue
+//	- orphans [-min-age <d>] [-max-age <d>] [-n <num>] : list orphan messages taken between min-age and max-age ago
+//	- requeue-orphans [-min-age <d>] [-max-age <d>] [-silent] : re-queue orphan messages
+//	- purge [-storage queue|ephemeral|all]         : delete all messages of the storage
+//	- export [-o <file>]                           : export all messages as JSON Lines to the file or stdout, see singu.Export
+//	- import [-i <file>]                           : import messages exported with command export from the file or stdin,
+//	  see singu.Import
+//
+// The queue must exist unless flag -create is set.
+// Output is human-readable by default, flag -json switches to JSON (messages in singu.QueueMessage's JSON representation).
+//
+// LevelDB allows only one process to open a database at a time, so the queue must not be in use by another application
+// (e.g. singu-server) while this tool runs.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/leveldb"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// cli holds global flags and the opened queue.
+type cli struct {
+	queue      singu.IQueue
+	jsonOutput bool
+	stdin      io.Reader
+	stdout     io.Writer
+}
+
+// command is a sub-command of the tool.
+type command struct {
+	usage string
+	run   func(c *cli, fs *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]command{
+	"stats":           {"stats", cmdStats},
+	"peek":            {"peek [-n <num>]", cmdPeek},
+	"enqueue":         {"enqueue [-lines]", cmdEnqueue},
+	"take":            {"take", cmdTake},
+	"finish":          {"finish <id>...", cmdFinish},
+	"requeue":         {"requeue [-silent] <id>...", cmdRequeue},
+	"orphans":         {"orphans [-min-age <duration>] [-max-age <duration>] [-n <num>]", cmdOrphans},
+	"requeue-orphans": {"requeue-orphans [-min-age <duration>] [-max-age <duration>] [-silent]", cmdRequeueOrphans},
+	"purge":           {"purge [-storage queue|ephemeral|all]", cmdPurge},
+	"export":          {"export [-o <file>]", cmdExport},
+	"import":          {"import [-i <file>]", cmdImport},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] <command> [command flags] [arguments]\n\nFlags:\n", os.Args[0])
+	flag.PrintDefaults()
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
+
+func main() {
+	dataPath := flag.String("data", "./data", "root directory of LevelDB data")
+	queueName := flag.String("queue", "", "name of the queue")
+	queueCapacity := flag.Int("queue-capacity", singu.SizeNotSupported, "queue storage capacity, negative value means unlimited")
+	ephemeralCapacity := flag.Int("ephemeral-capacity", singu.SizeNotSupported, "ephemeral storage capacity, negative value means unlimited")
+	jsonOutput := flag.Bool("json", false, "print output as JSON")
+	create := flag.Bool("create", false, "create the queue if it does not exist")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *queueName == "" || flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if _, err := os.Stat(*dataPath + "/" + *queueName); err != nil && !(*create && os.IsNotExist(err)) {
+		fmt.Fprintf(os.Stderr, "error opening queue [%s]: %s\n", *queueName, err)
+		os.Exit(1)
+	}
+	queue := leveldb.NewLeveldbQueue(*queueName, *dataPath, *queueCapacity, false, *ephemeralCapacity)
+	if err := queue.(*leveldb.LeveldbQueue).Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "error opening queue [%s]: %s\n", *queueName, err)
+		os.Exit(1)
+	}
+	c := &cli{queue: queue, jsonOutput: *jsonOutput, stdin: os.Stdin, stdout: os.Stdout}
+	fs := flag.NewFlagSet(flag.Arg(0), flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s\n", cmd.usage)
+		fs.PrintDefaults()
+	}
+	err := cmd.run(c, fs, flag.Args()[1:])
+	queue.(*leveldb.LeveldbQueue).Destroy()
+	if err == errUsage {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+// errUsage is returned by commands when their flags are invalid, the error and usage have been printed already.
+var errUsage = errors.New("invalid usage")
+
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if fs.Parse(args) != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// print writes the result as JSON if flag -json is set, or calls human to print it in human-readable form otherwise.
+func (c *cli) print(result interface{}, human func(w io.Writer)) {
+	if c.jsonOutput {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+		return
+	}
+	human(c.stdout)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// formatPayload returns a preview of the payload, quoted and truncated to 64 bytes.
+func formatPayload(payload []byte) string {
+	if len(payload) > 64 {
+		return strconv.Quote(string(payload[:64])) + "..."
+	}
+	return strconv.Quote(string(payload))
+}
+
+// printMessages prints messages as a table, or "no message" if there is none.
+func printMessages(w io.Writer, msgs []*singu.QueueMessage) {
+	if len(msgs) == 0 {
+		fmt.Fprintln(w, "no message")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tQUEUED\tTAKEN\tREQUEUES\tSIZE\tPAYLOAD")
+	for _, msg := range msgs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", msg.Id, formatTime(msg.QueueTimestamp), formatTime(msg.TakenTimestamp),
+			msg.NumRequeues, len(msg.Payload), formatPayload(msg.Payload))
+	}
+	tw.Flush()
+}
+
+// Stats is the output of command stats.
+//
+// LevelDB queues do not store their capacities, QueueCapacity and EphemeralCapacity are the values of flags
+// -queue-capacity and -ephemeral-capacity this tool was run with.
+type Stats struct {
+	Name              string `json:"name"`
+	QueueSize         int    `json:"queue_size"`
+	EphemeralSize     int    `json:"ephemeral_size"`
+	QueueCapacity     int    `json:"configured_queue_capacity"`
+	EphemeralCapacity int    `json:"configured_ephemeral_capacity"`
+	Paused            bool   `json:"paused"`
+}
+
+func formatCapacity(capacity int) string {
+	if capacity <= 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(capacity)
+}
+
+func cmdStats(c *cli, fs *flag.FlagSet, args []string) error {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	stats := Stats{Name: c.queue.Name(), Paused: c.queue.IsPaused()}
+	var err error
+	if stats.QueueSize, err = c.queue.QueueSize(); err != nil {
+		return err
+	}
+	if stats.EphemeralSize, err = c.queue.EphemeralSize(); err != nil {
+		return err
+	}
+	if stats.QueueCapacity, err = c.queue.QueueStorageCapacity(); err != nil {
+		return err
+	}
+	if stats.EphemeralCapacity, err = c.queue.EphemeralStorageCapacity(); err != nil {
+		return err
+	}
+	c.print(stats, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "queue:\t%s\n", stats.Name)
+		fmt.Fprintf(tw, "queue size:\t%d\n", stats.QueueSize)
+		fmt.Fprintf(tw, "ephemeral size:\t%d\n", stats.EphemeralSize)
+		fmt.Fprintf(tw, "queue capacity (configured):\t%s\n", formatCapacity(stats.QueueCapacity))
+		fmt.Fprintf(tw, "ephemeral capacity (configured):\t%s\n", formatCapacity(stats.EphemeralCapacity))
+		fmt.Fprintf(tw, "paused:\t%t\n", stats.Paused)
+		tw.Flush()
+	})
+	return nil
+}
+
+func cmdPeek(c *cli, fs *flag.FlagSet, args []string) error {
+	num := fs.Int("n", 10, "number of messages")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	msgs, err := c.queue.Peek(*num)
+	if err != nil {
+		return err
+	}
+	c.print(msgs, func(w io.Writer) { printMessages(w, msgs) })
+	return nil
+}
+
+func cmdEnqueue(c *cli, fs *flag.FlagSet, args []string) error {
+	lines := fs.Bool("lines", false, "enqueue each line of stdin as a separate message")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	payloads := make([][]byte, 0)
+	if *lines {
+		scanner := bufio.NewScanner(c.stdin)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			if len(scanner.Bytes()) > 0 {
+				payloads = append(payloads, append([]byte{}, scanner.Bytes()...))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	} else {
+		payload, err := ioutil.ReadAll(c.stdin)
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, payload)
+	}
+	msgs := make([]*singu.QueueMessage, 0, len(payloads))
+	for _, payload := range payloads {
+		msg, err := c.queue.Queue(singu.NewQueueMessage(payload))
+		if err != nil {
+			return fmt.Errorf("%d message(s) enqueued: %s", len(msgs), err)
+		}
+		msgs = append(msgs, msg)
+	}
+	c.print(msgs, func(w io.Writer) {
+		for _, msg := range msgs {
+			fmt.Fprintf(w, "enqueued %s\n", msg.Id)
+		}
+	})
+	return nil
+}
+
+func cmdTake(c *cli, fs *flag.FlagSet, args []string) error {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	msg, err := c.queue.Take()
+	if err != nil {
+		return err
+	}
+	c.print(msg, func(w io.Writer) {
+		if msg == nil {
+			printMessages(w, nil)
+		} else {
+			printMessages(w, []*singu.QueueMessage{msg})
+		}
+	})
+	return nil
+}
+
+func cmdFinish(c *cli, fs *flag.FlagSet, args []string) error {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing message id")
+	}
+	ids := fs.Args()
+	for _, id := range ids {
+		if msg, err := c.queue.GetById(singu.EphemeralStorage, id); err != nil {
+			return err
+		} else if msg == nil {
+			return fmt.Errorf("message [%s] not found in ephemeral storage", id)
+		}
+		if err := c.queue.Finish(id); err != nil {
+			return err
+		}
+	}
+	c.print(ids, func(w io.Writer) {
+		for _, id := range ids {
+			fmt.Fprintf(w, "finished %s\n", id)
+		}
+	})
+	return nil
+}
+
+// requeued is the output of commands requeue and requeue-orphans, it maps old ids to re-queued messages.
+type requeued struct {
+	Id      string              `json:"id"`
+	Message *singu.QueueMessage `json:"message"`
+}
+
+func printRequeued(c *cli, result []requeued) {
+	c.print(result, func(w io.Writer) {
+		if len(result) == 0 {
+			fmt.Fprintln(w, "no message")
+		}
+		for _, r := range result {
+			fmt.Fprintf(w, "requeued %s as %s\n", r.Id, r.Message.Id)
+		}
+	})
+}
+
+func cmdRequeue(c *cli, fs *flag.FlagSet, args []string) error {
+	silent := fs.Bool("silent", false, "silent re-queue, see IQueue.Requeue")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing message id")
+	}
+	result := make([]requeued, 0, fs.NArg())
+	for _, id := range fs.Args() {
+		msg, err := c.queue.Requeue(id, *silent)
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			return fmt.Errorf("message [%s] not found in ephemeral storage", id)
+		}
+		result = append(result, requeued{Id: id, Message: msg})
+	}
+	printRequeued(c, result)
+	return nil
+}
+
+// orphans returns orphan messages taken between minAge and maxAge ago, maxAge <= 0 means no upper limit.
+func orphans(queue singu.IQueue, minAge, maxAge time.Duration, numMessages int) ([]*singu.QueueMessage, error) {
+	msgs, err := queue.OrphanMessages(int(minAge/time.Second), 0)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*singu.QueueMessage, 0, len(msgs))
+	now := time.Now()
+	for _, msg := range msgs {
+		if maxAge > 0 && msg.TakenTimestamp.Before(now.Add(-maxAge)) {
+			continue
+		}
+		if numMessages > 0 && len(result) >= numMessages {
+			break
+		}
+		result = append(result, msg)
+	}
+	return result, nil
+}
+
+func cmdOrphans(c *cli, fs *flag.FlagSet, args []string) error {
+	minAge := fs.Duration("min-age", time.Minute, "list messages taken at least this long ago")
+	maxAge := fs.Duration("max-age", 0, "list messages taken at most this long ago, 0 means no limit")
+	num := fs.Int("n", 0, "max number of messages, 0 means no limit")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	msgs, err := orphans(c.queue, *minAge, *maxAge, *num)
+	if err != nil {
+		return err
+	}
+	c.print(msgs, func(w io.Writer) { printMessages(w, msgs) })
+	return nil
+}
+
+func cmdRequeueOrphans(c *cli, fs *flag.FlagSet, args []string) error {
+	minAge := fs.Duration("min-age", time.Minute, "re-queue messages taken at least this long ago")
+	maxAge := fs.Duration("max-age", 0, "re-queue messages taken at most this long ago, 0 means no limit")
+	silent := fs.Bool("silent", false, "silent re-queue, see IQueue.Requeue")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	msgs, err := orphans(c.queue, *minAge, *maxAge, 0)
+	if err != nil {
+		return err
+	}
+	result := make([]requeued, 0, len(msgs))
+	for _, msg := range msgs {
+		requeuedMsg, err := c.queue.Requeue(msg.Id, *silent)
+		if err != nil {
+			return fmt.Errorf("%d message(s) re-queued: %s", len(result), err)
+		}
+		if requeuedMsg != nil {
+			result = append(result, requeued{Id: msg.Id, Message: requeuedMsg})
+		}
+	}
+	printRequeued(c, result)
+	return nil
+}
+
+// purged is the output of command purge.
+type purged struct {
+	Queue     int `json:"queue"`
+	Ephemeral int `json:"ephemeral"`
+}
+
+func cmdPurge(c *cli, fs *flag.FlagSet, args []string) error {
+	storage := fs.String("storage", "all", "storage to purge: queue, ephemeral or all")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	result := purged{}
+	var err error
+	switch strings.ToLower(*storage) {
+	case "queue":
+		result.Queue, err = c.queue.PurgeQueueStorage()
+	case "ephemeral":
+		result.Ephemeral, err = c.queue.PurgeEphemeralStorage()
+	case "all":
+		if result.Queue, err = c.queue.PurgeQueueStorage(); err == nil {
+			result.Ephemeral, err = c.queue.PurgeEphemeralStorage()
+		}
+	default:
+		return fmt.Errorf("invalid storage [%s]", *storage)
+	}
+	if err != nil {
+		return err
+	}
+	c.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "purged %d message(s) from queue storage, %d message(s) from ephemeral storage\n", result.Queue, result.Ephemeral)
+	})
+	return nil
+}
+
+// transferred is the output of commands export and import.
+type transferred struct {
+	Count int `json:"count"`
+}
+
+func cmdExport(c *cli, fs *flag.FlagSet, args []string) error {
+	output := fs.String("o", "", "output file, default is stdout")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	w := c.stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	count, err := singu.Export(c.queue, bw)
+	if flushErr := bw.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return fmt.Errorf("%d message(s) exported: %s", count, err)
+	}
+	if *output != "" {
+		// exported records go to stdout otherwise, the summary is not mixed with them
+		c.print(transferred{Count: count}, func(w io.Writer) { fmt.Fprintf(w, "exported %d message(s)\n", count) })
+	}
+	return nil
+}
+
+func cmdImport(c *cli, fs *flag.FlagSet, args []string) error {
+	input := fs.String("i", "", "input file, default is stdin")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	r := c.stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	count, err := singu.Import(c.queue, bufio.NewReader(r))
+	if err != nil {
+		return fmt.Errorf("%d message(s) imported: %s", count, err)
+	}
+	c.print(transferred{Count: count}, func(w io.Writer) { fmt.Fprintf(w, "imported %d message(s)\n", count) })
+	return nil
+}
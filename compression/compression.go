@@ -0,0 +1,359 @@
+// Package compression compresses payloads of singu queues: CompressedQueue is an IQueue decorator that compresses
+// payloads of queued messages and decompresses payloads of messages read from the queue.
+//
+// Compressed messages are marked with the name of the codec in their metadata (key MetadataEncoding), so queues can
+// hold a mix of compressed and uncompressed messages, or messages compressed by different codecs: messages without the
+// mark are returned as is, and messages are decompressed with the codec they were compressed with, as long as it is
+// registered (see RegisterCodec). The mark is removed from messages returned by CompressedQueue, and marks supplied by
+// callers are ignored. Decompressed payloads are capped to Config.MaxDecodedSize bytes.
+//
+// Built-in codecs: Gzip, Snappy and Zstd. Other algorithms plug in through the Codec interface.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+const (
+	// MetadataEncoding is the metadata key compressed messages are marked with, its value is the name of the codec
+	MetadataEncoding = "content-encoding"
+
+	// DefaultThreshold is the default size, in bytes, below which payloads are left uncompressed
+	DefaultThreshold = 1024
+
+	// DefaultZstdLevel is the compression level of the registered Zstd codec
+	DefaultZstdLevel = 3
+
+	// DefaultMaxDecodedSize is the default max size, in bytes, of decompressed payloads
+	DefaultMaxDecodedSize = 64 << 20
+)
+
+// Names of well-known codecs.
+const (
+	Gzip   = "gzip"
+	Snappy = "snappy"
+	Zstd   = "zstd"
+)
+
+var (
+	// ErrorUnknownEncoding is returned when a message is marked with a codec that is not registered
+	ErrorUnknownEncoding = errors.New("unknown payload encoding")
+
+	// ErrorTooLarge is returned when a payload decompresses to more bytes than allowed
+	ErrorTooLarge = errors.New("decompressed payload is too large")
+)
+
+// Codec is a compression algorithm.
+type Codec interface {
+	// Name returns the name messages compressed by the codec are marked with.
+	Name() string
+
+	// Encode compresses data.
+	Encode(data []byte) ([]byte, error)
+
+	// Decode decompresses data.
+	Decode(data []byte) ([]byte, error)
+}
+
+// LimitedCodec is a Codec that stops decompressing as soon as the decompressed data exceeds a max size, instead of
+// decompressing it entirely first. Built-in codecs are LimitedCodecs.
+type LimitedCodec interface {
+	Codec
+
+	// DecodeLimit decompresses data, or fails with ErrorTooLarge if it decompresses to more than max bytes.
+	DecodeLimit(data []byte, max int) ([]byte, error)
+}
+
+var (
+	codecs     = map[string]Codec{Gzip: NewGzip(gzip.DefaultCompression), Snappy: snappyCodec{}, Zstd: NewZstd(DefaultZstdLevel)}
+	codecsLock sync.RWMutex
+)
+
+// RegisterCodec registers a codec, replacing the codec of the same name if any, so that messages it compressed can be
+// decompressed by CompressedQueue.
+func RegisterCodec(codec Codec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// GetCodec returns the registered codec of the specified name, or nil if there is none.
+func GetCodec(name string) Codec {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	return codecs[name]
+}
+
+// NewGzip creates a gzip codec with the specified compression level (see package compress/gzip).
+func NewGzip(level int) Codec {
+	return gzipCodec{level: level}
+}
+
+type gzipCodec struct {
+	level int
+}
+
+// Name implements Codec.Name
+func (c gzipCodec) Name() string {
+	return Gzip
+}
+
+// Encode implements Codec.Encode
+func (c gzipCodec) Encode(data []byte) ([]byte, error) {
+	buf := bytes.Buffer{}
+	w, err := gzip.NewWriterLevel(&buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements Codec.Decode
+func (c gzipCodec) Decode(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// DecodeLimit implements LimitedCodec.DecodeLimit
+func (c gzipCodec) DecodeLimit(data []byte, max int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	result, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err == nil && len(result) > max {
+		return nil, ErrorTooLarge
+	}
+	return result, err
+}
+
+// snappyCodec uses snappy's block format.
+type snappyCodec struct{}
+
+// Name implements Codec.Name
+func (c snappyCodec) Name() string {
+	return Snappy
+}
+
+// Encode implements Codec.Encode
+func (c snappyCodec) Encode(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+// Decode implements Codec.Decode
+func (c snappyCodec) Decode(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+// DecodeLimit implements LimitedCodec.DecodeLimit
+func (c snappyCodec) DecodeLimit(data []byte, max int) ([]byte, error) {
+	if size, err := snappy.DecodedLen(data); err != nil {
+		return nil, err
+	} else if size > max {
+		return nil, ErrorTooLarge
+	}
+	return snappy.Decode(nil, data)
+}
+
+// NewZstd creates a zstd codec with the specified compression level, from 1 (fastest) to 22 (best compression). Levels
+// are mapped to the nearest level supported by package github.com/klauspost/compress/zstd.
+func NewZstd(level int) Codec {
+	c := &zstdCodec{}
+	if c.enc, c.err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level))); c.err == nil {
+		c.dec, c.err = zstd.NewReader(nil)
+	}
+	return c
+}
+
+// zstdCodec uses zstd's frame format, its encoder and decoders are safe for concurrent use.
+type zstdCodec struct {
+	enc     *zstd.Encoder
+	dec     *zstd.Decoder
+	limited sync.Map // decoders limited to a max decoded size, by size
+	err     error    // error creating the encoder or the decoder
+}
+
+// Name implements Codec.Name
+func (c *zstdCodec) Name() string {
+	return Zstd
+}
+
+// Encode implements Codec.Encode
+func (c *zstdCodec) Encode(data []byte) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.enc.EncodeAll(data, nil), nil
+}
+
+// Decode implements Codec.Decode
+func (c *zstdCodec) Decode(data []byte) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.dec.DecodeAll(data, nil)
+}
+
+// DecodeLimit implements LimitedCodec.DecodeLimit
+func (c *zstdCodec) DecodeLimit(data []byte, max int) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	dec, err := c.limitedDecoder(max)
+	if err != nil {
+		return nil, err
+	}
+	result, err := dec.DecodeAll(data, nil)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return nil, ErrorTooLarge
+	}
+	return result, err
+}
+
+// limitedDecoder returns the decoder limited to the max decoded size, creating it on first use.
+func (c *zstdCodec) limitedDecoder(max int) (*zstd.Decoder, error) {
+	if dec, ok := c.limited.Load(max); ok {
+		return dec.(*zstd.Decoder), nil
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(max)))
+	if err != nil {
+		return nil, err
+	}
+	if existing, loaded := c.limited.LoadOrStore(max, dec); loaded {
+		dec.Close()
+		return existing.(*zstd.Decoder), nil
+	}
+	return dec, nil
+}
+
+// Config holds CompressedQueue's configurations.
+type Config struct {
+	// Codec compresses payloads of queued messages, default value is the registered Gzip codec. It does not need to be
+	// registered to decompress the messages it compressed.
+	Codec Codec
+
+	// Threshold is the size, in bytes, below which payloads are left uncompressed, default value is DefaultThreshold.
+	// Negative value means all payloads are compressed. Payloads are left uncompressed as well if compression does not
+	// make them smaller.
+	Threshold int
+
+	// MaxDecodedSize is the max size, in bytes, payloads are allowed to decompress to, default value is
+	// DefaultMaxDecodedSize. Reading a message whose payload decompresses to more bytes fails with ErrorTooLarge.
+	// Codecs that are not LimitedCodecs decompress payloads entirely before their size is checked. Negative value means
+	// no limit.
+	MaxDecodedSize int
+}
+
+// NewCompressedQueue creates a new CompressedQueue that decorates the queue.
+func NewCompressedQueue(queue singu.IQueue, config Config) *CompressedQueue {
+	if config.Codec == nil {
+		config.Codec = GetCodec(Gzip)
+	}
+	if config.Threshold == 0 {
+		config.Threshold = DefaultThreshold
+	}
+	if config.MaxDecodedSize == 0 {
+		config.MaxDecodedSize = DefaultMaxDecodedSize
+	}
+	q := &CompressedQueue{config: config}
+	q.marker = &singu.PayloadMarker{
+		MetadataKey: MetadataEncoding,
+		Encode:      q.compress,
+		EncodeAs:    q.compressAs,
+		Decode:      q.decompress,
+	}
+	q.IQueue = singu.Wrap(queue, q.marker.Interceptor())
+	return q
+}
+
+// CompressedQueue is an IQueue decorator that compresses payloads.
+//	- Queue compresses the payload of the message, if it is not smaller than Config.Threshold. The caller's message is
+//	  not modified, a mark it carries is removed.
+//	- UpdatePayload compresses the new payload with the codec the message was compressed with, if any.
+//	- Messages returned by Queue, Requeue, Take, OrphanMessages, Peek, Browse, GetById, RemoveById and UpdatePayload are
+//	  decompressed. If a message can not be decompressed (e.g. ErrorUnknownEncoding), the operation fails; a message
+//	  taken from the queue is left in ephemeral storage in that case.
+type CompressedQueue struct {
+	singu.IQueue
+	config Config
+	marker *singu.PayloadMarker
+}
+
+// Encode returns a clone of the message whose payload is compressed and marked, or the message itself if its payload is
+// left uncompressed.
+func (q *CompressedQueue) Encode(msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	return q.marker.EncodeMessage(msg)
+}
+
+// Decode returns a clone of the message whose payload is decompressed and whose mark is removed, or the message itself
+// if it is not marked.
+func (q *CompressedQueue) Decode(msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	return q.marker.DecodeMessage(msg)
+}
+
+func (q *CompressedQueue) codec(msg *singu.QueueMessage, name string) (Codec, error) {
+	if name == q.config.Codec.Name() {
+		return q.config.Codec, nil
+	}
+	if codec := GetCodec(name); codec != nil {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("message %s: %w [%s]", msg.Id, ErrorUnknownEncoding, name)
+}
+
+func (q *CompressedQueue) compress(msg *singu.QueueMessage) (string, []byte, error) {
+	if len(msg.Payload) < q.config.Threshold {
+		return "", nil, nil
+	}
+	payload, err := q.config.Codec.Encode(msg.Payload)
+	if err != nil || len(payload) >= len(msg.Payload) {
+		return "", nil, err
+	}
+	return q.config.Codec.Name(), payload, nil
+}
+
+func (q *CompressedQueue) compressAs(msg *singu.QueueMessage, name string, payload []byte) ([]byte, error) {
+	codec, err := q.codec(msg, name)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Encode(payload)
+}
+
+func (q *CompressedQueue) decompress(msg *singu.QueueMessage, name string) ([]byte, error) {
+	codec, err := q.codec(msg, name)
+	if err != nil {
+		return nil, err
+	}
+	var payload []byte
+	max := q.config.MaxDecodedSize
+	if limited, ok := codec.(LimitedCodec); ok && max > 0 {
+		payload, err = limited.DecodeLimit(msg.Payload, max)
+	} else if payload, err = codec.Decode(msg.Payload); err == nil && max > 0 && len(payload) > max {
+		err = ErrorTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("message %s: %w", msg.Id, err)
+	}
+	return payload, nil
+}
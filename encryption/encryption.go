@@ -0,0 +1,220 @@
+// Package encryption encrypts payloads of singu queues at rest: EncryptedQueue is an IQueue decorator that encrypts
+// payloads of queued messages with AES-GCM and decrypts payloads of messages read from the queue.
+//
+// Keys are supplied by a KeyProvider. Each encrypted message carries the id of the key it was encrypted with in its
+// metadata (key MetadataKeyId), so keys can be rotated while messages encrypted with previous keys are still in the
+// queue: new messages are encrypted with the current key, and messages are decrypted with the key they were encrypted
+// with as long as the KeyProvider still knows it.
+//
+// Encrypted payloads are the random nonce followed by the ciphertext. The key id is authenticated along with the
+// payload, so tampering with either is detected: it is reported as a DecryptError wrapping ErrorTampered.
+//
+// To combine encryption with compression, compress first, i.e. decorate the EncryptedQueue with the CompressedQueue:
+// ciphertext does not compress.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"io"
+)
+
+// MetadataKeyId is the metadata key encrypted messages carry the id of their key in.
+const MetadataKeyId = "encryption-key-id"
+
+var (
+	// ErrorTampered is returned when an encrypted payload or its key id fails authentication
+	ErrorTampered = errors.New("encrypted payload failed authentication")
+
+	// ErrorUnknownKey is returned when the key a message was encrypted with is not known by the key provider
+	ErrorUnknownKey = errors.New("unknown encryption key")
+
+	// ErrorNotEncrypted is returned when reading a message that is not encrypted, unless Config.AllowUnencrypted is set
+	ErrorNotEncrypted = errors.New("payload is not encrypted")
+)
+
+// DecryptError is returned when a message read from the queue can not be decrypted, it wraps one of ErrorTampered,
+// ErrorUnknownKey or ErrorNotEncrypted. Id identifies the message, e.g. so that a message taken from the queue can be
+// finished or moved aside.
+type DecryptError struct {
+	Id  string
+	Err error
+}
+
+// Error implements error.Error
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("message %s: %s", e.Id, e.Err)
+}
+
+// Unwrap returns the wrapped error.
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// KeyProvider supplies encryption keys, identified by non-empty ids. Keys are 16, 24 or 32 bytes long, to select
+// AES-128, AES-192 or AES-256. Implementations must be safe for concurrent use.
+type KeyProvider interface {
+	// CurrentKey returns the key new messages are encrypted with, and its id.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the key of the specified id, or ErrorUnknownKey if there is none.
+	Key(id string) ([]byte, error)
+}
+
+// Keyring is a KeyProvider that holds keys in memory. To rotate keys, add the new key and make it current, and keep
+// previous keys as long as messages encrypted with them may be in the queue. A Keyring must not be modified while it is
+// in use, use a new Keyring instead.
+type Keyring struct {
+	Current string            // id of the current key
+	Keys    map[string][]byte // keys, by id
+}
+
+// CurrentKey implements KeyProvider.CurrentKey
+func (r *Keyring) CurrentKey() (string, []byte, error) {
+	key, err := r.Key(r.Current)
+	return r.Current, key, err
+}
+
+// Key implements KeyProvider.Key
+func (r *Keyring) Key(id string) ([]byte, error) {
+	if key, ok := r.Keys[id]; ok {
+		return key, nil
+	}
+	return nil, ErrorUnknownKey
+}
+
+// Config holds EncryptedQueue's configurations.
+type Config struct {
+	// KeyProvider supplies the keys, it is required.
+	KeyProvider KeyProvider
+
+	// AllowUnencrypted, if true, lets messages that are not encrypted (e.g. queued before encryption was enabled) be
+	// read as is. Otherwise reading them fails with ErrorNotEncrypted. Their payload can not be updated either way.
+	AllowUnencrypted bool
+}
+
+// NewEncryptedQueue creates a new EncryptedQueue that decorates the queue.
+func NewEncryptedQueue(queue singu.IQueue, config Config) *EncryptedQueue {
+	q := &EncryptedQueue{config: config}
+	q.marker = &singu.PayloadMarker{
+		MetadataKey: MetadataKeyId,
+		Encode:      q.encrypt,
+		EncodeAs:    q.encryptAs,
+		Decode:      q.decrypt,
+	}
+	notEncrypted := func(msg *singu.QueueMessage) error { return &DecryptError{Id: msg.Id, Err: ErrorNotEncrypted} }
+	if !config.AllowUnencrypted {
+		q.marker.Unmarked = notEncrypted
+	}
+	// new payloads of messages that are not encrypted would be stored unencrypted
+	q.marker.UnmarkedUpdate = notEncrypted
+	q.IQueue = singu.Wrap(queue, q.marker.Interceptor())
+	return q
+}
+
+// EncryptedQueue is an IQueue decorator that encrypts payloads.
+//	- Queue encrypts the payload of the message with the current key. The caller's message is not modified, a key id it
+//	  carries is ignored.
+//	- UpdatePayload encrypts the new payload with the key the message was encrypted with. It fails with a DecryptError
+//	  wrapping ErrorNotEncrypted if the message is not encrypted, even if Config.AllowUnencrypted is set.
+//	- Messages returned by Queue, Requeue, Take, OrphanMessages, Peek, Browse, GetById, RemoveById and UpdatePayload are
+//	  decrypted. If a message can not be decrypted, the operation fails with a DecryptError; a message taken from the
+//	  queue is left in ephemeral storage in that case.
+type EncryptedQueue struct {
+	singu.IQueue
+	config Config
+	marker *singu.PayloadMarker
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(keyId string, key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(keyId)), nil
+}
+
+func open(keyId string, key, ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrorTampered
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[aead.NonceSize():], []byte(keyId))
+	if err != nil {
+		return nil, ErrorTampered
+	}
+	return plaintext, nil
+}
+
+// Encrypt returns a clone of the message whose payload is encrypted with the current key.
+func (q *EncryptedQueue) Encrypt(msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	return q.marker.EncodeMessage(msg)
+}
+
+// Decrypt returns a clone of the message whose payload is decrypted and whose key id is removed. Errors are
+// DecryptErrors, unless the key provider fails.
+func (q *EncryptedQueue) Decrypt(msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	return q.marker.DecodeMessage(msg)
+}
+
+// key returns the key the message was encrypted with.
+func (q *EncryptedQueue) key(msg *singu.QueueMessage, keyId string) ([]byte, error) {
+	key, err := q.config.KeyProvider.Key(keyId)
+	if errors.Is(err, ErrorUnknownKey) {
+		return nil, &DecryptError{Id: msg.Id, Err: err}
+	}
+	return key, err
+}
+
+func (q *EncryptedQueue) encrypt(msg *singu.QueueMessage) (string, []byte, error) {
+	keyId, key, err := q.config.KeyProvider.CurrentKey()
+	if err != nil {
+		return "", nil, err
+	}
+	if keyId == "" {
+		// messages are marked with the key id, an empty id would leave them unencrypted
+		return "", nil, ErrorUnknownKey
+	}
+	payload, err := seal(keyId, key, msg.Payload)
+	return keyId, payload, err
+}
+
+func (q *EncryptedQueue) encryptAs(msg *singu.QueueMessage, keyId string, payload []byte) ([]byte, error) {
+	key, err := q.key(msg, keyId)
+	if err != nil {
+		return nil, err
+	}
+	return seal(keyId, key, payload)
+}
+
+func (q *EncryptedQueue) decrypt(msg *singu.QueueMessage, keyId string) ([]byte, error) {
+	key, err := q.key(msg, keyId)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := open(keyId, key, msg.Payload)
+	if err != nil {
+		return nil, &DecryptError{Id: msg.Id, Err: err}
+	}
+	return payload, nil
+}
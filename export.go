@@ -0,0 +1,91 @@
+package singu
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ExportRecord is a line of the JSON Lines stream written by Export and read by Import.
+type ExportRecord struct {
+	Storage string        `json:"storage"` // storage the message is in, see StorageType.String
+	Message *QueueMessage `json:"message"`
+}
+
+// exportBatchSize is the number of messages Export reads per IQueue.Browse call.
+const exportBatchSize = 100
+
+// Export writes all messages of the queue to w as JSON Lines, one ExportRecord per line, and returns number of exported
+// messages. Queue storage is exported first, in the order of IQueue.Browse, followed by ephemeral storage.
+//
+// Note: Export does not stop the queue, messages queued, taken or finished while exporting may or may not be exported.
+// Pause the queue and stop producers for a consistent backup.
+func Export(queue IQueue, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	storages := []StorageType{QueueStorage}
+	if queue.IsEphemeralStorageEnabled() {
+		storages = append(storages, EphemeralStorage)
+	}
+	count := 0
+	for _, storage := range storages {
+		cursor := ""
+		for {
+			msgs, next, err := queue.Browse(storage, cursor, exportBatchSize)
+			if err != nil {
+				return count, err
+			}
+			for _, msg := range msgs {
+				if err := encoder.Encode(ExportRecord{Storage: storage.String(), Message: msg}); err != nil {
+					return count, err
+				}
+				count++
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	}
+	return count, nil
+}
+
+// Import reads ExportRecords written by Export from r, puts the messages to the queue and returns number of imported
+// messages.
+//	- If the queue implements IRestorable, messages are restored to the storage they were exported from, keeping their
+//	  ids, timestamps and NumRequeues. Importing the same stream twice does not duplicate messages.
+//	- Otherwise messages of both storages are enqueued with IQueue.Queue, so the queue assigns ids and timestamps as it
+//	  does for new messages, and messages exported from ephemeral storage are delivered again.
+func Import(queue IQueue, r io.Reader) (int, error) {
+	restorable, isRestorable := queue.(IRestorable)
+	decoder := json.NewDecoder(r)
+	count := 0
+	for decoder.More() {
+		record := ExportRecord{}
+		if err := decoder.Decode(&record); err != nil {
+			return count, fmt.Errorf("record #%d: %w", count+1, err)
+		}
+		var storage StorageType
+		switch record.Storage {
+		case QueueStorage.String():
+			storage = QueueStorage
+		case EphemeralStorage.String():
+			storage = EphemeralStorage
+		default:
+			return count, fmt.Errorf("record #%d: invalid storage [%s]", count+1, record.Storage)
+		}
+		if record.Message == nil {
+			return count, fmt.Errorf("record #%d: missing message", count+1)
+		}
+		var err error
+		if isRestorable {
+			err = restorable.Restore(storage, record.Message)
+		} else {
+			_, err = queue.Queue(record.Message)
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
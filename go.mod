@@ -1,8 +1,20 @@
 module github.com/btnguyen2k/singu
 
-go 1.13
+go 1.18
 
 require (
 	github.com/btnguyen2k/consu/olaf v0.1.2
+	github.com/golang/protobuf v1.3.3
+	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db
+	github.com/gorilla/websocket v1.4.2
+	github.com/klauspost/compress v1.17.2
 	github.com/syndtr/goleveldb v1.0.0
+	google.golang.org/grpc v1.27.1
+)
+
+require (
+	golang.org/x/net v0.0.0-20190311183353-d8887717615a // indirect
+	golang.org/x/sys v0.0.0-20190215142949-d0b11bdaac8a // indirect
+	golang.org/x/text v0.3.0 // indirect
+	google.golang.org/genproto v0.0.0-20190819201941-24fa4b261c55 // indirect
 )
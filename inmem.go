@@ -2,6 +2,8 @@ package singu
 
 import (
 	"container/list"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -11,11 +13,20 @@ import (
 //	- queueCapacity: if zero or negative queue storage has unlimited capacity; otherwise number of messages can be stored in queue storage is capped by the specified number
 //	- ephemeralCapacity: if zero or negative ephemeral storage has unlimited capacity; otherwise ephemeral storage is capped by the specified number
 func NewInmemQueue(name string, queueCapacity int, ephemeralDisabled bool, ephemeralCapacity int) IQueue {
+	return NewInmemQueueWithClock(name, queueCapacity, ephemeralDisabled, ephemeralCapacity, nil)
+}
+
+// NewInmemQueueWithClock creates a new InmemQueue instance that obtains timestamps from the supplied clock.
+//	- clock: if nil, SystemClock is used
+//
+// See NewInmemQueue for the other parameters.
+func NewInmemQueueWithClock(name string, queueCapacity int, ephemeralDisabled bool, ephemeralCapacity int, clock Clock) IQueue {
 	queue := &InmemQueue{
 		name:              name,
 		queueCapacity:     queueCapacity,
 		ephemeralCapacity: ephemeralCapacity,
 		ephemeralDisabled: ephemeralDisabled,
+		clock:             clock,
 	}
 	queue.Init()
 	return queue
@@ -27,13 +38,36 @@ type InmemQueue struct {
 	name                             string // queue's name
 	queueCapacity, ephemeralCapacity int    // queue storage and ephemeral storage capacity
 	ephemeralDisabled                bool   // is ephemeral storage disabled?
+	clock                            Clock  // source of current time
 
-	queueStorage     *list.List               // queue storage implemented as a linked list
+	queueStorage     *list.List               // queue storage implemented as a linked list of inmemItem
+	queueIndex       map[string]*list.Element // index of queue storage's elements by message id
 	ephemeralStorage map[string]*QueueMessage // ephemeral storage implemented as a map
+	lastSeq          uint64                   // sequence number of the last message put to queue storage
+	paused           bool                     // is consumption paused?
 	inited           bool                     // has this queue instance been initialized
 	lock             sync.Mutex               // lock to avoid race condition
 }
 
+// inmemItem is an element of InmemQueue's queue storage.
+type inmemItem struct {
+	seq uint64       // sequence number, increased every time a message is put to queue storage
+	msg QueueMessage // the queued message
+}
+
+func (q *InmemQueue) pushBack(msg QueueMessage) {
+	q.lastSeq++
+	q.queueIndex[msg.Id] = q.queueStorage.PushBack(&inmemItem{seq: q.lastSeq, msg: msg})
+}
+
+func (q *InmemQueue) remove(el *list.Element) *inmemItem {
+	item := q.queueStorage.Remove(el).(*inmemItem)
+	if q.queueIndex[item.msg.Id] == el {
+		delete(q.queueIndex, item.msg.Id)
+	}
+	return item
+}
+
 // Init initializes the queue instance
 func (q *InmemQueue) Init() error {
 	if !q.inited {
@@ -43,8 +77,10 @@ func (q *InmemQueue) Init() error {
 		if q.queueCapacity < 0 {
 			q.queueCapacity = SizeNotSupported
 		}
+		q.clock = ClockOrDefault(q.clock)
 
 		q.queueStorage = list.New()
+		q.queueIndex = make(map[string]*list.Element)
 		if !q.ephemeralDisabled {
 			q.ephemeralStorage = make(map[string]*QueueMessage)
 		}
@@ -64,6 +100,7 @@ func (q *InmemQueue) ensureInit() error {
 func (q *InmemQueue) Destroy() {
 	if q.queueStorage != nil {
 		q.queueStorage = nil
+		q.queueIndex = nil
 	}
 	if q.ephemeralStorage != nil {
 		q.ephemeralStorage = nil
@@ -106,10 +143,10 @@ func (q *InmemQueue) Queue(msg *QueueMessage) (*QueueMessage, error) {
 	if clone.Id == "" {
 		clone.Id = UniqueId()
 	}
-	clone.QueueTimestamp = time.Now()
+	clone.QueueTimestamp = q.clock.Now()
 	clone.TakenTimestamp = time.Time{}
 	clone.NumRequeues = 0
-	q.queueStorage.PushBack(clone)
+	q.pushBack(CloneQueueMessage(clone))
 	return &clone, nil
 }
 
@@ -126,10 +163,10 @@ func (q *InmemQueue) Requeue(id string, silent bool) (*QueueMessage, error) {
 	if msg, ok := q.ephemeralStorage[id]; ok {
 		msg.TakenTimestamp = time.Time{}
 		if !silent {
-			msg.QueueTimestamp = time.Now()
+			msg.QueueTimestamp = q.clock.Now()
 			msg.NumRequeues++
 		}
-		q.queueStorage.PushBack(*msg)
+		q.pushBack(*msg)
 		delete(q.ephemeralStorage, id)
 		clone := CloneQueueMessage(*msg)
 		return &clone, nil
@@ -155,31 +192,20 @@ func (q *InmemQueue) Take() (*QueueMessage, error) {
 	if err := q.ensureInit(); err != nil {
 		return nil, err
 	}
+	if q.paused {
+		return nil, ErrorQueueIsPaused
+	}
 	if !q.ephemeralDisabled && q.ephemeralCapacity > 0 && len(q.ephemeralStorage) >= q.ephemeralCapacity {
 		return nil, ErrorEphemeralIsFull
 	}
 	if el := q.queueStorage.Front(); el != nil {
-		defer q.queueStorage.Remove(el)
-		switch el.Value.(type) {
-		case *QueueMessage:
-			msg1 := CloneQueueMessage(*el.Value.(*QueueMessage))
-			msg1.TakenTimestamp = time.Now()
-			if !q.ephemeralDisabled {
-				msg2 := CloneQueueMessage(msg1)
-				q.ephemeralStorage[msg2.Id] = &msg2
-			}
-			return &msg1, nil
-		case QueueMessage:
-			msg1 := CloneQueueMessage(el.Value.(QueueMessage))
-			msg1.TakenTimestamp = time.Now()
-			if !q.ephemeralDisabled {
-				msg2 := CloneQueueMessage(msg1)
-				q.ephemeralStorage[msg2.Id] = &msg2
-			}
-			return &msg1, nil
-		default:
-			// TODO raise error?
+		msg1 := CloneQueueMessage(q.remove(el).msg)
+		msg1.TakenTimestamp = q.clock.Now()
+		if !q.ephemeralDisabled {
+			msg2 := CloneQueueMessage(msg1)
+			q.ephemeralStorage[msg2.Id] = &msg2
 		}
+		return &msg1, nil
 	}
 	return nil, nil
 }
@@ -195,10 +221,10 @@ func (q *InmemQueue) OrphanMessages(numSeconds, numMessages int) ([]*QueueMessag
 		return nil, nil
 	}
 	result := make([]*QueueMessage, 0)
-	now := time.Now()
+	deadline := q.clock.Now().Add(-time.Duration(numSeconds) * time.Second)
 	counter := 0
 	for _, msg := range q.ephemeralStorage {
-		if msg.TakenTimestamp.Unix()+int64(numSeconds) < now.Unix() {
+		if msg.TakenTimestamp.Before(deadline) {
 			counter++
 			clone := CloneQueueMessage(*msg)
 			result = append(result, &clone)
@@ -229,3 +255,256 @@ func (q *InmemQueue) EphemeralSize() (int, error) {
 	}
 	return len(q.ephemeralStorage), nil
 }
+
+// Peek implements IQueue.Peek
+func (q *InmemQueue) Peek(numMessages int) ([]*QueueMessage, error) {
+	result, _, err := q.Browse(QueueStorage, "", numMessages)
+	return result, err
+}
+
+// Browse implements IQueue.Browse
+//	- Queue storage is browsed in FIFO order, cursor is the sequence number of the last returned message.
+//	- Ephemeral storage is browsed in order of message id, cursor is the id of the last returned message.
+func (q *InmemQueue) Browse(storage StorageType, cursor string, numMessages int) ([]*QueueMessage, string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.ensureInit(); err != nil {
+		return nil, "", err
+	}
+	switch storage {
+	case QueueStorage:
+		return q.browseQueueStorage(cursor, numMessages)
+	case EphemeralStorage:
+		return q.browseEphemeralStorage(cursor, numMessages)
+	}
+	return nil, "", ErrorOperationNotSupported
+}
+
+func (q *InmemQueue) browseQueueStorage(cursor string, numMessages int) ([]*QueueMessage, string, error) {
+	var lastSeq uint64
+	if cursor != "" {
+		var err error
+		if lastSeq, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", err
+		}
+	}
+	result := make([]*QueueMessage, 0)
+	for el := q.queueStorage.Front(); el != nil; el = el.Next() {
+		item := el.Value.(*inmemItem)
+		if item.seq <= lastSeq {
+			continue
+		}
+		if numMessages > 0 && len(result) >= numMessages {
+			return result, strconv.FormatUint(lastSeq, 10), nil
+		}
+		clone := CloneQueueMessage(item.msg)
+		result = append(result, &clone)
+		lastSeq = item.seq
+	}
+	return result, "", nil
+}
+
+func (q *InmemQueue) browseEphemeralStorage(cursor string, numMessages int) ([]*QueueMessage, string, error) {
+	result := make([]*QueueMessage, 0)
+	if q.ephemeralDisabled {
+		return result, "", nil
+	}
+	ids := make([]string, 0, len(q.ephemeralStorage))
+	for id := range q.ephemeralStorage {
+		if id > cursor {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for i, id := range ids {
+		if numMessages > 0 && i >= numMessages {
+			return result, ids[i-1], nil
+		}
+		clone := CloneQueueMessage(*q.ephemeralStorage[id])
+		result = append(result, &clone)
+	}
+	return result, "", nil
+}
+
+// Restore implements IRestorable.Restore
+//	- Messages restored to queue storage are put to its tail, a replaced message keeps its position.
+func (q *InmemQueue) Restore(storage StorageType, msg *QueueMessage) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.ensureInit(); err != nil {
+		return err
+	}
+	clone := CloneQueueMessage(*msg)
+	if clone.Id == "" {
+		clone.Id = UniqueId()
+	}
+	switch storage {
+	case QueueStorage:
+		if el, ok := q.queueIndex[clone.Id]; ok {
+			el.Value.(*inmemItem).msg = clone
+			return nil
+		}
+		if q.queueCapacity > 0 && q.queueStorage.Len() >= q.queueCapacity {
+			return ErrorQueueIsFull
+		}
+		q.pushBack(clone)
+		return nil
+	case EphemeralStorage:
+		if q.ephemeralDisabled {
+			return ErrorOperationNotSupported
+		}
+		if _, ok := q.ephemeralStorage[clone.Id]; !ok && q.ephemeralCapacity > 0 && len(q.ephemeralStorage) >= q.ephemeralCapacity {
+			return ErrorEphemeralIsFull
+		}
+		q.ephemeralStorage[clone.Id] = &clone
+		return nil
+	}
+	return ErrorOperationNotSupported
+}
+
+// lookup returns the message with the specified id from the specified storage, or nil if there is no such message.
+func (q *InmemQueue) lookup(storage StorageType, id string) (*QueueMessage, error) {
+	switch storage {
+	case QueueStorage:
+		if el, ok := q.queueIndex[id]; ok {
+			return &el.Value.(*inmemItem).msg, nil
+		}
+		return nil, nil
+	case EphemeralStorage:
+		return q.ephemeralStorage[id], nil
+	}
+	return nil, ErrorOperationNotSupported
+}
+
+// GetById implements IQueue.GetById
+func (q *InmemQueue) GetById(storage StorageType, id string) (*QueueMessage, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.ensureInit(); err != nil {
+		return nil, err
+	}
+	msg, err := q.lookup(storage, id)
+	if msg == nil || err != nil {
+		return nil, err
+	}
+	clone := CloneQueueMessage(*msg)
+	return &clone, nil
+}
+
+// RemoveById implements IQueue.RemoveById
+func (q *InmemQueue) RemoveById(storage StorageType, id string) (*QueueMessage, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.ensureInit(); err != nil {
+		return nil, err
+	}
+	msg, err := q.lookup(storage, id)
+	if msg == nil || err != nil {
+		return nil, err
+	}
+	clone := CloneQueueMessage(*msg)
+	if storage == QueueStorage {
+		q.remove(q.queueIndex[id])
+	} else {
+		delete(q.ephemeralStorage, id)
+	}
+	return &clone, nil
+}
+
+// UpdatePayload implements IQueue.UpdatePayload
+func (q *InmemQueue) UpdatePayload(storage StorageType, id string, payload []byte) (*QueueMessage, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.ensureInit(); err != nil {
+		return nil, err
+	}
+	msg, err := q.lookup(storage, id)
+	if msg == nil || err != nil {
+		return nil, err
+	}
+	msg.Payload = []byte(string(payload))
+	clone := CloneQueueMessage(*msg)
+	return &clone, nil
+}
+
+// PurgeQueueStorage implements IQueue.PurgeQueueStorage
+func (q *InmemQueue) PurgeQueueStorage() (int, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.ensureInit(); err != nil {
+		return 0, err
+	}
+	count := q.queueStorage.Len()
+	q.queueStorage.Init()
+	q.queueIndex = make(map[string]*list.Element)
+	return count, nil
+}
+
+// PurgeEphemeralStorage implements IQueue.PurgeEphemeralStorage
+func (q *InmemQueue) PurgeEphemeralStorage() (int, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.ensureInit(); err != nil {
+		return 0, err
+	}
+	if q.ephemeralDisabled {
+		return 0, nil
+	}
+	count := len(q.ephemeralStorage)
+	q.ephemeralStorage = make(map[string]*QueueMessage)
+	return count, nil
+}
+
+// RequeueAllEphemeral implements IQueue.RequeueAllEphemeral
+//	- Messages are put back to queue storage in order of message id.
+func (q *InmemQueue) RequeueAllEphemeral(silent bool) (int, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.ensureInit(); err != nil {
+		return 0, err
+	}
+	if q.ephemeralDisabled {
+		return 0, nil
+	}
+	ids := make([]string, 0, len(q.ephemeralStorage))
+	for id := range q.ephemeralStorage {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	now := q.clock.Now()
+	for _, id := range ids {
+		msg := q.ephemeralStorage[id]
+		msg.TakenTimestamp = time.Time{}
+		if !silent {
+			msg.QueueTimestamp = now
+			msg.NumRequeues++
+		}
+		q.pushBack(*msg)
+	}
+	q.ephemeralStorage = make(map[string]*QueueMessage)
+	return len(ids), nil
+}
+
+// Pause implements IQueue.Pause
+//	- Paused state of in-memory queue does not survive application restarts.
+func (q *InmemQueue) Pause() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.paused = true
+	return nil
+}
+
+// Resume implements IQueue.Resume
+func (q *InmemQueue) Resume() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.paused = false
+	return nil
+}
+
+// IsPaused implements IQueue.IsPaused
+func (q *InmemQueue) IsPaused() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.paused
+}
@@ -0,0 +1,407 @@
+package singu
+
+import (
+	"fmt"
+	"time"
+)
+
+// Call describes an invocation of an intercepted operation. Only the fields of the operation are set:
+//	- OpQueue: Message.
+//	- OpTake: none.
+//	- OpFinish: Id.
+//	- OpRequeue: Id and Silent.
+//	- OpOrphanMessages: NumSeconds and NumMessages.
+//	- OpPeek: NumMessages.
+//	- OpBrowse: Storage, Cursor and NumMessages.
+//	- OpGetById and OpRemoveById: Storage and Id.
+//	- OpUpdatePayload: Storage, Id and Payload.
+type Call struct {
+	Queue       IQueue        // the wrapped queue
+	Op          string        // one of the Op constants
+	Message     *QueueMessage // message to queue
+	Id          string        // id of the message to finish, re-queue, get, remove or update
+	Silent      bool          // silent re-queue
+	NumSeconds  int           // OrphanMessages' numSeconds
+	NumMessages int           // numMessages of OrphanMessages, Peek and Browse
+	Storage     StorageType   // storage of Browse, GetById, RemoveById and UpdatePayload
+	Cursor      string        // Browse's cursor
+	Payload     []byte        // UpdatePayload's new payload
+}
+
+// Result is the outcome of a Call. Only the fields of the operation are set:
+//	- OpQueue, OpTake, OpRequeue, OpGetById, OpRemoveById and OpUpdatePayload: Message (nil if there is no message)
+//	  and Err.
+//	- OpFinish: Err.
+//	- OpOrphanMessages and OpPeek: Messages and Err.
+//	- OpBrowse: Messages, Cursor and Err.
+type Result struct {
+	Message  *QueueMessage
+	Messages []*QueueMessage
+	Cursor   string // Browse's next cursor
+	Err      error
+}
+
+// Handler performs a Call.
+type Handler func(call Call) Result
+
+// Interceptor intercepts a Call: it can inspect or modify the call before passing it to next, inspect or modify the
+// result returned by next, or short-circuit the call by returning a result without calling next.
+//
+// Interceptors must not modify call.Message nor the messages of the result in place, modify clones instead
+// (see CloneQueueMessage): messages are shared with the caller and with other interceptors.
+type Interceptor func(call Call, next Handler) Result
+
+// Wrap returns an IQueue whose Queue, Take, Finish, Requeue, OrphanMessages, Peek, Browse, GetById, RemoveById and
+// UpdatePayload calls go through the interceptors before reaching the queue. Other operations are passed through to the
+// queue as is.
+//
+// Ordering guarantees, for Wrap(queue, a, b, c):
+//	- Calls flow through the interceptors in the order they are supplied: a, then b, then c, then the queue. Results
+//	  flow back in reverse order: the queue, then c, then b, then a. The first interceptor is the outermost one: it
+//	  sees the call as made by the caller and the result as returned to the caller.
+//	- A modified call is seen by the following interceptors and the queue, a modified result by the preceding
+//	  interceptors and the caller. An interceptor that short-circuits a call hides it from the following interceptors
+//	  and from the queue.
+//	- Each call goes through the chain synchronously, in the caller's goroutine. Concurrent calls go through the chain
+//	  concurrently, interceptors must be safe for concurrent use.
+//
+// Wrapping a wrapped queue puts the new chain outside the existing one, i.e. Wrap(Wrap(queue, b), a) behaves like
+// Wrap(queue, a, b).
+func Wrap(queue IQueue, interceptors ...Interceptor) IQueue {
+	q := &interceptedQueue{IQueue: queue}
+	handler := q.invoke
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(call Call) Result { return interceptor(call, next) }
+	}
+	q.handler = handler
+	return q
+}
+
+// interceptedQueue is the IQueue returned by Wrap.
+type interceptedQueue struct {
+	IQueue
+	handler Handler
+}
+
+// invoke is the last handler of the chain, it performs the call on the wrapped queue.
+func (q *interceptedQueue) invoke(call Call) Result {
+	var result Result
+	switch call.Op {
+	case OpQueue:
+		result.Message, result.Err = q.IQueue.Queue(call.Message)
+	case OpTake:
+		result.Message, result.Err = q.IQueue.Take()
+	case OpFinish:
+		result.Err = q.IQueue.Finish(call.Id)
+	case OpRequeue:
+		result.Message, result.Err = q.IQueue.Requeue(call.Id, call.Silent)
+	case OpOrphanMessages:
+		result.Messages, result.Err = q.IQueue.OrphanMessages(call.NumSeconds, call.NumMessages)
+	case OpPeek:
+		result.Messages, result.Err = q.IQueue.Peek(call.NumMessages)
+	case OpBrowse:
+		result.Messages, result.Cursor, result.Err = q.IQueue.Browse(call.Storage, call.Cursor, call.NumMessages)
+	case OpGetById:
+		result.Message, result.Err = q.IQueue.GetById(call.Storage, call.Id)
+	case OpRemoveById:
+		result.Message, result.Err = q.IQueue.RemoveById(call.Storage, call.Id)
+	case OpUpdatePayload:
+		result.Message, result.Err = q.IQueue.UpdatePayload(call.Storage, call.Id, call.Payload)
+	default:
+		result.Err = ErrorOperationNotSupported
+	}
+	return result
+}
+
+// Queue implements IQueue.Queue
+func (q *interceptedQueue) Queue(msg *QueueMessage) (*QueueMessage, error) {
+	result := q.handler(Call{Queue: q.IQueue, Op: OpQueue, Message: msg})
+	return result.Message, result.Err
+}
+
+// Take implements IQueue.Take
+func (q *interceptedQueue) Take() (*QueueMessage, error) {
+	result := q.handler(Call{Queue: q.IQueue, Op: OpTake})
+	return result.Message, result.Err
+}
+
+// Finish implements IQueue.Finish
+func (q *interceptedQueue) Finish(id string) error {
+	return q.handler(Call{Queue: q.IQueue, Op: OpFinish, Id: id}).Err
+}
+
+// Requeue implements IQueue.Requeue
+func (q *interceptedQueue) Requeue(id string, silent bool) (*QueueMessage, error) {
+	result := q.handler(Call{Queue: q.IQueue, Op: OpRequeue, Id: id, Silent: silent})
+	return result.Message, result.Err
+}
+
+// OrphanMessages implements IQueue.OrphanMessages
+func (q *interceptedQueue) OrphanMessages(numSeconds, numMessages int) ([]*QueueMessage, error) {
+	result := q.handler(Call{Queue: q.IQueue, Op: OpOrphanMessages, NumSeconds: numSeconds, NumMessages: numMessages})
+	return result.Messages, result.Err
+}
+
+// Peek implements IQueue.Peek
+func (q *interceptedQueue) Peek(numMessages int) ([]*QueueMessage, error) {
+	result := q.handler(Call{Queue: q.IQueue, Op: OpPeek, NumMessages: numMessages})
+	return result.Messages, result.Err
+}
+
+// Browse implements IQueue.Browse
+func (q *interceptedQueue) Browse(storage StorageType, cursor string, numMessages int) ([]*QueueMessage, string, error) {
+	result := q.handler(Call{Queue: q.IQueue, Op: OpBrowse, Storage: storage, Cursor: cursor, NumMessages: numMessages})
+	return result.Messages, result.Cursor, result.Err
+}
+
+// GetById implements IQueue.GetById
+func (q *interceptedQueue) GetById(storage StorageType, id string) (*QueueMessage, error) {
+	result := q.handler(Call{Queue: q.IQueue, Op: OpGetById, Storage: storage, Id: id})
+	return result.Message, result.Err
+}
+
+// RemoveById implements IQueue.RemoveById
+func (q *interceptedQueue) RemoveById(storage StorageType, id string) (*QueueMessage, error) {
+	result := q.handler(Call{Queue: q.IQueue, Op: OpRemoveById, Storage: storage, Id: id})
+	return result.Message, result.Err
+}
+
+// UpdatePayload implements IQueue.UpdatePayload
+func (q *interceptedQueue) UpdatePayload(storage StorageType, id string, payload []byte) (*QueueMessage, error) {
+	result := q.handler(Call{Queue: q.IQueue, Op: OpUpdatePayload, Storage: storage, Id: id, Payload: payload})
+	return result.Message, result.Err
+}
+
+// ValidatePayload returns an Interceptor that rejects Queue and UpdatePayload calls whose payload validate returns an
+// error for, the error is returned to the caller.
+func ValidatePayload(validate func(payload []byte) error) Interceptor {
+	return func(call Call, next Handler) Result {
+		var err error
+		switch call.Op {
+		case OpQueue:
+			err = validate(call.Message.Payload)
+		case OpUpdatePayload:
+			err = validate(call.Payload)
+		}
+		if err != nil {
+			return Result{Err: err}
+		}
+		return next(call)
+	}
+}
+
+// TransformPayload returns an Interceptor that transforms payloads: encode is applied to the payload of messages to
+// queue and to new payloads of UpdatePayload, decode to the payload of messages returned by all intercepted operations.
+// An encode or decode error is returned to the caller, the call is not performed if encode fails. A message taken from
+// the queue but whose payload can not be decoded is left in ephemeral storage.
+func TransformPayload(encode, decode func(payload []byte) ([]byte, error)) Interceptor {
+	return TransformMessages(
+		func(msg *QueueMessage) (*QueueMessage, error) {
+			payload, err := encode(msg.Payload)
+			if err != nil {
+				return nil, err
+			}
+			clone := CloneQueueMessage(*msg)
+			clone.Payload = payload
+			return &clone, nil
+		},
+		func(stored *QueueMessage, payload []byte) ([]byte, error) { return encode(payload) },
+		func(msg *QueueMessage) (*QueueMessage, error) {
+			payload, err := decode(msg.Payload)
+			if err != nil {
+				return nil, err
+			}
+			clone := CloneQueueMessage(*msg)
+			clone.Payload = payload
+			return &clone, nil
+		})
+}
+
+// TransformMessages returns an Interceptor that transforms messages, it is the base of TransformPayload and of
+// payload-transforming decorators such as compression.CompressedQueue:
+//	- encode returns the message to queue in place of a message to queue.
+//	- encodeUpdate returns the payload to store in place of the new payload of UpdatePayload. stored is the message
+//	  being updated, read with a GetById call passed to the following interceptors, e.g. so that the new payload is
+//	  encoded the way the stored payload was; encodeUpdate is not called if there is no such message.
+//	- decode returns the message to return to the caller in place of a message returned by an intercepted operation.
+//
+// The functions are never called with nil messages, they must not modify the messages they receive (see
+// CloneQueueMessage). Errors are handled as described by TransformPayload.
+func TransformMessages(encode func(msg *QueueMessage) (*QueueMessage, error),
+	encodeUpdate func(stored *QueueMessage, payload []byte) ([]byte, error),
+	decode func(msg *QueueMessage) (*QueueMessage, error)) Interceptor {
+	return func(call Call, next Handler) Result {
+		switch call.Op {
+		case OpQueue:
+			if call.Message != nil {
+				msg, err := encode(call.Message)
+				if err != nil {
+					return Result{Err: err}
+				}
+				call.Message = msg
+			}
+		case OpUpdatePayload:
+			// the stored message is read through the following interceptors, so that it is seen as they return it
+			stored := next(Call{Queue: call.Queue, Op: OpGetById, Storage: call.Storage, Id: call.Id})
+			if stored.Err != nil || stored.Message == nil {
+				return stored
+			}
+			var err error
+			if call.Payload, err = encodeUpdate(stored.Message, call.Payload); err != nil {
+				return Result{Err: err}
+			}
+		}
+		result := next(call)
+		if result.Err != nil {
+			return result
+		}
+		if result.Message != nil {
+			if result.Message, result.Err = decode(result.Message); result.Err != nil {
+				return result
+			}
+		}
+		if result.Messages != nil {
+			msgs := make([]*QueueMessage, len(result.Messages))
+			for i, msg := range result.Messages {
+				if msgs[i], result.Err = decode(msg); result.Err != nil {
+					result.Messages = nil
+					return result
+				}
+			}
+			result.Messages = msgs
+		}
+		return result
+	}
+}
+
+// PayloadMarker transforms payloads and marks transformed messages with a metadata entry, so that a queue can hold a
+// mix of transformed and untransformed messages and each message is decoded the way it was encoded, e.g. with the codec
+// or the key named by its mark. It is the base of compression.CompressedQueue and encryption.EncryptedQueue, see
+// Interceptor.
+type PayloadMarker struct {
+	// MetadataKey is the metadata key transformed messages are marked with.
+	MetadataKey string
+
+	// Encode transforms the payload of a message to queue and returns the mark of the message. If the mark is empty the
+	// message is queued as is.
+	Encode func(msg *QueueMessage) (mark string, payload []byte, err error)
+
+	// EncodeAs transforms payload, the new payload of the marked message msg, the way the message was transformed.
+	EncodeAs func(msg *QueueMessage, mark string, payload []byte) ([]byte, error)
+
+	// Decode reverses the transformation of the payload of the marked message msg.
+	Decode func(msg *QueueMessage, mark string) ([]byte, error)
+
+	// Unmarked, if supplied, is called with messages that are not marked before they are returned as is and before their
+	// payload is updated as is, its error is returned to the caller.
+	Unmarked func(msg *QueueMessage) error
+
+	// UnmarkedUpdate, if supplied, is called instead of Unmarked before the payload of a message that is not marked is
+	// updated as is, its error is returned to the caller.
+	UnmarkedUpdate func(msg *QueueMessage) error
+}
+
+// EncodeMessage returns a clone of the message whose payload is transformed and marked, or the message itself if it is
+// left as is. Marks supplied by the caller are not trusted: they are removed before the message is encoded, so that
+// only payloads transformed by the marker are ever marked.
+func (m *PayloadMarker) EncodeMessage(msg *QueueMessage) (*QueueMessage, error) {
+	if msg == nil {
+		return nil, nil
+	}
+	if _, marked := msg.Metadata[m.MetadataKey]; marked {
+		clone := CloneQueueMessage(*msg)
+		delete(clone.Metadata, m.MetadataKey)
+		if len(clone.Metadata) == 0 {
+			clone.Metadata = nil
+		}
+		msg = &clone
+	}
+	mark, payload, err := m.Encode(msg)
+	if err != nil || mark == "" {
+		return msg, err
+	}
+	clone := CloneQueueMessage(*msg)
+	clone.Payload = payload
+	if clone.Metadata == nil {
+		clone.Metadata = make(map[string]string)
+	}
+	clone.Metadata[m.MetadataKey] = mark
+	return &clone, nil
+}
+
+// DecodeMessage returns a clone of the message whose payload is restored and whose mark is removed, or the message
+// itself if it is not marked.
+func (m *PayloadMarker) DecodeMessage(msg *QueueMessage) (*QueueMessage, error) {
+	if msg == nil {
+		return nil, nil
+	}
+	mark := msg.Metadata[m.MetadataKey]
+	if mark == "" {
+		if m.Unmarked != nil {
+			if err := m.Unmarked(msg); err != nil {
+				return nil, err
+			}
+		}
+		return msg, nil
+	}
+	payload, err := m.Decode(msg, mark)
+	if err != nil {
+		return nil, err
+	}
+	clone := CloneQueueMessage(*msg)
+	clone.Payload = payload
+	delete(clone.Metadata, m.MetadataKey)
+	if len(clone.Metadata) == 0 {
+		clone.Metadata = nil
+	}
+	return &clone, nil
+}
+
+// encodeUpdate transforms the new payload of the stored message the way the message was transformed.
+func (m *PayloadMarker) encodeUpdate(stored *QueueMessage, payload []byte) ([]byte, error) {
+	mark := stored.Metadata[m.MetadataKey]
+	if mark == "" {
+		check := m.Unmarked
+		if m.UnmarkedUpdate != nil {
+			check = m.UnmarkedUpdate
+		}
+		if check != nil {
+			if err := check(stored); err != nil {
+				return nil, err
+			}
+		}
+		return payload, nil
+	}
+	return m.EncodeAs(stored, mark, payload)
+}
+
+// Interceptor returns an Interceptor that encodes messages to queue and new payloads of UpdatePayload, and decodes
+// messages returned by all intercepted operations, see TransformMessages.
+func (m *PayloadMarker) Interceptor() Interceptor {
+	return TransformMessages(m.EncodeMessage, m.encodeUpdate, m.DecodeMessage)
+}
+
+// Observe returns an Interceptor that calls observer with each call, its result and its latency, e.g. to record
+// metrics. observer must be safe for concurrent use.
+func Observe(observer func(call Call, result Result, latency time.Duration)) Interceptor {
+	return func(call Call, next Handler) Result {
+		start := time.Now()
+		result := next(call)
+		observer(call, result, time.Since(start))
+		return result
+	}
+}
+
+// Recover returns an Interceptor that turns panics of the following interceptors and of the queue into errors
+// returned to the caller.
+func Recover() Interceptor {
+	return func(call Call, next Handler) (result Result) {
+		defer func() {
+			if r := recover(); r != nil {
+				result = Result{Err: fmt.Errorf("panic in %s: %v", call.Op, r)}
+			}
+		}()
+		return next(call)
+	}
+}
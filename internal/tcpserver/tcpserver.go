@@ -0,0 +1,230 @@
+// Package tcpserver holds the plumbing shared by singu's TCP protocol front ends (beanstalkd, kestrel, resp and stomp):
+// queue registry, listener and connection management, bounded line reading and polling Take.
+package tcpserver
+
+import (
+	"bufio"
+	"errors"
+	"github.com/btnguyen2k/singu"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config holds the server's configurations.
+type Config struct {
+	// PollInterval is the interval between two attempts of Poll.
+	PollInterval time.Duration
+
+	// QueueFactory, if supplied, is called to create a queue that has not been registered.
+	QueueFactory func(name string) (singu.IQueue, error)
+
+	// Handler serves a connection, it is called in its own goroutine. The connection is closed once Handler returns.
+	Handler func(netConn net.Conn)
+}
+
+// New creates a new Server instance.
+func New(config Config) *Server {
+	return &Server{
+		config: config,
+		queues: make(map[string]singu.IQueue),
+		conns:  make(map[net.Conn]bool),
+	}
+}
+
+// Server serves registered singu.IQueue instances over TCP, protocols are implemented by Config.Handler.
+type Server struct {
+	config   Config
+	queues   map[string]singu.IQueue // registered queues, by name
+	listener net.Listener
+	conns    map[net.Conn]bool // open connections
+	closed   bool
+	lock     sync.Mutex // lock to avoid race condition
+}
+
+// RegisterQueue registers a queue with the server, the queue is served under its name.
+func (s *Server) RegisterQueue(queue singu.IQueue) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queues[queue.Name()] = queue
+}
+
+// GetQueue returns the queue of the specified name, creating it with Config.QueueFactory if needed.
+// Nil is returned if there is no such queue.
+func (s *Server) GetQueue(name string) (singu.IQueue, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if queue, ok := s.queues[name]; ok || s.config.QueueFactory == nil {
+		return queue, nil
+	}
+	queue, err := s.config.QueueFactory(name)
+	if err == nil && queue != nil {
+		s.queues[name] = queue
+	}
+	return queue, err
+}
+
+// QueueNames returns names of all known queues, sorted alphabetically.
+func (s *Server) QueueNames() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	names := make([]string, 0, len(s.queues))
+	for name := range s.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NumConns returns the number of open connections.
+func (s *Server) NumConns() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.conns)
+}
+
+// ListenAndServe listens on the TCP network address and serves incoming connections until Close is called.
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve serves incoming connections on the listener until Close is called.
+func (s *Server) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	s.listener = listener
+	s.lock.Unlock()
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			if s.IsClosed() {
+				return nil
+			}
+			return err
+		}
+		s.lock.Lock()
+		s.conns[netConn] = true
+		s.lock.Unlock()
+		go func() {
+			s.config.Handler(netConn)
+			netConn.Close()
+			s.lock.Lock()
+			delete(s.conns, netConn)
+			s.lock.Unlock()
+		}()
+	}
+}
+
+// Close stops the server and closes all open connections.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	listener := s.listener
+	conns := make([]net.Conn, 0, len(s.conns))
+	for netConn := range s.conns {
+		conns = append(conns, netConn)
+	}
+	s.lock.Unlock()
+	for _, netConn := range conns {
+		netConn.Close()
+	}
+	if listener != nil {
+		return listener.Close()
+	}
+	return nil
+}
+
+// IsClosed returns true once Close has been called.
+func (s *Server) IsClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closed
+}
+
+// Poll calls take until it returns a message or an error, waiting Config.PollInterval between two attempts.
+// Nil is returned if no message is available before the timeout (never if timeout is negative), or once the server is
+// closed or done is closed (done may be nil).
+func (s *Server) Poll(timeout time.Duration, done <-chan struct{}, take func() (*singu.QueueMessage, error)) (*singu.QueueMessage, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if msg, err := take(); msg != nil || err != nil {
+			return msg, err
+		}
+		if (timeout >= 0 && !time.Now().Before(deadline)) || s.IsClosed() {
+			return nil, nil
+		}
+		select {
+		case <-done:
+			return nil, nil
+		case <-time.After(s.config.PollInterval):
+		}
+	}
+}
+
+// Take takes a message from the queue. A full ephemeral storage or a paused queue is reported as an empty queue, as
+// front ends wait for messages to become available in both cases.
+func Take(queue singu.IQueue) (*singu.QueueMessage, error) {
+	msg, err := queue.Take()
+	if errors.Is(err, singu.ErrorEphemeralIsFull) || errors.Is(err, singu.ErrorQueueIsPaused) {
+		return nil, nil
+	}
+	return msg, err
+}
+
+// WatchDisconnect watches the connection while its reader is idle, e.g. while the client waits for a blocking command.
+// The returned channel is closed if the client disconnects. stop must be called before the reader is used again, data
+// the client sends in the meantime is left in the reader.
+//
+// Note: stop clears the connection's read deadline.
+func WatchDisconnect(netConn net.Conn, reader *bufio.Reader) (gone <-chan struct{}, stop func()) {
+	goneCh, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		if _, err := reader.Peek(1); err != nil {
+			if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+				close(goneCh)
+			}
+		}
+	}()
+	return goneCh, func() {
+		// interrupt Peek, then restore the connection
+		netConn.SetReadDeadline(time.Now())
+		<-exited
+		netConn.SetReadDeadline(time.Time{})
+	}
+}
+
+// ErrorLineTooLong is returned by ReadLine if a line exceeds the max length.
+var ErrorLineTooLong = errors.New("line too long")
+
+// ReadLine reads a line terminated by "\n" or "\r\n" and returns it without the line end. ErrorLineTooLong is returned
+// as soon as the line is known to be longer than maxLength, so that long lines are never buffered entirely.
+func ReadLine(reader *bufio.Reader, maxLength int) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		// allow room for the line end
+		if len(line)+len(chunk) > maxLength+2 {
+			return "", ErrorLineTooLong
+		}
+		line = append(line, chunk...)
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	if len(line) > maxLength {
+		return "", ErrorLineTooLong
+	}
+	return string(line), nil
+}
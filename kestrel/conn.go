@@ -0,0 +1,334 @@
+package kestrel
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/internal/tcpserver"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxLineLength = 2048 // max length of a command line
+	maxKeyLength  = 250  // max length of a key, see memcache's protocol
+)
+
+// conn serves a client connection.
+type conn struct {
+	server    *Server
+	netConn   net.Conn
+	reader    *bufio.Reader
+	writer    *bufio.Writer
+	openItems map[string]string // id of the open item, by queue name
+}
+
+func newConn(server *Server, netConn net.Conn) *conn {
+	return &conn{
+		server:    server,
+		netConn:   netConn,
+		reader:    bufio.NewReader(netConn),
+		writer:    bufio.NewWriter(netConn),
+		openItems: make(map[string]string),
+	}
+}
+
+// serve reads and executes commands until the connection is closed.
+func (c *conn) serve() {
+	defer c.close()
+	for {
+		line, err := tcpserver.ReadLine(c.reader, maxLineLength)
+		if err != nil {
+			if err == tcpserver.ErrorLineTooLong {
+				c.reply("CLIENT_ERROR line too long")
+				c.writer.Flush()
+			}
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			c.reply("ERROR")
+		} else if fields[0] == "quit" {
+			return
+		} else {
+			c.execute(fields[0], fields[1:])
+		}
+		if c.writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+// close aborts items still open by the connection.
+func (c *conn) close() {
+	for name, id := range c.openItems {
+		if queue, _ := c.server.GetQueue(name); queue != nil {
+			queue.Requeue(id, true)
+		}
+	}
+}
+
+func (c *conn) reply(format string, args ...interface{}) {
+	fmt.Fprintf(c.writer, format+"\r\n", args...)
+}
+
+func (c *conn) replyServerError(err error) {
+	c.reply("SERVER_ERROR %s", err)
+}
+
+func (c *conn) execute(cmd string, args []string) {
+	switch cmd {
+	case "set":
+		c.cmdSet(args)
+	case "get", "gets":
+		c.cmdGet(args)
+	case "flush":
+		c.cmdFlush(args)
+	case "flush_all":
+		c.cmdFlushAll(args)
+	case "stats":
+		c.cmdStats(args)
+	case "version":
+		c.reply("VERSION singu-%s", singu.Version)
+	default:
+		c.reply("ERROR")
+	}
+}
+
+// set <queue> <flags> <exptime> <bytes> [noreply]
+func (c *conn) cmdSet(args []string) {
+	if len(args) != 4 && (len(args) != 5 || args[4] != "noreply") {
+		c.reply("CLIENT_ERROR bad command line format")
+		return
+	}
+	noreply := len(args) == 5
+	numBytes, err := strconv.Atoi(args[3])
+	if err != nil || numBytes < 0 || len(args[0]) > maxKeyLength {
+		c.reply("CLIENT_ERROR bad command line format")
+		return
+	}
+	if numBytes > c.server.config.MaxItemSize {
+		// discard the item's data
+		io.CopyN(ioutil.Discard, c.reader, int64(numBytes)+2)
+		c.reply("SERVER_ERROR object too large for cache")
+		return
+	}
+	data := make([]byte, numBytes+2)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return
+	}
+	if data[numBytes] != '\r' || data[numBytes+1] != '\n' {
+		c.reply("CLIENT_ERROR bad data chunk")
+		return
+	}
+	queue, err := c.server.GetQueue(args[0])
+	if err != nil {
+		c.replyServerError(err)
+		return
+	}
+	if queue == nil {
+		c.reply("SERVER_ERROR queue not found")
+		return
+	}
+	_, err = queue.Queue(singu.NewQueueMessage(data[:numBytes]))
+	if noreply {
+		return
+	}
+	if err == singu.ErrorQueueIsFull {
+		c.reply("NOT_STORED")
+	} else if err != nil {
+		c.replyServerError(err)
+	} else {
+		c.reply("STORED")
+	}
+}
+
+// getOptions holds options of a "get" command's key.
+type getOptions struct {
+	open, close, abort, peek bool
+	timeout                  time.Duration
+}
+
+// parseKey parses a "get" command's key in format <queue>[/<option>...].
+func parseKey(key string) (string, *getOptions, error) {
+	tokens := strings.Split(key, "/")
+	opts := &getOptions{}
+	for _, opt := range tokens[1:] {
+		switch {
+		case opt == "open":
+			opts.open = true
+		case opt == "close":
+			opts.close = true
+		case opt == "abort":
+			opts.abort = true
+		case opt == "peek":
+			opts.peek = true
+		case strings.HasPrefix(opt, "t="):
+			ms, err := strconv.Atoi(opt[2:])
+			if err != nil || ms < 0 {
+				return "", nil, fmt.Errorf("invalid timeout [%s]", opt)
+			}
+			opts.timeout = time.Duration(ms) * time.Millisecond
+		default:
+			return "", nil, fmt.Errorf("unknown option [%s]", opt)
+		}
+	}
+	if opts.abort && (opts.open || opts.close || opts.peek) {
+		return "", nil, fmt.Errorf("abort can not be combined with other options")
+	}
+	if opts.peek && (opts.open || opts.close) {
+		return "", nil, fmt.Errorf("peek can not be combined with open or close")
+	}
+	return tokens[0], opts, nil
+}
+
+// get <queue>[/<option>...]
+func (c *conn) cmdGet(args []string) {
+	if len(args) != 1 {
+		c.reply("CLIENT_ERROR exactly one key is supported")
+		return
+	}
+	name, opts, err := parseKey(args[0])
+	if err != nil {
+		c.reply("CLIENT_ERROR %s", err)
+		return
+	}
+	queue, err := c.server.GetQueue(name)
+	if err != nil {
+		c.replyServerError(err)
+		return
+	}
+	if queue == nil {
+		c.reply("END")
+		return
+	}
+	if id, ok := c.openItems[name]; ok && (opts.close || opts.abort) {
+		if opts.close {
+			err = queue.Finish(id)
+		} else {
+			_, err = queue.Requeue(id, false)
+		}
+		if err != nil {
+			c.replyServerError(err)
+			return
+		}
+		delete(c.openItems, name)
+	}
+	if opts.abort || (opts.close && !opts.open) {
+		c.reply("END")
+		return
+	}
+	if _, ok := c.openItems[name]; ok && opts.open {
+		c.reply("CLIENT_ERROR transaction already open")
+		return
+	}
+	msg, gone, err := c.fetch(queue, opts)
+	if gone {
+		return
+	}
+	if err != nil {
+		c.replyServerError(err)
+		return
+	}
+	if msg != nil {
+		if opts.open {
+			c.openItems[name] = msg.Id
+		} else if !opts.peek {
+			if err := queue.Finish(msg.Id); err != nil {
+				c.replyServerError(err)
+				return
+			}
+		}
+		c.reply("VALUE %s 0 %d", args[0], len(msg.Payload))
+		c.writer.Write(msg.Payload)
+		c.writer.WriteString("\r\n")
+	}
+	c.reply("END")
+}
+
+// fetch takes (or peeks) an item from the queue, waiting up to the requested timeout. gone is true if the client has
+// disconnected while waiting, the taken item (if any) is re-queued silently in such case.
+func (c *conn) fetch(queue singu.IQueue, opts *getOptions) (msg *singu.QueueMessage, gone bool, err error) {
+	timeout := opts.timeout
+	if timeout > c.server.config.MaxWait {
+		timeout = c.server.config.MaxWait
+	}
+	var goneCh <-chan struct{}
+	stop := func() {}
+	if timeout != 0 {
+		goneCh, stop = tcpserver.WatchDisconnect(c.netConn, c.reader)
+	}
+	msg, err = c.server.Poll(timeout, goneCh, func() (*singu.QueueMessage, error) {
+		if !opts.peek {
+			return tcpserver.Take(queue)
+		}
+		msgs, err := queue.Peek(1)
+		if len(msgs) > 0 {
+			return msgs[0], err
+		}
+		return nil, err
+	})
+	stop()
+	select {
+	case <-goneCh:
+		// the client has disconnected while waiting, it would never receive the item
+		if msg != nil && !opts.peek {
+			queue.Requeue(msg.Id, true)
+		}
+		return nil, true, nil
+	default:
+	}
+	return msg, false, err
+}
+
+// flush <queue>
+func (c *conn) cmdFlush(args []string) {
+	if len(args) != 1 {
+		c.reply("CLIENT_ERROR bad command line format")
+		return
+	}
+	if queue, _ := c.server.GetQueue(args[0]); queue != nil {
+		if _, err := queue.PurgeQueueStorage(); err != nil {
+			c.replyServerError(err)
+			return
+		}
+	}
+	c.reply("END")
+}
+
+// flush_all
+func (c *conn) cmdFlushAll(_ []string) {
+	for _, name := range c.server.QueueNames() {
+		if queue, _ := c.server.GetQueue(name); queue != nil {
+			if _, err := queue.PurgeQueueStorage(); err != nil {
+				c.replyServerError(err)
+				return
+			}
+		}
+	}
+	c.reply("OK")
+}
+
+// stats
+func (c *conn) cmdStats(_ []string) {
+	now := time.Now()
+	c.reply("STAT uptime %d", int(now.Sub(c.server.startTime).Seconds()))
+	c.reply("STAT time %d", now.Unix())
+	c.reply("STAT version singu-%s", singu.Version)
+	c.reply("STAT curr_connections %d", c.server.NumConns())
+	for _, name := range c.server.QueueNames() {
+		queue, _ := c.server.GetQueue(name)
+		if queue == nil {
+			continue
+		}
+		items, _ := queue.QueueSize()
+		openTransactions, _ := queue.EphemeralSize()
+		c.reply("STAT queue_%s_items %d", name, items)
+		c.reply("STAT queue_%s_open_transactions %d", name, openTransactions)
+	}
+	c.reply("END")
+}
@@ -0,0 +1,80 @@
+// Package kestrel implements a TCP server speaking the memcache text protocol with Kestrel's queue semantics on top of
+// singu queues, so that any memcache client can talk to singu queues.
+//
+// Protocol mapping (keys are queue names, with options appended to "get" keys after slashes):
+//	- set <queue> <flags> <exptime> <bytes>: IQueue.Queue. Flags and expiration time are accepted but ignored.
+//	- get <queue>: IQueue.Take immediately followed by IQueue.Finish, i.e. the item is removed without confirmation.
+//	- get <queue>/open: IQueue.Take, the item is left open (in ephemeral storage) until it is closed or aborted.
+//	  A connection can have at most one open item per queue.
+//	- get <queue>/close: IQueue.Finish on the open item. Can be combined with "open" to close the current item
+//	  and open the next one: get <queue>/close/open.
+//	- get <queue>/abort: IQueue.Requeue on the open item.
+//	- get <queue>/peek: IQueue.Peek.
+//	- get <queue>/t=<milliseconds>: waits up to the specified duration for an item to become available.
+//	- flush <queue>: IQueue.PurgeQueueStorage.
+//	- stats, version and quit are supported as well.
+//
+// Open items of a connection are aborted (re-queued silently) when the connection is closed.
+package kestrel
+
+import (
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/internal/tcpserver"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultMaxItemSize is the default max size of an item's data, in bytes
+	DefaultMaxItemSize = 1024 * 1024
+
+	// DefaultPollInterval is the default interval between two Take attempts while waiting for an item
+	DefaultPollInterval = 100 * time.Millisecond
+
+	// DefaultMaxWait is the default upper limit of "t=<milliseconds>" waiting
+	DefaultMaxWait = 30 * time.Second
+)
+
+// Config holds the server's configurations.
+type Config struct {
+	// MaxItemSize is the max size of an item's data in bytes, default value is DefaultMaxItemSize.
+	MaxItemSize int
+
+	// PollInterval is the interval between two Take attempts while waiting for an item, default value is DefaultPollInterval.
+	PollInterval time.Duration
+
+	// MaxWait is the upper limit of "t=<milliseconds>" waiting, default value is DefaultMaxWait.
+	MaxWait time.Duration
+
+	// QueueFactory, if supplied, is called to create a queue that has not been registered.
+	// If nil, items can not be set to unregistered queues and getting from unregistered queues returns no item.
+	QueueFactory func(name string) (singu.IQueue, error)
+}
+
+// NewServer creates a new Server instance.
+func NewServer(config Config) *Server {
+	if config.MaxItemSize <= 0 {
+		config.MaxItemSize = DefaultMaxItemSize
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	if config.MaxWait <= 0 {
+		config.MaxWait = DefaultMaxWait
+	}
+	s := &Server{config: config, startTime: time.Now()}
+	s.Server = tcpserver.New(tcpserver.Config{
+		PollInterval: config.PollInterval,
+		QueueFactory: config.QueueFactory,
+		Handler:      func(netConn net.Conn) { newConn(s, netConn).serve() },
+	})
+	return s
+}
+
+// Server serves registered singu.IQueue instances over the memcache text protocol, each queue is served under its name
+// (see RegisterQueue).
+type Server struct {
+	*tcpserver.Server
+	config    Config
+	startTime time.Time
+}
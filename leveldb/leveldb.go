@@ -17,12 +17,21 @@ import (
 //	- queueCapacity: if zero or negative queue storage has unlimited capacity; otherwise number of messages can be stored in queue storage is capped by the specified number
 //	- ephemeralCapacity: if zero or negative ephemeral storage has unlimited capacity; otherwise ephemeral storage is capped by the specified number
 func NewLeveldbQueue(name, dataPath string, queueCapacity int, ephemeralDisabled bool, ephemeralCapacity int) singu.IQueue {
+	return NewLeveldbQueueWithClock(name, dataPath, queueCapacity, ephemeralDisabled, ephemeralCapacity, nil)
+}
+
+// NewLeveldbQueueWithClock creates a new LeveldbQueue instance that obtains timestamps from the supplied clock.
+//	- clock: if nil, singu.SystemClock is used
+//
+// See NewLeveldbQueue for the other parameters.
+func NewLeveldbQueueWithClock(name, dataPath string, queueCapacity int, ephemeralDisabled bool, ephemeralCapacity int, clock singu.Clock) singu.IQueue {
 	queue := &LeveldbQueue{
 		name:              name,
 		dataPath:          dataPath,
 		queueCapacity:     queueCapacity,
 		ephemeralCapacity: ephemeralCapacity,
 		ephemeralDisabled: ephemeralDisabled,
+		clock:             clock,
 	}
 	queue.Init()
 	return queue
@@ -32,17 +41,20 @@ const (
 	prefixQueue     = "queue-"
 	prefixEphemeral = "ephemeral-"
 	keyLastTakenId  = "last-taken-id"
+	keyPaused       = "paused"
 )
 
 // LeveldbQueue is LevelDB queue implementation.
 //	- This queue implementation does not use the pre-set message it. It always assigns assign new id for every enqueued message.
 type LeveldbQueue struct {
-	name                             string // queue's name
-	queueCapacity, ephemeralCapacity int    // queue storage and ephemeral storage capacity
-	ephemeralDisabled                bool   // is ephemeral storage disabled?
-	dataPath                         string // root directory to store LevelDB data, actual data is stored in <name> sub-directory
+	name                             string      // queue's name
+	queueCapacity, ephemeralCapacity int         // queue storage and ephemeral storage capacity
+	ephemeralDisabled                bool        // is ephemeral storage disabled?
+	dataPath                         string      // root directory to store LevelDB data, actual data is stored in <name> sub-directory
+	clock                            singu.Clock // source of current time
 
 	lastTakenId string
+	paused      bool        // is consumption paused? persisted under keyPaused
 	db          *leveldb.DB // LevelDB instance
 	inited      bool        // has this queue instance been initialized
 	lockInit    sync.Mutex  // lock to avoid race condition
@@ -58,6 +70,7 @@ func (q *LeveldbQueue) Init() error {
 		if q.queueCapacity < 0 {
 			q.queueCapacity = singu.SizeNotSupported
 		}
+		q.clock = singu.ClockOrDefault(q.clock)
 		q.dataPath = strings.TrimSuffix(q.dataPath, "/")
 		if db, err := leveldb.OpenFile(q.dataPath+"/"+q.name, nil); err != nil {
 			return err
@@ -67,6 +80,11 @@ func (q *LeveldbQueue) Init() error {
 		if lastTakenId, err := q.db.Get([]byte(keyLastTakenId), nil); err != nil {
 			q.lastTakenId = string(lastTakenId)
 		}
+		if paused, err := q.db.Has([]byte(keyPaused), nil); err != nil {
+			return err
+		} else {
+			q.paused = paused
+		}
 		q.inited = true
 	}
 	return nil
@@ -126,7 +144,7 @@ func (q *LeveldbQueue) Queue(msg *singu.QueueMessage) (*singu.QueueMessage, erro
 
 	clone := singu.CloneQueueMessage(*msg)
 	clone.Id = singu.UniqueId()
-	clone.QueueTimestamp = time.Now()
+	clone.QueueTimestamp = q.clock.Now()
 	clone.TakenTimestamp = time.Time{}
 	clone.NumRequeues = 0
 	value, _ := json.Marshal(clone)
@@ -155,7 +173,7 @@ func (q *LeveldbQueue) Requeue(id string, silent bool) (*singu.QueueMessage, err
 		msg.Id = singu.UniqueId()
 		msg.TakenTimestamp = time.Time{}
 		if !silent {
-			msg.QueueTimestamp = time.Now()
+			msg.QueueTimestamp = q.clock.Now()
 			msg.NumRequeues++
 		}
 		js, _ := json.Marshal(msg)
@@ -178,6 +196,12 @@ func (q *LeveldbQueue) Take() (*singu.QueueMessage, error) {
 	if err := q.ensureInit(); err != nil {
 		return nil, err
 	}
+	// paused state is checked under lockTake, so that no message is taken once Pause returns
+	q.lockTake.Lock()
+	defer q.lockTake.Unlock()
+	if q.paused {
+		return nil, singu.ErrorQueueIsPaused
+	}
 	if !q.ephemeralDisabled && q.ephemeralCapacity > 0 {
 		if ephemeralSize, err := q.countRangePrefix(prefixEphemeral); err != nil {
 			return nil, err
@@ -185,8 +209,6 @@ func (q *LeveldbQueue) Take() (*singu.QueueMessage, error) {
 			return nil, singu.ErrorEphemeralIsFull
 		}
 	}
-	q.lockTake.Lock()
-	defer q.lockTake.Unlock()
 	iter := q.db.NewIterator(util.BytesPrefix([]byte(prefixQueue)), nil)
 	defer iter.Release()
 	if iter.Seek([]byte(q.lastTakenId)) {
@@ -196,7 +218,7 @@ func (q *LeveldbQueue) Take() (*singu.QueueMessage, error) {
 		if err := json.Unmarshal(value, &msg); err != nil {
 			return nil, err
 		}
-		msg.TakenTimestamp = time.Now()
+		msg.TakenTimestamp = q.clock.Now()
 		batch := new(leveldb.Batch)
 		batch.Delete(key)
 		if !q.ephemeralDisabled {
@@ -222,13 +244,13 @@ func (q *LeveldbQueue) OrphanMessages(numSeconds, numMessages int) ([]*singu.Que
 	iter := q.db.NewIterator(util.BytesPrefix([]byte(prefixEphemeral)), nil)
 	defer iter.Release()
 	result := make([]*singu.QueueMessage, 0)
-	now := time.Now()
+	deadline := q.clock.Now().Add(-time.Duration(numSeconds) * time.Second)
 	counter := 0
 	for iter.Next() {
 		counter++
 		value := iter.Value()
 		var msg singu.QueueMessage
-		if err := json.Unmarshal(value, &msg); err == nil && msg.TakenTimestamp.Unix()+int64(numSeconds) < now.Unix() {
+		if err := json.Unmarshal(value, &msg); err == nil && msg.TakenTimestamp.Before(deadline) {
 			result = append(result, &msg)
 		}
 		if numMessages > 0 && counter >= numMessages {
@@ -263,3 +285,295 @@ func (q *LeveldbQueue) EphemeralSize() (int, error) {
 	}
 	return q.countRangePrefix(prefixEphemeral)
 }
+
+// Peek implements IQueue.Peek
+func (q *LeveldbQueue) Peek(numMessages int) ([]*singu.QueueMessage, error) {
+	result, _, err := q.Browse(singu.QueueStorage, "", numMessages)
+	return result, err
+}
+
+// Browse implements IQueue.Browse
+//	- Messages are browsed in order of their storage keys, cursor is the id of the last returned message.
+//	- Each call reads from a consistent snapshot of the database.
+func (q *LeveldbQueue) Browse(storage singu.StorageType, cursor string, numMessages int) ([]*singu.QueueMessage, string, error) {
+	if err := q.ensureInit(); err != nil {
+		return nil, "", err
+	}
+	var prefix string
+	switch storage {
+	case singu.QueueStorage:
+		prefix = prefixQueue
+	case singu.EphemeralStorage:
+		prefix = prefixEphemeral
+	default:
+		return nil, "", singu.ErrorOperationNotSupported
+	}
+	snapshot, err := q.db.GetSnapshot()
+	if err != nil {
+		return nil, "", err
+	}
+	defer snapshot.Release()
+	iter := snapshot.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+	result := make([]*singu.QueueMessage, 0)
+	ok := iter.First()
+	if cursor != "" {
+		ok = iter.Seek([]byte(prefix + cursor))
+		if ok && string(iter.Key()) == prefix+cursor {
+			ok = iter.Next()
+		}
+	}
+	for ; ok; ok = iter.Next() {
+		if numMessages > 0 && len(result) >= numMessages {
+			return result, cursor, nil
+		}
+		var msg singu.QueueMessage
+		if err := json.Unmarshal(iter.Value(), &msg); err != nil {
+			return nil, "", err
+		}
+		result = append(result, &msg)
+		cursor = strings.TrimPrefix(string(iter.Key()), prefix)
+	}
+	return result, "", iter.Error()
+}
+
+// storageKey returns the LevelDB key of the message with the specified id in the specified storage.
+// Storage keys are derived from message ids, so messages are looked up by id directly without scanning.
+func storageKey(storage singu.StorageType, id string) ([]byte, error) {
+	switch storage {
+	case singu.QueueStorage:
+		return []byte(prefixQueue + id), nil
+	case singu.EphemeralStorage:
+		return []byte(prefixEphemeral + id), nil
+	}
+	return nil, singu.ErrorOperationNotSupported
+}
+
+func (q *LeveldbQueue) get(key []byte) (*singu.QueueMessage, error) {
+	value, err := q.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var msg singu.QueueMessage
+	if err := json.Unmarshal(value, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// GetById implements IQueue.GetById
+func (q *LeveldbQueue) GetById(storage singu.StorageType, id string) (*singu.QueueMessage, error) {
+	if err := q.ensureInit(); err != nil {
+		return nil, err
+	}
+	key, err := storageKey(storage, id)
+	if err != nil {
+		return nil, err
+	}
+	return q.get(key)
+}
+
+// RemoveById implements IQueue.RemoveById
+func (q *LeveldbQueue) RemoveById(storage singu.StorageType, id string) (*singu.QueueMessage, error) {
+	if err := q.ensureInit(); err != nil {
+		return nil, err
+	}
+	key, err := storageKey(storage, id)
+	if err != nil {
+		return nil, err
+	}
+	q.lockTake.Lock()
+	defer q.lockTake.Unlock()
+	msg, err := q.get(key)
+	if msg == nil || err != nil {
+		return nil, err
+	}
+	return msg, q.db.Delete(key, nil)
+}
+
+// UpdatePayload implements IQueue.UpdatePayload
+func (q *LeveldbQueue) UpdatePayload(storage singu.StorageType, id string, payload []byte) (*singu.QueueMessage, error) {
+	if err := q.ensureInit(); err != nil {
+		return nil, err
+	}
+	key, err := storageKey(storage, id)
+	if err != nil {
+		return nil, err
+	}
+	q.lockTake.Lock()
+	defer q.lockTake.Unlock()
+	msg, err := q.get(key)
+	if msg == nil || err != nil {
+		return nil, err
+	}
+	msg.Payload = []byte(string(payload))
+	value, _ := json.Marshal(msg)
+	return msg, q.db.Put(key, value, nil)
+}
+
+// purgeRangePrefix deletes all keys with the specified prefix in one batch, then compacts the key range.
+func (q *LeveldbQueue) purgeRangePrefix(prefix string) (int, error) {
+	snapshot, err := q.db.GetSnapshot()
+	if err != nil {
+		return 0, err
+	}
+	defer snapshot.Release()
+	keyRange := util.BytesPrefix([]byte(prefix))
+	iter := snapshot.NewIterator(keyRange, nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Delete(iter.Key())
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+	return batch.Len(), q.db.CompactRange(*keyRange)
+}
+
+// PurgeQueueStorage implements IQueue.PurgeQueueStorage
+func (q *LeveldbQueue) PurgeQueueStorage() (int, error) {
+	if err := q.ensureInit(); err != nil {
+		return 0, err
+	}
+	q.lockTake.Lock()
+	defer q.lockTake.Unlock()
+	return q.purgeRangePrefix(prefixQueue)
+}
+
+// PurgeEphemeralStorage implements IQueue.PurgeEphemeralStorage
+func (q *LeveldbQueue) PurgeEphemeralStorage() (int, error) {
+	if err := q.ensureInit(); err != nil {
+		return 0, err
+	}
+	q.lockTake.Lock()
+	defer q.lockTake.Unlock()
+	return q.purgeRangePrefix(prefixEphemeral)
+}
+
+// RequeueAllEphemeral implements IQueue.RequeueAllEphemeral
+//	- As with Requeue, re-queued messages are assigned new ids.
+func (q *LeveldbQueue) RequeueAllEphemeral(silent bool) (int, error) {
+	if err := q.ensureInit(); err != nil {
+		return 0, err
+	}
+	if q.ephemeralDisabled {
+		return 0, nil
+	}
+	q.lockTake.Lock()
+	defer q.lockTake.Unlock()
+	iter := q.db.NewIterator(util.BytesPrefix([]byte(prefixEphemeral)), nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	now := q.clock.Now()
+	count := 0
+	for iter.Next() {
+		var msg singu.QueueMessage
+		if err := json.Unmarshal(iter.Value(), &msg); err != nil {
+			return 0, err
+		}
+		batch.Delete(iter.Key())
+		msg.Id = singu.UniqueId()
+		msg.TakenTimestamp = time.Time{}
+		if !silent {
+			msg.QueueTimestamp = now
+			msg.NumRequeues++
+		}
+		js, _ := json.Marshal(msg)
+		batch.Put([]byte(prefixQueue+msg.Id), js)
+		count++
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	return count, q.db.Write(batch, nil)
+}
+
+// Restore implements singu.IRestorable.Restore
+//	- Messages are stored under their own ids, queue storage is consumed in order of message ids.
+func (q *LeveldbQueue) Restore(storage singu.StorageType, msg *singu.QueueMessage) error {
+	if err := q.ensureInit(); err != nil {
+		return err
+	}
+	if storage == singu.EphemeralStorage && q.ephemeralDisabled {
+		return singu.ErrorOperationNotSupported
+	}
+	clone := singu.CloneQueueMessage(*msg)
+	if clone.Id == "" {
+		clone.Id = singu.UniqueId()
+	}
+	key, err := storageKey(storage, clone.Id)
+	if err != nil {
+		return err
+	}
+	q.lockTake.Lock()
+	defer q.lockTake.Unlock()
+	if exists, err := q.db.Has(key, nil); err != nil {
+		return err
+	} else if !exists {
+		if storage == singu.QueueStorage && q.queueCapacity > 0 {
+			if queueSize, err := q.countRangePrefix(prefixQueue); err != nil {
+				return err
+			} else if queueSize >= q.queueCapacity {
+				return singu.ErrorQueueIsFull
+			}
+		}
+		if storage == singu.EphemeralStorage && q.ephemeralCapacity > 0 {
+			if ephemeralSize, err := q.countRangePrefix(prefixEphemeral); err != nil {
+				return err
+			} else if ephemeralSize >= q.ephemeralCapacity {
+				return singu.ErrorEphemeralIsFull
+			}
+		}
+	}
+	batch := new(leveldb.Batch)
+	if storage == singu.QueueStorage && string(key) < q.lastTakenId {
+		// Take seeks from the last taken key, it must restart from the beginning to see the restored message
+		q.lastTakenId = ""
+		batch.Delete([]byte(keyLastTakenId))
+	}
+	value, _ := json.Marshal(clone)
+	batch.Put(key, value)
+	return q.db.Write(batch, nil)
+}
+
+// Pause implements IQueue.Pause
+//	- Paused state is persisted, a paused queue stays paused after application restarts.
+func (q *LeveldbQueue) Pause() error {
+	if err := q.ensureInit(); err != nil {
+		return err
+	}
+	q.lockTake.Lock()
+	defer q.lockTake.Unlock()
+	if err := q.db.Put([]byte(keyPaused), []byte{1}, nil); err != nil {
+		return err
+	}
+	q.paused = true
+	return nil
+}
+
+// Resume implements IQueue.Resume
+func (q *LeveldbQueue) Resume() error {
+	if err := q.ensureInit(); err != nil {
+		return err
+	}
+	q.lockTake.Lock()
+	defer q.lockTake.Unlock()
+	if err := q.db.Delete([]byte(keyPaused), nil); err != nil {
+		return err
+	}
+	q.paused = false
+	return nil
+}
+
+// IsPaused implements IQueue.IsPaused
+func (q *LeveldbQueue) IsPaused() bool {
+	q.lockTake.Lock()
+	defer q.lockTake.Unlock()
+	return q.paused
+}
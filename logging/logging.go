@@ -0,0 +1,239 @@
+// Package logging traces the lifecycle of messages in singu queues: LoggedQueue is an IQueue decorator that emits a
+// structured event through the Logger interface for each call of Queue, Take, Finish, Requeue and OrphanMessages.
+//
+// Events carry the following fields, plus Config.Fields (e.g. to identify the producer or consumer):
+//	- FieldQueue: name of the queue.
+//	- FieldOperation: one of the singu.Op constants.
+//	- FieldId: id of the message, if the operation is about one message.
+//	- FieldNumRequeues: NumRequeues of the taken or re-queued message.
+//	- FieldLatency: time spent in the decorated queue's call, as a time.Duration.
+//	- FieldError: error returned by the call, if any.
+//
+// Successful calls are logged at LevelInfo, except Take calls that return no message and OrphanMessages calls which are
+// logged at LevelDebug. Failed calls are logged at LevelError, or LevelWarn for singu.ErrorQueueIsPaused.
+// See Config for level and sampling controls.
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Level is the severity of an event.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String implements fmt.Stringer
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Keys of the fields of events emitted by LoggedQueue.
+const (
+	FieldQueue       = "queue"
+	FieldOperation   = "operation"
+	FieldId          = "id"
+	FieldNumRequeues = "num_requeues"
+	FieldTakenId     = "taken_id"
+	FieldSilent      = "silent"
+	FieldCount       = "count"
+	FieldLatency     = "latency"
+	FieldError       = "error"
+)
+
+// Field is a key-value pair of an event.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger is the interface events are emitted through, adapters to logging libraries implement it. Implementations must
+// be safe for concurrent use.
+type Logger interface {
+	// Log emits an event.
+	Log(level Level, msg string, fields ...Field)
+}
+
+// LoggerFunc adapts a function to the Logger interface.
+type LoggerFunc func(level Level, msg string, fields ...Field)
+
+// Log implements Logger.Log
+func (f LoggerFunc) Log(level Level, msg string, fields ...Field) {
+	f(level, msg, fields...)
+}
+
+// NewStdLogger creates a Logger that writes events to l in logfmt (key=value pairs), e.g.
+//
+//	level=info msg="singu: take" queue=orders operation=take id=1234 num_requeues=0 latency=52.3µs
+//
+// Nil l means the standard logger of package log.
+func NewStdLogger(l *log.Logger) Logger {
+	print := log.Print
+	if l != nil {
+		print = l.Print
+	}
+	return LoggerFunc(func(level Level, msg string, fields ...Field) {
+		sb := strings.Builder{}
+		sb.WriteString("level=" + level.String() + " msg=" + logfmtValue(msg))
+		for _, f := range fields {
+			sb.WriteString(" " + f.Key + "=" + logfmtValue(fmt.Sprint(f.Value)))
+		}
+		print(sb.String())
+	})
+}
+
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\t\r\n") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// Config holds LoggedQueue's configurations.
+type Config struct {
+	// Level is the min level of emitted events, default value is LevelDebug (all events).
+	Level Level
+
+	// SampleRate, in range (0, 1], is the fraction of messages whose events are emitted, default value is 1 (all
+	// messages). Sampling is by message id, so all events of a sampled message are emitted as long as its id does not
+	// change (LeveldbQueue assigns new ids to re-queued messages). Events of failed calls are always emitted.
+	SampleRate float64
+
+	// Fields are added to every event, e.g. the name of the host or the consumer.
+	Fields []Field
+}
+
+// NewLoggedQueue creates a new LoggedQueue that decorates the queue and emits events to logger.
+func NewLoggedQueue(queue singu.IQueue, logger Logger, config Config) *LoggedQueue {
+	if config.SampleRate <= 0 || config.SampleRate > 1 {
+		config.SampleRate = 1
+	}
+	return &LoggedQueue{IQueue: queue, logger: logger, config: config}
+}
+
+// LoggedQueue is an IQueue decorator that emits structured events for the decorated queue's operations.
+// Operations not listed in the package documentation are passed through without being logged.
+type LoggedQueue struct {
+	singu.IQueue
+	logger Logger
+	config Config
+}
+
+// sampled returns true if events of the message id are to be emitted.
+func (q *LoggedQueue) sampled(id string) bool {
+	if q.config.SampleRate >= 1 || id == "" {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return float64(h.Sum32()%10000) < q.config.SampleRate*10000
+}
+
+// log emits the event of a call of op that started at start. id is the message id the event is sampled by, fields are
+// op-specific fields.
+func (q *LoggedQueue) log(level Level, op string, start time.Time, id string, err error, fields ...Field) {
+	latency := time.Since(start)
+	if err != nil {
+		level = LevelError
+		if errors.Is(err, singu.ErrorQueueIsPaused) {
+			level = LevelWarn
+		}
+	} else if !q.sampled(id) {
+		return
+	}
+	if level < q.config.Level {
+		return
+	}
+	all := make([]Field, 0, 4+len(fields)+len(q.config.Fields))
+	all = append(all, Field{Key: FieldQueue, Value: q.Name()}, Field{Key: FieldOperation, Value: op})
+	if id != "" {
+		all = append(all, Field{Key: FieldId, Value: id})
+	}
+	all = append(all, fields...)
+	all = append(all, Field{Key: FieldLatency, Value: latency})
+	if err != nil {
+		all = append(all, Field{Key: FieldError, Value: err.Error()})
+	}
+	all = append(all, q.config.Fields...)
+	q.logger.Log(level, "singu: "+op, all...)
+}
+
+// Queue implements IQueue.Queue
+func (q *LoggedQueue) Queue(msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	start := time.Now()
+	result, err := q.IQueue.Queue(msg)
+	id := msg.Id
+	if result != nil {
+		id = result.Id
+	}
+	q.log(LevelInfo, singu.OpQueue, start, id, err)
+	return result, err
+}
+
+// Take implements IQueue.Take
+func (q *LoggedQueue) Take() (*singu.QueueMessage, error) {
+	start := time.Now()
+	msg, err := q.IQueue.Take()
+	if msg == nil {
+		q.log(LevelDebug, singu.OpTake, start, "", err)
+	} else {
+		q.log(LevelInfo, singu.OpTake, start, msg.Id, err, Field{Key: FieldNumRequeues, Value: msg.NumRequeues})
+	}
+	return msg, err
+}
+
+// Finish implements IQueue.Finish
+func (q *LoggedQueue) Finish(id string) error {
+	start := time.Now()
+	err := q.IQueue.Finish(id)
+	q.log(LevelInfo, singu.OpFinish, start, id, err)
+	return err
+}
+
+// Requeue implements IQueue.Requeue, the event carries the id the message was re-queued with and, if it changed, the
+// id it was taken with as FieldTakenId.
+func (q *LoggedQueue) Requeue(id string, silent bool) (*singu.QueueMessage, error) {
+	start := time.Now()
+	msg, err := q.IQueue.Requeue(id, silent)
+	fields := []Field{{Key: FieldSilent, Value: silent}}
+	newId := id
+	if msg != nil {
+		newId = msg.Id
+		if newId != id {
+			fields = append(fields, Field{Key: FieldTakenId, Value: id})
+		}
+		fields = append(fields, Field{Key: FieldNumRequeues, Value: msg.NumRequeues})
+	}
+	q.log(LevelInfo, singu.OpRequeue, start, newId, err, fields...)
+	return msg, err
+}
+
+// OrphanMessages implements IQueue.OrphanMessages
+func (q *LoggedQueue) OrphanMessages(numSeconds, numMessages int) ([]*singu.QueueMessage, error) {
+	start := time.Now()
+	msgs, err := q.IQueue.OrphanMessages(numSeconds, numMessages)
+	q.log(LevelDebug, singu.OpOrphanMessages, start, "", err, Field{Key: FieldCount, Value: len(msgs)})
+	return msgs, err
+}
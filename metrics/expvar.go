@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"expvar"
+	"sync"
+)
+
+// NewExpvar creates a new Expvar instance that publishes metrics as an expvar.Map of the specified name. If a map of
+// that name has been published already, it is reused.
+func NewExpvar(name string) *Expvar {
+	vars, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		vars = expvar.NewMap(name)
+	}
+	return &Expvar{vars: vars}
+}
+
+// Expvar is a Metrics implementation that publishes metrics with package expvar, e.g. to be served at /debug/vars.
+//
+// Metrics are entries of the published map, keyed by metric name followed by labels as in the Prometheus format, e.g.
+// singu_operations_total{operation="take",queue="orders"}. Counters and gauges are expvar.Float values, histograms
+// are expvar.Map values with entries "count", "sum" and "max".
+type Expvar struct {
+	vars *expvar.Map
+	lock sync.Mutex // lock to avoid race condition
+}
+
+// AddCounter implements Metrics.AddCounter
+func (e *Expvar) AddCounter(name string, labels Labels, delta float64) {
+	e.vars.AddFloat(name+formatLabels(labels), delta)
+}
+
+// SetGauge implements Metrics.SetGauge
+func (e *Expvar) SetGauge(name string, labels Labels, value float64) {
+	key := name + formatLabels(labels)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	gauge, ok := e.vars.Get(key).(*expvar.Float)
+	if !ok {
+		gauge = new(expvar.Float)
+		e.vars.Set(key, gauge)
+	}
+	gauge.Set(value)
+}
+
+// Observe implements Metrics.Observe
+func (e *Expvar) Observe(name string, labels Labels, value float64) {
+	key := name + formatLabels(labels)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	histogram, ok := e.vars.Get(key).(*expvar.Map)
+	if !ok {
+		histogram = new(expvar.Map).Init()
+		histogram.Set("max", new(expvar.Float))
+		e.vars.Set(key, histogram)
+	}
+	histogram.Add("count", 1)
+	histogram.AddFloat("sum", value)
+	if max := histogram.Get("max").(*expvar.Float); histogram.Get("count").(*expvar.Int).Value() == 1 || value > max.Value() {
+		max.Set(value)
+	}
+}
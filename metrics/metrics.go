@@ -0,0 +1,230 @@
+// Package metrics instruments singu queues: InstrumentedQueue is an IQueue decorator that records metrics of the
+// decorated queue's operations through the Metrics interface.
+//
+// Recorded metrics (all labeled with "queue", the queue's name):
+//	- MetricOperations (counter, label "operation"): number of calls of Queue, Take, Finish, Requeue and OrphanMessages.
+//	- MetricMessages (counter, label "operation"): number of messages queued, taken, finished and re-queued. Unlike
+//	  MetricOperations, failed calls and Take calls that return no message are not counted.
+//	- MetricErrors (counter, labels "operation" and "error"): number of failed calls, by error, see ErrorLabel.
+//	- MetricDuration (histogram, label "operation"): latency of the calls, in seconds.
+//	- MetricQueueSize and MetricEphemeralSize (gauges): sizes of the queue's storages, see Config.SizeInterval.
+//	- MetricMessageAge (histogram): age of taken messages, i.e. time since their last-queued timestamp, in seconds.
+//	- MetricMessageRequeues (histogram): NumRequeues of taken messages.
+//
+// Values of label "operation" are the singu.Op constants.
+//
+// Adapters for expvar (see NewExpvar) and the Prometheus text exposition format (see NewPrometheus) are included.
+package metrics
+
+import (
+	"errors"
+	"github.com/btnguyen2k/singu"
+	"sync"
+	"time"
+)
+
+const (
+	// MetricOperations counts calls of queue operations
+	MetricOperations = "singu_operations_total"
+
+	// MetricMessages counts messages queued, taken, finished and re-queued
+	MetricMessages = "singu_messages_total"
+
+	// MetricErrors counts failed calls of queue operations
+	MetricErrors = "singu_errors_total"
+
+	// MetricDuration is the histogram of operations' latency, in seconds
+	MetricDuration = "singu_operation_duration_seconds"
+
+	// MetricQueueSize is the gauge of queue storage's size
+	MetricQueueSize = "singu_queue_size"
+
+	// MetricEphemeralSize is the gauge of ephemeral storage's size
+	MetricEphemeralSize = "singu_ephemeral_size"
+
+	// MetricMessageAge is the histogram of taken messages' age, in seconds
+	MetricMessageAge = "singu_message_age_seconds"
+
+	// MetricMessageRequeues is the histogram of taken messages' NumRequeues
+	MetricMessageRequeues = "singu_message_requeues"
+)
+
+// DefaultSizeInterval is the default min interval between two updates of the size gauges
+const DefaultSizeInterval = 5 * time.Second
+
+// Labels are the labels (dimensions) of a metric.
+type Labels map[string]string
+
+// Metrics is the interface metrics are recorded through. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// AddCounter adds delta to the counter of the specified name and labels.
+	AddCounter(name string, labels Labels, delta float64)
+
+	// SetGauge sets the gauge of the specified name and labels.
+	SetGauge(name string, labels Labels, value float64)
+
+	// Observe records a value to the histogram of the specified name and labels.
+	Observe(name string, labels Labels, value float64)
+}
+
+// ErrorLabel returns the "error" label value of an error: the name of singu's sentinel errors (e.g. "queue_is_full"
+// for singu.ErrorQueueIsFull), or "other". Wrapped sentinel errors are recognized, see errors.Is.
+func ErrorLabel(err error) string {
+	switch {
+	case errors.Is(err, singu.ErrorQueueIsFull):
+		return "queue_is_full"
+	case errors.Is(err, singu.ErrorEphemeralIsFull):
+		return "ephemeral_is_full"
+	case errors.Is(err, singu.ErrorQueueIsPaused):
+		return "queue_is_paused"
+	case errors.Is(err, singu.ErrorOperationNotSupported):
+		return "operation_not_supported"
+	}
+	return "other"
+}
+
+// Config holds InstrumentedQueue's configurations.
+type Config struct {
+	// SizeInterval is the min interval between two updates of the size gauges, default value is DefaultSizeInterval.
+	// Sizes are read in the background after an operation once the interval has elapsed (at most one read at a time, so
+	// that slow size queries never hold up operations), and every time QueueSize or EphemeralSize is called through the
+	// InstrumentedQueue. Negative value disables the size gauges.
+	SizeInterval time.Duration
+
+	// Clock is the source of current time used to compute message age, default value is singu.SystemClock.
+	Clock singu.Clock
+}
+
+// NewInstrumentedQueue creates a new InstrumentedQueue that decorates the queue and records metrics to m.
+func NewInstrumentedQueue(queue singu.IQueue, m Metrics, config Config) *InstrumentedQueue {
+	if config.SizeInterval == 0 {
+		config.SizeInterval = DefaultSizeInterval
+	}
+	config.Clock = singu.ClockOrDefault(config.Clock)
+	return &InstrumentedQueue{IQueue: queue, metrics: m, config: config, nextSizeUpdate: time.Now().Add(config.SizeInterval)}
+}
+
+// InstrumentedQueue is an IQueue decorator that records metrics of the decorated queue's operations.
+// Operations not listed in the package documentation are passed through without being recorded.
+type InstrumentedQueue struct {
+	singu.IQueue
+	metrics        Metrics
+	config         Config
+	nextSizeUpdate time.Time  // when the size gauges are due for an update
+	updatingSizes  bool       // true while the size gauges are being updated
+	lock           sync.Mutex // lock to avoid race condition
+}
+
+func (q *InstrumentedQueue) labels(op string) Labels {
+	return Labels{"queue": q.Name(), "operation": op}
+}
+
+// record records the call of an operation that started at start, and the messages it affected.
+func (q *InstrumentedQueue) record(op string, start time.Time, numMessages int, err error) {
+	labels := q.labels(op)
+	q.metrics.AddCounter(MetricOperations, labels, 1)
+	q.metrics.Observe(MetricDuration, labels, time.Since(start).Seconds())
+	if err != nil {
+		q.metrics.AddCounter(MetricErrors, Labels{"queue": q.Name(), "operation": op, "error": ErrorLabel(err)}, 1)
+	} else if numMessages > 0 {
+		q.metrics.AddCounter(MetricMessages, labels, float64(numMessages))
+	}
+	q.updateSizes()
+}
+
+// updateSizes reads the storages' sizes and updates the size gauges in the background, if the update is due and no
+// other update is in progress.
+func (q *InstrumentedQueue) updateSizes() {
+	if q.config.SizeInterval < 0 {
+		return
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	now := time.Now()
+	if q.updatingSizes || now.Before(q.nextSizeUpdate) {
+		return
+	}
+	q.nextSizeUpdate = now.Add(q.config.SizeInterval)
+	q.updatingSizes = true
+	go func() {
+		defer func() {
+			q.lock.Lock()
+			defer q.lock.Unlock()
+			q.updatingSizes = false
+		}()
+		q.QueueSize()
+		if q.IsEphemeralStorageEnabled() {
+			q.EphemeralSize()
+		}
+	}()
+}
+
+func count(msg *singu.QueueMessage) int {
+	if msg == nil {
+		return 0
+	}
+	return 1
+}
+
+// Queue implements IQueue.Queue
+func (q *InstrumentedQueue) Queue(msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	start := time.Now()
+	result, err := q.IQueue.Queue(msg)
+	q.record(singu.OpQueue, start, count(result), err)
+	return result, err
+}
+
+// Take implements IQueue.Take
+func (q *InstrumentedQueue) Take() (*singu.QueueMessage, error) {
+	start := time.Now()
+	msg, err := q.IQueue.Take()
+	q.record(singu.OpTake, start, count(msg), err)
+	if msg != nil {
+		labels := Labels{"queue": q.Name()}
+		q.metrics.Observe(MetricMessageAge, labels, q.config.Clock.Now().Sub(msg.QueueTimestamp).Seconds())
+		q.metrics.Observe(MetricMessageRequeues, labels, float64(msg.NumRequeues))
+	}
+	return msg, err
+}
+
+// Finish implements IQueue.Finish
+func (q *InstrumentedQueue) Finish(id string) error {
+	start := time.Now()
+	err := q.IQueue.Finish(id)
+	q.record(singu.OpFinish, start, 1, err)
+	return err
+}
+
+// Requeue implements IQueue.Requeue
+func (q *InstrumentedQueue) Requeue(id string, silent bool) (*singu.QueueMessage, error) {
+	start := time.Now()
+	msg, err := q.IQueue.Requeue(id, silent)
+	q.record(singu.OpRequeue, start, count(msg), err)
+	return msg, err
+}
+
+// OrphanMessages implements IQueue.OrphanMessages
+func (q *InstrumentedQueue) OrphanMessages(numSeconds, numMessages int) ([]*singu.QueueMessage, error) {
+	start := time.Now()
+	msgs, err := q.IQueue.OrphanMessages(numSeconds, numMessages)
+	q.record(singu.OpOrphanMessages, start, 0, err)
+	return msgs, err
+}
+
+// QueueSize implements IQueue.QueueSize, the queue size gauge is updated as well.
+func (q *InstrumentedQueue) QueueSize() (int, error) {
+	size, err := q.IQueue.QueueSize()
+	if err == nil && size >= 0 && q.config.SizeInterval >= 0 {
+		q.metrics.SetGauge(MetricQueueSize, Labels{"queue": q.Name()}, float64(size))
+	}
+	return size, err
+}
+
+// EphemeralSize implements IQueue.EphemeralSize, the ephemeral size gauge is updated as well.
+func (q *InstrumentedQueue) EphemeralSize() (int, error) {
+	size, err := q.IQueue.EphemeralSize()
+	if err == nil && size >= 0 && q.config.SizeInterval >= 0 {
+		q.metrics.SetGauge(MetricEphemeralSize, Labels{"queue": q.Name()}, float64(size))
+	}
+	return size, err
+}
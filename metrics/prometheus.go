@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the default histogram buckets of the metrics recorded by InstrumentedQueue.
+var DefaultBuckets = map[string][]float64{
+	MetricDuration:        {0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	MetricMessageAge:      {0.1, 1, 5, 15, 60, 300, 900, 3600, 21600, 86400},
+	MetricMessageRequeues: {0, 1, 2, 3, 5, 10, 20, 50},
+}
+
+// DefaultHistogramBuckets are the buckets of histograms that have no entry in the buckets passed to NewPrometheus.
+var DefaultHistogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// family holds all series of a metric.
+type family struct {
+	kind   string
+	series map[string]*series // series by formatted labels
+}
+
+// series is a metric's value for a set of labels.
+type series struct {
+	value   float64  // value of counters and gauges
+	buckets []uint64 // histograms: number of observations per bucket, not cumulative
+	count   uint64   // histograms: number of observations
+	sum     float64  // histograms: sum of observations
+}
+
+// NewPrometheus creates a new Prometheus instance.
+//	- buckets: histogram buckets (upper bounds) by metric name, if nil DefaultBuckets is used
+func NewPrometheus(buckets map[string][]float64) *Prometheus {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &Prometheus{buckets: buckets, families: make(map[string]*family)}
+}
+
+// Prometheus is a Metrics implementation that keeps metrics in memory and exposes them in the Prometheus text
+// exposition format, see WriteTo. It implements http.Handler, so it can be registered as a scrape endpoint.
+type Prometheus struct {
+	buckets  map[string][]float64
+	families map[string]*family // metric families by name
+	lock     sync.Mutex         // lock to avoid race condition
+}
+
+// labelEscaper escapes label values as specified by the exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabel(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+// formatLabels formats labels as in the exposition format, sorted by name, e.g. {operation="take",queue="orders"}.
+func formatLabels(labels Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, formatLabel(name, labels[name]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// getSeries returns the series of the metric, creating it if needed. Caller must hold the lock.
+func (p *Prometheus) getSeries(kind, name string, labels Labels) *series {
+	f, ok := p.families[name]
+	if !ok {
+		f = &family{kind: kind, series: make(map[string]*series)}
+		p.families[name] = f
+	}
+	key := formatLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{}
+		if kind == kindHistogram {
+			s.buckets = make([]uint64, len(p.histogramBuckets(name)))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (p *Prometheus) histogramBuckets(name string) []float64 {
+	if buckets, ok := p.buckets[name]; ok {
+		return buckets
+	}
+	return DefaultHistogramBuckets
+}
+
+// AddCounter implements Metrics.AddCounter
+func (p *Prometheus) AddCounter(name string, labels Labels, delta float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.getSeries(kindCounter, name, labels).value += delta
+}
+
+// SetGauge implements Metrics.SetGauge
+func (p *Prometheus) SetGauge(name string, labels Labels, value float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.getSeries(kindGauge, name, labels).value = value
+}
+
+// Observe implements Metrics.Observe
+func (p *Prometheus) Observe(name string, labels Labels, value float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s := p.getSeries(kindHistogram, name, labels)
+	for i, bound := range p.histogramBuckets(name) {
+		if value <= bound && i < len(s.buckets) {
+			s.buckets[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format, metric families sorted by name.
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+	p.lock.Lock()
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := p.families[name]
+		buf.WriteString("# TYPE " + name + " " + f.kind + "\n")
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != kindHistogram {
+				buf.WriteString(name + key + " " + formatValue(s.value) + "\n")
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range p.histogramBuckets(name) {
+				if i < len(s.buckets) {
+					cumulative += s.buckets[i]
+				}
+				buf.WriteString(name + "_bucket" + withLabel(key, "le", formatValue(bound)) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+			}
+			buf.WriteString(name + "_bucket" + withLabel(key, "le", "+Inf") + " " + strconv.FormatUint(s.count, 10) + "\n")
+			buf.WriteString(name + "_sum" + key + " " + formatValue(s.sum) + "\n")
+			buf.WriteString(name + "_count" + key + " " + strconv.FormatUint(s.count, 10) + "\n")
+		}
+	}
+	p.lock.Unlock()
+	return buf.WriteTo(w)
+}
+
+// withLabel appends a label to formatted labels.
+func withLabel(formatted, name, value string) string {
+	label := formatLabel(name, value)
+	if formatted == "" {
+		return "{" + label + "}"
+	}
+	return strings.TrimSuffix(formatted, "}") + "," + label + "}"
+}
+
+// ServeHTTP implements http.Handler, it responds with all metrics in the Prometheus text exposition format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
@@ -0,0 +1,522 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/internal/tcpserver"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxInlineLength = 64 * 1024 // max length of an inline command
+
+var errProtocol = errors.New("protocol error")
+
+// conn serves a client connection.
+type conn struct {
+	server        *Server
+	netConn       net.Conn
+	reader        *bufio.Reader
+	writer        *bufio.Writer
+	authenticated bool
+}
+
+func newConn(server *Server, netConn net.Conn) *conn {
+	return &conn{
+		server:  server,
+		netConn: netConn,
+		reader:  bufio.NewReader(netConn),
+		writer:  bufio.NewWriter(netConn),
+	}
+}
+
+// serve reads and executes commands until the connection is closed.
+func (c *conn) serve() {
+	for {
+		args, err := c.readCommand()
+		if err != nil {
+			if err == errProtocol {
+				c.writeError("ERR", "Protocol error")
+				c.writer.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToUpper(string(args[0]))
+		if name == "QUIT" {
+			c.writeSimple("OK")
+			c.writer.Flush()
+			return
+		}
+		c.execute(name, args[1:])
+		if c.writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+// readLine reads a line terminated by "\r\n" (or "\n" for inline commands), errProtocol is returned if the line is too long.
+func (c *conn) readLine() (string, error) {
+	line, err := tcpserver.ReadLine(c.reader, maxInlineLength)
+	if err == tcpserver.ErrorLineTooLong {
+		return "", errProtocol
+	}
+	return line, err
+}
+
+// readCommand reads a command, either as a RESP array of bulk strings or as an inline command.
+// A null array ("*-1") is read as an empty command.
+func (c *conn) readCommand() ([][]byte, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		fields := strings.Fields(line)
+		args := make([][]byte, len(fields))
+		for i, field := range fields {
+			args[i] = []byte(field)
+		}
+		return args, nil
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < -1 || count > 1024*1024 {
+		return nil, errProtocol
+	}
+	if count <= 0 {
+		return nil, nil
+	}
+	args := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(header, "$") {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 || size > c.server.config.MaxBulkSize {
+			return nil, errProtocol
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		if data[size] != '\r' || data[size+1] != '\n' {
+			return nil, errProtocol
+		}
+		args = append(args, data[:size])
+	}
+	return args, nil
+}
+
+func (c *conn) writeSimple(s string) {
+	c.writer.WriteString("+" + s + "\r\n")
+}
+
+func (c *conn) writeError(code, msg string) {
+	c.writer.WriteString("-" + code + " " + msg + "\r\n")
+}
+
+func (c *conn) writeInt(i int) {
+	c.writer.WriteString(":" + strconv.Itoa(i) + "\r\n")
+}
+
+func (c *conn) writeBulk(data []byte) {
+	c.writer.WriteString("$" + strconv.Itoa(len(data)) + "\r\n")
+	c.writer.Write(data)
+	c.writer.WriteString("\r\n")
+}
+
+func (c *conn) writeNil() {
+	c.writer.WriteString("$-1\r\n")
+}
+
+func (c *conn) writeNilArray() {
+	c.writer.WriteString("*-1\r\n")
+}
+
+func (c *conn) writeArrayHeader(n int) {
+	c.writer.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// writeQueueError maps an error returned by a queue to an error reply.
+func (c *conn) writeQueueError(err error) {
+	if err == singu.ErrorQueueIsFull {
+		c.writeError("OOM", err.Error())
+	} else {
+		c.writeError("ERR", err.Error())
+	}
+}
+
+// writeMessage writes a message as a [id, payload] array.
+func (c *conn) writeMessage(msg *singu.QueueMessage) {
+	c.writeArrayHeader(2)
+	c.writeBulk([]byte(msg.Id))
+	c.writeBulk(msg.Payload)
+}
+
+type commandFunc func(c *conn, args [][]byte)
+
+var commands = map[string]struct {
+	minArgs, maxArgs int // maxArgs less than zero means no limit
+	fn               commandFunc
+}{
+	"PING":          {0, 1, (*conn).cmdPing},
+	"ECHO":          {1, 1, (*conn).cmdEcho},
+	"SELECT":        {1, 1, (*conn).cmdSelect},
+	"COMMAND":       {0, -1, (*conn).cmdCommand},
+	"LPUSH":         {2, -1, (*conn).cmdPush},
+	"RPUSH":         {2, -1, (*conn).cmdPush},
+	"RPOP":          {1, 2, (*conn).cmdRpop},
+	"BRPOP":         {2, -1, (*conn).cmdBrpop},
+	"LLEN":          {1, 1, (*conn).cmdLlen},
+	"SINGU.TAKE":    {1, 2, (*conn).cmdSinguTake},
+	"SINGU.FINISH":  {2, 2, (*conn).cmdSinguFinish},
+	"SINGU.REQUEUE": {2, 3, (*conn).cmdSinguRequeue},
+	"SINGU.ORPHANS": {2, 3, (*conn).cmdSinguOrphans},
+	"SINGU.ELEN":    {1, 1, (*conn).cmdSinguElen},
+}
+
+func (c *conn) execute(name string, args [][]byte) {
+	if name == "AUTH" {
+		c.cmdAuth(args)
+		return
+	}
+	if c.server.config.Authenticate != nil && !c.authenticated {
+		c.writeError("NOAUTH", "Authentication required.")
+		return
+	}
+	command, ok := commands[name]
+	if !ok {
+		c.writeError("ERR", fmt.Sprintf("unknown command '%s'", name))
+	} else if len(args) < command.minArgs || (command.maxArgs >= 0 && len(args) > command.maxArgs) {
+		c.writeError("ERR", fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(name)))
+	} else {
+		command.fn(c, args)
+	}
+}
+
+// parseTimeout parses a timeout in seconds, zero means waiting forever and is returned as a negative duration.
+func parseTimeout(arg []byte) (time.Duration, bool) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	if seconds == 0 {
+		return -1, true
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// take takes a message from the first non-empty queue, waiting up to timeout (forever if negative).
+// Nil is returned if no message is available before the timeout, or if the client disconnects while waiting.
+func (c *conn) take(names []string, timeout time.Duration) (string, *singu.QueueMessage, error) {
+	var name string
+	var queue singu.IQueue
+	var gone <-chan struct{}
+	stop := func() {}
+	if timeout != 0 {
+		gone, stop = tcpserver.WatchDisconnect(c.netConn, c.reader)
+	}
+	msg, err := c.server.Poll(timeout, gone, func() (*singu.QueueMessage, error) {
+		for _, name = range names {
+			var err error
+			if queue, err = c.server.GetQueue(name); err != nil {
+				return nil, err
+			}
+			if queue == nil {
+				continue
+			}
+			if msg, err := tcpserver.Take(queue); msg != nil || err != nil {
+				return msg, err
+			}
+		}
+		return nil, nil
+	})
+	stop()
+	select {
+	case <-gone:
+		// the client has disconnected while blocking, it would never receive the message
+		if msg != nil {
+			queue.Requeue(msg.Id, true)
+		}
+		return "", nil, nil
+	default:
+	}
+	if err != nil || msg == nil {
+		return "", nil, err
+	}
+	return name, msg, nil
+}
+
+// takeAndFinish takes messages with c.take and finishes them right away.
+func (c *conn) takeAndFinish(names []string, timeout time.Duration) (string, *singu.QueueMessage, error) {
+	name, msg, err := c.take(names, timeout)
+	if err != nil || msg == nil {
+		return name, msg, err
+	}
+	queue, _ := c.server.GetQueue(name)
+	return name, msg, queue.Finish(msg.Id)
+}
+
+// AUTH [username] password
+func (c *conn) cmdAuth(args [][]byte) {
+	if len(args) < 1 || len(args) > 2 {
+		c.writeError("ERR", "wrong number of arguments for 'auth' command")
+		return
+	}
+	if c.server.config.Authenticate == nil {
+		c.writeError("ERR", "AUTH called without any password configured")
+		return
+	}
+	username := "default"
+	if len(args) == 2 {
+		username = string(args[0])
+	}
+	if !c.server.config.Authenticate(username, string(args[len(args)-1])) {
+		c.writeError("WRONGPASS", "invalid username-password pair")
+		return
+	}
+	c.authenticated = true
+	c.writeSimple("OK")
+}
+
+// PING [message]
+func (c *conn) cmdPing(args [][]byte) {
+	if len(args) == 0 {
+		c.writeSimple("PONG")
+	} else {
+		c.writeBulk(args[0])
+	}
+}
+
+// ECHO message
+func (c *conn) cmdEcho(args [][]byte) {
+	c.writeBulk(args[0])
+}
+
+// SELECT index: singu has no databases, any index is accepted.
+func (c *conn) cmdSelect(_ [][]byte) {
+	c.writeSimple("OK")
+}
+
+// COMMAND [...]: replies with an empty list, clients fall back to their built-in command tables.
+func (c *conn) cmdCommand(_ [][]byte) {
+	c.writeArrayHeader(0)
+}
+
+// LPUSH|RPUSH queue payload [payload...]
+func (c *conn) cmdPush(args [][]byte) {
+	queue, err := c.server.GetQueue(string(args[0]))
+	if err != nil {
+		c.writeQueueError(err)
+		return
+	}
+	if queue == nil {
+		c.writeError("ERR", "no such queue")
+		return
+	}
+	for _, payload := range args[1:] {
+		if _, err := queue.Queue(singu.NewQueueMessage(payload)); err != nil {
+			c.writeQueueError(err)
+			return
+		}
+	}
+	size, err := queue.QueueSize()
+	if err != nil {
+		c.writeQueueError(err)
+		return
+	}
+	c.writeInt(size)
+}
+
+// RPOP queue [count]
+func (c *conn) cmdRpop(args [][]byte) {
+	count := -1
+	if len(args) > 1 {
+		var err error
+		if count, err = strconv.Atoi(string(args[1])); err != nil || count < 0 {
+			c.writeError("ERR", "value is out of range, must be positive")
+			return
+		}
+	}
+	names := []string{string(args[0])}
+	if count < 0 {
+		if _, msg, err := c.takeAndFinish(names, 0); err != nil {
+			c.writeQueueError(err)
+		} else if msg == nil {
+			c.writeNil()
+		} else {
+			c.writeBulk(msg.Payload)
+		}
+		return
+	}
+	payloads := make([][]byte, 0)
+	for len(payloads) < count {
+		_, msg, err := c.takeAndFinish(names, 0)
+		if err != nil {
+			c.writeQueueError(err)
+			return
+		}
+		if msg == nil {
+			break
+		}
+		payloads = append(payloads, msg.Payload)
+	}
+	if len(payloads) == 0 {
+		c.writeNilArray()
+		return
+	}
+	c.writeArrayHeader(len(payloads))
+	for _, payload := range payloads {
+		c.writeBulk(payload)
+	}
+}
+
+// BRPOP queue [queue...] timeout
+func (c *conn) cmdBrpop(args [][]byte) {
+	timeout, ok := parseTimeout(args[len(args)-1])
+	if !ok {
+		c.writeError("ERR", "timeout is not a float or out of range")
+		return
+	}
+	names := make([]string, 0, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		names = append(names, string(arg))
+	}
+	name, msg, err := c.takeAndFinish(names, timeout)
+	if err != nil {
+		c.writeQueueError(err)
+	} else if msg == nil {
+		c.writeNilArray()
+	} else {
+		c.writeArrayHeader(2)
+		c.writeBulk([]byte(name))
+		c.writeBulk(msg.Payload)
+	}
+}
+
+// LLEN queue
+func (c *conn) cmdLlen(args [][]byte) {
+	c.writeSize(string(args[0]), singu.IQueue.QueueSize)
+}
+
+// SINGU.ELEN queue
+func (c *conn) cmdSinguElen(args [][]byte) {
+	c.writeSize(string(args[0]), singu.IQueue.EphemeralSize)
+}
+
+func (c *conn) writeSize(name string, sizeFunc func(singu.IQueue) (int, error)) {
+	queue, err := c.server.GetQueue(name)
+	if err != nil {
+		c.writeQueueError(err)
+		return
+	}
+	if queue == nil {
+		c.writeInt(0)
+		return
+	}
+	if size, err := sizeFunc(queue); err != nil {
+		c.writeQueueError(err)
+	} else {
+		c.writeInt(size)
+	}
+}
+
+// SINGU.TAKE queue [timeout]
+func (c *conn) cmdSinguTake(args [][]byte) {
+	var timeout time.Duration
+	if len(args) > 1 {
+		var ok bool
+		if timeout, ok = parseTimeout(args[1]); !ok {
+			c.writeError("ERR", "timeout is not a float or out of range")
+			return
+		}
+	}
+	if _, msg, err := c.take([]string{string(args[0])}, timeout); err != nil {
+		c.writeQueueError(err)
+	} else if msg == nil {
+		c.writeNilArray()
+	} else {
+		c.writeMessage(msg)
+	}
+}
+
+// SINGU.FINISH queue id
+func (c *conn) cmdSinguFinish(args [][]byte) {
+	queue, err := c.server.GetQueue(string(args[0]))
+	if err == nil && queue != nil {
+		err = queue.Finish(string(args[1]))
+	}
+	if err != nil {
+		c.writeQueueError(err)
+	} else {
+		c.writeSimple("OK")
+	}
+}
+
+// SINGU.REQUEUE queue id [SILENT]
+func (c *conn) cmdSinguRequeue(args [][]byte) {
+	silent := false
+	if len(args) > 2 {
+		if !strings.EqualFold(string(args[2]), "SILENT") {
+			c.writeError("ERR", "syntax error")
+			return
+		}
+		silent = true
+	}
+	queue, err := c.server.GetQueue(string(args[0]))
+	if err != nil {
+		c.writeQueueError(err)
+		return
+	}
+	if queue == nil {
+		c.writeNil()
+		return
+	}
+	if msg, err := queue.Requeue(string(args[1]), silent); err != nil {
+		c.writeQueueError(err)
+	} else if msg == nil {
+		c.writeNil()
+	} else {
+		c.writeBulk([]byte(msg.Id))
+	}
+}
+
+// SINGU.ORPHANS queue seconds [count]
+func (c *conn) cmdSinguOrphans(args [][]byte) {
+	seconds, err := strconv.Atoi(string(args[1]))
+	count := 0
+	if err == nil && len(args) > 2 {
+		count, err = strconv.Atoi(string(args[2]))
+	}
+	if err != nil {
+		c.writeError("ERR", "value is not an integer or out of range")
+		return
+	}
+	queue, err := c.server.GetQueue(string(args[0]))
+	if err != nil {
+		c.writeQueueError(err)
+		return
+	}
+	var msgs []*singu.QueueMessage
+	if queue != nil {
+		if msgs, err = queue.OrphanMessages(seconds, count); err != nil {
+			c.writeQueueError(err)
+			return
+		}
+	}
+	c.writeArrayHeader(len(msgs))
+	for _, msg := range msgs {
+		c.writeMessage(msg)
+	}
+}
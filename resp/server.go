@@ -0,0 +1,76 @@
+// Package resp implements a TCP server speaking the Redis serialization protocol (RESP) on top of singu queues,
+// so that redis-cli and Redis client libraries can be pointed at singu queues. Keys are queue names.
+//
+// Command mapping:
+//	- LPUSH, RPUSH <queue> <payload> [<payload>...]: IQueue.Queue for each payload, replies with the queue size.
+//	  singu queues are FIFO, so both commands append to the queue (LPUSH+RPOP and RPUSH+RPOP behave the same).
+//	- RPOP <queue> [<count>], BRPOP <queue> [<queue>...] <timeout>: IQueue.Take. As plain Redis clients have no way to
+//	  acknowledge, taken messages are finished right away; use SINGU.TAKE for reliable consumption.
+//	- LLEN <queue>: IQueue.QueueSize.
+//	- SINGU.TAKE <queue> [<timeout>]: IQueue.Take, replies with [id, payload] or nil. The message stays in
+//	  ephemeral storage until it is finished or re-queued.
+//	- SINGU.FINISH <queue> <id>: IQueue.Finish.
+//	- SINGU.REQUEUE <queue> <id> [SILENT]: IQueue.Requeue, replies with the new id or nil.
+//	- SINGU.ORPHANS <queue> <seconds> [<count>]: IQueue.OrphanMessages, replies with a list of [id, payload].
+//	- SINGU.ELEN <queue>: IQueue.EphemeralSize.
+//	- AUTH [<username>] <password>: authenticates the connection, see Config.Authenticate.
+//	- PING, ECHO, SELECT, COMMAND and QUIT are supported for client compatibility.
+//
+// Timeouts are in seconds (fractions allowed) and 0 means waiting forever, as in Redis.
+// Errors returned by queues are replied with code "OOM" for singu.ErrorQueueIsFull and "ERR" otherwise.
+package resp
+
+import (
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/internal/tcpserver"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultPollInterval is the default interval between two Take attempts while blocking
+	DefaultPollInterval = 100 * time.Millisecond
+
+	// DefaultMaxBulkSize is the default max size of a bulk string, in bytes
+	DefaultMaxBulkSize = 16 * 1024 * 1024
+)
+
+// Config holds the server's configurations.
+type Config struct {
+	// PollInterval is the interval between two Take attempts while blocking, default value is DefaultPollInterval.
+	PollInterval time.Duration
+
+	// MaxBulkSize is the max size of a bulk string in bytes, default value is DefaultMaxBulkSize.
+	MaxBulkSize int
+
+	// Authenticate, if supplied, is called to validate the credentials of AUTH commands, username is "default" if the
+	// client supplies the password only. Connections must authenticate before sending other commands.
+	Authenticate func(username, password string) bool
+
+	// QueueFactory, if supplied, is called to create a queue that has not been registered.
+	// If nil, pushing to unregistered queues fails and unregistered queues are treated as empty.
+	QueueFactory func(name string) (singu.IQueue, error)
+}
+
+// NewServer creates a new Server instance.
+func NewServer(config Config) *Server {
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	if config.MaxBulkSize <= 0 {
+		config.MaxBulkSize = DefaultMaxBulkSize
+	}
+	s := &Server{config: config}
+	s.Server = tcpserver.New(tcpserver.Config{
+		PollInterval: config.PollInterval,
+		QueueFactory: config.QueueFactory,
+		Handler:      func(netConn net.Conn) { newConn(s, netConn).serve() },
+	})
+	return s
+}
+
+// Server serves registered singu.IQueue instances over RESP, each queue is served under its name (see RegisterQueue).
+type Server struct {
+	*tcpserver.Server
+	config Config
+}
@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// AuthServerOptions returns grpc.ServerOption that authenticate incoming calls with bearer tokens, the same way
+// the REST server does: clients send a token via metadata "authorization: Bearer <token>".
+// If tokens is empty, no option is returned and calls are not authenticated.
+func AuthServerOptions(tokens []string) []grpc.ServerOption {
+	if len(tokens) == 0 {
+		return nil
+	}
+	authenticate := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			token := strings.TrimPrefix(value, "Bearer ")
+			for _, t := range tokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+					return nil
+				}
+			}
+		}
+		return status.Error(codes.Unauthenticated, "invalid or missing auth token")
+	}
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := authenticate(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := authenticate(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
@@ -0,0 +1,487 @@
+// Package rpc exposes singu queues as a gRPC service, see singu.proto for the service definition.
+//
+// Besides unary RPCs mirroring IQueue's API, the service offers 2 streaming RPCs for high-throughput consumers:
+//	- TakeStream: server-streaming, messages are pushed to the client as they become available and finished once sent (at-most-once delivery).
+//	- Consume: bidirectional-streaming, acknowledgements flow back on the same stream and limit the number of in-flight messages.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"github.com/btnguyen2k/singu"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPollInterval is the default interval between two Take attempts while streaming from an empty queue
+	DefaultPollInterval = 100 * time.Millisecond
+)
+
+// Config holds the server's configurations.
+type Config struct {
+	// PollInterval is the interval between two Take attempts while streaming from an empty (or paused) queue, default value is DefaultPollInterval.
+	PollInterval time.Duration
+}
+
+// NewServer creates a new Server instance.
+func NewServer(config Config) *Server {
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	return &Server{config: config, queues: make(map[string]singu.IQueue)}
+}
+
+// Server implements QueueServer, backed by registered singu.IQueue instances.
+//
+// Usage:
+//
+//	grpcServer := grpc.NewServer()
+//	rpc.RegisterQueueServer(grpcServer, server)
+type Server struct {
+	config Config
+	queues map[string]singu.IQueue // registered queues, by name
+	lock   sync.RWMutex            // lock to avoid race condition
+}
+
+// RegisterQueue registers a queue with the server, the queue is served under its name.
+// A queue registered earlier with the same name is replaced.
+func (s *Server) RegisterQueue(queue singu.IQueue) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queues[queue.Name()] = queue
+}
+
+// GetQueue returns the registered queue with the specified name, or nil if there is no such queue.
+func (s *Server) GetQueue(name string) singu.IQueue {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.queues[name]
+}
+
+func (s *Server) getQueue(name string) (singu.IQueue, error) {
+	if queue := s.GetQueue(name); queue != nil {
+		return queue, nil
+	}
+	return nil, status.Error(codes.NotFound, "queue not found: "+name)
+}
+
+// sentinelCodes maps singu's sentinel errors to gRPC status codes.
+var sentinelCodes = map[error]codes.Code{
+	singu.ErrorQueueIsFull:           codes.ResourceExhausted,
+	singu.ErrorEphemeralIsFull:       codes.ResourceExhausted,
+	singu.ErrorQueueIsPaused:         codes.FailedPrecondition,
+	singu.ErrorOperationNotSupported: codes.Unimplemented,
+}
+
+// SentinelError returns singu's sentinel error corresponding to the specified gRPC error, or nil if there is none.
+// Sentinel errors are transferred as their status code and message, the message of a wrapped sentinel error contains
+// the sentinel's own message.
+func SentinelError(err error) error {
+	if st, ok := status.FromError(err); ok {
+		for sentinel, code := range sentinelCodes {
+			if st.Code() == code && strings.Contains(st.Message(), sentinel.Error()) {
+				return sentinel
+			}
+		}
+	}
+	return nil
+}
+
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	for sentinel, code := range sentinelCodes {
+		if errors.Is(err, sentinel) {
+			return status.Error(code, err.Error())
+		}
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(nsec int64) time.Time {
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
+}
+
+// ToProto converts a singu.QueueMessage to its protobuf representation, nil is converted to nil.
+func ToProto(msg *singu.QueueMessage) *QueueMessage {
+	if msg == nil {
+		return nil
+	}
+	return &QueueMessage{
+		Id:             msg.Id,
+		Timestamp:      toUnixNano(msg.Timestamp),
+		QueueTimestamp: toUnixNano(msg.QueueTimestamp),
+		TakenTimestamp: toUnixNano(msg.TakenTimestamp),
+		NumRequeues:    int32(msg.NumRequeues),
+		Payload:        msg.Payload,
+		Metadata:       msg.Metadata,
+	}
+}
+
+// FromProto converts a protobuf QueueMessage to singu.QueueMessage, nil is converted to nil.
+func FromProto(msg *QueueMessage) *singu.QueueMessage {
+	if msg == nil {
+		return nil
+	}
+	return &singu.QueueMessage{
+		Id:             msg.Id,
+		Timestamp:      fromUnixNano(msg.Timestamp),
+		QueueTimestamp: fromUnixNano(msg.QueueTimestamp),
+		TakenTimestamp: fromUnixNano(msg.TakenTimestamp),
+		NumRequeues:    int(msg.NumRequeues),
+		Payload:        msg.Payload,
+		Metadata:       msg.Metadata,
+	}
+}
+
+func toProtoList(msgs []*singu.QueueMessage) []*QueueMessage {
+	result := make([]*QueueMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		result = append(result, ToProto(msg))
+	}
+	return result
+}
+
+func toStorage(storage StorageType) singu.StorageType {
+	if storage == StorageType_EPHEMERAL {
+		return singu.EphemeralStorage
+	}
+	return singu.QueueStorage
+}
+
+func messageResponse(msg *singu.QueueMessage, err error) (*QueueMessageResponse, error) {
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &QueueMessageResponse{Message: ToProto(msg)}, nil
+}
+
+func messageList(msgs []*singu.QueueMessage, err error) (*QueueMessageList, error) {
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &QueueMessageList{Messages: toProtoList(msgs)}, nil
+}
+
+func countResponse(count int, err error) (*CountResponse, error) {
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &CountResponse{Count: int32(count)}, nil
+}
+
+func emptyResponse(err error) (*Empty, error) {
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &Empty{}, nil
+}
+
+// Info implements QueueServer.Info
+func (s *Server) Info(ctx context.Context, req *QueueRequest) (*QueueInfo, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	info := &QueueInfo{Name: queue.Name(), EphemeralEnabled: queue.IsEphemeralStorageEnabled(), Paused: queue.IsPaused()}
+	for _, f := range []struct {
+		get   func() (int, error)
+		field *int32
+	}{
+		{queue.QueueSize, &info.QueueSize},
+		{queue.EphemeralSize, &info.EphemeralSize},
+		{queue.QueueStorageCapacity, &info.QueueCapacity},
+		{queue.EphemeralStorageCapacity, &info.EphemeralCapacity},
+	} {
+		value, err := f.get()
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		*f.field = int32(value)
+	}
+	return info, nil
+}
+
+// Queue implements QueueServer.Queue
+func (s *Server) Queue(ctx context.Context, req *QueueMessageRequest) (*QueueMessageResponse, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	msg := FromProto(req.Message)
+	if msg == nil {
+		return nil, status.Error(codes.InvalidArgument, "message is required")
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return messageResponse(queue.Queue(msg))
+}
+
+// Take implements QueueServer.Take
+func (s *Server) Take(ctx context.Context, req *QueueRequest) (*QueueMessageResponse, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return messageResponse(queue.Take())
+}
+
+// Finish implements QueueServer.Finish
+func (s *Server) Finish(ctx context.Context, req *IdRequest) (*Empty, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return emptyResponse(queue.Finish(req.Id))
+}
+
+// Requeue implements QueueServer.Requeue
+func (s *Server) Requeue(ctx context.Context, req *RequeueRequest) (*QueueMessageResponse, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return messageResponse(queue.Requeue(req.Id, req.Silent))
+}
+
+// OrphanMessages implements QueueServer.OrphanMessages
+func (s *Server) OrphanMessages(ctx context.Context, req *OrphanMessagesRequest) (*QueueMessageList, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return messageList(queue.OrphanMessages(int(req.NumSeconds), int(req.NumMessages)))
+}
+
+// Peek implements QueueServer.Peek
+func (s *Server) Peek(ctx context.Context, req *PeekRequest) (*QueueMessageList, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return messageList(queue.Peek(int(req.NumMessages)))
+}
+
+// Browse implements QueueServer.Browse
+func (s *Server) Browse(ctx context.Context, req *BrowseRequest) (*BrowseResponse, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	msgs, cursor, err := queue.Browse(toStorage(req.Storage), req.Cursor, int(req.NumMessages))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &BrowseResponse{Messages: toProtoList(msgs), Cursor: cursor}, nil
+}
+
+// GetById implements QueueServer.GetById
+func (s *Server) GetById(ctx context.Context, req *IdRequest) (*QueueMessageResponse, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return messageResponse(queue.GetById(toStorage(req.Storage), req.Id))
+}
+
+// RemoveById implements QueueServer.RemoveById
+func (s *Server) RemoveById(ctx context.Context, req *IdRequest) (*QueueMessageResponse, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return messageResponse(queue.RemoveById(toStorage(req.Storage), req.Id))
+}
+
+// UpdatePayload implements QueueServer.UpdatePayload
+func (s *Server) UpdatePayload(ctx context.Context, req *UpdatePayloadRequest) (*QueueMessageResponse, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return messageResponse(queue.UpdatePayload(toStorage(req.Storage), req.Id, req.Payload))
+}
+
+// Purge implements QueueServer.Purge
+func (s *Server) Purge(ctx context.Context, req *StorageRequest) (*CountResponse, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	if req.Storage == StorageType_EPHEMERAL {
+		return countResponse(queue.PurgeEphemeralStorage())
+	}
+	return countResponse(queue.PurgeQueueStorage())
+}
+
+// RequeueAllEphemeral implements QueueServer.RequeueAllEphemeral
+func (s *Server) RequeueAllEphemeral(ctx context.Context, req *RequeueAllRequest) (*CountResponse, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return countResponse(queue.RequeueAllEphemeral(req.Silent))
+}
+
+// Pause implements QueueServer.Pause
+func (s *Server) Pause(ctx context.Context, req *QueueRequest) (*Empty, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return emptyResponse(queue.Pause())
+}
+
+// Resume implements QueueServer.Resume
+func (s *Server) Resume(ctx context.Context, req *QueueRequest) (*Empty, error) {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return nil, err
+	}
+	return emptyResponse(queue.Resume())
+}
+
+// take takes a message from the queue. Nil is returned without error if the queue is empty, paused or its ephemeral
+// storage is full, so that streaming RPCs keep waiting in such cases.
+func take(queue singu.IQueue) (*singu.QueueMessage, error) {
+	msg, err := queue.Take()
+	if errors.Is(err, singu.ErrorQueueIsPaused) || errors.Is(err, singu.ErrorEphemeralIsFull) {
+		return nil, nil
+	}
+	return msg, err
+}
+
+// TakeStream implements QueueServer.TakeStream
+//	- Delivery is at-most-once: a message is finished as soon as it has been sent, messages lost in transit (e.g. the
+//	  client disconnects before receiving them) are not redelivered. Consume offers acknowledged delivery.
+//	- If a taken message can not be sent to the client, it is re-queued silently.
+func (s *Server) TakeStream(req *TakeStreamRequest, stream Queue_TakeStreamServer) error {
+	queue, err := s.getQueue(req.Queue)
+	if err != nil {
+		return err
+	}
+	for {
+		msg, err := take(queue)
+		if err != nil {
+			return toStatus(err)
+		}
+		if msg == nil {
+			select {
+			case <-stream.Context().Done():
+				return nil
+			case <-time.After(s.config.PollInterval):
+			}
+			continue
+		}
+		if err := stream.Send(ToProto(msg)); err != nil {
+			queue.Requeue(msg.Id, true)
+			return err
+		}
+		if err := queue.Finish(msg.Id); err != nil {
+			return toStatus(err)
+		}
+	}
+}
+
+// Consume implements QueueServer.Consume
+func (s *Server) Consume(stream Queue_ConsumeServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	sub := req.GetSubscribe()
+	if sub == nil {
+		return status.Error(codes.InvalidArgument, "first request must be a subscription")
+	}
+	queue, err := s.getQueue(sub.Queue)
+	if err != nil {
+		return err
+	}
+	maxInFlight := int(sub.MaxInFlight)
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+
+	acks := make(chan *ConsumeRequest_Ack)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			if ack := req.GetAck(); ack != nil {
+				select {
+				case acks <- ack:
+				case <-stream.Context().Done():
+					return
+				}
+			}
+		}
+	}()
+
+	inFlight := make(map[string]bool)
+	defer func() {
+		for id := range inFlight {
+			queue.Requeue(id, true)
+		}
+	}()
+	for {
+		var timer <-chan time.Time
+		if len(inFlight) < maxInFlight {
+			msg, err := take(queue)
+			if err != nil {
+				return toStatus(err)
+			}
+			if msg != nil {
+				inFlight[msg.Id] = true
+				if err := stream.Send(ToProto(msg)); err != nil {
+					return err
+				}
+				continue
+			}
+			timer = time.After(s.config.PollInterval)
+		}
+		select {
+		case ack := <-acks:
+			if !inFlight[ack.Id] {
+				return status.Error(codes.InvalidArgument, "message not in flight: "+ack.Id)
+			}
+			delete(inFlight, ack.Id)
+			if ack.Type == ConsumeRequest_REQUEUE {
+				_, err = queue.Requeue(ack.Id, ack.Silent)
+			} else {
+				err = queue.Finish(ack.Id)
+			}
+			if err != nil {
+				return toStatus(err)
+			}
+		case <-recvErr:
+			// client closed its side of the stream, no more acknowledgement is expected
+			return nil
+		case <-stream.Context().Done():
+			return nil
+		case <-timer:
+		}
+	}
+}
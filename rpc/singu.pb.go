@@ -0,0 +1,2048 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: singu.proto
+
+package rpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// StorageType mirrors singu.StorageType.
+type StorageType int32
+
+const (
+	StorageType_QUEUE     StorageType = 0
+	StorageType_EPHEMERAL StorageType = 1
+)
+
+var StorageType_name = map[int32]string{
+	0: "QUEUE",
+	1: "EPHEMERAL",
+}
+
+var StorageType_value = map[string]int32{
+	"QUEUE":     0,
+	"EPHEMERAL": 1,
+}
+
+func (x StorageType) String() string {
+	return proto.EnumName(StorageType_name, int32(x))
+}
+
+func (StorageType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{0}
+}
+
+type ConsumeRequest_AckType int32
+
+const (
+	ConsumeRequest_FINISH  ConsumeRequest_AckType = 0
+	ConsumeRequest_REQUEUE ConsumeRequest_AckType = 1
+)
+
+var ConsumeRequest_AckType_name = map[int32]string{
+	0: "FINISH",
+	1: "REQUEUE",
+}
+
+var ConsumeRequest_AckType_value = map[string]int32{
+	"FINISH":  0,
+	"REQUEUE": 1,
+}
+
+func (x ConsumeRequest_AckType) String() string {
+	return proto.EnumName(ConsumeRequest_AckType_name, int32(x))
+}
+
+func (ConsumeRequest_AckType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{18, 0}
+}
+
+// QueueMessage mirrors singu.QueueMessage, timestamps are in nanoseconds since Unix epoch (zero means unset).
+type QueueMessage struct {
+	Id                   string            `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Timestamp            int64             `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	QueueTimestamp       int64             `protobuf:"varint,3,opt,name=queue_timestamp,json=queueTimestamp,proto3" json:"queue_timestamp,omitempty"`
+	TakenTimestamp       int64             `protobuf:"varint,4,opt,name=taken_timestamp,json=takenTimestamp,proto3" json:"taken_timestamp,omitempty"`
+	NumRequeues          int32             `protobuf:"varint,5,opt,name=num_requeues,json=numRequeues,proto3" json:"num_requeues,omitempty"`
+	Payload              []byte            `protobuf:"bytes,6,opt,name=payload,proto3" json:"payload,omitempty"`
+	Metadata             map[string]string `protobuf:"bytes,7,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *QueueMessage) Reset()         { *m = QueueMessage{} }
+func (m *QueueMessage) String() string { return proto.CompactTextString(m) }
+func (*QueueMessage) ProtoMessage()    {}
+func (*QueueMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{0}
+}
+
+func (m *QueueMessage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueueMessage.Unmarshal(m, b)
+}
+func (m *QueueMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueueMessage.Marshal(b, m, deterministic)
+}
+func (m *QueueMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueueMessage.Merge(m, src)
+}
+func (m *QueueMessage) XXX_Size() int {
+	return xxx_messageInfo_QueueMessage.Size(m)
+}
+func (m *QueueMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueueMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueueMessage proto.InternalMessageInfo
+
+func (m *QueueMessage) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *QueueMessage) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *QueueMessage) GetQueueTimestamp() int64 {
+	if m != nil {
+		return m.QueueTimestamp
+	}
+	return 0
+}
+
+func (m *QueueMessage) GetTakenTimestamp() int64 {
+	if m != nil {
+		return m.TakenTimestamp
+	}
+	return 0
+}
+
+func (m *QueueMessage) GetNumRequeues() int32 {
+	if m != nil {
+		return m.NumRequeues
+	}
+	return 0
+}
+
+func (m *QueueMessage) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *QueueMessage) GetMetadata() map[string]string {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+type Empty struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+func (*Empty) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{1}
+}
+
+func (m *Empty) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Empty.Unmarshal(m, b)
+}
+func (m *Empty) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Empty.Marshal(b, m, deterministic)
+}
+func (m *Empty) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Empty.Merge(m, src)
+}
+func (m *Empty) XXX_Size() int {
+	return xxx_messageInfo_Empty.Size(m)
+}
+func (m *Empty) XXX_DiscardUnknown() {
+	xxx_messageInfo_Empty.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Empty proto.InternalMessageInfo
+
+type QueueRequest struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *QueueRequest) Reset()         { *m = QueueRequest{} }
+func (m *QueueRequest) String() string { return proto.CompactTextString(m) }
+func (*QueueRequest) ProtoMessage()    {}
+func (*QueueRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{2}
+}
+
+func (m *QueueRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueueRequest.Unmarshal(m, b)
+}
+func (m *QueueRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueueRequest.Marshal(b, m, deterministic)
+}
+func (m *QueueRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueueRequest.Merge(m, src)
+}
+func (m *QueueRequest) XXX_Size() int {
+	return xxx_messageInfo_QueueRequest.Size(m)
+}
+func (m *QueueRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueueRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueueRequest proto.InternalMessageInfo
+
+func (m *QueueRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+type QueueInfo struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	QueueSize            int32    `protobuf:"varint,2,opt,name=queue_size,json=queueSize,proto3" json:"queue_size,omitempty"`
+	EphemeralSize        int32    `protobuf:"varint,3,opt,name=ephemeral_size,json=ephemeralSize,proto3" json:"ephemeral_size,omitempty"`
+	QueueCapacity        int32    `protobuf:"varint,4,opt,name=queue_capacity,json=queueCapacity,proto3" json:"queue_capacity,omitempty"`
+	EphemeralCapacity    int32    `protobuf:"varint,5,opt,name=ephemeral_capacity,json=ephemeralCapacity,proto3" json:"ephemeral_capacity,omitempty"`
+	EphemeralEnabled     bool     `protobuf:"varint,6,opt,name=ephemeral_enabled,json=ephemeralEnabled,proto3" json:"ephemeral_enabled,omitempty"`
+	Paused               bool     `protobuf:"varint,7,opt,name=paused,proto3" json:"paused,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *QueueInfo) Reset()         { *m = QueueInfo{} }
+func (m *QueueInfo) String() string { return proto.CompactTextString(m) }
+func (*QueueInfo) ProtoMessage()    {}
+func (*QueueInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{3}
+}
+
+func (m *QueueInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueueInfo.Unmarshal(m, b)
+}
+func (m *QueueInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueueInfo.Marshal(b, m, deterministic)
+}
+func (m *QueueInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueueInfo.Merge(m, src)
+}
+func (m *QueueInfo) XXX_Size() int {
+	return xxx_messageInfo_QueueInfo.Size(m)
+}
+func (m *QueueInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueueInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueueInfo proto.InternalMessageInfo
+
+func (m *QueueInfo) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *QueueInfo) GetQueueSize() int32 {
+	if m != nil {
+		return m.QueueSize
+	}
+	return 0
+}
+
+func (m *QueueInfo) GetEphemeralSize() int32 {
+	if m != nil {
+		return m.EphemeralSize
+	}
+	return 0
+}
+
+func (m *QueueInfo) GetQueueCapacity() int32 {
+	if m != nil {
+		return m.QueueCapacity
+	}
+	return 0
+}
+
+func (m *QueueInfo) GetEphemeralCapacity() int32 {
+	if m != nil {
+		return m.EphemeralCapacity
+	}
+	return 0
+}
+
+func (m *QueueInfo) GetEphemeralEnabled() bool {
+	if m != nil {
+		return m.EphemeralEnabled
+	}
+	return false
+}
+
+func (m *QueueInfo) GetPaused() bool {
+	if m != nil {
+		return m.Paused
+	}
+	return false
+}
+
+type QueueMessageRequest struct {
+	Queue                string        `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	Message              *QueueMessage `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *QueueMessageRequest) Reset()         { *m = QueueMessageRequest{} }
+func (m *QueueMessageRequest) String() string { return proto.CompactTextString(m) }
+func (*QueueMessageRequest) ProtoMessage()    {}
+func (*QueueMessageRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{4}
+}
+
+func (m *QueueMessageRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueueMessageRequest.Unmarshal(m, b)
+}
+func (m *QueueMessageRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueueMessageRequest.Marshal(b, m, deterministic)
+}
+func (m *QueueMessageRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueueMessageRequest.Merge(m, src)
+}
+func (m *QueueMessageRequest) XXX_Size() int {
+	return xxx_messageInfo_QueueMessageRequest.Size(m)
+}
+func (m *QueueMessageRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueueMessageRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueueMessageRequest proto.InternalMessageInfo
+
+func (m *QueueMessageRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *QueueMessageRequest) GetMessage() *QueueMessage {
+	if m != nil {
+		return m.Message
+	}
+	return nil
+}
+
+type QueueMessageResponse struct {
+	Message              *QueueMessage `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *QueueMessageResponse) Reset()         { *m = QueueMessageResponse{} }
+func (m *QueueMessageResponse) String() string { return proto.CompactTextString(m) }
+func (*QueueMessageResponse) ProtoMessage()    {}
+func (*QueueMessageResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{5}
+}
+
+func (m *QueueMessageResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueueMessageResponse.Unmarshal(m, b)
+}
+func (m *QueueMessageResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueueMessageResponse.Marshal(b, m, deterministic)
+}
+func (m *QueueMessageResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueueMessageResponse.Merge(m, src)
+}
+func (m *QueueMessageResponse) XXX_Size() int {
+	return xxx_messageInfo_QueueMessageResponse.Size(m)
+}
+func (m *QueueMessageResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueueMessageResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueueMessageResponse proto.InternalMessageInfo
+
+func (m *QueueMessageResponse) GetMessage() *QueueMessage {
+	if m != nil {
+		return m.Message
+	}
+	return nil
+}
+
+type QueueMessageList struct {
+	Messages             []*QueueMessage `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *QueueMessageList) Reset()         { *m = QueueMessageList{} }
+func (m *QueueMessageList) String() string { return proto.CompactTextString(m) }
+func (*QueueMessageList) ProtoMessage()    {}
+func (*QueueMessageList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{6}
+}
+
+func (m *QueueMessageList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueueMessageList.Unmarshal(m, b)
+}
+func (m *QueueMessageList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueueMessageList.Marshal(b, m, deterministic)
+}
+func (m *QueueMessageList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueueMessageList.Merge(m, src)
+}
+func (m *QueueMessageList) XXX_Size() int {
+	return xxx_messageInfo_QueueMessageList.Size(m)
+}
+func (m *QueueMessageList) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueueMessageList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueueMessageList proto.InternalMessageInfo
+
+func (m *QueueMessageList) GetMessages() []*QueueMessage {
+	if m != nil {
+		return m.Messages
+	}
+	return nil
+}
+
+type IdRequest struct {
+	Queue                string      `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	Storage              StorageType `protobuf:"varint,2,opt,name=storage,proto3,enum=singu.StorageType" json:"storage,omitempty"`
+	Id                   string      `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *IdRequest) Reset()         { *m = IdRequest{} }
+func (m *IdRequest) String() string { return proto.CompactTextString(m) }
+func (*IdRequest) ProtoMessage()    {}
+func (*IdRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{7}
+}
+
+func (m *IdRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IdRequest.Unmarshal(m, b)
+}
+func (m *IdRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IdRequest.Marshal(b, m, deterministic)
+}
+func (m *IdRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IdRequest.Merge(m, src)
+}
+func (m *IdRequest) XXX_Size() int {
+	return xxx_messageInfo_IdRequest.Size(m)
+}
+func (m *IdRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_IdRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IdRequest proto.InternalMessageInfo
+
+func (m *IdRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *IdRequest) GetStorage() StorageType {
+	if m != nil {
+		return m.Storage
+	}
+	return StorageType_QUEUE
+}
+
+func (m *IdRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type RequeueRequest struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	Id                   string   `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Silent               bool     `protobuf:"varint,3,opt,name=silent,proto3" json:"silent,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RequeueRequest) Reset()         { *m = RequeueRequest{} }
+func (m *RequeueRequest) String() string { return proto.CompactTextString(m) }
+func (*RequeueRequest) ProtoMessage()    {}
+func (*RequeueRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{8}
+}
+
+func (m *RequeueRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RequeueRequest.Unmarshal(m, b)
+}
+func (m *RequeueRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RequeueRequest.Marshal(b, m, deterministic)
+}
+func (m *RequeueRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RequeueRequest.Merge(m, src)
+}
+func (m *RequeueRequest) XXX_Size() int {
+	return xxx_messageInfo_RequeueRequest.Size(m)
+}
+func (m *RequeueRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RequeueRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RequeueRequest proto.InternalMessageInfo
+
+func (m *RequeueRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *RequeueRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *RequeueRequest) GetSilent() bool {
+	if m != nil {
+		return m.Silent
+	}
+	return false
+}
+
+type OrphanMessagesRequest struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	NumSeconds           int32    `protobuf:"varint,2,opt,name=num_seconds,json=numSeconds,proto3" json:"num_seconds,omitempty"`
+	NumMessages          int32    `protobuf:"varint,3,opt,name=num_messages,json=numMessages,proto3" json:"num_messages,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *OrphanMessagesRequest) Reset()         { *m = OrphanMessagesRequest{} }
+func (m *OrphanMessagesRequest) String() string { return proto.CompactTextString(m) }
+func (*OrphanMessagesRequest) ProtoMessage()    {}
+func (*OrphanMessagesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{9}
+}
+
+func (m *OrphanMessagesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_OrphanMessagesRequest.Unmarshal(m, b)
+}
+func (m *OrphanMessagesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_OrphanMessagesRequest.Marshal(b, m, deterministic)
+}
+func (m *OrphanMessagesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_OrphanMessagesRequest.Merge(m, src)
+}
+func (m *OrphanMessagesRequest) XXX_Size() int {
+	return xxx_messageInfo_OrphanMessagesRequest.Size(m)
+}
+func (m *OrphanMessagesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_OrphanMessagesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_OrphanMessagesRequest proto.InternalMessageInfo
+
+func (m *OrphanMessagesRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *OrphanMessagesRequest) GetNumSeconds() int32 {
+	if m != nil {
+		return m.NumSeconds
+	}
+	return 0
+}
+
+func (m *OrphanMessagesRequest) GetNumMessages() int32 {
+	if m != nil {
+		return m.NumMessages
+	}
+	return 0
+}
+
+type PeekRequest struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	NumMessages          int32    `protobuf:"varint,2,opt,name=num_messages,json=numMessages,proto3" json:"num_messages,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PeekRequest) Reset()         { *m = PeekRequest{} }
+func (m *PeekRequest) String() string { return proto.CompactTextString(m) }
+func (*PeekRequest) ProtoMessage()    {}
+func (*PeekRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{10}
+}
+
+func (m *PeekRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeekRequest.Unmarshal(m, b)
+}
+func (m *PeekRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeekRequest.Marshal(b, m, deterministic)
+}
+func (m *PeekRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeekRequest.Merge(m, src)
+}
+func (m *PeekRequest) XXX_Size() int {
+	return xxx_messageInfo_PeekRequest.Size(m)
+}
+func (m *PeekRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeekRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeekRequest proto.InternalMessageInfo
+
+func (m *PeekRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *PeekRequest) GetNumMessages() int32 {
+	if m != nil {
+		return m.NumMessages
+	}
+	return 0
+}
+
+type BrowseRequest struct {
+	Queue                string      `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	Storage              StorageType `protobuf:"varint,2,opt,name=storage,proto3,enum=singu.StorageType" json:"storage,omitempty"`
+	Cursor               string      `protobuf:"bytes,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	NumMessages          int32       `protobuf:"varint,4,opt,name=num_messages,json=numMessages,proto3" json:"num_messages,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *BrowseRequest) Reset()         { *m = BrowseRequest{} }
+func (m *BrowseRequest) String() string { return proto.CompactTextString(m) }
+func (*BrowseRequest) ProtoMessage()    {}
+func (*BrowseRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{11}
+}
+
+func (m *BrowseRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BrowseRequest.Unmarshal(m, b)
+}
+func (m *BrowseRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BrowseRequest.Marshal(b, m, deterministic)
+}
+func (m *BrowseRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BrowseRequest.Merge(m, src)
+}
+func (m *BrowseRequest) XXX_Size() int {
+	return xxx_messageInfo_BrowseRequest.Size(m)
+}
+func (m *BrowseRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BrowseRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BrowseRequest proto.InternalMessageInfo
+
+func (m *BrowseRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *BrowseRequest) GetStorage() StorageType {
+	if m != nil {
+		return m.Storage
+	}
+	return StorageType_QUEUE
+}
+
+func (m *BrowseRequest) GetCursor() string {
+	if m != nil {
+		return m.Cursor
+	}
+	return ""
+}
+
+func (m *BrowseRequest) GetNumMessages() int32 {
+	if m != nil {
+		return m.NumMessages
+	}
+	return 0
+}
+
+type BrowseResponse struct {
+	Messages             []*QueueMessage `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	Cursor               string          `protobuf:"bytes,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *BrowseResponse) Reset()         { *m = BrowseResponse{} }
+func (m *BrowseResponse) String() string { return proto.CompactTextString(m) }
+func (*BrowseResponse) ProtoMessage()    {}
+func (*BrowseResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{12}
+}
+
+func (m *BrowseResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BrowseResponse.Unmarshal(m, b)
+}
+func (m *BrowseResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BrowseResponse.Marshal(b, m, deterministic)
+}
+func (m *BrowseResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BrowseResponse.Merge(m, src)
+}
+func (m *BrowseResponse) XXX_Size() int {
+	return xxx_messageInfo_BrowseResponse.Size(m)
+}
+func (m *BrowseResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_BrowseResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BrowseResponse proto.InternalMessageInfo
+
+func (m *BrowseResponse) GetMessages() []*QueueMessage {
+	if m != nil {
+		return m.Messages
+	}
+	return nil
+}
+
+func (m *BrowseResponse) GetCursor() string {
+	if m != nil {
+		return m.Cursor
+	}
+	return ""
+}
+
+type UpdatePayloadRequest struct {
+	Queue                string      `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	Storage              StorageType `protobuf:"varint,2,opt,name=storage,proto3,enum=singu.StorageType" json:"storage,omitempty"`
+	Id                   string      `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	Payload              []byte      `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *UpdatePayloadRequest) Reset()         { *m = UpdatePayloadRequest{} }
+func (m *UpdatePayloadRequest) String() string { return proto.CompactTextString(m) }
+func (*UpdatePayloadRequest) ProtoMessage()    {}
+func (*UpdatePayloadRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{13}
+}
+
+func (m *UpdatePayloadRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UpdatePayloadRequest.Unmarshal(m, b)
+}
+func (m *UpdatePayloadRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UpdatePayloadRequest.Marshal(b, m, deterministic)
+}
+func (m *UpdatePayloadRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UpdatePayloadRequest.Merge(m, src)
+}
+func (m *UpdatePayloadRequest) XXX_Size() int {
+	return xxx_messageInfo_UpdatePayloadRequest.Size(m)
+}
+func (m *UpdatePayloadRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UpdatePayloadRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UpdatePayloadRequest proto.InternalMessageInfo
+
+func (m *UpdatePayloadRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *UpdatePayloadRequest) GetStorage() StorageType {
+	if m != nil {
+		return m.Storage
+	}
+	return StorageType_QUEUE
+}
+
+func (m *UpdatePayloadRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *UpdatePayloadRequest) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+type StorageRequest struct {
+	Queue                string      `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	Storage              StorageType `protobuf:"varint,2,opt,name=storage,proto3,enum=singu.StorageType" json:"storage,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *StorageRequest) Reset()         { *m = StorageRequest{} }
+func (m *StorageRequest) String() string { return proto.CompactTextString(m) }
+func (*StorageRequest) ProtoMessage()    {}
+func (*StorageRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{14}
+}
+
+func (m *StorageRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StorageRequest.Unmarshal(m, b)
+}
+func (m *StorageRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StorageRequest.Marshal(b, m, deterministic)
+}
+func (m *StorageRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StorageRequest.Merge(m, src)
+}
+func (m *StorageRequest) XXX_Size() int {
+	return xxx_messageInfo_StorageRequest.Size(m)
+}
+func (m *StorageRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_StorageRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StorageRequest proto.InternalMessageInfo
+
+func (m *StorageRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *StorageRequest) GetStorage() StorageType {
+	if m != nil {
+		return m.Storage
+	}
+	return StorageType_QUEUE
+}
+
+type RequeueAllRequest struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	Silent               bool     `protobuf:"varint,2,opt,name=silent,proto3" json:"silent,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RequeueAllRequest) Reset()         { *m = RequeueAllRequest{} }
+func (m *RequeueAllRequest) String() string { return proto.CompactTextString(m) }
+func (*RequeueAllRequest) ProtoMessage()    {}
+func (*RequeueAllRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{15}
+}
+
+func (m *RequeueAllRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RequeueAllRequest.Unmarshal(m, b)
+}
+func (m *RequeueAllRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RequeueAllRequest.Marshal(b, m, deterministic)
+}
+func (m *RequeueAllRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RequeueAllRequest.Merge(m, src)
+}
+func (m *RequeueAllRequest) XXX_Size() int {
+	return xxx_messageInfo_RequeueAllRequest.Size(m)
+}
+func (m *RequeueAllRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RequeueAllRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RequeueAllRequest proto.InternalMessageInfo
+
+func (m *RequeueAllRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *RequeueAllRequest) GetSilent() bool {
+	if m != nil {
+		return m.Silent
+	}
+	return false
+}
+
+type CountResponse struct {
+	Count                int32    `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CountResponse) Reset()         { *m = CountResponse{} }
+func (m *CountResponse) String() string { return proto.CompactTextString(m) }
+func (*CountResponse) ProtoMessage()    {}
+func (*CountResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{16}
+}
+
+func (m *CountResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CountResponse.Unmarshal(m, b)
+}
+func (m *CountResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CountResponse.Marshal(b, m, deterministic)
+}
+func (m *CountResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CountResponse.Merge(m, src)
+}
+func (m *CountResponse) XXX_Size() int {
+	return xxx_messageInfo_CountResponse.Size(m)
+}
+func (m *CountResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_CountResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CountResponse proto.InternalMessageInfo
+
+func (m *CountResponse) GetCount() int32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+type TakeStreamRequest struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TakeStreamRequest) Reset()         { *m = TakeStreamRequest{} }
+func (m *TakeStreamRequest) String() string { return proto.CompactTextString(m) }
+func (*TakeStreamRequest) ProtoMessage()    {}
+func (*TakeStreamRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{17}
+}
+
+func (m *TakeStreamRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TakeStreamRequest.Unmarshal(m, b)
+}
+func (m *TakeStreamRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TakeStreamRequest.Marshal(b, m, deterministic)
+}
+func (m *TakeStreamRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TakeStreamRequest.Merge(m, src)
+}
+func (m *TakeStreamRequest) XXX_Size() int {
+	return xxx_messageInfo_TakeStreamRequest.Size(m)
+}
+func (m *TakeStreamRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TakeStreamRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TakeStreamRequest proto.InternalMessageInfo
+
+func (m *TakeStreamRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+// ConsumeRequest is either a subscription (first request of the stream) or an acknowledgement.
+type ConsumeRequest struct {
+	// Types that are valid to be assigned to Request:
+	//	*ConsumeRequest_Subscribe
+	//	*ConsumeRequest_Ack_
+	Request              isConsumeRequest_Request `protobuf_oneof:"request"`
+	XXX_NoUnkeyedLiteral struct{}                 `json:"-"`
+	XXX_unrecognized     []byte                   `json:"-"`
+	XXX_sizecache        int32                    `json:"-"`
+}
+
+func (m *ConsumeRequest) Reset()         { *m = ConsumeRequest{} }
+func (m *ConsumeRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsumeRequest) ProtoMessage()    {}
+func (*ConsumeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{18}
+}
+
+func (m *ConsumeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ConsumeRequest.Unmarshal(m, b)
+}
+func (m *ConsumeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ConsumeRequest.Marshal(b, m, deterministic)
+}
+func (m *ConsumeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ConsumeRequest.Merge(m, src)
+}
+func (m *ConsumeRequest) XXX_Size() int {
+	return xxx_messageInfo_ConsumeRequest.Size(m)
+}
+func (m *ConsumeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ConsumeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ConsumeRequest proto.InternalMessageInfo
+
+type isConsumeRequest_Request interface {
+	isConsumeRequest_Request()
+}
+
+type ConsumeRequest_Subscribe struct {
+	Subscribe *ConsumeRequest_Subscription `protobuf:"bytes,1,opt,name=subscribe,proto3,oneof"`
+}
+
+type ConsumeRequest_Ack_ struct {
+	Ack *ConsumeRequest_Ack `protobuf:"bytes,2,opt,name=ack,proto3,oneof"`
+}
+
+func (*ConsumeRequest_Subscribe) isConsumeRequest_Request() {}
+
+func (*ConsumeRequest_Ack_) isConsumeRequest_Request() {}
+
+func (m *ConsumeRequest) GetRequest() isConsumeRequest_Request {
+	if m != nil {
+		return m.Request
+	}
+	return nil
+}
+
+func (m *ConsumeRequest) GetSubscribe() *ConsumeRequest_Subscription {
+	if x, ok := m.GetRequest().(*ConsumeRequest_Subscribe); ok {
+		return x.Subscribe
+	}
+	return nil
+}
+
+func (m *ConsumeRequest) GetAck() *ConsumeRequest_Ack {
+	if x, ok := m.GetRequest().(*ConsumeRequest_Ack_); ok {
+		return x.Ack
+	}
+	return nil
+}
+
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*ConsumeRequest) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*ConsumeRequest_Subscribe)(nil),
+		(*ConsumeRequest_Ack_)(nil),
+	}
+}
+
+type ConsumeRequest_Subscription struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	MaxInFlight          int32    `protobuf:"varint,2,opt,name=max_in_flight,json=maxInFlight,proto3" json:"max_in_flight,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ConsumeRequest_Subscription) Reset()         { *m = ConsumeRequest_Subscription{} }
+func (m *ConsumeRequest_Subscription) String() string { return proto.CompactTextString(m) }
+func (*ConsumeRequest_Subscription) ProtoMessage()    {}
+func (*ConsumeRequest_Subscription) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{18, 0}
+}
+
+func (m *ConsumeRequest_Subscription) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ConsumeRequest_Subscription.Unmarshal(m, b)
+}
+func (m *ConsumeRequest_Subscription) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ConsumeRequest_Subscription.Marshal(b, m, deterministic)
+}
+func (m *ConsumeRequest_Subscription) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ConsumeRequest_Subscription.Merge(m, src)
+}
+func (m *ConsumeRequest_Subscription) XXX_Size() int {
+	return xxx_messageInfo_ConsumeRequest_Subscription.Size(m)
+}
+func (m *ConsumeRequest_Subscription) XXX_DiscardUnknown() {
+	xxx_messageInfo_ConsumeRequest_Subscription.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ConsumeRequest_Subscription proto.InternalMessageInfo
+
+func (m *ConsumeRequest_Subscription) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *ConsumeRequest_Subscription) GetMaxInFlight() int32 {
+	if m != nil {
+		return m.MaxInFlight
+	}
+	return 0
+}
+
+type ConsumeRequest_Ack struct {
+	Id                   string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type                 ConsumeRequest_AckType `protobuf:"varint,2,opt,name=type,proto3,enum=singu.ConsumeRequest_AckType" json:"type,omitempty"`
+	Silent               bool                   `protobuf:"varint,3,opt,name=silent,proto3" json:"silent,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
+
+func (m *ConsumeRequest_Ack) Reset()         { *m = ConsumeRequest_Ack{} }
+func (m *ConsumeRequest_Ack) String() string { return proto.CompactTextString(m) }
+func (*ConsumeRequest_Ack) ProtoMessage()    {}
+func (*ConsumeRequest_Ack) Descriptor() ([]byte, []int) {
+	return fileDescriptor_49e170f3febb0638, []int{18, 1}
+}
+
+func (m *ConsumeRequest_Ack) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ConsumeRequest_Ack.Unmarshal(m, b)
+}
+func (m *ConsumeRequest_Ack) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ConsumeRequest_Ack.Marshal(b, m, deterministic)
+}
+func (m *ConsumeRequest_Ack) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ConsumeRequest_Ack.Merge(m, src)
+}
+func (m *ConsumeRequest_Ack) XXX_Size() int {
+	return xxx_messageInfo_ConsumeRequest_Ack.Size(m)
+}
+func (m *ConsumeRequest_Ack) XXX_DiscardUnknown() {
+	xxx_messageInfo_ConsumeRequest_Ack.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ConsumeRequest_Ack proto.InternalMessageInfo
+
+func (m *ConsumeRequest_Ack) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ConsumeRequest_Ack) GetType() ConsumeRequest_AckType {
+	if m != nil {
+		return m.Type
+	}
+	return ConsumeRequest_FINISH
+}
+
+func (m *ConsumeRequest_Ack) GetSilent() bool {
+	if m != nil {
+		return m.Silent
+	}
+	return false
+}
+
+func init() {
+	proto.RegisterEnum("singu.StorageType", StorageType_name, StorageType_value)
+	proto.RegisterEnum("singu.ConsumeRequest_AckType", ConsumeRequest_AckType_name, ConsumeRequest_AckType_value)
+	proto.RegisterType((*QueueMessage)(nil), "singu.QueueMessage")
+	proto.RegisterMapType((map[string]string)(nil), "singu.QueueMessage.MetadataEntry")
+	proto.RegisterType((*Empty)(nil), "singu.Empty")
+	proto.RegisterType((*QueueRequest)(nil), "singu.QueueRequest")
+	proto.RegisterType((*QueueInfo)(nil), "singu.QueueInfo")
+	proto.RegisterType((*QueueMessageRequest)(nil), "singu.QueueMessageRequest")
+	proto.RegisterType((*QueueMessageResponse)(nil), "singu.QueueMessageResponse")
+	proto.RegisterType((*QueueMessageList)(nil), "singu.QueueMessageList")
+	proto.RegisterType((*IdRequest)(nil), "singu.IdRequest")
+	proto.RegisterType((*RequeueRequest)(nil), "singu.RequeueRequest")
+	proto.RegisterType((*OrphanMessagesRequest)(nil), "singu.OrphanMessagesRequest")
+	proto.RegisterType((*PeekRequest)(nil), "singu.PeekRequest")
+	proto.RegisterType((*BrowseRequest)(nil), "singu.BrowseRequest")
+	proto.RegisterType((*BrowseResponse)(nil), "singu.BrowseResponse")
+	proto.RegisterType((*UpdatePayloadRequest)(nil), "singu.UpdatePayloadRequest")
+	proto.RegisterType((*StorageRequest)(nil), "singu.StorageRequest")
+	proto.RegisterType((*RequeueAllRequest)(nil), "singu.RequeueAllRequest")
+	proto.RegisterType((*CountResponse)(nil), "singu.CountResponse")
+	proto.RegisterType((*TakeStreamRequest)(nil), "singu.TakeStreamRequest")
+	proto.RegisterType((*ConsumeRequest)(nil), "singu.ConsumeRequest")
+	proto.RegisterType((*ConsumeRequest_Subscription)(nil), "singu.ConsumeRequest.Subscription")
+	proto.RegisterType((*ConsumeRequest_Ack)(nil), "singu.ConsumeRequest.Ack")
+}
+
+func init() { proto.RegisterFile("singu.proto", fileDescriptor_49e170f3febb0638) }
+
+var fileDescriptor_49e170f3febb0638 = []byte{
+	// 1128 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x57, 0xcd, 0x6e, 0xdb, 0x46,
+	0x10, 0x36, 0x29, 0x51, 0xb4, 0x46, 0x96, 0x2a, 0xaf, 0x65, 0x57, 0x55, 0x13, 0x54, 0x61, 0x6b,
+	0x44, 0x4d, 0x6a, 0x3b, 0x75, 0x5a, 0x20, 0xad, 0x61, 0xa0, 0xb6, 0x41, 0xc7, 0x02, 0xe2, 0xd4,
+	0xa6, 0xec, 0x43, 0x73, 0x51, 0x57, 0xd4, 0x46, 0x26, 0x24, 0xfe, 0x84, 0xbb, 0x4c, 0xa3, 0x9c,
+	0x7a, 0xe8, 0xb9, 0xaf, 0xd5, 0xb7, 0xe8, 0xa1, 0x4f, 0x52, 0x68, 0xb9, 0xfc, 0x8b, 0x29, 0x22,
+	0x2d, 0x92, 0x9b, 0x76, 0xf6, 0x9b, 0x6f, 0x66, 0x67, 0x67, 0xbe, 0xa5, 0xa0, 0x46, 0x2d, 0x67,
+	0x12, 0xec, 0x7a, 0xbe, 0xcb, 0x5c, 0xa4, 0xf0, 0x85, 0xf6, 0x97, 0x0c, 0x6b, 0x97, 0x01, 0x09,
+	0xc8, 0x39, 0xa1, 0x14, 0x4f, 0x08, 0x6a, 0x80, 0x6c, 0x8d, 0xdb, 0x52, 0x57, 0xea, 0x55, 0x0d,
+	0xd9, 0x1a, 0xa3, 0x3b, 0x50, 0x65, 0x96, 0x4d, 0x28, 0xc3, 0xb6, 0xd7, 0x96, 0xbb, 0x52, 0xaf,
+	0x64, 0x24, 0x06, 0x74, 0x1f, 0x3e, 0x79, 0xb5, 0xf0, 0x1e, 0x26, 0x98, 0x12, 0xc7, 0x34, 0xb8,
+	0xf9, 0x2a, 0x0d, 0x64, 0x78, 0x4a, 0x9c, 0x14, 0xb0, 0x1c, 0x02, 0xb9, 0x39, 0x01, 0xde, 0x83,
+	0x35, 0x27, 0xb0, 0x87, 0x3e, 0xe1, 0x04, 0xb4, 0xad, 0x74, 0xa5, 0x9e, 0x62, 0xd4, 0x9c, 0xc0,
+	0x36, 0x84, 0x09, 0xb5, 0x41, 0xf5, 0xf0, 0x7c, 0xe6, 0xe2, 0x71, 0xbb, 0xd2, 0x95, 0x7a, 0x6b,
+	0x46, 0xb4, 0x44, 0x87, 0xb0, 0x6a, 0x13, 0x86, 0xc7, 0x98, 0xe1, 0xb6, 0xda, 0x2d, 0xf5, 0x6a,
+	0xfb, 0xf7, 0x76, 0xc3, 0x43, 0xa7, 0xcf, 0xb8, 0x7b, 0x2e, 0x30, 0xba, 0xc3, 0xfc, 0xb9, 0x11,
+	0xbb, 0x74, 0x0e, 0xa0, 0x9e, 0xd9, 0x42, 0x4d, 0x28, 0x4d, 0xc9, 0x5c, 0x54, 0x63, 0xf1, 0x13,
+	0xb5, 0x40, 0x79, 0x8d, 0x67, 0x01, 0xe1, 0xa5, 0xa8, 0x1a, 0xe1, 0xe2, 0x47, 0xf9, 0x89, 0xa4,
+	0xa9, 0xa0, 0xe8, 0xb6, 0xc7, 0xe6, 0xda, 0x57, 0xa2, 0xa2, 0x3c, 0x5f, 0xca, 0x16, 0x2e, 0x3c,
+	0x71, 0x41, 0x13, 0x2e, 0xb4, 0xdf, 0x65, 0xa8, 0x72, 0x58, 0xdf, 0x79, 0xe9, 0x22, 0x04, 0x65,
+	0x07, 0xdb, 0x11, 0x84, 0xff, 0x46, 0x77, 0x01, 0xc2, 0xda, 0x52, 0xeb, 0x6d, 0x18, 0x4f, 0x31,
+	0xaa, 0xdc, 0x32, 0xb0, 0xde, 0x12, 0xb4, 0x0d, 0x0d, 0xe2, 0xdd, 0x10, 0x9b, 0xf8, 0x78, 0x16,
+	0x42, 0x4a, 0x1c, 0x52, 0x8f, 0xad, 0x11, 0x2c, 0x64, 0x31, 0xb1, 0x87, 0x4d, 0x8b, 0xcd, 0x79,
+	0xdd, 0x15, 0xa3, 0xce, 0xad, 0x27, 0xc2, 0x88, 0x76, 0x00, 0x25, 0x6c, 0x31, 0x34, 0x2c, 0xfe,
+	0x7a, 0xbc, 0x13, 0xc3, 0x1f, 0x42, 0x62, 0x1c, 0x12, 0x07, 0x8f, 0x66, 0x24, 0xbc, 0x8c, 0x55,
+	0xa3, 0x19, 0x6f, 0xe8, 0xa1, 0x1d, 0x6d, 0x41, 0xc5, 0xc3, 0x01, 0x25, 0xe3, 0xb6, 0xca, 0x11,
+	0x62, 0xa5, 0xbd, 0x80, 0x8d, 0xf4, 0xb5, 0x14, 0xd6, 0x0b, 0xed, 0x80, 0x6a, 0x87, 0x38, 0x5e,
+	0x8a, 0xda, 0xfe, 0x46, 0xce, 0xcd, 0x1a, 0x11, 0x46, 0xd3, 0xa1, 0x95, 0xe5, 0xa6, 0x9e, 0xeb,
+	0xd0, 0x0c, 0x8d, 0xf4, 0x1e, 0x34, 0x27, 0xd0, 0x4c, 0x6f, 0x3c, 0xb3, 0x28, 0x43, 0x7b, 0x8b,
+	0x26, 0xe3, 0x4b, 0xda, 0x96, 0xba, 0xa5, 0x65, 0x1c, 0x31, 0x48, 0x1b, 0x42, 0xb5, 0x3f, 0x2e,
+	0x3e, 0xdd, 0x37, 0xa0, 0x52, 0xe6, 0xfa, 0xd1, 0xe9, 0x1a, 0xfb, 0x48, 0x50, 0x0e, 0x42, 0xeb,
+	0xd5, 0xdc, 0x23, 0x46, 0x04, 0x11, 0x33, 0x5a, 0x8a, 0x66, 0x54, 0x7b, 0x0e, 0x0d, 0x31, 0x1c,
+	0xc5, 0x51, 0x42, 0x3f, 0x39, 0x9e, 0xed, 0x2d, 0xa8, 0x50, 0x6b, 0x46, 0x1c, 0xc6, 0xb9, 0x56,
+	0x0d, 0xb1, 0xd2, 0x5e, 0xc1, 0xe6, 0xcf, 0xbe, 0x77, 0x83, 0x1d, 0x71, 0x16, 0x5a, 0x4c, 0xfb,
+	0x05, 0x2c, 0xc6, 0x73, 0x48, 0x89, 0xe9, 0x3a, 0x63, 0x2a, 0x3a, 0x15, 0x9c, 0xc0, 0x1e, 0x84,
+	0x96, 0x68, 0xa6, 0xe3, 0xaa, 0x95, 0xe2, 0x99, 0x8e, 0x02, 0x68, 0xa7, 0x50, 0xbb, 0x20, 0x64,
+	0x5a, 0x1c, 0xe8, 0x5d, 0x1e, 0xf9, 0x36, 0xcf, 0x9f, 0x12, 0xd4, 0x8f, 0x7d, 0xf7, 0x37, 0x4a,
+	0x3e, 0x64, 0xc1, 0xb7, 0xa0, 0x62, 0x06, 0x3e, 0x75, 0x7d, 0x51, 0x74, 0xb1, 0xba, 0x95, 0x50,
+	0xf9, 0x76, 0x42, 0xbf, 0x40, 0x23, 0xca, 0x47, 0xb4, 0xe0, 0x7f, 0xed, 0x9f, 0x54, 0x74, 0x39,
+	0x1d, 0x5d, 0xfb, 0x43, 0x82, 0xd6, 0xb5, 0x37, 0xc6, 0x8c, 0x5c, 0x84, 0xfa, 0xf7, 0x11, 0x7b,
+	0x2c, 0x2d, 0xba, 0xe5, 0x8c, 0xe8, 0x6a, 0x57, 0xd0, 0x10, 0x0c, 0x1f, 0x30, 0xbe, 0x76, 0x04,
+	0xeb, 0xa2, 0xa7, 0x8f, 0x66, 0xb3, 0x62, 0xe2, 0xa4, 0x8d, 0xe5, 0x4c, 0x1b, 0x6f, 0x43, 0xfd,
+	0xc4, 0x0d, 0x1c, 0x16, 0x57, 0xbe, 0x05, 0x8a, 0xb9, 0x30, 0x70, 0x77, 0xc5, 0x08, 0x17, 0xda,
+	0xd7, 0xb0, 0x7e, 0x85, 0xa7, 0x64, 0xc0, 0x7c, 0x82, 0xed, 0x62, 0xd1, 0xfe, 0x5b, 0x86, 0xc6,
+	0x89, 0xeb, 0xd0, 0xc0, 0x8e, 0xcf, 0x7a, 0x0c, 0x55, 0x1a, 0x8c, 0xa8, 0xe9, 0x5b, 0xa3, 0x48,
+	0x52, 0x34, 0x71, 0xae, 0x2c, 0x72, 0x77, 0x10, 0xc2, 0x3c, 0x66, 0xb9, 0xce, 0xd9, 0x8a, 0x91,
+	0xb8, 0xa1, 0x1d, 0x28, 0x61, 0x73, 0x2a, 0x74, 0xed, 0xb3, 0x7c, 0xef, 0x23, 0x73, 0x7a, 0xb6,
+	0x62, 0x2c, 0x70, 0x9d, 0x33, 0x58, 0x4b, 0x73, 0x2d, 0xa9, 0x8a, 0x06, 0x75, 0x1b, 0xbf, 0x19,
+	0x5a, 0xce, 0xf0, 0xe5, 0xcc, 0x9a, 0xdc, 0xb0, 0x68, 0x5a, 0x6c, 0xfc, 0xa6, 0xef, 0x9c, 0x72,
+	0x53, 0xe7, 0x57, 0x28, 0x1d, 0x99, 0xd3, 0x5b, 0x6f, 0xfe, 0xb7, 0x50, 0x66, 0x73, 0x2f, 0xba,
+	0xa6, 0xbb, 0x4b, 0x13, 0xe2, 0x37, 0xc6, 0xa1, 0x4b, 0xa5, 0x44, 0x03, 0x55, 0x00, 0x11, 0x40,
+	0xe5, 0xb4, 0xff, 0xbc, 0x3f, 0x38, 0x6b, 0xae, 0xa0, 0x1a, 0xa8, 0x86, 0x7e, 0x79, 0xad, 0x5f,
+	0xeb, 0x4d, 0xe9, 0xb8, 0x0a, 0xaa, 0x1f, 0x92, 0x3e, 0xb8, 0x0f, 0xb5, 0x54, 0x37, 0xa0, 0x2a,
+	0x28, 0x21, 0x68, 0x05, 0xd5, 0xa1, 0xaa, 0x5f, 0x9c, 0xe9, 0xe7, 0xba, 0x71, 0xf4, 0xac, 0x29,
+	0xed, 0xff, 0xa3, 0x82, 0x72, 0x29, 0x1e, 0x86, 0x32, 0x7f, 0x42, 0x33, 0x43, 0x24, 0x92, 0xec,
+	0x34, 0xd3, 0x46, 0x0e, 0xfb, 0x29, 0xf2, 0xeb, 0xe4, 0x0d, 0x9d, 0x70, 0xfb, 0x3c, 0x77, 0x4f,
+	0x74, 0xd1, 0x13, 0x28, 0x2f, 0xfa, 0x25, 0x3f, 0x60, 0xa1, 0x67, 0x0f, 0x2a, 0xa7, 0x96, 0x63,
+	0xd1, 0x1b, 0x14, 0xe5, 0x15, 0xbf, 0x0b, 0x9d, 0x35, 0x61, 0xe1, 0xdf, 0x10, 0xe8, 0x10, 0x54,
+	0xd1, 0xfd, 0x68, 0x53, 0x6c, 0x64, 0x15, 0xbe, 0x38, 0xd0, 0x53, 0x68, 0x64, 0x05, 0x1c, 0xdd,
+	0x11, 0xf0, 0x5c, 0x5d, 0xef, 0x7c, 0x9a, 0x43, 0xc6, 0xdf, 0xba, 0xc7, 0x50, 0x5e, 0xc8, 0x32,
+	0x8a, 0x46, 0x35, 0xa5, 0xd1, 0xcb, 0x9d, 0xbe, 0x87, 0x4a, 0x28, 0x79, 0xa8, 0x25, 0x20, 0x19,
+	0x45, 0xee, 0x6c, 0xbe, 0x63, 0x8d, 0xeb, 0xaa, 0x3e, 0x25, 0xec, 0x78, 0xde, 0x1f, 0xe7, 0x94,
+	0xa7, 0xf0, 0xb8, 0x07, 0x00, 0x06, 0xb1, 0xdd, 0xd7, 0xe4, 0xff, 0x38, 0xf7, 0xa1, 0x9e, 0x11,
+	0x51, 0x14, 0xa1, 0xf3, 0xa4, 0xb5, 0x98, 0xea, 0x3b, 0x50, 0x2e, 0x02, 0x7f, 0x92, 0xdc, 0x59,
+	0x56, 0x17, 0x3b, 0xad, 0x78, 0x92, 0xd2, 0xaa, 0xa4, 0xc3, 0x46, 0xa2, 0x74, 0x7a, 0xf4, 0xf1,
+	0x84, 0xda, 0xd9, 0x7b, 0x4f, 0x54, 0x70, 0x09, 0xcd, 0x03, 0x50, 0x2e, 0x70, 0x40, 0x97, 0xf4,
+	0x65, 0xb6, 0xbd, 0x1e, 0x42, 0xc5, 0x20, 0x8b, 0x61, 0x7e, 0x1f, 0xf0, 0x21, 0x40, 0xa2, 0x8f,
+	0x71, 0x5a, 0xb7, 0x24, 0xb3, 0x93, 0xf7, 0x8a, 0x3d, 0x92, 0xd0, 0x0f, 0xa0, 0x0a, 0xe5, 0x88,
+	0xcb, 0x92, 0x55, 0x92, 0x5c, 0xc7, 0x9e, 0xf4, 0x48, 0x3a, 0xde, 0x7e, 0xf1, 0xe5, 0xc4, 0x62,
+	0x37, 0xc1, 0x68, 0xd7, 0x74, 0xed, 0xbd, 0x11, 0x73, 0x26, 0xc1, 0x9c, 0x38, 0xfb, 0xd3, 0x3d,
+	0x8e, 0xdf, 0xf3, 0x3d, 0xf3, 0xc0, 0xf7, 0xcc, 0x51, 0x85, 0xff, 0xa3, 0x79, 0xfc, 0xef, 0x00,
+	0x15, 0x9f, 0x52, 0x22, 0xe0, 0x0c, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// QueueClient is the client API for Queue service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type QueueClient interface {
+	// Info returns sizes, capacities and paused state of a queue.
+	Info(ctx context.Context, in *QueueRequest, opts ...grpc.CallOption) (*QueueInfo, error)
+	// Queue mirrors IQueue.Queue.
+	Queue(ctx context.Context, in *QueueMessageRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error)
+	// Take mirrors IQueue.Take. Response's message is absent if queue storage is empty.
+	Take(ctx context.Context, in *QueueRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error)
+	// Finish mirrors IQueue.Finish.
+	Finish(ctx context.Context, in *IdRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Requeue mirrors IQueue.Requeue. Response's message is absent if there is no such message in ephemeral storage.
+	Requeue(ctx context.Context, in *RequeueRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error)
+	// OrphanMessages mirrors IQueue.OrphanMessages.
+	OrphanMessages(ctx context.Context, in *OrphanMessagesRequest, opts ...grpc.CallOption) (*QueueMessageList, error)
+	// Peek mirrors IQueue.Peek.
+	Peek(ctx context.Context, in *PeekRequest, opts ...grpc.CallOption) (*QueueMessageList, error)
+	// Browse mirrors IQueue.Browse.
+	Browse(ctx context.Context, in *BrowseRequest, opts ...grpc.CallOption) (*BrowseResponse, error)
+	// GetById mirrors IQueue.GetById.
+	GetById(ctx context.Context, in *IdRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error)
+	// RemoveById mirrors IQueue.RemoveById.
+	RemoveById(ctx context.Context, in *IdRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error)
+	// UpdatePayload mirrors IQueue.UpdatePayload.
+	UpdatePayload(ctx context.Context, in *UpdatePayloadRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error)
+	// Purge mirrors IQueue.PurgeQueueStorage and IQueue.PurgeEphemeralStorage.
+	Purge(ctx context.Context, in *StorageRequest, opts ...grpc.CallOption) (*CountResponse, error)
+	// RequeueAllEphemeral mirrors IQueue.RequeueAllEphemeral.
+	RequeueAllEphemeral(ctx context.Context, in *RequeueAllRequest, opts ...grpc.CallOption) (*CountResponse, error)
+	// Pause mirrors IQueue.Pause.
+	Pause(ctx context.Context, in *QueueRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Resume mirrors IQueue.Resume.
+	Resume(ctx context.Context, in *QueueRequest, opts ...grpc.CallOption) (*Empty, error)
+	// TakeStream takes messages continuously and pushes them to the client as they become available.
+	// Sending is subject to gRPC flow control: a slow client slows down taking.
+	// Delivery is at-most-once: messages are finished as soon as they are sent, use Consume for acknowledged delivery.
+	TakeStream(ctx context.Context, in *TakeStreamRequest, opts ...grpc.CallOption) (Queue_TakeStreamClient, error)
+	// Consume is the bidirectional variant of TakeStream: the client first sends a subscription, then acknowledges
+	// received messages on the same stream. At most max_in_flight messages are left unacknowledged at any time.
+	// Unacknowledged messages are re-queued (silently) when the stream ends.
+	Consume(ctx context.Context, opts ...grpc.CallOption) (Queue_ConsumeClient, error)
+}
+
+type queueClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewQueueClient(cc grpc.ClientConnInterface) QueueClient {
+	return &queueClient{cc}
+}
+
+func (c *queueClient) Info(ctx context.Context, in *QueueRequest, opts ...grpc.CallOption) (*QueueInfo, error) {
+	out := new(QueueInfo)
+	err := c.cc.Invoke(ctx, "/singu.Queue/Info", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Queue(ctx context.Context, in *QueueMessageRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error) {
+	out := new(QueueMessageResponse)
+	err := c.cc.Invoke(ctx, "/singu.Queue/Queue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Take(ctx context.Context, in *QueueRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error) {
+	out := new(QueueMessageResponse)
+	err := c.cc.Invoke(ctx, "/singu.Queue/Take", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Finish(ctx context.Context, in *IdRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/singu.Queue/Finish", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Requeue(ctx context.Context, in *RequeueRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error) {
+	out := new(QueueMessageResponse)
+	err := c.cc.Invoke(ctx, "/singu.Queue/Requeue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) OrphanMessages(ctx context.Context, in *OrphanMessagesRequest, opts ...grpc.CallOption) (*QueueMessageList, error) {
+	out := new(QueueMessageList)
+	err := c.cc.Invoke(ctx, "/singu.Queue/OrphanMessages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Peek(ctx context.Context, in *PeekRequest, opts ...grpc.CallOption) (*QueueMessageList, error) {
+	out := new(QueueMessageList)
+	err := c.cc.Invoke(ctx, "/singu.Queue/Peek", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Browse(ctx context.Context, in *BrowseRequest, opts ...grpc.CallOption) (*BrowseResponse, error) {
+	out := new(BrowseResponse)
+	err := c.cc.Invoke(ctx, "/singu.Queue/Browse", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) GetById(ctx context.Context, in *IdRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error) {
+	out := new(QueueMessageResponse)
+	err := c.cc.Invoke(ctx, "/singu.Queue/GetById", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) RemoveById(ctx context.Context, in *IdRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error) {
+	out := new(QueueMessageResponse)
+	err := c.cc.Invoke(ctx, "/singu.Queue/RemoveById", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) UpdatePayload(ctx context.Context, in *UpdatePayloadRequest, opts ...grpc.CallOption) (*QueueMessageResponse, error) {
+	out := new(QueueMessageResponse)
+	err := c.cc.Invoke(ctx, "/singu.Queue/UpdatePayload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Purge(ctx context.Context, in *StorageRequest, opts ...grpc.CallOption) (*CountResponse, error) {
+	out := new(CountResponse)
+	err := c.cc.Invoke(ctx, "/singu.Queue/Purge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) RequeueAllEphemeral(ctx context.Context, in *RequeueAllRequest, opts ...grpc.CallOption) (*CountResponse, error) {
+	out := new(CountResponse)
+	err := c.cc.Invoke(ctx, "/singu.Queue/RequeueAllEphemeral", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Pause(ctx context.Context, in *QueueRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/singu.Queue/Pause", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Resume(ctx context.Context, in *QueueRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/singu.Queue/Resume", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) TakeStream(ctx context.Context, in *TakeStreamRequest, opts ...grpc.CallOption) (Queue_TakeStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Queue_serviceDesc.Streams[0], "/singu.Queue/TakeStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &queueTakeStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Queue_TakeStreamClient interface {
+	Recv() (*QueueMessage, error)
+	grpc.ClientStream
+}
+
+type queueTakeStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *queueTakeStreamClient) Recv() (*QueueMessage, error) {
+	m := new(QueueMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *queueClient) Consume(ctx context.Context, opts ...grpc.CallOption) (Queue_ConsumeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Queue_serviceDesc.Streams[1], "/singu.Queue/Consume", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &queueConsumeClient{stream}
+	return x, nil
+}
+
+type Queue_ConsumeClient interface {
+	Send(*ConsumeRequest) error
+	Recv() (*QueueMessage, error)
+	grpc.ClientStream
+}
+
+type queueConsumeClient struct {
+	grpc.ClientStream
+}
+
+func (x *queueConsumeClient) Send(m *ConsumeRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *queueConsumeClient) Recv() (*QueueMessage, error) {
+	m := new(QueueMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// QueueServer is the server API for Queue service.
+type QueueServer interface {
+	// Info returns sizes, capacities and paused state of a queue.
+	Info(context.Context, *QueueRequest) (*QueueInfo, error)
+	// Queue mirrors IQueue.Queue.
+	Queue(context.Context, *QueueMessageRequest) (*QueueMessageResponse, error)
+	// Take mirrors IQueue.Take. Response's message is absent if queue storage is empty.
+	Take(context.Context, *QueueRequest) (*QueueMessageResponse, error)
+	// Finish mirrors IQueue.Finish.
+	Finish(context.Context, *IdRequest) (*Empty, error)
+	// Requeue mirrors IQueue.Requeue. Response's message is absent if there is no such message in ephemeral storage.
+	Requeue(context.Context, *RequeueRequest) (*QueueMessageResponse, error)
+	// OrphanMessages mirrors IQueue.OrphanMessages.
+	OrphanMessages(context.Context, *OrphanMessagesRequest) (*QueueMessageList, error)
+	// Peek mirrors IQueue.Peek.
+	Peek(context.Context, *PeekRequest) (*QueueMessageList, error)
+	// Browse mirrors IQueue.Browse.
+	Browse(context.Context, *BrowseRequest) (*BrowseResponse, error)
+	// GetById mirrors IQueue.GetById.
+	GetById(context.Context, *IdRequest) (*QueueMessageResponse, error)
+	// RemoveById mirrors IQueue.RemoveById.
+	RemoveById(context.Context, *IdRequest) (*QueueMessageResponse, error)
+	// UpdatePayload mirrors IQueue.UpdatePayload.
+	UpdatePayload(context.Context, *UpdatePayloadRequest) (*QueueMessageResponse, error)
+	// Purge mirrors IQueue.PurgeQueueStorage and IQueue.PurgeEphemeralStorage.
+	Purge(context.Context, *StorageRequest) (*CountResponse, error)
+	// RequeueAllEphemeral mirrors IQueue.RequeueAllEphemeral.
+	RequeueAllEphemeral(context.Context, *RequeueAllRequest) (*CountResponse, error)
+	// Pause mirrors IQueue.Pause.
+	Pause(context.Context, *QueueRequest) (*Empty, error)
+	// Resume mirrors IQueue.Resume.
+	Resume(context.Context, *QueueRequest) (*Empty, error)
+	// TakeStream takes messages continuously and pushes them to the client as they become available.
+	// Sending is subject to gRPC flow control: a slow client slows down taking.
+	// Delivery is at-most-once: messages are finished as soon as they are sent, use Consume for acknowledged delivery.
+	TakeStream(*TakeStreamRequest, Queue_TakeStreamServer) error
+	// Consume is the bidirectional variant of TakeStream: the client first sends a subscription, then acknowledges
+	// received messages on the same stream. At most max_in_flight messages are left unacknowledged at any time.
+	// Unacknowledged messages are re-queued (silently) when the stream ends.
+	Consume(Queue_ConsumeServer) error
+}
+
+// UnimplementedQueueServer can be embedded to have forward compatible implementations.
+type UnimplementedQueueServer struct {
+}
+
+func (*UnimplementedQueueServer) Info(ctx context.Context, req *QueueRequest) (*QueueInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Info not implemented")
+}
+func (*UnimplementedQueueServer) Queue(ctx context.Context, req *QueueMessageRequest) (*QueueMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Queue not implemented")
+}
+func (*UnimplementedQueueServer) Take(ctx context.Context, req *QueueRequest) (*QueueMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Take not implemented")
+}
+func (*UnimplementedQueueServer) Finish(ctx context.Context, req *IdRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Finish not implemented")
+}
+func (*UnimplementedQueueServer) Requeue(ctx context.Context, req *RequeueRequest) (*QueueMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Requeue not implemented")
+}
+func (*UnimplementedQueueServer) OrphanMessages(ctx context.Context, req *OrphanMessagesRequest) (*QueueMessageList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OrphanMessages not implemented")
+}
+func (*UnimplementedQueueServer) Peek(ctx context.Context, req *PeekRequest) (*QueueMessageList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Peek not implemented")
+}
+func (*UnimplementedQueueServer) Browse(ctx context.Context, req *BrowseRequest) (*BrowseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Browse not implemented")
+}
+func (*UnimplementedQueueServer) GetById(ctx context.Context, req *IdRequest) (*QueueMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetById not implemented")
+}
+func (*UnimplementedQueueServer) RemoveById(ctx context.Context, req *IdRequest) (*QueueMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveById not implemented")
+}
+func (*UnimplementedQueueServer) UpdatePayload(ctx context.Context, req *UpdatePayloadRequest) (*QueueMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdatePayload not implemented")
+}
+func (*UnimplementedQueueServer) Purge(ctx context.Context, req *StorageRequest) (*CountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Purge not implemented")
+}
+func (*UnimplementedQueueServer) RequeueAllEphemeral(ctx context.Context, req *RequeueAllRequest) (*CountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequeueAllEphemeral not implemented")
+}
+func (*UnimplementedQueueServer) Pause(ctx context.Context, req *QueueRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pause not implemented")
+}
+func (*UnimplementedQueueServer) Resume(ctx context.Context, req *QueueRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resume not implemented")
+}
+func (*UnimplementedQueueServer) TakeStream(req *TakeStreamRequest, srv Queue_TakeStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method TakeStream not implemented")
+}
+func (*UnimplementedQueueServer) Consume(srv Queue_ConsumeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Consume not implemented")
+}
+
+func RegisterQueueServer(s *grpc.Server, srv QueueServer) {
+	s.RegisterService(&_Queue_serviceDesc, srv)
+}
+
+func _Queue_Info_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Info(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/Info",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Info(ctx, req.(*QueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Queue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Queue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/Queue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Queue(ctx, req.(*QueueMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Take_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Take(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/Take",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Take(ctx, req.(*QueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Finish_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Finish(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/Finish",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Finish(ctx, req.(*IdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Requeue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RequeueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Requeue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/Requeue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Requeue(ctx, req.(*RequeueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_OrphanMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OrphanMessagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).OrphanMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/OrphanMessages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).OrphanMessages(ctx, req.(*OrphanMessagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Peek_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeekRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Peek(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/Peek",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Peek(ctx, req.(*PeekRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Browse_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BrowseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Browse(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/Browse",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Browse(ctx, req.(*BrowseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_GetById_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).GetById(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/GetById",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).GetById(ctx, req.(*IdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_RemoveById_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).RemoveById(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/RemoveById",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).RemoveById(ctx, req.(*IdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_UpdatePayload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdatePayloadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).UpdatePayload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/UpdatePayload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).UpdatePayload(ctx, req.(*UpdatePayloadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Purge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StorageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Purge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/Purge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Purge(ctx, req.(*StorageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_RequeueAllEphemeral_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RequeueAllRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).RequeueAllEphemeral(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/RequeueAllEphemeral",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).RequeueAllEphemeral(ctx, req.(*RequeueAllRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/Pause",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Pause(ctx, req.(*QueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/singu.Queue/Resume",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Resume(ctx, req.(*QueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_TakeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TakeStreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueueServer).TakeStream(m, &queueTakeStreamServer{stream})
+}
+
+type Queue_TakeStreamServer interface {
+	Send(*QueueMessage) error
+	grpc.ServerStream
+}
+
+type queueTakeStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *queueTakeStreamServer) Send(m *QueueMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Queue_Consume_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(QueueServer).Consume(&queueConsumeServer{stream})
+}
+
+type Queue_ConsumeServer interface {
+	Send(*QueueMessage) error
+	Recv() (*ConsumeRequest, error)
+	grpc.ServerStream
+}
+
+type queueConsumeServer struct {
+	grpc.ServerStream
+}
+
+func (x *queueConsumeServer) Send(m *QueueMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *queueConsumeServer) Recv() (*ConsumeRequest, error) {
+	m := new(ConsumeRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _Queue_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "singu.Queue",
+	HandlerType: (*QueueServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Info",
+			Handler:    _Queue_Info_Handler,
+		},
+		{
+			MethodName: "Queue",
+			Handler:    _Queue_Queue_Handler,
+		},
+		{
+			MethodName: "Take",
+			Handler:    _Queue_Take_Handler,
+		},
+		{
+			MethodName: "Finish",
+			Handler:    _Queue_Finish_Handler,
+		},
+		{
+			MethodName: "Requeue",
+			Handler:    _Queue_Requeue_Handler,
+		},
+		{
+			MethodName: "OrphanMessages",
+			Handler:    _Queue_OrphanMessages_Handler,
+		},
+		{
+			MethodName: "Peek",
+			Handler:    _Queue_Peek_Handler,
+		},
+		{
+			MethodName: "Browse",
+			Handler:    _Queue_Browse_Handler,
+		},
+		{
+			MethodName: "GetById",
+			Handler:    _Queue_GetById_Handler,
+		},
+		{
+			MethodName: "RemoveById",
+			Handler:    _Queue_RemoveById_Handler,
+		},
+		{
+			MethodName: "UpdatePayload",
+			Handler:    _Queue_UpdatePayload_Handler,
+		},
+		{
+			MethodName: "Purge",
+			Handler:    _Queue_Purge_Handler,
+		},
+		{
+			MethodName: "RequeueAllEphemeral",
+			Handler:    _Queue_RequeueAllEphemeral_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _Queue_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _Queue_Resume_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "TakeStream",
+			Handler:       _Queue_TakeStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Consume",
+			Handler:       _Queue_Consume_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "singu.proto",
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/btnguyen2k/singu"
+	"net/http"
+	"reflect"
+)
+
+// ErrorCode is the machine-readable error code included in error responses.
+type ErrorCode string
+
+const (
+	// CodeBadRequest is returned when the request is malformed (status 400)
+	CodeBadRequest ErrorCode = "bad_request"
+
+	// CodeUnauthorized is returned when the request does not carry a valid auth token (status 401)
+	CodeUnauthorized ErrorCode = "unauthorized"
+
+	// CodeNotFound is returned when the requested endpoint does not exist (status 404)
+	CodeNotFound ErrorCode = "not_found"
+
+	// CodeQueueNotFound is returned when the requested queue is not registered (status 404)
+	CodeQueueNotFound ErrorCode = "queue_not_found"
+
+	// CodeStreamNotFound is returned when the stream session of an acknowledgement does not exist (status 404)
+	CodeStreamNotFound ErrorCode = "stream_not_found"
+
+	// CodeMessageNotInFlight is returned when the acknowledged message is not in flight on the stream (status 404)
+	CodeMessageNotInFlight ErrorCode = "message_not_in_flight"
+
+	// CodeMethodNotAllowed is returned when the endpoint does not support the request's method (status 405)
+	CodeMethodNotAllowed ErrorCode = "method_not_allowed"
+
+	// CodeRequestTooLarge is returned when the request body exceeds the configured max size (status 413)
+	CodeRequestTooLarge ErrorCode = "request_too_large"
+
+	// CodeQueueIsPaused is returned for singu.ErrorQueueIsPaused (status 423)
+	CodeQueueIsPaused ErrorCode = "queue_is_paused"
+
+	// CodeEphemeralIsFull is returned for singu.ErrorEphemeralIsFull (status 429)
+	CodeEphemeralIsFull ErrorCode = "ephemeral_is_full"
+
+	// CodeQueueIsFull is returned for singu.ErrorQueueIsFull (status 507)
+	CodeQueueIsFull ErrorCode = "queue_is_full"
+
+	// CodeOperationNotSupported is returned for singu.ErrorOperationNotSupported (status 501)
+	CodeOperationNotSupported ErrorCode = "operation_not_supported"
+
+	// CodeInternalError is returned for all other errors (status 500)
+	CodeInternalError ErrorCode = "internal_error"
+)
+
+// sentinelErrors maps singu's sentinel errors to status and error code of their responses.
+var sentinelErrors = map[error]*HttpError{
+	singu.ErrorQueueIsFull:           {Status: http.StatusInsufficientStorage, Code: CodeQueueIsFull},
+	singu.ErrorEphemeralIsFull:       {Status: http.StatusTooManyRequests, Code: CodeEphemeralIsFull},
+	singu.ErrorQueueIsPaused:         {Status: http.StatusLocked, Code: CodeQueueIsPaused},
+	singu.ErrorOperationNotSupported: {Status: http.StatusNotImplemented, Code: CodeOperationNotSupported},
+}
+
+// SentinelError returns singu's sentinel error corresponding to the specified error code, or nil if there is none.
+func SentinelError(code ErrorCode) error {
+	for err, httpErr := range sentinelErrors {
+		if httpErr.Code == code {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrorResponse is the body of error responses.
+type ErrorResponse struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"error"`
+}
+
+// HttpError is an error that carries its response status and error code.
+type HttpError struct {
+	Status  int
+	Code    ErrorCode
+	Message string
+}
+
+// Error implements error
+func (e *HttpError) Error() string {
+	return e.Message
+}
+
+func newHttpError(status int, code ErrorCode, message string) *HttpError {
+	return &HttpError{Status: status, Code: code, Message: message}
+}
+
+var errNotFound = newHttpError(http.StatusNotFound, CodeNotFound, "not found")
+
+func toHttpError(err error) *HttpError {
+	if httpErr, ok := err.(*HttpError); ok {
+		return httpErr
+	}
+	for sentinel, httpErr := range sentinelErrors {
+		if errors.Is(err, sentinel) {
+			return newHttpError(httpErr.Status, httpErr.Code, err.Error())
+		}
+	}
+	return newHttpError(http.StatusInternalServerError, CodeInternalError, err.Error())
+}
+
+func writeJson(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	httpErr := toHttpError(err)
+	writeJson(w, httpErr.Status, ErrorResponse{Code: httpErr.Code, Message: httpErr.Message})
+}
+
+// writeResult writes the result as a JSON response, or status 204 if there is nothing to return.
+func writeResult(w http.ResponseWriter, result interface{}) {
+	if v := reflect.ValueOf(result); !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJson(w, http.StatusOK, result)
+}
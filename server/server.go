@@ -0,0 +1,479 @@
+// Package server exposes singu queues over a REST API using JSON as data format.
+//
+// API endpoints (all request and response bodies are JSON):
+//	- GET  /queues                                  : list names of registered queues
+//	- GET  /queues/<name>                           : queue information (sizes, capacities, paused state)
+//	- POST /queues/<name>/messages                  : enqueue a message, see IQueue.Queue
+//	- POST /queues/<name>/take?wait=<duration>      : dequeue a message, see IQueue.Take (long-polling if wait is specified)
+//	- POST /queues/<name>/ephemeral/<id>/finish     : see IQueue.Finish
+//	- POST /queues/<name>/ephemeral/<id>/requeue    : see IQueue.Requeue, add query parameter silent=true for silent re-queue
+//	- GET  /queues/<name>/orphans?seconds=<n>&limit=<n> : see IQueue.OrphanMessages
+//	- GET  /queues/<name>/peek?limit=<n>            : see IQueue.Peek
+//	- GET  /queues/<name>/<storage>?cursor=<c>&limit=<n> : see IQueue.Browse, storage is either "queue" or "ephemeral"
+//	- DELETE /queues/<name>/<storage>               : see IQueue.PurgeQueueStorage and IQueue.PurgeEphemeralStorage
+//	- GET, DELETE, PUT /queues/<name>/<storage>/<id> : see IQueue.GetById, IQueue.RemoveById and IQueue.UpdatePayload
+//	- POST /queues/<name>/requeue-all               : see IQueue.RequeueAllEphemeral, add query parameter silent=true for silent re-queue
+//	- POST /queues/<name>/pause, POST /queues/<name>/resume : see IQueue.Pause and IQueue.Resume
+//	- GET  /queues/<name>/stream?max_in_flight=<n>  : live consumer, messages are streamed as Server-Sent Events, or over
+//	  WebSocket if the request asks for a protocol upgrade
+//	- POST /queues/<name>/stream/<session>/ack      : acknowledge a streamed message, see StreamAck
+//
+// Streams: the first event of a stream carries its session id, each following "message" event delivers a message taken
+// from the queue (see StreamEvent). Delivered messages stay in ephemeral storage until the client acknowledges them with
+// a StreamAck, action "finish" calls IQueue.Finish and action "requeue" calls IQueue.Requeue. SSE clients post
+// acknowledgements to the ack endpoint, WebSocket clients send them as text messages over the same connection. At most
+// max_in_flight unacknowledged messages are delivered at any time. Messages still unacknowledged when the connection
+// drops are re-queued silently.
+//
+// Messages are encoded as singu.QueueMessage's JSON representation, payload is base64-encoded.
+// Operations that have nothing to return (e.g. taking from an empty queue) respond with status 204.
+//
+// Errors are responded with a JSON body {"code": <error-code>, "error": <error-message>}, see ErrorCode for the list of error codes.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/btnguyen2k/singu"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxWait is the default upper limit of long-polling duration
+	DefaultMaxWait = 30 * time.Second
+
+	// DefaultPollInterval is the default interval between two Take attempts while long-polling or streaming
+	DefaultPollInterval = 100 * time.Millisecond
+
+	// DefaultStreamMaxInFlight is the default max number of unacknowledged messages of a stream
+	DefaultStreamMaxInFlight = 10
+
+	// DefaultStreamKeepAlive is the default interval keep-alives are sent to idle streams at
+	DefaultStreamKeepAlive = 15 * time.Second
+
+	// DefaultMaxBodySize is the default max size (in bytes) of request bodies
+	DefaultMaxBodySize = 4 << 20
+)
+
+// Config holds the server's configurations.
+type Config struct {
+	// AuthTokens lists accepted bearer tokens. If empty, requests are not authenticated.
+	// Clients send a token via header "Authorization: Bearer <token>".
+	AuthTokens []string
+
+	// MaxWait caps the long-polling duration requested by clients, default value is DefaultMaxWait.
+	MaxWait time.Duration
+
+	// PollInterval is the interval between two Take attempts while long-polling or streaming, default value is
+	// DefaultPollInterval.
+	PollInterval time.Duration
+
+	// StreamMaxInFlight caps the number of unacknowledged messages of a stream, default value is DefaultStreamMaxInFlight.
+	// Clients can ask for a lower limit via query parameter max_in_flight.
+	StreamMaxInFlight int
+
+	// StreamKeepAlive is the interval keep-alives (SSE comments or WebSocket pings) are sent at, default value is
+	// DefaultStreamKeepAlive.
+	StreamKeepAlive time.Duration
+
+	// MaxBodySize caps the size (in bytes) of request bodies, default value is DefaultMaxBodySize. Larger requests are
+	// rejected with status 413.
+	MaxBodySize int64
+
+	// StreamCheckOrigin, if supplied, validates the Origin header of WebSocket handshakes. If nil, cross-origin
+	// handshakes are rejected.
+	StreamCheckOrigin func(r *http.Request) bool
+}
+
+// NewServer creates a new Server instance.
+func NewServer(config Config) *Server {
+	if config.MaxWait <= 0 {
+		config.MaxWait = DefaultMaxWait
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	if config.StreamMaxInFlight <= 0 {
+		config.StreamMaxInFlight = DefaultStreamMaxInFlight
+	}
+	if config.StreamKeepAlive <= 0 {
+		config.StreamKeepAlive = DefaultStreamKeepAlive
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultMaxBodySize
+	}
+	return &Server{config: config, queues: make(map[string]singu.IQueue), streams: make(map[string]*stream)}
+}
+
+// Server is a http.Handler that exposes registered singu.IQueue instances over a REST API.
+type Server struct {
+	config  Config
+	queues  map[string]singu.IQueue // registered queues, by name
+	streams map[string]*stream      // open streams, by session id
+	lock    sync.RWMutex            // lock to avoid race condition
+}
+
+// RegisterQueue registers a queue with the server, the queue is exposed under its name.
+// A queue registered earlier with the same name is replaced.
+func (s *Server) RegisterQueue(queue singu.IQueue) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queues[queue.Name()] = queue
+}
+
+// GetQueue returns the registered queue with the specified name, or nil if there is no such queue.
+func (s *Server) GetQueue(name string) singu.IQueue {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.queues[name]
+}
+
+// QueueNames returns names of all registered queues, sorted alphabetically.
+func (s *Server) QueueNames() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	names := make([]string, 0, len(s.queues))
+	for name := range s.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) authenticate(r *http.Request) bool {
+	if len(s.config.AuthTokens) == 0 {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for _, t := range s.config.AuthTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(r) {
+		writeError(w, newHttpError(http.StatusUnauthorized, CodeUnauthorized, "invalid or missing auth token"))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxBodySize)
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "queues" {
+		s.route(w, r, methodHandlers{http.MethodGet: func() (interface{}, error) { return s.QueueNames(), nil }})
+		return
+	}
+	if !strings.HasPrefix(path, "queues/") {
+		writeError(w, errNotFound)
+		return
+	}
+	// <name>[/<action>], <name>/<storage>[/<id>] or <name>/ephemeral/<id>/<action>
+	tokens := strings.Split(strings.TrimPrefix(path, "queues/"), "/")
+	queue := s.GetQueue(tokens[0])
+	if queue == nil {
+		writeError(w, newHttpError(http.StatusNotFound, CodeQueueNotFound, "queue not found: "+tokens[0]))
+		return
+	}
+	storage, isStorage := singu.QueueStorage, false
+	if len(tokens) > 1 {
+		storage, isStorage = parseStorage(tokens[1])
+	}
+	switch {
+	case len(tokens) == 2 && tokens[1] == "stream":
+		s.handleStream(w, r, queue)
+	case len(tokens) == 4 && tokens[1] == "stream" && tokens[3] == "ack":
+		s.route(w, r, methodHandlers{http.MethodPost: func() (interface{}, error) { return s.handleStreamAck(queue, tokens[2], r) }})
+	case len(tokens) == 1:
+		s.route(w, r, methodHandlers{http.MethodGet: func() (interface{}, error) { return queueInfo(queue) }})
+	case len(tokens) == 2 && tokens[1] == "messages":
+		s.route(w, r, methodHandlers{http.MethodPost: func() (interface{}, error) { return s.handleQueue(queue, r) }})
+	case len(tokens) == 2 && tokens[1] == "take":
+		s.route(w, r, methodHandlers{http.MethodPost: func() (interface{}, error) { return s.handleTake(queue, r) }})
+	case len(tokens) == 2 && tokens[1] == "orphans":
+		s.route(w, r, methodHandlers{http.MethodGet: func() (interface{}, error) { return s.handleOrphanMessages(queue, r) }})
+	case len(tokens) == 2 && tokens[1] == "peek":
+		s.route(w, r, methodHandlers{http.MethodGet: func() (interface{}, error) { return s.handlePeek(queue, r) }})
+	case len(tokens) == 2 && tokens[1] == "requeue-all":
+		s.route(w, r, methodHandlers{http.MethodPost: func() (interface{}, error) { return s.handleRequeueAll(queue, r) }})
+	case len(tokens) == 2 && tokens[1] == "pause":
+		s.route(w, r, methodHandlers{http.MethodPost: func() (interface{}, error) { return nil, queue.Pause() }})
+	case len(tokens) == 2 && tokens[1] == "resume":
+		s.route(w, r, methodHandlers{http.MethodPost: func() (interface{}, error) { return nil, queue.Resume() }})
+	case len(tokens) == 2 && isStorage:
+		s.route(w, r, methodHandlers{
+			http.MethodGet:    func() (interface{}, error) { return s.handleBrowse(queue, storage, r) },
+			http.MethodDelete: func() (interface{}, error) { return s.handlePurge(queue, storage) },
+		})
+	case len(tokens) == 3 && isStorage:
+		s.route(w, r, methodHandlers{
+			http.MethodGet:    func() (interface{}, error) { return queue.GetById(storage, tokens[2]) },
+			http.MethodDelete: func() (interface{}, error) { return queue.RemoveById(storage, tokens[2]) },
+			http.MethodPut:    func() (interface{}, error) { return s.handleUpdatePayload(queue, storage, tokens[2], r) },
+		})
+	case len(tokens) == 4 && tokens[1] == "ephemeral" && tokens[3] == "finish":
+		s.route(w, r, methodHandlers{http.MethodPost: func() (interface{}, error) { return nil, queue.Finish(tokens[2]) }})
+	case len(tokens) == 4 && tokens[1] == "ephemeral" && tokens[3] == "requeue":
+		s.route(w, r, methodHandlers{http.MethodPost: func() (interface{}, error) { return s.handleRequeue(queue, tokens[2], r) }})
+	default:
+		writeError(w, errNotFound)
+	}
+}
+
+// methodHandlers maps request methods to the functions handling them.
+type methodHandlers map[string]func() (interface{}, error)
+
+// route invokes the handler matching request's method, and writes handler's result as response.
+func (s *Server) route(w http.ResponseWriter, r *http.Request, handlers methodHandlers) {
+	handler, ok := handlers[r.Method]
+	if !ok {
+		methods := make([]string, 0, len(handlers))
+		for method := range handlers {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, newHttpError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed: "+r.Method))
+		return
+	}
+	result, err := handler()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResult(w, result)
+}
+
+// parseStorage parses storage name as used in API paths, see singu.StorageType.String.
+func parseStorage(name string) (singu.StorageType, bool) {
+	switch name {
+	case singu.QueueStorage.String():
+		return singu.QueueStorage, true
+	case singu.EphemeralStorage.String():
+		return singu.EphemeralStorage, true
+	}
+	return singu.QueueStorage, false
+}
+
+// QueueInfo is the response body of endpoint GET /queues/<name>.
+type QueueInfo struct {
+	Name              string `json:"name"`
+	QueueSize         int    `json:"queue_size"`
+	EphemeralSize     int    `json:"ephemeral_size"`
+	QueueCapacity     int    `json:"queue_capacity"`
+	EphemeralCapacity int    `json:"ephemeral_capacity"`
+	EphemeralEnabled  bool   `json:"ephemeral_enabled"`
+	Paused            bool   `json:"paused"`
+}
+
+func queueInfo(queue singu.IQueue) (*QueueInfo, error) {
+	info := &QueueInfo{Name: queue.Name(), EphemeralEnabled: queue.IsEphemeralStorageEnabled(), Paused: queue.IsPaused()}
+	var err error
+	if info.QueueSize, err = queue.QueueSize(); err != nil {
+		return nil, err
+	}
+	if info.EphemeralSize, err = queue.EphemeralSize(); err != nil {
+		return nil, err
+	}
+	if info.QueueCapacity, err = queue.QueueStorageCapacity(); err != nil {
+		return nil, err
+	}
+	if info.EphemeralCapacity, err = queue.EphemeralStorageCapacity(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *Server) handleQueue(queue singu.IQueue, r *http.Request) (*singu.QueueMessage, error) {
+	msg := singu.QueueMessage{}
+	if err := s.decodeBody(r, &msg, "invalid message: "); err != nil {
+		return nil, err
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return queue.Queue(&msg)
+}
+
+// handleTake takes a message from the queue. If query parameter "wait" is specified, Take is retried until a message
+// is available, the wait duration elapses or the client goes away.
+func (s *Server) handleTake(queue singu.IQueue, r *http.Request) (*singu.QueueMessage, error) {
+	wait, err := durationParam(r, "wait")
+	if err != nil {
+		return nil, err
+	}
+	if wait > s.config.MaxWait {
+		wait = s.config.MaxWait
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		msg, err := queue.Take()
+		if msg != nil || err != nil || !time.Now().Before(deadline) {
+			return msg, err
+		}
+		select {
+		case <-r.Context().Done():
+			return nil, nil
+		case <-time.After(s.config.PollInterval):
+		}
+	}
+}
+
+func (s *Server) handleRequeue(queue singu.IQueue, id string, r *http.Request) (*singu.QueueMessage, error) {
+	silent, err := boolParam(r, "silent")
+	if err != nil {
+		return nil, err
+	}
+	return queue.Requeue(id, silent)
+}
+
+func (s *Server) handleOrphanMessages(queue singu.IQueue, r *http.Request) ([]*singu.QueueMessage, error) {
+	numSeconds, err := intParam(r, "seconds")
+	if err != nil {
+		return nil, err
+	}
+	numMessages, err := intParam(r, "limit")
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := queue.OrphanMessages(numSeconds, numMessages)
+	if msgs == nil && err == nil {
+		msgs = make([]*singu.QueueMessage, 0)
+	}
+	return msgs, err
+}
+
+func (s *Server) handlePeek(queue singu.IQueue, r *http.Request) ([]*singu.QueueMessage, error) {
+	numMessages, err := intParam(r, "limit")
+	if err != nil {
+		return nil, err
+	}
+	return queue.Peek(numMessages)
+}
+
+// BrowseResult is the response body of endpoint GET /queues/<name>/<storage>.
+type BrowseResult struct {
+	Messages []*singu.QueueMessage `json:"messages"`
+	Cursor   string                `json:"cursor"`
+}
+
+func (s *Server) handleBrowse(queue singu.IQueue, storage singu.StorageType, r *http.Request) (*BrowseResult, error) {
+	numMessages, err := intParam(r, "limit")
+	if err != nil {
+		return nil, err
+	}
+	msgs, cursor, err := queue.Browse(storage, r.URL.Query().Get("cursor"), numMessages)
+	if err != nil {
+		return nil, err
+	}
+	if msgs == nil {
+		msgs = make([]*singu.QueueMessage, 0)
+	}
+	return &BrowseResult{Messages: msgs, Cursor: cursor}, nil
+}
+
+// CountResult is the response body of endpoints that report number of affected messages.
+type CountResult struct {
+	Count int `json:"count"`
+}
+
+func (s *Server) handlePurge(queue singu.IQueue, storage singu.StorageType) (*CountResult, error) {
+	var count int
+	var err error
+	if storage == singu.QueueStorage {
+		count, err = queue.PurgeQueueStorage()
+	} else {
+		count, err = queue.PurgeEphemeralStorage()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CountResult{Count: count}, nil
+}
+
+func (s *Server) handleRequeueAll(queue singu.IQueue, r *http.Request) (*CountResult, error) {
+	silent, err := boolParam(r, "silent")
+	if err != nil {
+		return nil, err
+	}
+	count, err := queue.RequeueAllEphemeral(silent)
+	if err != nil {
+		return nil, err
+	}
+	return &CountResult{Count: count}, nil
+}
+
+// UpdatePayloadRequest is the request body of endpoint PUT /queues/<name>/<storage>/<id>.
+type UpdatePayloadRequest struct {
+	Payload []byte `json:"payload"`
+}
+
+func (s *Server) handleUpdatePayload(queue singu.IQueue, storage singu.StorageType, id string, r *http.Request) (*singu.QueueMessage, error) {
+	req := UpdatePayloadRequest{}
+	if err := s.decodeBody(r, &req, "invalid request: "); err != nil {
+		return nil, err
+	}
+	return queue.UpdatePayload(storage, id, req.Payload)
+}
+
+// decodeBody decodes the JSON request body into v. A body exceeding Config.MaxBodySize is reported with status 413,
+// other decoding errors with status 400.
+func (s *Server) decodeBody(r *http.Request, v interface{}, prefix string) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		if int64(len(body)) >= s.config.MaxBodySize {
+			return newHttpError(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, "request body exceeds "+strconv.FormatInt(s.config.MaxBodySize, 10)+" bytes")
+		}
+		return newHttpError(http.StatusBadRequest, CodeBadRequest, prefix+err.Error())
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return newHttpError(http.StatusBadRequest, CodeBadRequest, prefix+err.Error())
+	}
+	return nil
+}
+
+func intParam(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	if v, err := strconv.Atoi(value); err != nil {
+		return 0, newHttpError(http.StatusBadRequest, CodeBadRequest, "invalid value for parameter "+name+": "+value)
+	} else {
+		return v, nil
+	}
+}
+
+func boolParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	if v, err := strconv.ParseBool(value); err != nil {
+		return false, newHttpError(http.StatusBadRequest, CodeBadRequest, "invalid value for parameter "+name+": "+value)
+	} else {
+		return v, nil
+	}
+}
+
+// durationParam parses a duration parameter, value is either a Go duration string (e.g. "1.5s") or a number of seconds.
+func durationParam(r *http.Request, name string) (time.Duration, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(v * float64(time.Second)), nil
+	}
+	if v, err := time.ParseDuration(value); err == nil {
+		return v, nil
+	}
+	return 0, newHttpError(http.StatusBadRequest, CodeBadRequest, "invalid value for parameter "+name+": "+value)
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/btnguyen2k/singu"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// StreamEventSession is the type of the first event of a stream, it carries the stream's session id
+	StreamEventSession = "session"
+
+	// StreamEventMessage is the type of events that deliver messages
+	StreamEventMessage = "message"
+
+	// StreamEventError is the type of events that report errors (e.g. a failed acknowledgement over WebSocket)
+	StreamEventError = "error"
+
+	// StreamAckFinish is the acknowledgement action that finishes a message, see IQueue.Finish
+	StreamAckFinish = "finish"
+
+	// StreamAckRequeue is the acknowledgement action that re-queues a message, see IQueue.Requeue
+	StreamAckRequeue = "requeue"
+)
+
+// StreamEvent is an event sent to stream clients, as JSON-encoded data of an SSE event or a WebSocket text message.
+type StreamEvent struct {
+	Type    string              `json:"type"`
+	Session string              `json:"session,omitempty"`
+	Message *singu.QueueMessage `json:"message,omitempty"`
+	Id      string              `json:"id,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// StreamAck is an acknowledgement sent by stream clients, as body of endpoint
+// POST /queues/<name>/stream/<session>/ack or as a WebSocket text message.
+type StreamAck struct {
+	Id     string `json:"id"`
+	Action string `json:"action"`
+	Silent bool   `json:"silent,omitempty"`
+}
+
+// stream is a live consumer session, it tracks messages delivered to the client that have not been acknowledged.
+type stream struct {
+	id          string
+	queue       singu.IQueue
+	maxInFlight int
+	inFlight    map[string]bool // ids of unacknowledged messages
+	acked       chan struct{}   // signaled when an in-flight slot is freed
+	lock        sync.Mutex      // lock to avoid race condition
+}
+
+func newStream(queue singu.IQueue, maxInFlight int) *stream {
+	return &stream{
+		id:          singu.UniqueId(),
+		queue:       queue,
+		maxInFlight: maxInFlight,
+		inFlight:    make(map[string]bool),
+		acked:       make(chan struct{}, 1),
+	}
+}
+
+func (st *stream) isFull() bool {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return len(st.inFlight) >= st.maxInFlight
+}
+
+func (st *stream) track(id string) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.inFlight[id] = true
+}
+
+// ack finishes or re-queues an in-flight message of the stream.
+func (st *stream) ack(ack StreamAck) (*singu.QueueMessage, error) {
+	if ack.Action != StreamAckFinish && ack.Action != StreamAckRequeue {
+		return nil, newHttpError(http.StatusBadRequest, CodeBadRequest, "invalid ack action: "+ack.Action)
+	}
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if !st.inFlight[ack.Id] {
+		return nil, newHttpError(http.StatusNotFound, CodeMessageNotInFlight, "message not in flight: "+ack.Id)
+	}
+	var msg *singu.QueueMessage
+	var err error
+	if ack.Action == StreamAckFinish {
+		err = st.queue.Finish(ack.Id)
+	} else {
+		msg, err = st.queue.Requeue(ack.Id, ack.Silent)
+	}
+	if err != nil {
+		return nil, err
+	}
+	delete(st.inFlight, ack.Id)
+	select {
+	case st.acked <- struct{}{}:
+	default:
+	}
+	return msg, nil
+}
+
+// requeueAll silently re-queues all unacknowledged messages, it is called when the stream ends.
+func (st *stream) requeueAll() {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	for id := range st.inFlight {
+		st.queue.Requeue(id, true)
+		delete(st.inFlight, id)
+	}
+}
+
+func (s *Server) addStream(st *stream) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.streams[st.id] = st
+}
+
+func (s *Server) removeStream(st *stream) {
+	s.lock.Lock()
+	delete(s.streams, st.id)
+	s.lock.Unlock()
+	st.requeueAll()
+}
+
+func (s *Server) getStream(queue singu.IQueue, id string) (*stream, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if st, ok := s.streams[id]; ok && st.queue == queue {
+		return st, nil
+	}
+	return nil, newHttpError(http.StatusNotFound, CodeStreamNotFound, "stream not found: "+id)
+}
+
+func (s *Server) handleStreamAck(queue singu.IQueue, session string, r *http.Request) (*singu.QueueMessage, error) {
+	st, err := s.getStream(queue, session)
+	if err != nil {
+		return nil, err
+	}
+	ack := StreamAck{}
+	if err := s.decodeBody(r, &ack, "invalid ack: "); err != nil {
+		return nil, err
+	}
+	return st.ack(ack)
+}
+
+// handleStream serves endpoint GET /queues/<name>/stream, over WebSocket if the request asks for a protocol upgrade
+// or as Server-Sent Events otherwise.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, queue singu.IQueue) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, newHttpError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed: "+r.Method))
+		return
+	}
+	maxInFlight, err := intParam(r, "max_in_flight")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if maxInFlight <= 0 || maxInFlight > s.config.StreamMaxInFlight {
+		maxInFlight = s.config.StreamMaxInFlight
+	}
+	if websocket.IsWebSocketUpgrade(r) {
+		s.serveWebSocket(w, r, newStream(queue, maxInFlight))
+	} else {
+		s.serveSSE(w, r, newStream(queue, maxInFlight))
+	}
+}
+
+func (s *Server) serveSSE(w http.ResponseWriter, r *http.Request, st *stream) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, newHttpError(http.StatusNotImplemented, CodeOperationNotSupported, "streaming is not supported"))
+		return
+	}
+	s.addStream(st)
+	defer s.removeStream(st)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(event *StreamEvent) error {
+		data, _ := json.Marshal(event)
+		var err error
+		if event.Message != nil {
+			_, err = w.Write([]byte("event: " + event.Type + "\nid: " + event.Message.Id + "\ndata: " + string(data) + "\n\n"))
+		} else {
+			_, err = w.Write([]byte("event: " + event.Type + "\ndata: " + string(data) + "\n\n"))
+		}
+		flusher.Flush()
+		return err
+	}
+	keepAlive := func() error {
+		_, err := w.Write([]byte(": keep-alive\n\n"))
+		flusher.Flush()
+		return err
+	}
+	s.runStream(r.Context(), st, send, keepAlive)
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request, st *stream) {
+	upgrader := websocket.Upgrader{CheckOrigin: s.config.StreamCheckOrigin}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has responded with an error already
+		return
+	}
+	defer ws.Close()
+	s.addStream(st)
+	defer s.removeStream(st)
+
+	// gorilla/websocket supports one concurrent writer only
+	var writeLock sync.Mutex
+	send := func(event *StreamEvent) error {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		return ws.WriteJSON(event)
+	}
+	keepAlive := func() error {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		return ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.config.StreamKeepAlive))
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		// the read loop processes acknowledgements, and ends the stream when the connection is closed
+		defer cancel()
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			ack := StreamAck{}
+			if err := json.Unmarshal(data, &ack); err != nil {
+				send(&StreamEvent{Type: StreamEventError, Error: "invalid ack: " + err.Error()})
+				continue
+			}
+			if _, err := st.ack(ack); err != nil {
+				send(&StreamEvent{Type: StreamEventError, Id: ack.Id, Error: err.Error()})
+			}
+		}
+	}()
+	s.runStream(ctx, st, send, keepAlive)
+}
+
+// runStream takes messages from the stream's queue and sends them to the client, until the context is done or sending
+// fails. At most maxInFlight unacknowledged messages are delivered at any time.
+func (s *Server) runStream(ctx context.Context, st *stream, send func(*StreamEvent) error, keepAlive func() error) {
+	if send(&StreamEvent{Type: StreamEventSession, Session: st.id}) != nil {
+		return
+	}
+	ticker := time.NewTicker(s.config.StreamKeepAlive)
+	defer ticker.Stop()
+	for {
+		var wait <-chan time.Time
+		if st.isFull() {
+			wait = nil // wait for an acknowledgement
+		} else if msg, err := st.queue.Take(); err != nil && err != singu.ErrorQueueIsPaused && err != singu.ErrorEphemeralIsFull {
+			send(&StreamEvent{Type: StreamEventError, Error: err.Error()})
+			return
+		} else if msg != nil {
+			st.track(msg.Id)
+			if send(&StreamEvent{Type: StreamEventMessage, Message: msg}) != nil {
+				return
+			}
+			continue
+		} else {
+			wait = time.After(s.config.PollInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if keepAlive() != nil {
+				return
+			}
+		case <-st.acked:
+		case <-wait:
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package shovel continuously moves messages from a source queue to a destination queue, e.g. to migrate from one queue
+// implementation to another without downtime.
+//
+// Each message is taken from the source with IQueue.Take, queued to the destination with IQueue.Queue, and only then
+// finished on the source with IQueue.Finish. Delivery is at-least-once:
+//	- If the destination rejects a message (e.g. ErrorQueueIsFull), the message is re-queued silently to the source and
+//	  retried later.
+//	- If the process stops between Queue and Finish, the message stays in the source's ephemeral storage and is moved
+//	  again once it is re-queued as an orphan message, so the destination may receive it twice.
+//
+// The source must have ephemeral storage enabled for these guarantees to hold.
+//
+// Messages are queued to the destination as new messages: payload and creation timestamp are preserved, id and queue
+// timestamp are handled by the destination as for any other message (e.g. LeveldbQueue assigns new ids).
+package shovel
+
+import (
+	"github.com/btnguyen2k/singu"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPollInterval is the default interval between two Take attempts when the source is empty
+	DefaultPollInterval = 100 * time.Millisecond
+
+	// DefaultProgressInterval is the default interval Config.OnProgress is called at
+	DefaultProgressInterval = 10 * time.Second
+)
+
+// Config holds the shovel's configurations.
+type Config struct {
+	// RateLimit caps the number of messages moved per second, zero or negative value means no limit.
+	RateLimit float64
+
+	// PollInterval is the interval between two Take attempts when the source is empty, and the delay before retrying
+	// after an error. Default value is DefaultPollInterval.
+	PollInterval time.Duration
+
+	// Filter, if supplied, is called for each message taken from the source. Messages it returns false for are not
+	// moved: they are finished on the source, i.e. dropped.
+	Filter func(msg *singu.QueueMessage) bool
+
+	// OnProgress, if supplied, is called every ProgressInterval and once more when the shovel stops.
+	OnProgress func(progress Progress)
+
+	// ProgressInterval is the interval OnProgress is called at, default value is DefaultProgressInterval.
+	ProgressInterval time.Duration
+
+	// OnError, if supplied, is called for each error. msg is nil for errors not related to a specific message.
+	OnError func(msg *singu.QueueMessage, err error)
+}
+
+// Progress reports what a shovel has done since it started.
+type Progress struct {
+	Moved      int64     `json:"moved"`       // number of messages moved to the destination
+	Filtered   int64     `json:"filtered"`    // number of messages dropped by Config.Filter
+	Errors     int64     `json:"errors"`      // number of errors
+	SourceSize int       `json:"source_size"` // number of messages left in the source's queue storage, as of LastUpdate
+	Started    time.Time `json:"started"`     // when the shovel started
+	LastUpdate time.Time `json:"last_update"` // when the progress was last reported
+}
+
+// New creates a new Shovel instance, call Start to start moving messages.
+func New(src, dst singu.IQueue, config Config) *Shovel {
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	if config.ProgressInterval <= 0 {
+		config.ProgressInterval = DefaultProgressInterval
+	}
+	return &Shovel{src: src, dst: dst, config: config}
+}
+
+// Shovel moves messages from a source queue to a destination queue.
+type Shovel struct {
+	src, dst singu.IQueue
+	config   Config
+	progress Progress
+	stop     chan struct{} // closed to stop the shovel
+	done     chan struct{} // closed when the shovel has stopped
+	lock     sync.Mutex    // lock to avoid race condition
+}
+
+// Start starts moving messages in a background goroutine, until Stop is called. Calling Start on a running shovel has
+// no effect.
+func (s *Shovel) Start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	s.progress = Progress{Started: time.Now()}
+	go s.run(s.stop, s.done)
+}
+
+// Stop stops the shovel and waits until the message being moved, if any, is done.
+func (s *Shovel) Stop() {
+	s.lock.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.lock.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Progress returns a snapshot of the shovel's progress.
+func (s *Shovel) Progress() Progress {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.progress
+}
+
+func (s *Shovel) update(f func(p *Progress)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f(&s.progress)
+}
+
+func (s *Shovel) reportError(msg *singu.QueueMessage, err error) {
+	s.update(func(p *Progress) { p.Errors++ })
+	if s.config.OnError != nil {
+		s.config.OnError(msg, err)
+	}
+}
+
+func (s *Shovel) reportProgress() {
+	size, err := s.src.QueueSize()
+	if err != nil {
+		s.reportError(nil, err)
+	}
+	s.update(func(p *Progress) {
+		p.SourceSize = size
+		p.LastUpdate = time.Now()
+	})
+	if s.config.OnProgress != nil {
+		s.config.OnProgress(s.Progress())
+	}
+}
+
+func (s *Shovel) run(stop, done chan struct{}) {
+	defer close(done)
+	defer s.reportProgress()
+	var interval time.Duration
+	if s.config.RateLimit > 0 {
+		interval = time.Duration(float64(time.Second) / s.config.RateLimit)
+	}
+	nextProgress := time.Now().Add(s.config.ProgressInterval)
+	next := time.Now()
+	for {
+		if now := time.Now(); !now.Before(nextProgress) {
+			s.reportProgress()
+			nextProgress = now.Add(s.config.ProgressInterval)
+		}
+		wait := time.Until(next)
+		if wait <= 0 {
+			if s.moveOne() {
+				if next = next.Add(interval); next.Before(time.Now()) {
+					// do not accumulate unused rate while idle or slow
+					next = time.Now()
+				}
+				continue
+			}
+			wait = s.config.PollInterval
+		}
+		if untilProgress := time.Until(nextProgress); untilProgress < wait {
+			wait = untilProgress
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// moveOne moves one message from the source to the destination, returns false if there was no message to move or an
+// error occurred.
+func (s *Shovel) moveOne() bool {
+	msg, err := s.src.Take()
+	if err != nil {
+		if err != singu.ErrorQueueIsPaused {
+			s.reportError(nil, err)
+		}
+		return false
+	}
+	if msg == nil {
+		return false
+	}
+	if s.config.Filter != nil && !s.config.Filter(msg) {
+		if err := s.src.Finish(msg.Id); err != nil {
+			s.reportError(msg, err)
+			return false
+		}
+		s.update(func(p *Progress) { p.Filtered++ })
+		return true
+	}
+	if _, err := s.dst.Queue(msg); err != nil {
+		s.reportError(msg, err)
+		if _, err := s.src.Requeue(msg.Id, true); err != nil {
+			s.reportError(msg, err)
+		}
+		return false
+	}
+	s.update(func(p *Progress) { p.Moved++ })
+	if err := s.src.Finish(msg.Id); err != nil {
+		// the message has been moved, it is moved again once re-queued as an orphan message
+		s.reportError(msg, err)
+	}
+	return true
+}
@@ -0,0 +1,282 @@
+// Package signing detects tampering of queued messages: SignedQueue is an IQueue decorator that signs messages at
+// Queue time and verifies them at Take time.
+//
+// The signature covers the payload and the metadata of the message (but not its id nor its timestamps, which queue
+// implementations manage). It is stored in the message's metadata along with the id of the key that made it (keys
+// MetadataSignature and MetadataKeyId), so keys can be rotated: messages are verified with the key they were signed with
+// as long as it is in the KeySet.
+//
+// Supported algorithms are HMAC-SHA256 (see NewHMAC), where producers and consumers share the secret, and Ed25519
+// (see NewEd25519 and NewEd25519Public), where consumers only hold public keys and can not sign.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"sort"
+)
+
+const (
+	// MetadataKeyId is the metadata key signed messages carry the id of the signing key in
+	MetadataKeyId = "signature-key-id"
+
+	// MetadataSignature is the metadata key signed messages carry the signature, base64-encoded, in
+	MetadataSignature = "signature"
+
+	// MetadataQuarantineReason is the metadata key quarantined messages carry the reason of the verification failure in
+	MetadataQuarantineReason = "quarantine-reason"
+
+	// MetadataQuarantineSource is the metadata key quarantined messages carry the name of their queue in
+	MetadataQuarantineSource = "quarantine-source"
+)
+
+var (
+	// ErrorInvalidSignature is returned when the signature of a message does not match its content
+	ErrorInvalidSignature = errors.New("invalid message signature")
+
+	// ErrorUnsigned is returned when a message is not signed
+	ErrorUnsigned = errors.New("message is not signed")
+
+	// ErrorUnknownKey is returned when the key a message was signed with is not in the key set
+	ErrorUnknownKey = errors.New("unknown signing key")
+
+	// ErrorCannotSign is returned when signing with a key that can only verify, e.g. an Ed25519 public key
+	ErrorCannotSign = errors.New("key can not sign")
+)
+
+// VerifyError is returned when a message fails verification and is not quarantined, it wraps one of
+// ErrorInvalidSignature, ErrorUnsigned or ErrorUnknownKey. Id identifies the message.
+type VerifyError struct {
+	Id  string
+	Err error
+}
+
+// Error implements error.Error
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("message %s: %s", e.Id, e.Err)
+}
+
+// Unwrap returns the wrapped error.
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// Key signs and verifies data. Implementations must be safe for concurrent use.
+type Key interface {
+	// Sign returns the signature of data, or ErrorCannotSign if the key can only verify.
+	Sign(data []byte) ([]byte, error)
+
+	// Verify returns true if signature is the signature of data.
+	Verify(data, signature []byte) bool
+}
+
+// NewHMAC creates an HMAC-SHA256 key from a shared secret.
+func NewHMAC(secret []byte) Key {
+	return hmacKey(secret)
+}
+
+type hmacKey []byte
+
+// Sign implements Key.Sign
+func (k hmacKey) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// Verify implements Key.Verify
+func (k hmacKey) Verify(data, signature []byte) bool {
+	expected, _ := k.Sign(data)
+	return hmac.Equal(expected, signature)
+}
+
+// NewEd25519 creates an Ed25519 key that signs and verifies, from a private key.
+func NewEd25519(private ed25519.PrivateKey) Key {
+	return ed25519Key{private: private, public: private.Public().(ed25519.PublicKey)}
+}
+
+// NewEd25519Public creates an Ed25519 key that only verifies, from a public key.
+func NewEd25519Public(public ed25519.PublicKey) Key {
+	return ed25519Key{public: public}
+}
+
+type ed25519Key struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// Sign implements Key.Sign
+func (k ed25519Key) Sign(data []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, ErrorCannotSign
+	}
+	return ed25519.Sign(k.private, data), nil
+}
+
+// Verify implements Key.Verify
+func (k ed25519Key) Verify(data, signature []byte) bool {
+	return ed25519.Verify(k.public, data, signature)
+}
+
+// KeySet holds the keys of a SignedQueue. To rotate keys, add the new key and make it current, and keep previous keys
+// as long as messages signed with them may be in the queue. A KeySet must not be modified while it is in use, use a new
+// KeySet instead.
+type KeySet struct {
+	Current string         // id of the key messages are signed with, not needed to verify only
+	Keys    map[string]Key // keys, by id
+}
+
+// Config holds SignedQueue's configurations.
+type Config struct {
+	// Keys is the key set messages are signed and verified with, it is required.
+	Keys *KeySet
+
+	// Quarantine, if supplied, is the queue messages that fail verification are moved to, with MetadataQuarantineReason
+	// and MetadataQuarantineSource added to their metadata. Otherwise Take returns a VerifyError for such messages.
+	Quarantine singu.IQueue
+
+	// OnQuarantine, if supplied, is called for each message moved to the quarantine queue, e.g. to raise an alert.
+	OnQuarantine func(msg *singu.QueueMessage, err error)
+}
+
+// NewSignedQueue creates a new SignedQueue that decorates the queue.
+func NewSignedQueue(queue singu.IQueue, config Config) *SignedQueue {
+	return &SignedQueue{IQueue: queue, config: config}
+}
+
+// SignedQueue is an IQueue decorator that signs and verifies messages.
+//	- Queue signs the message with the current key. The caller's message is not modified.
+//	- Take verifies taken messages. A message that fails verification is moved to the quarantine queue (queued there,
+//	  then finished on this queue) and the next message is taken instead, so consumers are never handed a message that
+//	  failed verification. Without quarantine queue, or if moving the message fails, Take returns an error and the
+//	  message is left in ephemeral storage.
+//	- UpdatePayload is not supported, as it would invalidate the signature.
+//	- Other operations are passed through, messages they return are not verified.
+type SignedQueue struct {
+	singu.IQueue
+	config Config
+}
+
+// signedData returns the data the signature of the message covers: its payload and its metadata but the signature,
+// length-prefixed, metadata sorted by key.
+func signedData(msg *singu.QueueMessage) []byte {
+	keys := make([]string, 0, len(msg.Metadata))
+	for k := range msg.Metadata {
+		if k != MetadataSignature {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	buf := bytes.Buffer{}
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	write := func(data []byte) {
+		buf.Write(lenBuf[:binary.PutUvarint(lenBuf, uint64(len(data)))])
+		buf.Write(data)
+	}
+	buf.WriteString("singu-signature-v1")
+	write(msg.Payload)
+	for _, k := range keys {
+		write([]byte(k))
+		write([]byte(msg.Metadata[k]))
+	}
+	return buf.Bytes()
+}
+
+// Sign returns a clone of the message signed with the current key.
+func (q *SignedQueue) Sign(msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	key, ok := q.config.Keys.Keys[q.config.Keys.Current]
+	if !ok {
+		return nil, ErrorUnknownKey
+	}
+	clone := singu.CloneQueueMessage(*msg)
+	if clone.Metadata == nil {
+		clone.Metadata = make(map[string]string)
+	}
+	clone.Metadata[MetadataKeyId] = q.config.Keys.Current
+	signature, err := key.Sign(signedData(&clone))
+	if err != nil {
+		return nil, err
+	}
+	clone.Metadata[MetadataSignature] = base64.StdEncoding.EncodeToString(signature)
+	return &clone, nil
+}
+
+// Verify checks the signature of the message, it returns ErrorInvalidSignature, ErrorUnsigned or ErrorUnknownKey if the
+// verification fails.
+func (q *SignedQueue) Verify(msg *singu.QueueMessage) error {
+	encoded, ok := msg.Metadata[MetadataSignature]
+	if !ok {
+		return ErrorUnsigned
+	}
+	key, ok := q.config.Keys.Keys[msg.Metadata[MetadataKeyId]]
+	if !ok {
+		return ErrorUnknownKey
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !key.Verify(signedData(msg), signature) {
+		return ErrorInvalidSignature
+	}
+	return nil
+}
+
+// quarantine moves the message, taken from this queue, to the quarantine queue.
+func (q *SignedQueue) quarantine(msg *singu.QueueMessage, reason error) error {
+	clone := singu.CloneQueueMessage(*msg)
+	if clone.Metadata == nil {
+		clone.Metadata = make(map[string]string)
+	}
+	clone.Metadata[MetadataQuarantineReason] = reason.Error()
+	clone.Metadata[MetadataQuarantineSource] = q.Name()
+	if _, err := q.config.Quarantine.Queue(&clone); err != nil {
+		return fmt.Errorf("quarantine message %s: %w", msg.Id, err)
+	}
+	if err := q.IQueue.Finish(msg.Id); err != nil {
+		// the message has been quarantined, it is quarantined again once re-queued as an orphan message
+		return fmt.Errorf("quarantine message %s: %w", msg.Id, err)
+	}
+	if q.config.OnQuarantine != nil {
+		q.config.OnQuarantine(&clone, reason)
+	}
+	return nil
+}
+
+// Queue implements IQueue.Queue
+func (q *SignedQueue) Queue(msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	signed, err := q.Sign(msg)
+	if err != nil {
+		return nil, err
+	}
+	return q.IQueue.Queue(signed)
+}
+
+// Take implements IQueue.Take
+func (q *SignedQueue) Take() (*singu.QueueMessage, error) {
+	for {
+		msg, err := q.IQueue.Take()
+		if err != nil || msg == nil {
+			return msg, err
+		}
+		err = q.Verify(msg)
+		if err == nil {
+			return msg, nil
+		}
+		if q.config.Quarantine == nil {
+			return nil, &VerifyError{Id: msg.Id, Err: err}
+		}
+		if err := q.quarantine(msg, err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// UpdatePayload implements IQueue.UpdatePayload, it returns ErrorOperationNotSupported.
+func (q *SignedQueue) UpdatePayload(storage singu.StorageType, id string, payload []byte) (*singu.QueueMessage, error) {
+	return nil, singu.ErrorOperationNotSupported
+}
@@ -43,7 +43,13 @@ func UniqueId() string {
 
 // NewQueueMessage creates a new QueueMessage instance with provided payload
 func NewQueueMessage(payload []byte) *QueueMessage {
-	now := time.Now()
+	return NewQueueMessageWithClock(payload, SystemClock)
+}
+
+// NewQueueMessageWithClock creates a new QueueMessage instance with provided payload, timestamps are obtained from the supplied clock.
+//	- clock: if nil, SystemClock is used
+func NewQueueMessageWithClock(payload []byte, clock Clock) *QueueMessage {
+	now := ClockOrDefault(clock).Now()
 	return &QueueMessage{
 		Id:             UniqueId(),
 		Timestamp:      now,
@@ -57,6 +63,12 @@ func NewQueueMessage(payload []byte) *QueueMessage {
 func CloneQueueMessage(msg QueueMessage) QueueMessage {
 	clone := msg
 	clone.Payload = []byte(string(msg.Payload))
+	if msg.Metadata != nil {
+		clone.Metadata = make(map[string]string, len(msg.Metadata))
+		for k, v := range msg.Metadata {
+			clone.Metadata[k] = v
+		}
+	}
 	return clone
 }
 
@@ -68,6 +80,10 @@ type QueueMessage struct {
 	TakenTimestamp time.Time `json:"ttime"`        // message's taken timestamp, maintained by queue implementation
 	NumRequeues    int       `json:"num_requeues"` // how many times message has been re-queued?, maintained by queue implementations
 	Payload        []byte    `json:"payload"`      // message's payload
+
+	// Metadata carries application-defined key-value pairs alongside the payload (e.g. trace context), it is stored and
+	// returned as is by queue implementations.
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 var (
@@ -79,6 +95,9 @@ var (
 
 	// ErrorEphemeralIsFull is returned when ephemeral storage is full and can not accept any more message
 	ErrorEphemeralIsFull = errors.New("ephemeral storage is full")
+
+	// ErrorQueueIsPaused is returned when taking message from a paused queue
+	ErrorQueueIsPaused = errors.New("queue is paused")
 )
 
 const (
@@ -86,6 +105,62 @@ const (
 	SizeNotSupported = -1
 )
 
+// StorageType identifies one of the queue's message storages.
+type StorageType int
+
+const (
+	// QueueStorage identifies the queue storage
+	QueueStorage StorageType = iota
+
+	// EphemeralStorage identifies the ephemeral storage
+	EphemeralStorage
+)
+
+// String implements fmt.Stringer
+func (s StorageType) String() string {
+	switch s {
+	case QueueStorage:
+		return "queue"
+	case EphemeralStorage:
+		return "ephemeral"
+	}
+	return "unknown"
+}
+
+// Names of IQueue operations, used as Call.Op by interceptors, as "operation" label by package metrics and as
+// operation field by package logging.
+const (
+	// OpQueue names IQueue.Queue
+	OpQueue = "queue"
+
+	// OpTake names IQueue.Take
+	OpTake = "take"
+
+	// OpFinish names IQueue.Finish
+	OpFinish = "finish"
+
+	// OpRequeue names IQueue.Requeue
+	OpRequeue = "requeue"
+
+	// OpOrphanMessages names IQueue.OrphanMessages
+	OpOrphanMessages = "orphan_messages"
+
+	// OpPeek names IQueue.Peek
+	OpPeek = "peek"
+
+	// OpBrowse names IQueue.Browse
+	OpBrowse = "browse"
+
+	// OpGetById names IQueue.GetById
+	OpGetById = "get_by_id"
+
+	// OpRemoveById names IQueue.RemoveById
+	OpRemoveById = "remove_by_id"
+
+	// OpUpdatePayload names IQueue.UpdatePayload
+	OpUpdatePayload = "update_payload"
+)
+
 // IQueue defines API to access queue messages.
 //
 // Queue implementation:
@@ -98,8 +173,8 @@ const (
 //	- Call IQueue.queue(msg) to put messages to queue.
 //	- Call IQueue.take() to take messages from queue.
 //	- Do something with the message.
-//		- When done, call IQueue.finish(id)
-//		- If not done and the message needs to be re-queued, call IQueue.requeue(id, true/false) to put the message back to queue.
+//	- When done, call IQueue.finish(id)
+//	- If not done and the message needs to be re-queued, call IQueue.requeue(id, true/false) to put the message back to queue.
 type IQueue interface {
 	// Name returns queue's name.
 	Name() string
@@ -131,7 +206,7 @@ type IQueue interface {
 	Finish(id string) error
 
 	// Take dequeues a message: move a message from the head of queue storage to ephemeral storage and return the message.
-	// Nil is returned if queue storage is empty.
+	// Nil is returned if queue storage is empty. ErrorQueueIsPaused is returned if the queue is paused.
 	Take() (*QueueMessage, error)
 
 	// OrphanMessages returns all messages that have been staying in ephemeral storage for more than a specific number of seconds.
@@ -146,4 +221,77 @@ type IQueue interface {
 
 	// EphemeralSize returns number messages currently in ephemeral storage.
 	EphemeralSize() (int, error)
+
+	// Peek returns messages at the head of queue storage without taking them.
+	//	- numMessages: limit number of returned messages, value less than or equal to zero means 'no limit'
+	//
+	// Messages are returned in the order they would be taken. Peek does not move messages or update their timestamps.
+	Peek(numMessages int) ([]*QueueMessage, error)
+
+	// Browse returns messages from the specified storage, page by page, without moving them.
+	//	- storage: QueueStorage or EphemeralStorage
+	//	- cursor: position to continue browsing from; empty string means 'start from the beginning'
+	//	- numMessages: limit number of returned messages, value less than or equal to zero means 'no limit'
+	//
+	// This function returns the messages and the cursor to fetch the next page with, or empty cursor if there is no more message.
+	//
+	// Notes:
+	//	- cursor is opaque and specific to queue implementation
+	//	- order of returned messages depends on queue implementation, but is stable across pages
+	//	- Browse does not move messages or update their timestamps
+	Browse(storage StorageType, cursor string, numMessages int) ([]*QueueMessage, string, error)
+
+	// GetById returns the message with the specified id from the specified storage, without moving it.
+	// Nil is returned if there is no such message.
+	GetById(storage StorageType, id string) (*QueueMessage, error)
+
+	// RemoveById removes the message with the specified id from the specified storage and returns the removed message.
+	// Nil is returned if there is no such message.
+	//
+	// Notes:
+	//	- removing a message from queue storage cancels it before it is taken
+	//	- removing a message from ephemeral storage has the same effect as Finish
+	RemoveById(storage StorageType, id string) (*QueueMessage, error)
+
+	// UpdatePayload replaces payload of the message with the specified id in the specified storage and returns the updated message.
+	// Nil is returned if there is no such message.
+	//
+	// Notes:
+	//	- the message is updated in place, its position in the storage and its timestamps are not changed
+	//	- only the payload is updated: updating message metadata by id is out of scope of the queue API, metadata is kept as is
+	UpdatePayload(storage StorageType, id string, payload []byte) (*QueueMessage, error)
+
+	// PurgeQueueStorage removes all messages from queue storage and returns number of removed messages.
+	PurgeQueueStorage() (int, error)
+
+	// PurgeEphemeralStorage removes all messages from ephemeral storage and returns number of removed messages.
+	// If ephemeral storage is disabled, there is nothing to remove and 0 is returned.
+	PurgeEphemeralStorage() (int, error)
+
+	// RequeueAllEphemeral moves all messages from ephemeral storage back to queue storage and returns number of moved messages.
+	//	- silent: same meaning as Requeue's silent parameter
+	//
+	// If ephemeral storage is disabled, there is nothing to move and 0 is returned.
+	RequeueAllEphemeral(silent bool) (int, error)
+
+	// Pause stops consumption of the queue: Take returns ErrorQueueIsPaused until Resume is called.
+	// Other operations, including Queue, keep working while the queue is paused.
+	//
+	// Note: whether paused state survives application restarts depends on queue implementation
+	Pause() error
+
+	// Resume resumes consumption of a paused queue.
+	Resume() error
+
+	// IsPaused returns true if the queue is paused, false otherwise.
+	IsPaused() bool
+}
+
+// IRestorable is implemented by queues that can restore messages as they are, e.g. from a backup, see Import.
+type IRestorable interface {
+	// Restore puts a message to the specified storage, keeping its id, timestamps and NumRequeues.
+	//	- A message with the same id already in the storage is replaced.
+	//	- Capacities are enforced: ErrorQueueIsFull or ErrorEphemeralIsFull is returned if the storage is full.
+	//	- ErrorOperationNotSupported is returned for ephemeral storage if ephemeral storage is disabled.
+	Restore(storage StorageType, msg *QueueMessage) error
 }
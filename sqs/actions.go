@@ -0,0 +1,357 @@
+package sqs
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"github.com/btnguyen2k/singu"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type actionFunc func(s *Server, req *request) (interface{}, *apiError)
+
+var actions = map[string]actionFunc{
+	"SendMessage":             (*Server).sendMessage,
+	"ReceiveMessage":          (*Server).receiveMessage,
+	"DeleteMessage":           (*Server).deleteMessage,
+	"ChangeMessageVisibility": (*Server).changeMessageVisibility,
+	"GetQueueAttributes":      (*Server).getQueueAttributes,
+	"GetQueueUrl":             (*Server).getQueueUrl,
+	"ListQueues":              (*Server).listQueues,
+}
+
+// attributes is a set of name-value pairs, marshalled as a list of <Attribute> elements in XML and as an object in JSON.
+type attributes map[string]string
+
+// MarshalXML implements xml.Marshaler.MarshalXML
+func (a attributes) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attr := struct {
+			Name  string `xml:"Name"`
+			Value string `xml:"Value"`
+		}{name, a[name]}
+		if err := e.EncodeElement(attr, start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectAttributes returns attributes requested by names ("All" selects all attributes).
+func selectAttributes(all attributes, names []string) attributes {
+	if len(names) == 0 {
+		return nil
+	}
+	result := make(attributes)
+	for _, name := range names {
+		if name == "All" {
+			return all
+		}
+		if value, ok := all[name]; ok {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func millis(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+func (s *Server) queueOf(req *request) (singu.IQueue, *apiError) {
+	if req.QueueUrl == "" && strings.Trim(req.path, "/") == "" {
+		return nil, errMissingParameter("QueueUrl")
+	}
+	queue := s.getQueue(req.queueName())
+	if queue == nil {
+		return nil, errNonExistentQueue()
+	}
+	return queue, nil
+}
+
+// queueUrl returns the URL of the queue, in format <base-url>/<account-id>/<queue-name>.
+func (s *Server) queueUrl(req *request, name string) string {
+	return strings.TrimRight(req.baseUrl, "/") + "/" + s.config.AccountId + "/" + name
+}
+
+// newReceiptHandle returns a receipt handle for the message, unique to each receive so that a stale handle can not refer
+// to a later delivery of the same message.
+func newReceiptHandle(id string) string {
+	return id + receiptHandleSeparator + singu.UniqueId()
+}
+
+// setVisibilityDeadline records the time a received message becomes visible again.
+func (s *Server) setVisibilityDeadline(queue, receiptHandle string, deadline time.Time) {
+	id := receiptHandle[:strings.LastIndex(receiptHandle, receiptHandleSeparator)]
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.inFlight[queue][id] = &inFlightMessage{receiptHandle: receiptHandle, deadline: deadline}
+}
+
+// removeInFlight stops tracking the visibility of the message the receipt handle was issued for, and returns the
+// message's id. An error is returned if the message is not in flight, or if the handle was issued for another receive.
+func (s *Server) removeInFlight(queue, receiptHandle string) (string, *apiError) {
+	sep := strings.LastIndex(receiptHandle, receiptHandleSeparator)
+	if sep < 0 {
+		return "", errInvalidReceiptHandle(receiptHandle)
+	}
+	id := receiptHandle[:sep]
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	msg, ok := s.inFlight[queue][id]
+	if !ok {
+		return "", &apiError{http.StatusBadRequest, "MessageNotInflight", "AWS.SimpleQueueService.MessageNotInflight", "The message referred to isn't in flight."}
+	}
+	if msg.receiptHandle != receiptHandle {
+		return "", errInvalidReceiptHandle(receiptHandle)
+	}
+	delete(s.inFlight[queue], id)
+	return id, nil
+}
+
+// requeueExpired re-queues received messages whose visibility timeout has expired.
+func (s *Server) requeueExpired(queue singu.IQueue) *apiError {
+	now := s.config.Clock.Now()
+	expired := make([]string, 0)
+	s.lock.Lock()
+	for id, msg := range s.inFlight[queue.Name()] {
+		if !msg.deadline.After(now) {
+			expired = append(expired, id)
+			delete(s.inFlight[queue.Name()], id)
+		}
+	}
+	s.lock.Unlock()
+	for _, id := range expired {
+		if _, err := queue.Requeue(id, false); err != nil {
+			return errFromQueue(err)
+		}
+	}
+	return nil
+}
+
+type sendMessageResult struct {
+	XMLName          xml.Name `xml:"SendMessageResult" json:"-"`
+	MessageId        string   `xml:"MessageId" json:"MessageId"`
+	MD5OfMessageBody string   `xml:"MD5OfMessageBody" json:"MD5OfMessageBody"`
+}
+
+func (s *Server) sendMessage(req *request) (interface{}, *apiError) {
+	queue, apiErr := s.queueOf(req)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if req.MessageBody == "" {
+		return nil, errMissingParameter("MessageBody")
+	}
+	if len(req.MessageBody) > s.config.MaxMessageSize {
+		return nil, errInvalidParameter("One or more parameters are invalid. Reason: Message must be shorter than " + strconv.Itoa(s.config.MaxMessageSize) + " bytes.")
+	}
+	body := []byte(req.MessageBody)
+	msg, err := queue.Queue(singu.NewQueueMessage(body))
+	if err != nil {
+		return nil, errFromQueue(err)
+	}
+	return &sendMessageResult{MessageId: msg.Id, MD5OfMessageBody: md5Hex(body)}, nil
+}
+
+type message struct {
+	MessageId     string     `xml:"MessageId" json:"MessageId"`
+	ReceiptHandle string     `xml:"ReceiptHandle" json:"ReceiptHandle"`
+	MD5OfBody     string     `xml:"MD5OfBody" json:"MD5OfBody"`
+	Body          string     `xml:"Body" json:"Body"`
+	Attributes    attributes `xml:"Attribute" json:"Attributes,omitempty"`
+}
+
+type receiveMessageResult struct {
+	XMLName  xml.Name   `xml:"ReceiveMessageResult" json:"-"`
+	Messages []*message `xml:"Message" json:"Messages,omitempty"`
+}
+
+func (s *Server) receiveMessage(req *request) (interface{}, *apiError) {
+	queue, apiErr := s.queueOf(req)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	maxMessages := 1
+	if req.MaxNumberOfMessages != nil {
+		if maxMessages = *req.MaxNumberOfMessages; maxMessages < 1 || maxMessages > 10 {
+			return nil, errInvalidParameter("Value for parameter MaxNumberOfMessages is invalid. Reason: Must be between 1 and 10.")
+		}
+	}
+	visibilityTimeout := s.config.VisibilityTimeout
+	if req.VisibilityTimeout != nil {
+		if visibilityTimeout = time.Duration(*req.VisibilityTimeout) * time.Second; visibilityTimeout < 0 || visibilityTimeout > maxVisibilityTimeout {
+			return nil, errInvalidParameter("Value for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and 43200.")
+		}
+	}
+	var waitTime time.Duration
+	if req.WaitTimeSeconds != nil {
+		if waitTime = time.Duration(*req.WaitTimeSeconds) * time.Second; waitTime < 0 || waitTime > maxWaitTime {
+			return nil, errInvalidParameter("Value for parameter WaitTimeSeconds is invalid. Reason: Must be between 0 and 20.")
+		}
+	}
+
+	result := &receiveMessageResult{}
+	deadline := time.Now().Add(waitTime)
+	for {
+		if apiErr := s.requeueExpired(queue); apiErr != nil {
+			return nil, apiErr
+		}
+		for len(result.Messages) < maxMessages {
+			msg, err := queue.Take()
+			if err == singu.ErrorEphemeralIsFull || err == singu.ErrorQueueIsPaused {
+				break
+			}
+			if err != nil {
+				return nil, errFromQueue(err)
+			}
+			if msg == nil {
+				break
+			}
+			receiptHandle := newReceiptHandle(msg.Id)
+			s.setVisibilityDeadline(queue.Name(), receiptHandle, s.config.Clock.Now().Add(visibilityTimeout))
+			result.Messages = append(result.Messages, &message{
+				MessageId:     msg.Id,
+				ReceiptHandle: receiptHandle,
+				MD5OfBody:     md5Hex(msg.Payload),
+				Body:          string(msg.Payload),
+				Attributes: selectAttributes(attributes{
+					"ApproximateReceiveCount":          strconv.Itoa(msg.NumRequeues + 1),
+					"SentTimestamp":                    millis(msg.Timestamp),
+					"ApproximateFirstReceiveTimestamp": millis(msg.TakenTimestamp),
+				}, req.AttributeNames),
+			})
+		}
+		if len(result.Messages) > 0 || !time.Now().Before(deadline) {
+			return result, nil
+		}
+		time.Sleep(s.config.PollInterval)
+	}
+}
+
+func (s *Server) deleteMessage(req *request) (interface{}, *apiError) {
+	queue, apiErr := s.queueOf(req)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if req.ReceiptHandle == "" {
+		return nil, errMissingParameter("ReceiptHandle")
+	}
+	// a message that is no longer in flight may have been re-queued and received again, deleting it would lose the
+	// later delivery
+	id, apiErr := s.removeInFlight(queue.Name(), req.ReceiptHandle)
+	if apiErr != nil {
+		return nil, errInvalidReceiptHandle(req.ReceiptHandle)
+	}
+	if err := queue.Finish(id); err != nil {
+		return nil, errFromQueue(err)
+	}
+	return nil, nil
+}
+
+func (s *Server) changeMessageVisibility(req *request) (interface{}, *apiError) {
+	queue, apiErr := s.queueOf(req)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if req.ReceiptHandle == "" {
+		return nil, errMissingParameter("ReceiptHandle")
+	}
+	if req.VisibilityTimeout == nil {
+		return nil, errMissingParameter("VisibilityTimeout")
+	}
+	visibilityTimeout := time.Duration(*req.VisibilityTimeout) * time.Second
+	if visibilityTimeout < 0 || visibilityTimeout > maxVisibilityTimeout {
+		return nil, errInvalidParameter("Value for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and 43200.")
+	}
+	id, apiErr := s.removeInFlight(queue.Name(), req.ReceiptHandle)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if visibilityTimeout == 0 {
+		// the message becomes visible immediately
+		if _, err := queue.Requeue(id, false); err != nil {
+			return nil, errFromQueue(err)
+		}
+		return nil, nil
+	}
+	s.setVisibilityDeadline(queue.Name(), req.ReceiptHandle, s.config.Clock.Now().Add(visibilityTimeout))
+	return nil, nil
+}
+
+type getQueueAttributesResult struct {
+	XMLName    xml.Name   `xml:"GetQueueAttributesResult" json:"-"`
+	Attributes attributes `xml:"Attribute" json:"Attributes,omitempty"`
+}
+
+func (s *Server) getQueueAttributes(req *request) (interface{}, *apiError) {
+	queue, apiErr := s.queueOf(req)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := s.requeueExpired(queue); apiErr != nil {
+		return nil, apiErr
+	}
+	queueSize, err := queue.QueueSize()
+	if err != nil {
+		return nil, errFromQueue(err)
+	}
+	ephemeralSize, err := queue.EphemeralSize()
+	if err != nil {
+		return nil, errFromQueue(err)
+	}
+	all := attributes{
+		"ApproximateNumberOfMessages":           strconv.Itoa(queueSize),
+		"ApproximateNumberOfMessagesNotVisible": strconv.Itoa(ephemeralSize),
+		"ApproximateNumberOfMessagesDelayed":    "0",
+		"VisibilityTimeout":                     strconv.Itoa(int(s.config.VisibilityTimeout / time.Second)),
+		"MaximumMessageSize":                    strconv.Itoa(s.config.MaxMessageSize),
+		"ReceiveMessageWaitTimeSeconds":         "0",
+		"QueueArn":                              "arn:aws:sqs:" + s.config.Region + ":" + s.config.AccountId + ":" + queue.Name(),
+	}
+	return &getQueueAttributesResult{Attributes: selectAttributes(all, req.AttributeNames)}, nil
+}
+
+type getQueueUrlResult struct {
+	XMLName  xml.Name `xml:"GetQueueUrlResult" json:"-"`
+	QueueUrl string   `xml:"QueueUrl" json:"QueueUrl"`
+}
+
+func (s *Server) getQueueUrl(req *request) (interface{}, *apiError) {
+	if req.QueueName == "" {
+		return nil, errMissingParameter("QueueName")
+	}
+	if s.getQueue(req.QueueName) == nil {
+		return nil, errNonExistentQueue()
+	}
+	return &getQueueUrlResult{QueueUrl: s.queueUrl(req, req.QueueName)}, nil
+}
+
+type listQueuesResult struct {
+	XMLName   xml.Name `xml:"ListQueuesResult" json:"-"`
+	QueueUrls []string `xml:"QueueUrl" json:"QueueUrls,omitempty"`
+}
+
+func (s *Server) listQueues(req *request) (interface{}, *apiError) {
+	result := &listQueuesResult{}
+	for _, name := range s.queueNames() {
+		if strings.HasPrefix(name, req.QueueNamePrefix) {
+			result.QueueUrls = append(result.QueueUrls, s.queueUrl(req, name))
+		}
+	}
+	return result, nil
+}
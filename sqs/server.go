@@ -0,0 +1,355 @@
+// Package sqs emulates the Amazon SQS HTTP API on top of singu queues, so that services written against the AWS SDK's
+// SQS client can use singu as a local, self-hosted replacement.
+//
+// Both wire protocols of SQS are supported: the query protocol (form-encoded requests, XML responses, used by older
+// SDKs such as aws-sdk-go) and the JSON protocol (header "X-Amz-Target: AmazonSQS.<Action>", used by newer SDKs).
+//
+// Supported actions:
+//	- SendMessage: IQueue.Queue. DelaySeconds and message attributes are not supported and ignored.
+//	- ReceiveMessage: IQueue.Take, supports MaxNumberOfMessages, VisibilityTimeout and WaitTimeSeconds (long-polling).
+//	- DeleteMessage: IQueue.Finish.
+//	- ChangeMessageVisibility: extends or shortens the visibility timeout of a received message.
+//	- GetQueueAttributes: ApproximateNumberOfMessages (IQueue.QueueSize), ApproximateNumberOfMessagesNotVisible
+//	  (IQueue.EphemeralSize), VisibilityTimeout, MaximumMessageSize and QueueArn.
+//	- GetQueueUrl and ListQueues.
+//
+// Queue URLs are in format <base-url>/<account-id>/<queue-name>. Receipt handles are made of the id of the message in
+// ephemeral storage and a nonce, so that each receive of a message gets a different handle; DeleteMessage and
+// ChangeMessageVisibility reject handles of earlier receives. A received message that is not deleted before its visibility timeout expires is re-queued (IQueue.Requeue)
+// the next time the queue is received from or its attributes are queried.
+//
+// Requests are not authenticated: AWS signatures are accepted but not verified.
+package sqs
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/btnguyen2k/singu"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAccountId is the default account id used in queue URLs and ARNs
+	DefaultAccountId = "000000000000"
+
+	// DefaultRegion is the default region used in queue ARNs
+	DefaultRegion = "us-east-1"
+
+	// DefaultVisibilityTimeout is the default visibility timeout of received messages
+	DefaultVisibilityTimeout = 30 * time.Second
+
+	// DefaultMaxMessageSize is the default max size of a message's body, in bytes
+	DefaultMaxMessageSize = 256 * 1024
+
+	// DefaultPollInterval is the default interval between two Take attempts while long-polling
+	DefaultPollInterval = 100 * time.Millisecond
+
+	// maxWaitTime is the upper limit of WaitTimeSeconds, as specified by SQS
+	maxWaitTime = 20 * time.Second
+
+	// maxVisibilityTimeout is the upper limit of VisibilityTimeout, as specified by SQS
+	maxVisibilityTimeout = 12 * time.Hour
+
+	xmlns = "http://queue.amazonaws.com/doc/2012-11-05/"
+
+	// receiptHandleSeparator separates the message id from the nonce in receipt handles
+	receiptHandleSeparator = "."
+)
+
+// Config holds the server's configurations.
+type Config struct {
+	// BaseUrl is the base URL of queue URLs returned to clients (e.g. "http://localhost:9324").
+	// If empty, it is derived from the request's Host header.
+	BaseUrl string
+
+	// AccountId is used in queue URLs and ARNs, default value is DefaultAccountId.
+	AccountId string
+
+	// Region is used in queue ARNs, default value is DefaultRegion.
+	Region string
+
+	// VisibilityTimeout is the visibility timeout of received messages if not specified by ReceiveMessage requests,
+	// default value is DefaultVisibilityTimeout.
+	VisibilityTimeout time.Duration
+
+	// MaxMessageSize is the max size of a message's body in bytes, default value is DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// PollInterval is the interval between two Take attempts while long-polling, default value is DefaultPollInterval.
+	PollInterval time.Duration
+
+	// Clock is used to track visibility timeouts, default value is singu.SystemClock.
+	Clock singu.Clock
+}
+
+// NewServer creates a new Server instance.
+func NewServer(config Config) *Server {
+	if config.AccountId == "" {
+		config.AccountId = DefaultAccountId
+	}
+	if config.Region == "" {
+		config.Region = DefaultRegion
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	config.Clock = singu.ClockOrDefault(config.Clock)
+	return &Server{
+		config:   config,
+		queues:   make(map[string]singu.IQueue),
+		inFlight: make(map[string]map[string]*inFlightMessage),
+	}
+}
+
+// Server is a http.Handler that exposes registered singu.IQueue instances over the SQS API.
+type Server struct {
+	config   Config
+	queues   map[string]singu.IQueue                // registered queues, by name
+	inFlight map[string]map[string]*inFlightMessage // received messages, by queue name and message id
+	lock     sync.Mutex                             // lock to avoid race condition
+}
+
+// inFlightMessage tracks the latest receive of a message.
+type inFlightMessage struct {
+	receiptHandle string
+	deadline      time.Time // time the message becomes visible again
+}
+
+// RegisterQueue registers a queue with the server, the queue is exposed under its name.
+func (s *Server) RegisterQueue(queue singu.IQueue) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queues[queue.Name()] = queue
+	if _, ok := s.inFlight[queue.Name()]; !ok {
+		s.inFlight[queue.Name()] = make(map[string]*inFlightMessage)
+	}
+}
+
+func (s *Server) getQueue(name string) singu.IQueue {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.queues[name]
+}
+
+func (s *Server) queueNames() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	names := make([]string, 0, len(s.queues))
+	for name := range s.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// request holds parameters of an action, decoded from either wire protocol.
+type request struct {
+	Action              string
+	QueueUrl            string
+	QueueName           string
+	QueueNamePrefix     string
+	MessageBody         string
+	ReceiptHandle       string
+	MaxNumberOfMessages *int
+	VisibilityTimeout   *int
+	WaitTimeSeconds     *int
+	AttributeNames      []string
+	json                bool   // true if the request was sent with the JSON protocol
+	path                string // request path, used as queue URL if QueueUrl is not specified
+	baseUrl             string
+}
+
+// parseRequest decodes the request from either wire protocol, an error is returned if the request is malformed.
+func parseRequest(r *http.Request) (*request, *apiError) {
+	req := &request{path: r.URL.Path}
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		req.json = true
+		req.Action = strings.TrimPrefix(target, "AmazonSQS.")
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return req, errInvalidParameter(err.Error())
+		}
+		var params struct {
+			QueueUrl, QueueName, QueueNamePrefix, MessageBody, ReceiptHandle string
+			MaxNumberOfMessages, VisibilityTimeout, WaitTimeSeconds          *int
+			AttributeNames, MessageSystemAttributeNames                      []string
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &params); err != nil {
+				return req, errInvalidParameter("malformed JSON request body: " + err.Error())
+			}
+		}
+		req.QueueUrl, req.QueueName, req.QueueNamePrefix = params.QueueUrl, params.QueueName, params.QueueNamePrefix
+		req.MessageBody, req.ReceiptHandle = params.MessageBody, params.ReceiptHandle
+		req.MaxNumberOfMessages, req.VisibilityTimeout, req.WaitTimeSeconds = params.MaxNumberOfMessages, params.VisibilityTimeout, params.WaitTimeSeconds
+		req.AttributeNames = append(params.AttributeNames, params.MessageSystemAttributeNames...)
+		return req, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return req, errInvalidParameter(err.Error())
+	}
+	form := r.Form
+	req.Action = form.Get("Action")
+	req.QueueUrl, req.QueueName, req.QueueNamePrefix = form.Get("QueueUrl"), form.Get("QueueName"), form.Get("QueueNamePrefix")
+	req.MessageBody, req.ReceiptHandle = form.Get("MessageBody"), form.Get("ReceiptHandle")
+	for _, p := range []struct {
+		name  string
+		value **int
+	}{{"MaxNumberOfMessages", &req.MaxNumberOfMessages}, {"VisibilityTimeout", &req.VisibilityTimeout}, {"WaitTimeSeconds", &req.WaitTimeSeconds}} {
+		if v := form.Get(p.name); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return req, errInvalidParameter("invalid value for parameter " + p.name)
+			}
+			*p.value = &i
+		}
+	}
+	for _, prefix := range []string{"AttributeName.", "MessageSystemAttributeName."} {
+		for i := 1; form.Get(prefix+strconv.Itoa(i)) != ""; i++ {
+			req.AttributeNames = append(req.AttributeNames, form.Get(prefix+strconv.Itoa(i)))
+		}
+	}
+	return req, nil
+}
+
+// queueName extracts the queue name from the request's QueueUrl, or from the request path if QueueUrl is not specified.
+func (req *request) queueName() string {
+	path := req.path
+	if req.QueueUrl != "" {
+		if u, err := url.Parse(req.QueueUrl); err == nil {
+			path = u.Path
+		}
+	}
+	path = strings.TrimRight(path, "/")
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// ServeHTTP implements http.Handler.ServeHTTP
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, int64(s.config.MaxMessageSize)*2+64*1024)
+	req, apiErr := parseRequest(r)
+	req.baseUrl = s.config.BaseUrl
+	if req.baseUrl == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		req.baseUrl = scheme + "://" + r.Host
+	}
+	var result interface{}
+	if apiErr == nil {
+		handler, ok := actions[req.Action]
+		if !ok {
+			apiErr = &apiError{http.StatusBadRequest, "InvalidAction", "AWS.SimpleQueueService.InvalidAction", "The action " + req.Action + " is not valid for this endpoint."}
+		} else {
+			result, apiErr = handler(s, req)
+		}
+	}
+	requestId := singu.UniqueId()
+	if apiErr != nil {
+		s.writeError(w, req, apiErr, requestId)
+		return
+	}
+	if req.json {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Header().Set("X-Amzn-RequestId", requestId)
+		if result == nil {
+			result = struct{}{}
+		}
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	resp := xmlResponse{
+		XMLName:   xml.Name{Local: req.Action + "Response"},
+		Xmlns:     xmlns,
+		Result:    result,
+		RequestId: requestId,
+	}
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(resp)
+}
+
+// xmlResponse is the envelope of query protocol responses.
+type xmlResponse struct {
+	XMLName   xml.Name
+	Xmlns     string      `xml:"xmlns,attr"`
+	Result    interface{} `xml:",omitempty"`
+	RequestId string      `xml:"ResponseMetadata>RequestId"`
+}
+
+// apiError is an error responded to clients.
+type apiError struct {
+	status    int
+	code      string // error code of the JSON protocol
+	queryCode string // error code of the query protocol
+	message   string
+}
+
+func errInvalidParameter(message string) *apiError {
+	return &apiError{http.StatusBadRequest, "InvalidParameterValue", "InvalidParameterValue", message}
+}
+
+func errMissingParameter(name string) *apiError {
+	return &apiError{http.StatusBadRequest, "MissingParameter", "MissingParameter", "The request must contain the parameter " + name + "."}
+}
+
+func errNonExistentQueue() *apiError {
+	return &apiError{http.StatusBadRequest, "QueueDoesNotExist", "AWS.SimpleQueueService.NonExistentQueue", "The specified queue does not exist."}
+}
+
+func errInvalidReceiptHandle(receiptHandle string) *apiError {
+	return &apiError{http.StatusBadRequest, "ReceiptHandleIsInvalid", "ReceiptHandleIsInvalid", "The input receipt handle \"" + receiptHandle + "\" is not a valid receipt handle."}
+}
+
+// errFromQueue maps an error returned by a queue to an apiError.
+func errFromQueue(err error) *apiError {
+	if err == singu.ErrorQueueIsFull {
+		return &apiError{http.StatusForbidden, "OverLimit", "OverLimit", err.Error()}
+	}
+	return &apiError{http.StatusInternalServerError, "InternalError", "InternalError", err.Error()}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, req *request, apiErr *apiError, requestId string) {
+	errType := "Sender"
+	if apiErr.status >= 500 {
+		errType = "Receiver"
+	}
+	if req.json {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Header().Set("X-Amzn-RequestId", requestId)
+		w.Header().Set("X-Amzn-Query-Error", apiErr.queryCode+";"+errType)
+		w.WriteHeader(apiErr.status)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.sqs#" + apiErr.code, "message": apiErr.message})
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(apiErr.status)
+	resp := struct {
+		XMLName   xml.Name `xml:"ErrorResponse"`
+		Xmlns     string   `xml:"xmlns,attr"`
+		Type      string   `xml:"Error>Type"`
+		Code      string   `xml:"Error>Code"`
+		Message   string   `xml:"Error>Message"`
+		RequestId string   `xml:"RequestId"`
+	}{Xmlns: xmlns, Type: errType, Code: apiErr.queryCode, Message: apiErr.message, RequestId: requestId}
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,521 @@
+package stomp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ack modes
+const (
+	ackAuto             = "auto"
+	ackClient           = "client"
+	ackClientIndividual = "client-individual"
+)
+
+// conn serves a client connection.
+type conn struct {
+	server      *Server
+	netConn     net.Conn
+	reader      *bufio.Reader
+	writer      *bufio.Writer
+	writeLock   sync.Mutex // lock to serialize frames written by the reader loop, subscriptions and heart-beating
+	connected   bool
+	readTimeout time.Duration // zero means no timeout
+	done        chan struct{} // closed when the connection ends
+
+	lock         sync.Mutex               // lock protecting the fields below
+	subs         map[string]*subscription // subscriptions, by id
+	pending      map[string]*pending      // unacknowledged messages, by ack id
+	lastAckSeq   uint64
+	transactions map[string][]*frame // buffered frames, by transaction id
+}
+
+// subscription is a SUBSCRIBE-d destination of a connection.
+type subscription struct {
+	id, destination string
+	queue           singu.IQueue
+	ackMode         string
+	prefetch        int
+	inFlight        int
+	stopped         bool
+	stop            chan struct{}
+	wake            chan struct{}
+}
+
+// pending is a message delivered to the client but not acknowledged yet.
+type pending struct {
+	seq   uint64
+	sub   *subscription
+	msgId string
+}
+
+func newConn(server *Server, netConn net.Conn) *conn {
+	return &conn{
+		server:       server,
+		netConn:      netConn,
+		reader:       bufio.NewReader(netConn),
+		writer:       bufio.NewWriter(netConn),
+		done:         make(chan struct{}),
+		subs:         make(map[string]*subscription),
+		pending:      make(map[string]*pending),
+		transactions: make(map[string][]*frame),
+	}
+}
+
+// errDisconnect signals the reader loop that the client has disconnected gracefully.
+var errDisconnect = errors.New("disconnect")
+
+// serve reads and handles frames until the connection is closed.
+func (c *conn) serve() {
+	defer c.close()
+	for {
+		// the deadline is extended by every frame and every heart-beat the client sends
+		if c.readTimeout > 0 {
+			c.netConn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		}
+		f, err := readFrame(c.reader, c.server.config.MaxBodySize)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				c.sendError(nil, "heart-beat timeout")
+			} else if _, ok := err.(net.Error); !ok && err != io.EOF && err != io.ErrUnexpectedEOF {
+				// malformed frame
+				c.sendError(nil, err.Error())
+			}
+			return
+		}
+		if f == nil {
+			// heart-beat
+			continue
+		}
+		if err := c.handle(f); err == errDisconnect {
+			return
+		} else if err != nil {
+			c.sendError(f, err.Error())
+			return
+		}
+	}
+}
+
+// close re-queues unacknowledged messages and stops subscriptions.
+func (c *conn) close() {
+	c.lock.Lock()
+	for _, sub := range c.subs {
+		sub.stopped = true
+	}
+	toRequeue := make([]*pending, 0, len(c.pending))
+	for _, p := range c.pending {
+		toRequeue = append(toRequeue, p)
+	}
+	c.pending = make(map[string]*pending)
+	c.lock.Unlock()
+	close(c.done)
+	for _, p := range toRequeue {
+		p.sub.queue.Requeue(p.msgId, true)
+	}
+}
+
+func (c *conn) send(f *frame) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return f.writeTo(c.writer)
+}
+
+// sendError sends an ERROR frame in response to the frame f (nil if the error is not caused by a specific frame).
+func (c *conn) sendError(f *frame, message string) {
+	errFrame := newFrame("ERROR", "message", message, "content-type", "text/plain")
+	if f != nil {
+		if receipt := f.header("receipt"); receipt != "" {
+			errFrame.addHeader("receipt-id", receipt)
+		}
+		errFrame.body = []byte(fmt.Sprintf("error handling %s frame: %s", f.command, message))
+	}
+	c.send(errFrame)
+}
+
+// handle handles a frame and sends a receipt if requested.
+func (c *conn) handle(f *frame) error {
+	if f.command == "CONNECT" || f.command == "STOMP" {
+		return c.handleConnect(f)
+	}
+	if !c.connected {
+		return errors.New("not connected")
+	}
+	var err error
+	if tx := f.header("transaction"); tx != "" && (f.command == "SEND" || f.command == "ACK" || f.command == "NACK") {
+		err = c.bufferInTransaction(tx, f)
+	} else {
+		switch f.command {
+		case "SEND":
+			err = c.handleSend(f)
+		case "SUBSCRIBE":
+			err = c.handleSubscribe(f)
+		case "UNSUBSCRIBE":
+			err = c.handleUnsubscribe(f)
+		case "ACK":
+			err = c.handleAck(f, false)
+		case "NACK":
+			err = c.handleAck(f, true)
+		case "BEGIN":
+			err = c.handleBegin(f)
+		case "COMMIT":
+			err = c.handleCommit(f)
+		case "ABORT":
+			err = c.handleAbort(f)
+		case "DISCONNECT":
+			err = errDisconnect
+		default:
+			err = fmt.Errorf("unknown command [%s]", f.command)
+		}
+	}
+	if err == nil || err == errDisconnect {
+		if receipt := f.header("receipt"); receipt != "" {
+			c.send(newFrame("RECEIPT", "receipt-id", receipt))
+		}
+	}
+	return err
+}
+
+// parseHeartBeat parses a heart-beat header, in format "<cx>,<cy>" in milliseconds.
+func parseHeartBeat(value string) (time.Duration, time.Duration, error) {
+	if value == "" {
+		return 0, 0, nil
+	}
+	tokens := strings.Split(value, ",")
+	if len(tokens) != 2 {
+		return 0, 0, fmt.Errorf("invalid heart-beat [%s]", value)
+	}
+	cx, err1 := strconv.Atoi(strings.TrimSpace(tokens[0]))
+	cy, err2 := strconv.Atoi(strings.TrimSpace(tokens[1]))
+	if err1 != nil || err2 != nil || cx < 0 || cy < 0 {
+		return 0, 0, fmt.Errorf("invalid heart-beat [%s]", value)
+	}
+	return time.Duration(cx) * time.Millisecond, time.Duration(cy) * time.Millisecond, nil
+}
+
+// negotiate returns the heart-beating interval agreed by both parties, zero means no heart-beating.
+func negotiate(canDo, wants time.Duration) time.Duration {
+	if canDo <= 0 || wants <= 0 {
+		return 0
+	}
+	if canDo > wants {
+		return canDo
+	}
+	return wants
+}
+
+func (c *conn) handleConnect(f *frame) error {
+	if c.connected {
+		return errors.New("already connected")
+	}
+	if versions := f.header("accept-version"); versions != "" && !strings.Contains(","+versions+",", ",1.2,") {
+		return errors.New("supported protocol versions are 1.2")
+	}
+	if auth := c.server.config.Authenticate; auth != nil && !auth(f.header("login"), f.header("passcode")) {
+		return errors.New("authentication failed")
+	}
+	cx, cy, err := parseHeartBeat(f.header("heart-beat"))
+	if err != nil {
+		return err
+	}
+	heartBeat := c.server.config.HeartBeat
+	if heartBeat < 0 {
+		heartBeat = 0
+	}
+	sendInterval, recvInterval := negotiate(heartBeat, cy), negotiate(cx, heartBeat)
+	c.connected = true
+	if recvInterval > 0 {
+		// be tolerant to network latency
+		c.readTimeout = 2 * recvInterval
+	}
+	ms := strconv.FormatInt(int64(heartBeat/time.Millisecond), 10)
+	if err := c.send(newFrame("CONNECTED", "version", "1.2", "heart-beat", ms+","+ms, "server", "singu/"+singu.Version)); err != nil {
+		return err
+	}
+	if sendInterval > 0 {
+		go c.sendHeartBeats(sendInterval)
+	}
+	return nil
+}
+
+// sendHeartBeats sends an EOL at every interval until the connection is closed.
+func (c *conn) sendHeartBeats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.writeLock.Lock()
+			c.writer.WriteByte('\n')
+			err := c.writer.Flush()
+			c.writeLock.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// queueOf returns the queue a destination refers to.
+func (c *conn) queueOf(destination string) (singu.IQueue, error) {
+	name := strings.TrimPrefix(destination, "/queue/")
+	if name == "" {
+		return nil, errors.New("missing destination")
+	}
+	queue, err := c.server.GetQueue(name)
+	if err == nil && queue == nil {
+		err = fmt.Errorf("unknown destination [%s]", destination)
+	}
+	return queue, err
+}
+
+func (c *conn) handleSend(f *frame) error {
+	queue, err := c.queueOf(f.header("destination"))
+	if err != nil {
+		return err
+	}
+	_, err = queue.Queue(singu.NewQueueMessage(f.body))
+	return err
+}
+
+func (c *conn) handleSubscribe(f *frame) error {
+	id := f.header("id")
+	if id == "" {
+		return errors.New("missing subscription id")
+	}
+	queue, err := c.queueOf(f.header("destination"))
+	if err != nil {
+		return err
+	}
+	sub := &subscription{
+		id:          id,
+		destination: f.header("destination"),
+		queue:       queue,
+		ackMode:     f.header("ack"),
+		prefetch:    1,
+		stop:        make(chan struct{}),
+		wake:        make(chan struct{}, 1),
+	}
+	if sub.ackMode == "" {
+		sub.ackMode = ackAuto
+	}
+	if sub.ackMode != ackAuto && sub.ackMode != ackClient && sub.ackMode != ackClientIndividual {
+		return fmt.Errorf("invalid ack mode [%s]", sub.ackMode)
+	}
+	if prefetch := f.header("prefetch-count"); prefetch != "" {
+		if sub.prefetch, err = strconv.Atoi(prefetch); err != nil || sub.prefetch <= 0 {
+			return fmt.Errorf("invalid prefetch-count [%s]", prefetch)
+		}
+	}
+	c.lock.Lock()
+	if _, ok := c.subs[id]; ok {
+		c.lock.Unlock()
+		return fmt.Errorf("duplicated subscription id [%s]", id)
+	}
+	c.subs[id] = sub
+	c.lock.Unlock()
+	go c.deliver(sub)
+	return nil
+}
+
+// deliver takes messages for the subscription and pushes them to the client until the subscription ends.
+func (c *conn) deliver(sub *subscription) {
+	for {
+		c.lock.Lock()
+		stopped, canTake := sub.stopped, sub.ackMode == ackAuto || sub.inFlight < sub.prefetch
+		c.lock.Unlock()
+		if stopped {
+			return
+		}
+		if canTake {
+			if msg, _ := sub.queue.Take(); msg != nil {
+				if !c.push(sub, msg) {
+					return
+				}
+				continue
+			}
+		}
+		select {
+		case <-sub.stop:
+			return
+		case <-c.done:
+			return
+		case <-sub.wake:
+		case <-time.After(c.server.config.PollInterval):
+		}
+	}
+}
+
+// push sends a taken message to the client, returns false if the subscription has ended.
+//	- ack:auto: the message is finished once the frame is sent, or re-queued if sending fails.
+//	- other ack modes: the message is pending until acknowledged, it is re-queued when the connection is closed.
+func (c *conn) push(sub *subscription, msg *singu.QueueMessage) bool {
+	f := newFrame("MESSAGE", "subscription", sub.id, "message-id", msg.Id, "destination", sub.destination)
+	if sub.ackMode != ackAuto {
+		c.lock.Lock()
+		if sub.stopped {
+			c.lock.Unlock()
+			sub.queue.Requeue(msg.Id, true)
+			return false
+		}
+		c.lastAckSeq++
+		ackId := strconv.FormatUint(c.lastAckSeq, 10)
+		c.pending[ackId] = &pending{seq: c.lastAckSeq, sub: sub, msgId: msg.Id}
+		sub.inFlight++
+		c.lock.Unlock()
+		f.addHeader("ack", ackId)
+	}
+	f.addHeader("content-length", strconv.Itoa(len(msg.Payload)))
+	f.body = msg.Payload
+	if err := c.send(f); err != nil {
+		// the connection is being closed, which re-queues pending messages
+		if sub.ackMode == ackAuto {
+			sub.queue.Requeue(msg.Id, true)
+		}
+		return false
+	}
+	if sub.ackMode == ackAuto {
+		sub.queue.Finish(msg.Id)
+	}
+	return true
+}
+
+func (c *conn) handleUnsubscribe(f *frame) error {
+	id := f.header("id")
+	c.lock.Lock()
+	sub, ok := c.subs[id]
+	if !ok {
+		c.lock.Unlock()
+		return fmt.Errorf("unknown subscription id [%s]", id)
+	}
+	delete(c.subs, id)
+	sub.stopped = true
+	close(sub.stop)
+	toRequeue := make([]*pending, 0)
+	for ackId, p := range c.pending {
+		if p.sub == sub {
+			toRequeue = append(toRequeue, p)
+			delete(c.pending, ackId)
+		}
+	}
+	c.lock.Unlock()
+	for _, p := range toRequeue {
+		if _, err := sub.queue.Requeue(p.msgId, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleAck handles ACK (nack=false) and NACK (nack=true) frames.
+func (c *conn) handleAck(f *frame, nack bool) error {
+	ackId := f.header("id")
+	c.lock.Lock()
+	p, ok := c.pending[ackId]
+	if !ok {
+		c.lock.Unlock()
+		return fmt.Errorf("unknown ack id [%s]", ackId)
+	}
+	acked := []*pending{p}
+	delete(c.pending, ackId)
+	if p.sub.ackMode == ackClient {
+		// cumulative acknowledgement: all messages of the subscription delivered before this one are acknowledged too
+		for id, other := range c.pending {
+			if other.sub == p.sub && other.seq < p.seq {
+				acked = append(acked, other)
+				delete(c.pending, id)
+			}
+		}
+	}
+	p.sub.inFlight -= len(acked)
+	c.lock.Unlock()
+	select {
+	case p.sub.wake <- struct{}{}:
+	default:
+	}
+	for _, a := range acked {
+		var err error
+		if nack {
+			_, err = a.sub.queue.Requeue(a.msgId, false)
+		} else {
+			err = a.sub.queue.Finish(a.msgId)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conn) bufferInTransaction(tx string, f *frame) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	frames, ok := c.transactions[tx]
+	if !ok {
+		return fmt.Errorf("unknown transaction [%s]", tx)
+	}
+	c.transactions[tx] = append(frames, f)
+	return nil
+}
+
+func (c *conn) handleBegin(f *frame) error {
+	tx := f.header("transaction")
+	if tx == "" {
+		return errors.New("missing transaction id")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.transactions[tx]; ok {
+		return fmt.Errorf("transaction [%s] already started", tx)
+	}
+	c.transactions[tx] = make([]*frame, 0)
+	return nil
+}
+
+// endTransaction removes the transaction and returns its buffered frames.
+func (c *conn) endTransaction(f *frame) ([]*frame, error) {
+	tx := f.header("transaction")
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	frames, ok := c.transactions[tx]
+	if !ok {
+		return nil, fmt.Errorf("unknown transaction [%s]", tx)
+	}
+	delete(c.transactions, tx)
+	return frames, nil
+}
+
+func (c *conn) handleCommit(f *frame) error {
+	frames, err := c.endTransaction(f)
+	if err != nil {
+		return err
+	}
+	for _, txFrame := range frames {
+		switch txFrame.command {
+		case "SEND":
+			err = c.handleSend(txFrame)
+		case "ACK":
+			err = c.handleAck(txFrame, false)
+		case "NACK":
+			err = c.handleAck(txFrame, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conn) handleAbort(f *frame) error {
+	_, err := c.endTransaction(f)
+	return err
+}
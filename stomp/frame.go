@@ -0,0 +1,156 @@
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/btnguyen2k/singu/internal/tcpserver"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxLineLength = 64 * 1024 // max length of a command or header line
+	maxHeaders    = 128       // max number of headers of a frame
+)
+
+var errFrameTooLarge = errors.New("frame too large")
+
+// frame is a STOMP frame.
+type frame struct {
+	command string
+	headers [][2]string // headers in order of appearance
+	body    []byte
+}
+
+func newFrame(command string, headers ...string) *frame {
+	f := &frame{command: command}
+	for i := 0; i+1 < len(headers); i += 2 {
+		f.headers = append(f.headers, [2]string{headers[i], headers[i+1]})
+	}
+	return f
+}
+
+// header returns the value of the first occurrence of the header, as specified by STOMP 1.2.
+func (f *frame) header(name string) string {
+	for _, h := range f.headers {
+		if h[0] == name {
+			return h[1]
+		}
+	}
+	return ""
+}
+
+func (f *frame) addHeader(name, value string) *frame {
+	f.headers = append(f.headers, [2]string{name, value})
+	return f
+}
+
+// escapesHeaders returns true if headers of the frame are escaped, which is the case for all frames but CONNECT and CONNECTED.
+func (f *frame) escapesHeaders() bool {
+	return f.command != "CONNECT" && f.command != "CONNECTED"
+}
+
+var (
+	headerEscaper   = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+	headerUnescaper = strings.NewReplacer("\\\\", "\\", "\\r", "\r", "\\n", "\n", "\\c", ":")
+)
+
+// writeTo serializes the frame.
+func (f *frame) writeTo(w *bufio.Writer) error {
+	w.WriteString(f.command)
+	w.WriteByte('\n')
+	for _, h := range f.headers {
+		if f.escapesHeaders() {
+			w.WriteString(headerEscaper.Replace(h[0]) + ":" + headerEscaper.Replace(h[1]))
+		} else {
+			w.WriteString(h[0] + ":" + h[1])
+		}
+		w.WriteByte('\n')
+	}
+	w.WriteByte('\n')
+	w.Write(f.body)
+	w.WriteByte(0)
+	return w.Flush()
+}
+
+// readLine reads a line terminated by "\n" or "\r\n".
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := tcpserver.ReadLine(r, maxLineLength)
+	if err == tcpserver.ErrorLineTooLong {
+		return "", errFrameTooLarge
+	}
+	return line, err
+}
+
+// readFrame reads the next frame, or a heart-beat which is returned as a nil frame. maxBodySize limits the size of the
+// frame's body.
+func readFrame(r *bufio.Reader, maxBodySize int) (*frame, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	// the previous frame's NUL may be followed by EOLs, which are heart-beats as well
+	command := strings.TrimLeft(line, "\x00")
+	if command == "" {
+		return nil, nil
+	}
+	f := &frame{command: command}
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		if len(f.headers) >= maxHeaders {
+			return nil, errFrameTooLarge
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("malformed header [%s]", line)
+		}
+		name, value := line[:i], line[i+1:]
+		if f.escapesHeaders() {
+			name, value = headerUnescaper.Replace(name), headerUnescaper.Replace(value)
+		}
+		f.headers = append(f.headers, [2]string{name, value})
+	}
+	if contentLength := f.header("content-length"); contentLength != "" {
+		size, err := strconv.Atoi(contentLength)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid content-length [%s]", contentLength)
+		}
+		if size > maxBodySize {
+			return nil, errFrameTooLarge
+		}
+		f.body = make([]byte, size+1)
+		if _, err := io.ReadFull(r, f.body); err != nil {
+			return nil, err
+		}
+		if f.body[size] != 0 {
+			return nil, errors.New("frame is not terminated by NUL")
+		}
+		f.body = f.body[:size]
+		return f, nil
+	}
+	var body bytes.Buffer
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			break
+		}
+		if body.Len() >= maxBodySize {
+			return nil, errFrameTooLarge
+		}
+		body.WriteByte(b)
+	}
+	f.body = body.Bytes()
+	return f, nil
+}
@@ -0,0 +1,84 @@
+// Package stomp implements a STOMP 1.2 broker front end on top of singu queues, so that STOMP clients and
+// message-broker tooling can produce to and consume from singu queues.
+//
+// Frame mapping:
+//	- Destinations are mapped to named queues, a "/queue/" prefix is stripped (i.e. "/queue/orders" and "orders" both
+//	  refer to the queue "orders").
+//	- SEND: IQueue.Queue.
+//	- SUBSCRIBE: messages are taken with IQueue.Take and pushed to the client as MESSAGE frames.
+//	  With "ack:auto" (the default) messages are finished once the MESSAGE frame is sent, and re-queued if sending fails.
+//	  With "ack:client-individual" each message stays in ephemeral storage until it is acknowledged; "ack:client" is
+//	  supported as well, acknowledgements are cumulative.
+//	  Header "prefetch-count" (default value 1) limits the number of unacknowledged messages of the subscription.
+//	- ACK: IQueue.Finish.
+//	- NACK: IQueue.Requeue.
+//	- BEGIN, COMMIT and ABORT: SEND, ACK and NACK frames of a transaction are buffered and executed on COMMIT.
+//	- Receipts are sent for all frames with a "receipt" header, and heart-beats are negotiated as specified by STOMP 1.2.
+//
+// Unacknowledged messages are re-queued (silently) when their subscription ends or the connection is closed.
+package stomp
+
+import (
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/internal/tcpserver"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultHeartBeat is the default interval the server sends heart-beats at and expects heart-beats at
+	DefaultHeartBeat = 10 * time.Second
+
+	// DefaultPollInterval is the default interval between two Take attempts of a subscription
+	DefaultPollInterval = 100 * time.Millisecond
+
+	// DefaultMaxBodySize is the default max size of a frame's body, in bytes
+	DefaultMaxBodySize = 1024 * 1024
+)
+
+// Config holds the server's configurations.
+type Config struct {
+	// HeartBeat is the interval the server can send heart-beats at and wants to receive heart-beats at, negotiated with
+	// clients on CONNECT. Default value is DefaultHeartBeat, negative value disables heart-beating.
+	HeartBeat time.Duration
+
+	// PollInterval is the interval between two Take attempts of a subscription, default value is DefaultPollInterval.
+	PollInterval time.Duration
+
+	// MaxBodySize is the max size of a frame's body in bytes, default value is DefaultMaxBodySize.
+	MaxBodySize int
+
+	// Authenticate, if supplied, is called to validate the login and passcode headers of CONNECT frames.
+	Authenticate func(login, passcode string) bool
+
+	// QueueFactory, if supplied, is called to create the queue of a destination that has not been registered.
+	// If nil, frames addressed to unregistered destinations are rejected.
+	QueueFactory func(name string) (singu.IQueue, error)
+}
+
+// NewServer creates a new Server instance.
+func NewServer(config Config) *Server {
+	if config.HeartBeat == 0 {
+		config.HeartBeat = DefaultHeartBeat
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultMaxBodySize
+	}
+	s := &Server{config: config}
+	s.Server = tcpserver.New(tcpserver.Config{
+		PollInterval: config.PollInterval,
+		QueueFactory: config.QueueFactory,
+		Handler:      func(netConn net.Conn) { newConn(s, netConn).serve() },
+	})
+	return s
+}
+
+// Server serves registered singu.IQueue instances as STOMP destinations, each queue is served under its name (see
+// RegisterQueue).
+type Server struct {
+	*tcpserver.Server
+	config Config
+}
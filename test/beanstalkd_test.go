@@ -0,0 +1,239 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/beanstalkd"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// beanstalkdClient is a minimal beanstalkd protocol client used for testing.
+type beanstalkdClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newBeanstalkdServer starts a beanstalkd protocol server serving the backend queues on a random local port.
+func newBeanstalkdServer(t *testing.T, queues ...singu.IQueue) (*beanstalkd.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %e", err)
+	}
+	srv := beanstalkd.NewServer(beanstalkd.Config{PollInterval: 10 * time.Millisecond})
+	for _, queue := range queues {
+		srv.RegisterQueue(queue)
+	}
+	go srv.Serve(listener)
+	return srv, listener.Addr().String()
+}
+
+func newBeanstalkdClient(t *testing.T, addr string) *beanstalkdClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("error connecting to beanstalkd server: %e", err)
+	}
+	return &beanstalkdClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// command sends a command line (and data block, if not nil) and returns the response line and data block, if any.
+func (c *beanstalkdClient) command(line string, data []byte) (string, []byte) {
+	if data != nil {
+		line = fmt.Sprintf("%s %d\r\n%s", line, len(data), data)
+	}
+	if _, err := io.WriteString(c.conn, line+"\r\n"); err != nil {
+		c.t.Fatalf("error sending command [%s]: %e", line, err)
+	}
+	resp, err := c.reader.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("error reading response of [%s]: %e", line, err)
+	}
+	resp = strings.TrimSuffix(resp, "\r\n")
+	fields := strings.Fields(resp)
+	if len(fields) > 0 && (fields[0] == "RESERVED" || fields[0] == "FOUND" || fields[0] == "OK") {
+		numBytes, _ := strconv.Atoi(fields[len(fields)-1])
+		body := make([]byte, numBytes+2)
+		if _, err := io.ReadFull(c.reader, body); err != nil {
+			c.t.Fatalf("error reading data of [%s]: %e", line, err)
+		}
+		return resp, body[:numBytes]
+	}
+	return resp, nil
+}
+
+func (c *beanstalkdClient) expect(test, line string, data []byte, expected string) []byte {
+	resp, body := c.command(line, data)
+	if resp != expected {
+		c.t.Fatalf("%s failed: [%s] expected [%s] but received [%s]", test, line, expected, resp)
+	}
+	return body
+}
+
+func TestBeanstalkdServer_PutReserveDelete(t *testing.T) {
+	test := "TestBeanstalkdServer_PutReserveDelete"
+	backend := singu.NewInmemQueue(beanstalkd.DefaultTube, 0, false, 0)
+	srv, addr := newBeanstalkdServer(t, backend)
+	defer srv.Close()
+	client := newBeanstalkdClient(t, addr)
+
+	client.expect(test, "put 0 0 60", []byte("job 1"), "INSERTED 1")
+	client.expect(test, "put 0 0 60", []byte("job 2"), "INSERTED 2")
+	client.expect(test, "peek-ready", nil, "FOUND 1 5")
+	if body := client.expect(test, "reserve", nil, "RESERVED 1 5"); string(body) != "job 1" {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, "job 1", body)
+	}
+	client.expect(test, "touch 1", nil, "TOUCHED")
+	if body := client.expect(test, "stats-job 1", nil, "OK 40"); !strings.Contains(string(body), "state: reserved") {
+		t.Fatalf("%s failed: unexpected job stats [%s]", test, body)
+	}
+	client.expect(test, "delete 1", nil, "DELETED")
+	client.expect(test, "delete 1", nil, "NOT_FOUND")
+
+	// ready jobs can be deleted too
+	client.expect(test, "delete 2", nil, "DELETED")
+	client.expect(test, "reserve-with-timeout 0", nil, "TIMED_OUT")
+	if queueSize, _ := backend.QueueSize(); queueSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, queueSize)
+	}
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, ephemeralSize)
+	}
+
+	client.expect(test, "put 0 0", nil, "BAD_FORMAT")
+	client.expect(test, "no-such-command", nil, "UNKNOWN_COMMAND")
+}
+
+func TestBeanstalkdServer_ReleaseBuryKick(t *testing.T) {
+	test := "TestBeanstalkdServer_ReleaseBuryKick"
+	backend := singu.NewInmemQueue(beanstalkd.DefaultTube, 0, false, 0)
+	srv, addr := newBeanstalkdServer(t, backend)
+	defer srv.Close()
+	client := newBeanstalkdClient(t, addr)
+
+	client.expect(test, "put 0 0 60", []byte("job"), "INSERTED 1")
+	client.expect(test, "reserve", nil, "RESERVED 1 3")
+	client.expect(test, "release 1 0 0", nil, "RELEASED")
+	client.expect(test, "reserve", nil, "RESERVED 1 3")
+	client.expect(test, "bury 1 0", nil, "BURIED")
+	client.expect(test, "reserve-with-timeout 0", nil, "TIMED_OUT")
+	// buried jobs are held by the server, they are not orphan messages
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, ephemeralSize)
+	}
+	if orphanMsgs, _ := backend.OrphanMessages(0, 0); len(orphanMsgs) != 0 {
+		t.Fatalf("%s failed: expected no orphan message but received %d", test, len(orphanMsgs))
+	}
+	if body := client.expect(test, "peek 1", nil, "FOUND 1 3"); string(body) != "job" {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, "job", body)
+	}
+	client.expect(test, "kick 10", nil, "KICKED 1")
+	msgs, _ := backend.Peek(1)
+	if len(msgs) != 1 || string(msgs[0].Payload) != "job" {
+		t.Fatalf("%s failed: expected kicked message but received %v", test, msgs)
+	}
+	client.expect(test, "reserve", nil, "RESERVED 1 3")
+	client.expect(test, "bury 1 0", nil, "BURIED")
+	client.expect(test, "delete 1", nil, "DELETED")
+	client.expect(test, "kick 10", nil, "KICKED 0")
+	if queueSize, _ := backend.QueueSize(); queueSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, queueSize)
+	}
+}
+
+func TestBeanstalkdServer_Tubes(t *testing.T) {
+	test := "TestBeanstalkdServer_Tubes"
+	backend := singu.NewInmemQueue(beanstalkd.DefaultTube, 0, false, 0)
+	other := singu.NewInmemQueue("other", 0, false, 0)
+	srv, addr := newBeanstalkdServer(t, backend, other)
+	defer srv.Close()
+	client := newBeanstalkdClient(t, addr)
+
+	client.expect(test, "use other", nil, "USING other")
+	client.expect(test, "put 0 0 60", []byte("job"), "INSERTED 1")
+	if queueSize, _ := other.QueueSize(); queueSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, queueSize)
+	}
+	client.expect(test, "reserve-with-timeout 0", nil, "TIMED_OUT")
+	client.expect(test, "watch other", nil, "WATCHING 2")
+	client.expect(test, "ignore default", nil, "WATCHING 1")
+	client.expect(test, "ignore other", nil, "NOT_IGNORED")
+	client.expect(test, "reserve-with-timeout 0", nil, "RESERVED 1 3")
+	if body := client.expect(test, "list-tubes", nil, "OK 22"); string(body) != "---\n- default\n- other\n" {
+		t.Fatalf("%s failed: unexpected tube list [%s]", test, body)
+	}
+
+	client.expect(test, "pause-tube default 60", nil, "PAUSED")
+	if !backend.IsPaused() {
+		t.Fatalf("%s failed: expected tube to be paused", test)
+	}
+	client.expect(test, "pause-tube default 0", nil, "PAUSED")
+	if backend.IsPaused() {
+		t.Fatalf("%s failed: expected tube to be resumed", test)
+	}
+	client.expect(test, "stats-tube no-such-tube", nil, "NOT_FOUND")
+}
+
+func TestBeanstalkdServer_ReleaseOnDisconnect(t *testing.T) {
+	test := "TestBeanstalkdServer_ReleaseOnDisconnect"
+	backend := singu.NewInmemQueue(beanstalkd.DefaultTube, 0, false, 0)
+	srv, addr := newBeanstalkdServer(t, backend)
+	defer srv.Close()
+	client := newBeanstalkdClient(t, addr)
+
+	client.expect(test, "put 0 0 60", []byte("job"), "INSERTED 1")
+	client.expect(test, "reserve", nil, "RESERVED 1 3")
+	client.conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	if queueSize, _ := backend.QueueSize(); queueSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, queueSize)
+	}
+
+	// the job keeps its id for other clients
+	client = newBeanstalkdClient(t, addr)
+	client.expect(test, "reserve", nil, "RESERVED 1 3")
+}
+
+func TestBeanstalkdServer_ReserveDisconnect(t *testing.T) {
+	test := "TestBeanstalkdServer_ReserveDisconnect"
+	backend := singu.NewInmemQueue(beanstalkd.DefaultTube, 0, false, 0)
+	srv, addr := newBeanstalkdServer(t, backend)
+	defer srv.Close()
+
+	// the client disconnects while waiting for a job: the next job must not be reserved for the dead connection
+	client := newBeanstalkdClient(t, addr)
+	io.WriteString(client.conn, "reserve\r\n")
+	time.Sleep(50 * time.Millisecond)
+	client.conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	if numConns := srv.NumConns(); numConns != 0 {
+		t.Fatalf("%s failed: expected %d open connections but received %d", test, 0, numConns)
+	}
+	msg, _ := backend.Queue(singu.NewQueueMessage([]byte("job")))
+	time.Sleep(100 * time.Millisecond)
+	if queueSize, _ := backend.QueueSize(); queueSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, queueSize)
+	}
+	if taken, _ := backend.Take(); taken == nil || taken.Id != msg.Id || !taken.QueueTimestamp.Equal(msg.QueueTimestamp) {
+		t.Fatalf("%s failed: expected the job to be left untouched but received %v", test, taken)
+	}
+}
+
+func TestBeanstalkdServer_JobFinishedElsewhere(t *testing.T) {
+	test := "TestBeanstalkdServer_JobFinishedElsewhere"
+	backend := singu.NewInmemQueue(beanstalkd.DefaultTube, 0, false, 0)
+	srv, addr := newBeanstalkdServer(t, backend)
+	defer srv.Close()
+	client := newBeanstalkdClient(t, addr)
+
+	client.expect(test, "put 0 0 60", []byte("job"), "INSERTED 1")
+	client.expect(test, "stats-job 1", nil, "OK 37")
+	msg, _ := backend.Take()
+	backend.Finish(msg.Id)
+	client.expect(test, "stats-job 1", nil, "NOT_FOUND")
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// buildCli builds command cmd/singu and returns a function running it against a queue in a temporary directory.
+func buildCli(t *testing.T) func(stdin string, args ...string) (string, error) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "singu")
+	if out, err := exec.Command("go", "build", "-o", bin, "github.com/btnguyen2k/singu/cmd/singu").CombinedOutput(); err != nil {
+		t.Fatalf("error building cmd/singu: %s\n%s", err, out)
+	}
+	return func(stdin string, args ...string) (string, error) {
+		cmd := exec.Command(bin, append([]string{"-data", filepath.Join(dir, "data"), "-queue", "cli", "-create"}, args...)...)
+		cmd.Stdin = strings.NewReader(stdin)
+		out, err := cmd.Output()
+		return string(out), err
+	}
+}
+
+func TestCli_Commands(t *testing.T) {
+	test := "TestCli_Commands"
+	run := buildCli(t)
+
+	out, err := run("hello\nworld\n", "enqueue", "-lines")
+	if err != nil || strings.Count(out, "enqueued ") != 2 {
+		t.Fatalf("%s failed: unexpected enqueue output %q/%e", test, out, err)
+	}
+
+	out, err = run("", "stats")
+	if err != nil {
+		t.Fatalf("%s failed: %e", test, err)
+	}
+	for _, pattern := range []string{`(?m)^queue size:\s+2$`, `(?m)^ephemeral size:\s+0$`, `(?m)^queue capacity \(configured\):\s+unlimited$`} {
+		if !regexp.MustCompile(pattern).MatchString(out) {
+			t.Fatalf("%s failed: stats output %q does not match %s", test, out, pattern)
+		}
+	}
+
+	out, err = run("", "-json", "-queue-capacity", "10", "stats")
+	var stats map[string]interface{}
+	if err != nil || json.Unmarshal([]byte(out), &stats) != nil {
+		t.Fatalf("%s failed: unexpected stats output %q/%e", test, out, err)
+	}
+	if stats["queue_size"] != 2.0 || stats["configured_queue_capacity"] != 10.0 || stats["paused"] != false {
+		t.Fatalf("%s failed: unexpected stats %v", test, stats)
+	}
+
+	out, err = run("", "-json", "take")
+	var msg struct {
+		Id      string `json:"id"`
+		Payload []byte `json:"payload"`
+	}
+	if err != nil || json.Unmarshal([]byte(out), &msg) != nil || string(msg.Payload) != "hello" {
+		t.Fatalf("%s failed: unexpected take output %q/%e", test, out, err)
+	}
+	out, err = run("", "finish", msg.Id)
+	if err != nil || out != "finished "+msg.Id+"\n" {
+		t.Fatalf("%s failed: unexpected finish output %q/%e", test, out, err)
+	}
+
+	out, err = run("", "peek")
+	if err != nil || !strings.Contains(out, `"world"`) || strings.Contains(out, `"hello"`) {
+		t.Fatalf("%s failed: unexpected peek output %q/%e", test, out, err)
+	}
+
+	if _, err = run("", "no-such-command"); err == nil {
+		t.Fatalf("%s failed: expected an error for an unknown command", test)
+	} else if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("%s failed: expected exit code 2 but received %e", test, err)
+	}
+}
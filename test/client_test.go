@@ -0,0 +1,96 @@
+package test
+
+import (
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/client"
+	"github.com/btnguyen2k/singu/server"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	queueNameRemote = "remote"
+	authTokenRemote = "secret"
+)
+
+// newRemoteQueue starts a test server serving the backend queue, and returns a RemoteQueue talking to it.
+func newRemoteQueue(backend singu.IQueue) (singu.IQueue, *httptest.Server) {
+	ts := newTestServer(server.Config{AuthTokens: []string{authTokenRemote}}, backend)
+	queue := client.NewRemoteQueue(backend.Name(), client.Config{BaseUrl: ts.URL, AuthToken: authTokenRemote})
+	return queue, ts
+}
+
+func TestRemoteQueue_Empty(t *testing.T) {
+	queue, ts := newRemoteQueue(singu.NewInmemQueue(queueNameRemote, 0, false, 0))
+	defer ts.Close()
+	MyTest_Empty("TestRemoteQueue_Empty", queue, t)
+}
+
+func TestRemoteQueue_QueueTakeAndFinishOne(t *testing.T) {
+	clock := singu.NewFakeClock(time.Now())
+	queue, ts := newRemoteQueue(singu.NewInmemQueueWithClock(queueNameRemote, 0, false, 0, clock))
+	defer ts.Close()
+	MyTest_QueueTakeAndFinishOne("TestRemoteQueue_QueueTakeAndFinishOne", queue, clock, t)
+}
+
+func TestRemoteQueue_QueueTakeAndRequeueOne(t *testing.T) {
+	queue, ts := newRemoteQueue(singu.NewInmemQueue(queueNameRemote, 0, false, 0))
+	defer ts.Close()
+	MyTest_QueueTakeAndRequeueOne("TestRemoteQueue_QueueTakeAndRequeueOne", queue, t)
+}
+
+func TestRemoteQueue_EphemeralDisabled(t *testing.T) {
+	queue, ts := newRemoteQueue(singu.NewInmemQueue(queueNameRemote, 0, true, 0))
+	defer ts.Close()
+	MyTest_EphemeralDisabled("TestRemoteQueue_EphemeralDisabled", queue, t)
+}
+
+func TestRemoteQueue_EphemeralMaxSize(t *testing.T) {
+	queue, ts := newRemoteQueue(singu.NewInmemQueue(queueNameRemote, 0, false, 10))
+	defer ts.Close()
+	MyTest_EphemeralMaxSize("TestRemoteQueue_EphemeralMaxSize", queue, t)
+}
+
+func TestRemoteQueue_QueueMaxSize(t *testing.T) {
+	queue, ts := newRemoteQueue(singu.NewInmemQueue(queueNameRemote, 10, false, 0))
+	defer ts.Close()
+	MyTest_QueueMaxSize("TestRemoteQueue_QueueMaxSize", queue, t)
+}
+
+func TestRemoteQueue_OrphanMessagesWithClock(t *testing.T) {
+	clock := singu.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	queue, ts := newRemoteQueue(singu.NewInmemQueueWithClock(queueNameRemote, 0, false, 0, clock))
+	defer ts.Close()
+	MyTest_OrphanMessagesWithClock("TestRemoteQueue_OrphanMessagesWithClock", queue, clock, t)
+}
+
+func TestRemoteQueue_PeekAndBrowse(t *testing.T) {
+	queue, ts := newRemoteQueue(singu.NewInmemQueue(queueNameRemote, 0, false, 0))
+	defer ts.Close()
+	MyTest_PeekAndBrowse("TestRemoteQueue_PeekAndBrowse", queue, t)
+}
+
+func TestRemoteQueue_GetRemoveUpdateById(t *testing.T) {
+	queue, ts := newRemoteQueue(singu.NewInmemQueue(queueNameRemote, 0, false, 0))
+	defer ts.Close()
+	MyTest_GetRemoveUpdateById("TestRemoteQueue_GetRemoveUpdateById", queue, t)
+}
+
+func TestRemoteQueue_PurgeAndRequeueAll(t *testing.T) {
+	queue, ts := newRemoteQueue(singu.NewInmemQueue(queueNameRemote, 0, false, 0))
+	defer ts.Close()
+	MyTest_PurgeAndRequeueAll("TestRemoteQueue_PurgeAndRequeueAll", queue, t)
+}
+
+func TestRemoteQueue_PauseAndResume(t *testing.T) {
+	queue, ts := newRemoteQueue(singu.NewInmemQueue(queueNameRemote, 0, false, 0))
+	defer ts.Close()
+	MyTest_PauseAndResume("TestRemoteQueue_PauseAndResume", queue, t)
+}
+
+func TestRemoteQueue_MultiThreads(t *testing.T) {
+	queue, ts := newRemoteQueue(singu.NewInmemQueue(queueNameRemote, 0, false, 0))
+	defer ts.Close()
+	MyTest_MultiThreads("TestRemoteQueue_MultiThreads_4P8C", queue, 4, 8, 10000, t)
+}
@@ -0,0 +1,185 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/compression"
+	"testing"
+)
+
+// reverseCodec stands in for codecs plugged in by applications, its name is unique as codecs are registered globally.
+type reverseCodec struct {
+	name string
+}
+
+func (c reverseCodec) Name() string { return c.name }
+
+func (reverseCodec) Encode(data []byte) ([]byte, error) {
+	result := make([]byte, len(data))
+	for i, b := range data {
+		result[len(data)-1-i] = b
+	}
+	return result[:len(result)/2], nil
+}
+
+func (reverseCodec) Decode(data []byte) ([]byte, error) {
+	return nil, errors.New("not reversible")
+}
+
+// Queue a large and a small message through a CompressedQueue, for each built-in codec. Expected:
+//	- Large payloads are stored compressed and marked with the codec, small payloads are stored as is
+//	- Messages returned by all operations are decompressed, updated payloads are compressed
+func TestCompressedQueue(t *testing.T) {
+	test := "TestCompressedQueue"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	small := []byte("small payload")
+	large := bytes.Repeat([]byte(`{"key":"value","number":12345}`), 100)
+	for _, codec := range []compression.Codec{compression.GetCodec(compression.Gzip), compression.GetCodec(compression.Snappy), compression.GetCodec(compression.Zstd)} {
+		queue := compression.NewCompressedQueue(backend, compression.Config{Codec: codec, Threshold: 100})
+		msg := singu.NewQueueMessage(large)
+		queued, err := queue.Queue(msg)
+		if err != nil || !bytes.Equal(queued.Payload, large) || queued.Metadata != nil || msg.Metadata != nil {
+			t.Fatalf("%s failed: unexpected result %v / %e", test, queued, err)
+		}
+		queue.Queue(singu.NewQueueMessage(small))
+
+		// stored compressed and marked, small payloads are left uncompressed
+		stored, _ := backend.Peek(2)
+		if len(stored[0].Payload) >= len(large)/5 || stored[0].Metadata[compression.MetadataEncoding] != codec.Name() {
+			t.Fatalf("%s failed: expected compressed payload but received %d bytes %v", test, len(stored[0].Payload), stored[0].Metadata)
+		}
+		if !bytes.Equal(stored[1].Payload, small) || stored[1].Metadata != nil {
+			t.Fatalf("%s failed: expected uncompressed payload but received %v", test, stored[1])
+		}
+		if peeked, _ := queue.Peek(2); !bytes.Equal(peeked[0].Payload, large) || !bytes.Equal(peeked[1].Payload, small) {
+			t.Fatalf("%s failed: unexpected peeked messages %v", test, peeked)
+		}
+
+		taken, _ := queue.Take()
+		if !bytes.Equal(taken.Payload, large) || taken.Metadata != nil {
+			t.Fatalf("%s failed: unexpected taken message %v", test, taken)
+		}
+		if orphans, _ := queue.OrphanMessages(0, 0); len(orphans) != 1 || !bytes.Equal(orphans[0].Payload, large) {
+			t.Fatalf("%s failed: unexpected orphan messages %v", test, orphans)
+		}
+		requeued, _ := queue.Requeue(taken.Id, false)
+		if !bytes.Equal(requeued.Payload, large) {
+			t.Fatalf("%s failed: unexpected re-queued message %v", test, requeued)
+		}
+		updated, err := queue.UpdatePayload(singu.QueueStorage, requeued.Id, append(large, large...))
+		if err != nil || len(updated.Payload) != 2*len(large) {
+			t.Fatalf("%s failed: unexpected updated message %v / %e", test, updated, err)
+		}
+		if stored, _ := backend.GetById(singu.QueueStorage, requeued.Id); len(stored.Payload) >= len(large)/5 {
+			t.Fatalf("%s failed: expected compressed payload but received %d bytes", test, len(stored.Payload))
+		}
+		for msg, _ := queue.Take(); msg != nil; msg, _ = queue.Take() {
+			queue.Finish(msg.Id)
+		}
+	}
+}
+
+func TestCompressedQueue_Codecs(t *testing.T) {
+	test := "TestCompressedQueue_Codecs"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	gzipped := compression.NewCompressedQueue(backend, compression.Config{Threshold: -1})
+	codec := reverseCodec{name: "reverse-" + singu.UniqueId()}
+	custom := compression.NewCompressedQueue(backend, compression.Config{Codec: codec, Threshold: -1})
+	gzipped.Queue(singu.NewQueueMessage(bytes.Repeat([]byte("a"), 100)))
+	custom.Queue(singu.NewQueueMessage([]byte("payload")))
+
+	// messages compressed by other registered codecs are decompressed
+	if msg, err := custom.Take(); err != nil || !bytes.Equal(msg.Payload, bytes.Repeat([]byte("a"), 100)) {
+		t.Fatalf("%s failed: unexpected message %v / %e", test, msg, err)
+	}
+	// codecs not registered are unknown to other queues
+	if msg, err := gzipped.Take(); msg != nil || !errors.Is(err, compression.ErrorUnknownEncoding) {
+		t.Fatalf("%s failed: expected %v but received %v / %v", test, compression.ErrorUnknownEncoding, msg, err)
+	}
+	compression.RegisterCodec(codec)
+	if orphans, err := gzipped.OrphanMessages(0, 0); orphans != nil || err == nil || errors.Is(err, compression.ErrorUnknownEncoding) {
+		t.Fatalf("%s failed: expected decode error but received %v / %v", test, orphans, err)
+	}
+	if compression.GetCodec(codec.Name()) == nil || compression.GetCodec("lz4") != nil {
+		t.Fatalf("%s failed: unexpected codec registry", test)
+	}
+}
+
+func TestCompressedQueue_Zstd(t *testing.T) {
+	test := "TestCompressedQueue_Zstd"
+	payload := bytes.Repeat([]byte("zstd compresses repetitive payloads "), 100)
+	for _, level := range []int{1, compression.DefaultZstdLevel, 19} {
+		codec := compression.NewZstd(level)
+		encoded, err := codec.Encode(payload)
+		if err != nil || len(encoded) >= len(payload)/10 {
+			t.Fatalf("%s failed: level %d: unexpected compressed payload of %d bytes / %e", test, level, len(encoded), err)
+		}
+		// frames are readable by the registered codec, whatever the level
+		if decoded, err := compression.GetCodec(compression.Zstd).Decode(encoded); err != nil || !bytes.Equal(decoded, payload) {
+			t.Fatalf("%s failed: level %d: unexpected decompressed payload / %e", test, level, err)
+		}
+	}
+	if _, err := compression.GetCodec(compression.Zstd).Decode([]byte("not a zstd frame")); err == nil {
+		t.Fatalf("%s failed: expected error decoding invalid data", test)
+	}
+
+	// messages compressed with zstd are decompressed by queues configured with another codec
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	compression.NewCompressedQueue(backend, compression.Config{Codec: compression.NewZstd(9)}).Queue(singu.NewQueueMessage(payload))
+	if stored, _ := backend.Peek(1); stored[0].Metadata[compression.MetadataEncoding] != compression.Zstd {
+		t.Fatalf("%s failed: expected message marked %s but received %v", test, compression.Zstd, stored[0].Metadata)
+	}
+	if msg, err := compression.NewCompressedQueue(backend, compression.Config{}).Take(); err != nil || !bytes.Equal(msg.Payload, payload) {
+		t.Fatalf("%s failed: unexpected message %v / %e", test, msg, err)
+	}
+}
+
+func TestCompressedQueue_PreMarked(t *testing.T) {
+	test := "TestCompressedQueue_PreMarked"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	queue := compression.NewCompressedQueue(backend, compression.Config{})
+
+	// marks supplied by the caller are removed, payloads are stored the way the queue would store them otherwise
+	small := singu.NewQueueMessage([]byte("not gzipped"))
+	small.Metadata = map[string]string{compression.MetadataEncoding: compression.Gzip, "other": "value"}
+	large := singu.NewQueueMessage(bytes.Repeat([]byte("a"), 2*compression.DefaultThreshold))
+	large.Metadata = map[string]string{compression.MetadataEncoding: compression.Zstd}
+	queue.Queue(small)
+	queue.Queue(large)
+	stored, _ := backend.Peek(2)
+	if _, ok := stored[0].Metadata[compression.MetadataEncoding]; ok || !bytes.Equal(stored[0].Payload, small.Payload) || stored[0].Metadata["other"] != "value" {
+		t.Fatalf("%s failed: expected message stored uncompressed but received %v", test, stored[0])
+	}
+	if stored[1].Metadata[compression.MetadataEncoding] != compression.Gzip {
+		t.Fatalf("%s failed: expected message compressed with %s but received %v", test, compression.Gzip, stored[1].Metadata)
+	}
+	for _, expected := range []*singu.QueueMessage{small, large} {
+		if msg, err := queue.Take(); err != nil || !bytes.Equal(msg.Payload, expected.Payload) {
+			t.Fatalf("%s failed: unexpected message %v / %e", test, msg, err)
+		}
+	}
+}
+
+func TestCompressedQueue_MaxDecodedSize(t *testing.T) {
+	test := "TestCompressedQueue_MaxDecodedSize"
+	max := 4096
+	for _, name := range []string{compression.Gzip, compression.Snappy, compression.Zstd} {
+		backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+		queue := compression.NewCompressedQueue(backend, compression.Config{Codec: compression.GetCodec(name), MaxDecodedSize: max})
+		queue.Queue(singu.NewQueueMessage(bytes.Repeat([]byte("a"), max)))
+		queue.Queue(singu.NewQueueMessage(bytes.Repeat([]byte("a"), max+1)))
+		if msg, err := queue.Take(); err != nil || len(msg.Payload) != max {
+			t.Fatalf("%s failed: %s: unexpected message %v / %e", test, name, msg, err)
+		} else {
+			queue.Finish(msg.Id)
+		}
+		if msg, err := queue.Take(); msg != nil || !errors.Is(err, compression.ErrorTooLarge) {
+			t.Fatalf("%s failed: %s: expected %v but received %v / %v", test, name, compression.ErrorTooLarge, msg, err)
+		}
+		// the limit does not apply to queues configured without it
+		if msgs, err := compression.NewCompressedQueue(backend, compression.Config{MaxDecodedSize: -1}).OrphanMessages(0, 0); err != nil || len(msgs) != 1 || len(msgs[0].Payload) != max+1 {
+			t.Fatalf("%s failed: %s: unexpected orphan messages %v / %e", test, name, msgs, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/compression"
+	"github.com/btnguyen2k/singu/encryption"
+	"testing"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 16)
+)
+
+// Queue messages through an EncryptedQueue, rotate the key, then tamper with stored messages. Expected:
+//	- Payloads are stored encrypted and marked with the key id, messages encrypted with previous keys are readable
+//	- Updated payloads are encrypted with the key of the message
+//	- Tampered payloads and key ids are reported as DecryptError wrapping ErrorTampered
+func TestEncryptedQueue(t *testing.T) {
+	test := "TestEncryptedQueue"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	keyring := &encryption.Keyring{Current: "k1", Keys: map[string][]byte{"k1": testKey1}}
+	queue := encryption.NewEncryptedQueue(backend, encryption.Config{KeyProvider: keyring})
+	plaintext := []byte("name=John Doe;ssn=123-45-6789")
+	msg := singu.NewQueueMessage(plaintext)
+	msg.Metadata = map[string]string{"key": "value"}
+	queued, err := queue.Queue(msg)
+	if err != nil || !bytes.Equal(queued.Payload, plaintext) || queued.Metadata["key"] != "value" || len(msg.Metadata) != 1 {
+		t.Fatalf("%s failed: unexpected result %v / %e", test, queued, err)
+	}
+	stored, _ := backend.Peek(1)
+	if bytes.Contains(stored[0].Payload, []byte("John Doe")) || stored[0].Metadata[encryption.MetadataKeyId] != "k1" {
+		t.Fatalf("%s failed: expected encrypted payload but received %v", test, stored[0])
+	}
+
+	// rotation: messages encrypted with the previous key are still readable
+	queue = encryption.NewEncryptedQueue(backend, encryption.Config{
+		KeyProvider: &encryption.Keyring{Current: "k2", Keys: map[string][]byte{"k1": testKey1, "k2": testKey2}},
+	})
+	queue.Queue(singu.NewQueueMessage([]byte("second")))
+	if peeked, err := queue.Peek(2); err != nil || !bytes.Equal(peeked[0].Payload, plaintext) || string(peeked[1].Payload) != "second" {
+		t.Fatalf("%s failed: unexpected messages %v / %e", test, peeked, err)
+	}
+	taken, _ := queue.Take()
+	if !bytes.Equal(taken.Payload, plaintext) || taken.Metadata[encryption.MetadataKeyId] != "" || taken.Metadata["key"] != "value" {
+		t.Fatalf("%s failed: unexpected taken message %v", test, taken)
+	}
+	requeued, _ := queue.Requeue(taken.Id, false)
+	if updated, err := queue.UpdatePayload(singu.QueueStorage, requeued.Id, []byte("updated")); err != nil || string(updated.Payload) != "updated" {
+		t.Fatalf("%s failed: unexpected updated message %v / %e", test, updated, err)
+	}
+	if stored, _ := backend.GetById(singu.QueueStorage, requeued.Id); bytes.Contains(stored.Payload, []byte("updated")) || stored.Metadata[encryption.MetadataKeyId] != "k1" {
+		t.Fatalf("%s failed: expected payload encrypted with k1 but received %v", test, stored)
+	}
+
+	// tampered ciphertext and key ids are reported at Take time
+	second, _ := backend.Peek(1)
+	tampered := append([]byte{}, second[0].Payload...)
+	tampered[len(tampered)-1] ^= 1
+	backend.UpdatePayload(singu.QueueStorage, second[0].Id, tampered)
+	msg, err = queue.Take()
+	var decryptErr *encryption.DecryptError
+	if msg != nil || !errors.Is(err, encryption.ErrorTampered) || !errors.As(err, &decryptErr) || decryptErr.Id != second[0].Id {
+		t.Fatalf("%s failed: expected %v but received %v / %v", test, encryption.ErrorTampered, msg, err)
+	}
+	queue.Finish(decryptErr.Id)
+	for msg, _ := queue.Take(); msg != nil; msg, _ = queue.Take() {
+		queue.Finish(msg.Id)
+	}
+	swapped := singu.CloneQueueMessage(*stored[0])
+	swapped.Metadata = map[string]string{encryption.MetadataKeyId: "k2"}
+	backend.Queue(&swapped)
+	if _, err := queue.Take(); !errors.Is(err, encryption.ErrorTampered) {
+		t.Fatalf("%s failed: expected %v but received %v", test, encryption.ErrorTampered, err)
+	}
+}
+
+func TestEncryptedQueue_UnknownKeyAndUnencrypted(t *testing.T) {
+	test := "TestEncryptedQueue_UnknownKeyAndUnencrypted"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	old := encryption.NewEncryptedQueue(backend, encryption.Config{KeyProvider: &encryption.Keyring{Current: "old", Keys: map[string][]byte{"old": testKey1}}})
+	queue := encryption.NewEncryptedQueue(backend, encryption.Config{KeyProvider: &encryption.Keyring{Current: "new", Keys: map[string][]byte{"new": testKey2}}})
+	old.Queue(singu.NewQueueMessage([]byte("encrypted with a retired key")))
+	backend.Queue(singu.NewQueueMessage([]byte("plaintext")))
+	if _, err := queue.Take(); !errors.Is(err, encryption.ErrorUnknownKey) {
+		t.Fatalf("%s failed: expected %v but received %v", test, encryption.ErrorUnknownKey, err)
+	}
+	if _, err := queue.Take(); !errors.Is(err, encryption.ErrorNotEncrypted) {
+		t.Fatalf("%s failed: expected %v but received %v", test, encryption.ErrorNotEncrypted, err)
+	}
+	lenient := encryption.NewEncryptedQueue(backend, encryption.Config{KeyProvider: &encryption.Keyring{Current: "new", Keys: map[string][]byte{"new": testKey2}}, AllowUnencrypted: true})
+	backend.Queue(singu.NewQueueMessage([]byte("plaintext")))
+	if msg, err := lenient.Take(); err != nil || string(msg.Payload) != "plaintext" {
+		t.Fatalf("%s failed: unexpected message %v / %e", test, msg, err)
+	}
+	if _, err := encryption.NewEncryptedQueue(backend, encryption.Config{KeyProvider: &encryption.Keyring{Current: "missing"}}).Queue(singu.NewQueueMessage(nil)); err != encryption.ErrorUnknownKey {
+		t.Fatalf("%s failed: expected %v but received %v", test, encryption.ErrorUnknownKey, err)
+	}
+}
+
+func TestEncryptedQueue_Compressed(t *testing.T) {
+	test := "TestEncryptedQueue_Compressed"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	keyring := &encryption.Keyring{Current: "k1", Keys: map[string][]byte{"k1": testKey1}}
+	queue := compression.NewCompressedQueue(encryption.NewEncryptedQueue(backend, encryption.Config{KeyProvider: keyring}), compression.Config{})
+	payload := bytes.Repeat([]byte("compressible "), 1000)
+	queue.Queue(singu.NewQueueMessage(payload))
+	if stored, _ := backend.Peek(1); len(stored[0].Payload) > len(payload)/10 {
+		t.Fatalf("%s failed: expected compressed then encrypted payload but received %d bytes", test, len(stored[0].Payload))
+	}
+	if msg, err := queue.Take(); err != nil || !bytes.Equal(msg.Payload, payload) || msg.Metadata != nil {
+		t.Fatalf("%s failed: unexpected message %v / %e", test, msg, err)
+	}
+}
+
+func TestEncryptedQueue_PreMarked(t *testing.T) {
+	test := "TestEncryptedQueue_PreMarked"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	keyring := &encryption.Keyring{Current: "k1", Keys: map[string][]byte{"k1": testKey1}}
+	queue := encryption.NewEncryptedQueue(backend, encryption.Config{KeyProvider: keyring, AllowUnencrypted: true})
+
+	// a key id supplied by the caller does not keep the payload from being encrypted
+	payload := []byte("plaintext under a planted key id")
+	msg := singu.NewQueueMessage(payload)
+	msg.Metadata = map[string]string{encryption.MetadataKeyId: "k1"}
+	queued, err := queue.Queue(msg)
+	if err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	stored, _ := backend.GetById(singu.QueueStorage, queued.Id)
+	if stored == nil || stored.Metadata[encryption.MetadataKeyId] != "k1" || bytes.Contains(stored.Payload, payload) {
+		t.Fatalf("%s failed: expected encrypted payload but received %v", test, stored)
+	}
+	if msg, err := queue.Take(); err != nil || !bytes.Equal(msg.Payload, payload) {
+		t.Fatalf("%s failed: unexpected message %v / %e", test, msg, err)
+	}
+
+	// payloads of messages that are not encrypted are not updated, they would be stored unencrypted
+	plain, _ := backend.Queue(singu.NewQueueMessage([]byte("plaintext")))
+	if _, err := queue.UpdatePayload(singu.QueueStorage, plain.Id, []byte("secret")); !errors.Is(err, encryption.ErrorNotEncrypted) {
+		t.Fatalf("%s failed: expected %v but received %v", test, encryption.ErrorNotEncrypted, err)
+	}
+	if stored, _ := backend.GetById(singu.QueueStorage, plain.Id); stored == nil || string(stored.Payload) != "plaintext" {
+		t.Fatalf("%s failed: expected payload left unchanged but received %v", test, stored)
+	}
+}
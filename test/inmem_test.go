@@ -3,6 +3,7 @@ package test
 import (
 	"github.com/btnguyen2k/singu"
 	"testing"
+	"time"
 )
 
 const (
@@ -20,13 +21,15 @@ func TestInmemQueue_QueueOne(t *testing.T) {
 }
 
 func TestInmemQueue_QueueAndTakeOne(t *testing.T) {
-	queue := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
-	MyTest_QueueAndTakeOne("TestInmemQueue_QueueAndTakeOne", queue, t)
+	clock := singu.NewFakeClock(time.Now())
+	queue := singu.NewInmemQueueWithClock(queueNameInmem, 0, false, 0, clock)
+	MyTest_QueueAndTakeOne("TestInmemQueue_QueueAndTakeOne", queue, clock, t)
 }
 
 func TestInmemQueue_QueueTakeAndFinishOne(t *testing.T) {
-	queue := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
-	MyTest_QueueTakeAndFinishOne("TestInmemQueue_QueueTakeAndFinishOne", queue, t)
+	clock := singu.NewFakeClock(time.Now())
+	queue := singu.NewInmemQueueWithClock(queueNameInmem, 0, false, 0, clock)
+	MyTest_QueueTakeAndFinishOne("TestInmemQueue_QueueTakeAndFinishOne", queue, clock, t)
 }
 
 func TestInmemQueue_QueueTakeAndRequeueOne(t *testing.T) {
@@ -74,6 +77,44 @@ func TestInmemQueue_MultiThreads(t *testing.T) {
 }
 
 func TestInmemQueue_OrphanMessagesWithLimit(t *testing.T) {
+	clock := singu.NewFakeClock(time.Now())
+	queue := singu.NewInmemQueueWithClock(queueNameInmem, 0, false, 0, clock)
+	MyTest_OrphanMessagesWithLimit("TestInmemQueue_OrphanMessagesWithLimit", queue, clock, t)
+}
+
+func TestInmemQueue_OrphanMessagesWithClock(t *testing.T) {
+	clock := singu.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	queue := singu.NewInmemQueueWithClock(queueNameInmem, 0, false, 0, clock)
+	MyTest_OrphanMessagesWithClock("TestInmemQueue_OrphanMessagesWithClock", queue, clock, t)
+}
+
+func TestInmemQueue_PeekAndBrowse(t *testing.T) {
+	queue := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	MyTest_PeekAndBrowse("TestInmemQueue_PeekAndBrowse", queue, t)
+}
+
+func TestInmemQueue_GetRemoveUpdateById(t *testing.T) {
+	queue := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	MyTest_GetRemoveUpdateById("TestInmemQueue_GetRemoveUpdateById", queue, t)
+}
+
+func TestInmemQueue_PurgeAndRequeueAll(t *testing.T) {
+	queue := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	MyTest_PurgeAndRequeueAll("TestInmemQueue_PurgeAndRequeueAll", queue, t)
+}
+
+func TestInmemQueue_PauseAndResume(t *testing.T) {
+	queue := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	MyTest_PauseAndResume("TestInmemQueue_PauseAndResume", queue, t)
+}
+
+func TestInmemQueue_ExportImport(t *testing.T) {
+	src := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	dst := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	MyTest_ExportImport("TestInmemQueue_ExportImport", src, dst, t)
+}
+
+func TestInmemQueue_ImportNonRestorable(t *testing.T) {
 	queue := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
-	MyTest_OrphanMessagesWithLimit("TestInmemQueue_OrphanMessagesWithLimit", queue, t)
+	MyTest_ImportNonRestorable("TestInmemQueue_ImportNonRestorable", queue, t)
 }
@@ -0,0 +1,175 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/btnguyen2k/singu"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWrap_Ordering(t *testing.T) {
+	test := "TestWrap_Ordering"
+	var trace []string
+	tracer := func(name string) singu.Interceptor {
+		return func(call singu.Call, next singu.Handler) singu.Result {
+			trace = append(trace, name+">"+call.Op)
+			result := next(call)
+			trace = append(trace, name+"<"+call.Op)
+			return result
+		}
+	}
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	queue := singu.Wrap(singu.Wrap(backend, tracer("c")), tracer("a"), tracer("b"))
+	queue.Queue(singu.NewQueueMessage([]byte("message")))
+	expected := "a>queue b>queue c>queue c<queue b<queue a<queue"
+	if strings.Join(trace, " ") != expected {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, expected, strings.Join(trace, " "))
+	}
+
+	// other operations are passed through
+	if size, _ := queue.QueueSize(); size != 1 || queue.Name() != queueNameInmem {
+		t.Fatalf("%s failed: expected 1 but received %d", test, size)
+	}
+}
+
+func TestWrap_ModifyAndShortCircuit(t *testing.T) {
+	test := "TestWrap_ModifyAndShortCircuit"
+	errDenied := errors.New("denied")
+	readOnlyTake := func(call singu.Call, next singu.Handler) singu.Result {
+		if call.Op == singu.OpFinish && call.Id == "protected" {
+			return singu.Result{Err: errDenied}
+		}
+		if call.Op == singu.OpRequeue {
+			// re-queue silently
+			call.Silent = true
+		}
+		result := next(call)
+		if call.Op == singu.OpOrphanMessages && result.Err == nil {
+			result.Messages = result.Messages[:0]
+		}
+		return result
+	}
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	queue := singu.Wrap(backend, readOnlyTake)
+	if err := queue.Finish("protected"); err != errDenied {
+		t.Fatalf("%s failed: expected %v but received %v", test, errDenied, err)
+	}
+	queue.Queue(singu.NewQueueMessage([]byte("message")))
+	msg, _ := queue.Take()
+	if requeued, err := queue.Requeue(msg.Id, false); err != nil || requeued.NumRequeues != 0 {
+		t.Fatalf("%s failed: expected silent re-queue but received %v / %e", test, requeued, err)
+	}
+	queue.Take()
+	if orphans, err := queue.OrphanMessages(0, 0); err != nil || len(orphans) != 0 {
+		t.Fatalf("%s failed: expected no orphan message but received %v / %e", test, orphans, err)
+	}
+	if orphans, _ := backend.OrphanMessages(0, 0); len(orphans) != 1 {
+		t.Fatalf("%s failed: expected 1 orphan message in backend but received %d", test, len(orphans))
+	}
+}
+
+func TestWrap_BuiltinInterceptors(t *testing.T) {
+	test := "TestWrap_BuiltinInterceptors"
+	errEmpty := errors.New("empty payload")
+	var observed []string
+	lock := sync.Mutex{}
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	queue := singu.Wrap(backend,
+		singu.Recover(),
+		singu.Observe(func(call singu.Call, result singu.Result, latency time.Duration) {
+			lock.Lock()
+			defer lock.Unlock()
+			observed = append(observed, call.Op)
+		}),
+		singu.ValidatePayload(func(payload []byte) error {
+			if len(payload) == 0 {
+				return errEmpty
+			}
+			return nil
+		}),
+		singu.TransformPayload(
+			func(payload []byte) ([]byte, error) { return bytes.ToUpper(payload), nil },
+			func(payload []byte) ([]byte, error) {
+				if bytes.Equal(payload, []byte("PANIC")) {
+					panic("cannot decode")
+				}
+				return bytes.ToLower(payload), nil
+			}),
+	)
+
+	if _, err := queue.Queue(singu.NewQueueMessage(nil)); err != errEmpty {
+		t.Fatalf("%s failed: expected %v but received %v", test, errEmpty, err)
+	}
+	original := singu.NewQueueMessage([]byte("Message"))
+	queued, err := queue.Queue(original)
+	if err != nil || string(queued.Payload) != "message" || string(original.Payload) != "Message" {
+		t.Fatalf("%s failed: unexpected result %v / %e", test, queued, err)
+	}
+	if stored, _ := backend.Peek(1); string(stored[0].Payload) != "MESSAGE" {
+		t.Fatalf("%s failed: expected [MESSAGE] but received [%s]", test, stored[0].Payload)
+	}
+	if msg, _ := queue.Take(); string(msg.Payload) != "message" {
+		t.Fatalf("%s failed: expected [message] but received [%s]", test, msg.Payload)
+	}
+	if orphans, _ := queue.OrphanMessages(0, 0); len(orphans) != 1 || string(orphans[0].Payload) != "message" {
+		t.Fatalf("%s failed: unexpected orphan messages %v", test, orphans)
+	}
+
+	// panics are turned into errors
+	backend.Queue(singu.NewQueueMessage([]byte("PANIC")))
+	if msg, err := queue.Take(); msg != nil || err == nil || !strings.Contains(err.Error(), "cannot decode") {
+		t.Fatalf("%s failed: expected error but received %v / %v", test, msg, err)
+	}
+	// the panicking take unwinds past Observe, Recover being the outermost interceptor
+	expected := "queue queue take orphan_messages"
+	if strings.Join(observed, " ") != expected {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, expected, strings.Join(observed, " "))
+	}
+}
+
+func TestWrap_ReadOperations(t *testing.T) {
+	test := "TestWrap_ReadOperations"
+	var observed []string
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	queue := singu.Wrap(backend,
+		singu.Observe(func(call singu.Call, result singu.Result, latency time.Duration) {
+			observed = append(observed, call.Op)
+		}),
+		singu.TransformPayload(
+			func(payload []byte) ([]byte, error) { return bytes.ToUpper(payload), nil },
+			func(payload []byte) ([]byte, error) { return bytes.ToLower(payload), nil }),
+	)
+	for _, payload := range []string{"One", "Two"} {
+		backend.Queue(singu.NewQueueMessage([]byte(strings.ToUpper(payload))))
+	}
+	peeked, err := queue.Peek(1)
+	if err != nil || len(peeked) != 1 || string(peeked[0].Payload) != "one" {
+		t.Fatalf("%s failed: unexpected peeked messages %v / %e", test, peeked, err)
+	}
+	browsed, cursor, err := queue.Browse(singu.QueueStorage, "", 1)
+	if err != nil || len(browsed) != 1 || string(browsed[0].Payload) != "one" || cursor == "" {
+		t.Fatalf("%s failed: unexpected browsed messages %v / %s / %e", test, browsed, cursor, err)
+	}
+	if msg, err := queue.GetById(singu.QueueStorage, peeked[0].Id); err != nil || string(msg.Payload) != "one" {
+		t.Fatalf("%s failed: unexpected message %v / %e", test, msg, err)
+	}
+	if msg, err := queue.UpdatePayload(singu.QueueStorage, peeked[0].Id, []byte("Three")); err != nil || string(msg.Payload) != "three" {
+		t.Fatalf("%s failed: unexpected updated message %v / %e", test, msg, err)
+	}
+	if stored, _ := backend.GetById(singu.QueueStorage, peeked[0].Id); string(stored.Payload) != "THREE" {
+		t.Fatalf("%s failed: expected [THREE] but received [%s]", test, stored.Payload)
+	}
+	if msg, err := queue.RemoveById(singu.QueueStorage, peeked[0].Id); err != nil || string(msg.Payload) != "three" {
+		t.Fatalf("%s failed: unexpected removed message %v / %e", test, msg, err)
+	}
+	if msg, err := queue.UpdatePayload(singu.QueueStorage, peeked[0].Id, []byte("Four")); err != nil || msg != nil {
+		t.Fatalf("%s failed: expected no message but received %v / %e", test, msg, err)
+	}
+	expected := "peek browse get_by_id update_payload remove_by_id update_payload"
+	if strings.Join(observed, " ") != expected {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, expected, strings.Join(observed, " "))
+	}
+}
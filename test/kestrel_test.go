@@ -0,0 +1,217 @@
+package test
+
+import (
+	"bufio"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/kestrel"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// kestrelClient is a minimal memcache text protocol client used for testing.
+type kestrelClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newKestrelServer starts a memcache protocol server serving the backend queues on a random local port.
+func newKestrelServer(t *testing.T, queues ...singu.IQueue) (*kestrel.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %e", err)
+	}
+	srv := kestrel.NewServer(kestrel.Config{PollInterval: 10 * time.Millisecond})
+	for _, queue := range queues {
+		srv.RegisterQueue(queue)
+	}
+	go srv.Serve(listener)
+	return srv, listener.Addr().String()
+}
+
+func newKestrelClient(t *testing.T, addr string) *kestrelClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("error connecting to memcache server: %e", err)
+	}
+	return &kestrelClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// command sends a command and returns the response lines, up to and including the terminating line.
+func (c *kestrelClient) command(cmd string, terminators ...string) []string {
+	if _, err := io.WriteString(c.conn, cmd+"\r\n"); err != nil {
+		c.t.Fatalf("error sending command [%s]: %e", cmd, err)
+	}
+	var lines []string
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("error reading response of [%s]: %e", cmd, err)
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		lines = append(lines, line)
+		for _, terminator := range terminators {
+			if line == terminator || strings.HasPrefix(line, "CLIENT_ERROR") || strings.HasPrefix(line, "SERVER_ERROR") || line == "ERROR" {
+				return lines
+			}
+		}
+	}
+}
+
+func (c *kestrelClient) set(test, queue, data, expected string) {
+	if resp := c.command("set "+queue+" 0 0 "+strconv.Itoa(len(data))+"\r\n"+data, "STORED", "NOT_STORED"); resp[0] != expected {
+		c.t.Fatalf("%s failed: expected [%s] but received %v", test, expected, resp)
+	}
+}
+
+// get returns the item's data, or empty string if no item was returned.
+func (c *kestrelClient) get(test, key string) string {
+	resp := c.command("get "+key, "END")
+	if len(resp) == 3 && strings.HasPrefix(resp[0], "VALUE "+key+" 0 ") {
+		return resp[1]
+	}
+	if len(resp) != 1 || resp[0] != "END" {
+		c.t.Fatalf("%s failed: unexpected response %v", test, resp)
+	}
+	return ""
+}
+
+func TestKestrelServer_SetGet(t *testing.T) {
+	test := "TestKestrelServer_SetGet"
+	backend := singu.NewInmemQueue(queueNameInmem, 1, false, 0)
+	srv, addr := newKestrelServer(t, backend)
+	defer srv.Close()
+	client := newKestrelClient(t, addr)
+
+	client.set(test, queueNameInmem, "item 1", "STORED")
+	client.set(test, queueNameInmem, "item 2", "NOT_STORED")
+	if data := client.get(test, queueNameInmem+"/peek"); data != "item 1" {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, "item 1", data)
+	}
+	if data := client.get(test, queueNameInmem); data != "item 1" {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, "item 1", data)
+	}
+	if data := client.get(test, queueNameInmem); data != "" {
+		t.Fatalf("%s failed: expected no item but received [%s]", test, data)
+	}
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, ephemeralSize)
+	}
+	if data := client.get(test, "not-exist"); data != "" {
+		t.Fatalf("%s failed: expected no item but received [%s]", test, data)
+	}
+
+	// wait for an item
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		backend.Queue(singu.NewQueueMessage([]byte("item 3")))
+	}()
+	if data := client.get(test, queueNameInmem+"/t=1000"); data != "item 3" {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, "item 3", data)
+	}
+}
+
+func TestKestrelServer_ReliableRead(t *testing.T) {
+	test := "TestKestrelServer_ReliableRead"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv, addr := newKestrelServer(t, backend)
+	defer srv.Close()
+	client := newKestrelClient(t, addr)
+
+	client.set(test, queueNameInmem, "item 1", "STORED")
+	client.set(test, queueNameInmem, "item 2", "STORED")
+	if data := client.get(test, queueNameInmem+"/open"); data != "item 1" {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, "item 1", data)
+	}
+	if resp := client.command("get "+queueNameInmem+"/open", "END"); !strings.HasPrefix(resp[0], "CLIENT_ERROR") {
+		t.Fatalf("%s failed: expected CLIENT_ERROR but received %v", test, resp)
+	}
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, ephemeralSize)
+	}
+
+	// abort: the item is re-queued
+	client.get(test, queueNameInmem+"/abort")
+	if queueSize, _ := backend.QueueSize(); queueSize != 2 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 2, queueSize)
+	}
+
+	// close and open the next one in one go
+	if data := client.get(test, queueNameInmem+"/open"); data != "item 2" {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, "item 2", data)
+	}
+	if data := client.get(test, queueNameInmem+"/close/open"); data != "item 1" {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, "item 1", data)
+	}
+	if queueSize, _ := backend.QueueSize(); queueSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, queueSize)
+	}
+
+	// disconnect: open item is aborted
+	client.conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	if queueSize, _ := backend.QueueSize(); queueSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, queueSize)
+	}
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, ephemeralSize)
+	}
+}
+
+func TestKestrelServer_StatsFlush(t *testing.T) {
+	test := "TestKestrelServer_StatsFlush"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv, addr := newKestrelServer(t, backend)
+	defer srv.Close()
+	client := newKestrelClient(t, addr)
+
+	client.set(test, queueNameInmem, "item", "STORED")
+	stats := client.command("stats", "END")
+	if !containsLine(stats, "STAT queue_"+queueNameInmem+"_items 1") {
+		t.Fatalf("%s failed: unexpected stats %v", test, stats)
+	}
+	if resp := client.command("flush "+queueNameInmem, "END"); resp[0] != "END" {
+		t.Fatalf("%s failed: unexpected response %v", test, resp)
+	}
+	if queueSize, _ := backend.QueueSize(); queueSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, queueSize)
+	}
+	if resp := client.command("no-such-command", "END"); resp[0] != "ERROR" {
+		t.Fatalf("%s failed: unexpected response %v", test, resp)
+	}
+}
+
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+func TestKestrelServer_BlockingDisconnect(t *testing.T) {
+	test := "TestKestrelServer_BlockingDisconnect"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv, addr := newKestrelServer(t, backend)
+	defer srv.Close()
+
+	// the client disconnects while blocking: the next item must not be taken for the dead connection
+	client := newKestrelClient(t, addr)
+	io.WriteString(client.conn, "get "+queueNameInmem+"/t=5000\r\n")
+	time.Sleep(50 * time.Millisecond)
+	client.conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	msg, _ := backend.Queue(singu.NewQueueMessage([]byte("item")))
+	time.Sleep(100 * time.Millisecond)
+	if queueSize, _ := backend.QueueSize(); queueSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, queueSize)
+	}
+	if taken, _ := backend.Take(); taken == nil || taken.Id != msg.Id || !taken.QueueTimestamp.Equal(msg.QueueTimestamp) {
+		t.Fatalf("%s failed: expected the item to be left untouched but received %v", test, taken)
+	}
+}
@@ -1,9 +1,11 @@
 package test
 
 import (
+	"github.com/btnguyen2k/singu"
 	"github.com/btnguyen2k/singu/leveldb"
 	"os"
 	"testing"
+	"time"
 )
 
 const queueNameLeveldb = "leveldb"
@@ -26,16 +28,18 @@ func TestLeveldbQueue_QueueOne(t *testing.T) {
 
 func TestLeveldbQueue_QueueAndTakeOne(t *testing.T) {
 	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
-	queue := leveldb.NewLeveldbQueue(queueNameLeveldb, dataPath, 0, false, 0)
+	clock := singu.NewFakeClock(time.Now())
+	queue := leveldb.NewLeveldbQueueWithClock(queueNameLeveldb, dataPath, 0, false, 0, clock)
 	defer queue.(*leveldb.LeveldbQueue).Destroy()
-	MyTest_QueueAndTakeOne("TestLeveldbQueue_QueueAndTakeOne", queue, t)
+	MyTest_QueueAndTakeOne("TestLeveldbQueue_QueueAndTakeOne", queue, clock, t)
 }
 
 func TestLeveldbQueue_QueueTakeAndFinishOne(t *testing.T) {
 	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
-	queue := leveldb.NewLeveldbQueue(queueNameLeveldb, dataPath, 0, false, 0)
+	clock := singu.NewFakeClock(time.Now())
+	queue := leveldb.NewLeveldbQueueWithClock(queueNameLeveldb, dataPath, 0, false, 0, clock)
 	defer queue.(*leveldb.LeveldbQueue).Destroy()
-	MyTest_QueueTakeAndFinishOne("TestLeveldbQueue_QueueTakeAndFinishOne", queue, t)
+	MyTest_QueueTakeAndFinishOne("TestLeveldbQueue_QueueTakeAndFinishOne", queue, clock, t)
 }
 
 func TestLeveldbQueue_QueueTakeAndRequeueOne(t *testing.T) {
@@ -95,8 +99,78 @@ func TestLeveldbQueue_MultiThreads(t *testing.T) {
 }
 
 func TestLeveldbQueue_OrphanMessagesWithLimit(t *testing.T) {
+	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
+	clock := singu.NewFakeClock(time.Now())
+	queue := leveldb.NewLeveldbQueueWithClock(queueNameLeveldb, dataPath, 0, false, 0, clock)
+	defer queue.(*leveldb.LeveldbQueue).Destroy()
+	MyTest_OrphanMessagesWithLimit("TestLeveldbQueue_OrphanMessagesWithLimit", queue, clock, t)
+}
+
+func TestLeveldbQueue_OrphanMessagesWithClock(t *testing.T) {
+	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
+	clock := singu.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	queue := leveldb.NewLeveldbQueueWithClock(queueNameLeveldb, dataPath, 0, false, 0, clock)
+	defer queue.(*leveldb.LeveldbQueue).Destroy()
+	MyTest_OrphanMessagesWithClock("TestLeveldbQueue_OrphanMessagesWithClock", queue, clock, t)
+}
+
+func TestLeveldbQueue_PeekAndBrowse(t *testing.T) {
+	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
+	queue := leveldb.NewLeveldbQueue(queueNameLeveldb, dataPath, 0, false, 0)
+	defer queue.(*leveldb.LeveldbQueue).Destroy()
+	MyTest_PeekAndBrowse("TestLeveldbQueue_PeekAndBrowse", queue, t)
+}
+
+func TestLeveldbQueue_GetRemoveUpdateById(t *testing.T) {
+	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
+	queue := leveldb.NewLeveldbQueue(queueNameLeveldb, dataPath, 0, false, 0)
+	defer queue.(*leveldb.LeveldbQueue).Destroy()
+	MyTest_GetRemoveUpdateById("TestLeveldbQueue_GetRemoveUpdateById", queue, t)
+}
+
+func TestLeveldbQueue_PurgeAndRequeueAll(t *testing.T) {
+	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
+	queue := leveldb.NewLeveldbQueue(queueNameLeveldb, dataPath, 0, false, 0)
+	defer queue.(*leveldb.LeveldbQueue).Destroy()
+	MyTest_PurgeAndRequeueAll("TestLeveldbQueue_PurgeAndRequeueAll", queue, t)
+}
+
+func TestLeveldbQueue_PauseAndResume(t *testing.T) {
+	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
+	queue := leveldb.NewLeveldbQueue(queueNameLeveldb, dataPath, 0, false, 0)
+	defer queue.(*leveldb.LeveldbQueue).Destroy()
+	MyTest_PauseAndResume("TestLeveldbQueue_PauseAndResume", queue, t)
+}
+
+func TestLeveldbQueue_PausedStatePersisted(t *testing.T) {
+	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
+	queue := leveldb.NewLeveldbQueue(queueNameLeveldb, dataPath, 0, false, 0)
+	if err := queue.Pause(); err != nil {
+		t.Fatalf("TestLeveldbQueue_PausedStatePersisted failed with error: %e", err)
+	}
+	queue.(*leveldb.LeveldbQueue).Destroy()
+
+	queue = leveldb.NewLeveldbQueue(queueNameLeveldb, dataPath, 0, false, 0)
+	defer queue.(*leveldb.LeveldbQueue).Destroy()
+	if !queue.IsPaused() {
+		t.Fatalf("TestLeveldbQueue_PausedStatePersisted failed: expected queue to be paused after reopening")
+	}
+	if err := queue.Resume(); err != nil {
+		t.Fatalf("TestLeveldbQueue_PausedStatePersisted failed with error: %e", err)
+	}
+}
+
+func TestLeveldbQueue_ExportImport(t *testing.T) {
+	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
+	src := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	dst := leveldb.NewLeveldbQueue(queueNameLeveldb, dataPath, 0, false, 0)
+	defer dst.(*leveldb.LeveldbQueue).Destroy()
+	MyTest_ExportImport("TestLeveldbQueue_ExportImport", src, dst, t)
+}
+
+func TestLeveldbQueue_ImportNonRestorable(t *testing.T) {
 	os.RemoveAll(dataPath + "/" + queueNameLeveldb)
 	queue := leveldb.NewLeveldbQueue(queueNameLeveldb, dataPath, 0, false, 0)
 	defer queue.(*leveldb.LeveldbQueue).Destroy()
-	MyTest_OrphanMessagesWithLimit("TestLeveldbQueue_OrphanMessagesWithLimit", queue, t)
+	MyTest_ImportNonRestorable("TestLeveldbQueue_ImportNonRestorable", queue, t)
 }
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/logging"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type loggedEvent struct {
+	level  logging.Level
+	msg    string
+	fields map[string]interface{}
+}
+
+type recordingLogger struct {
+	events []loggedEvent
+	lock   sync.Mutex
+}
+
+func (l *recordingLogger) Log(level logging.Level, msg string, fields ...logging.Field) {
+	event := loggedEvent{level: level, msg: msg, fields: map[string]interface{}{}}
+	for _, f := range fields {
+		event.fields[f.Key] = f.Value
+	}
+	l.lock.Lock()
+	l.events = append(l.events, event)
+	l.lock.Unlock()
+}
+
+func TestLoggedQueue(t *testing.T) {
+	test := "TestLoggedQueue"
+	logger := &recordingLogger{}
+	backend := singu.NewInmemQueue(queueNameInmem, 1, false, 0)
+	queue := logging.NewLoggedQueue(backend, logger, logging.Config{Fields: []logging.Field{{Key: "consumer", Value: "worker-1"}}})
+
+	queued, _ := queue.Queue(singu.NewQueueMessage([]byte("message 1")))
+	queue.Queue(singu.NewQueueMessage([]byte("message 2")))
+	msg, _ := queue.Take()
+	queue.Requeue(msg.Id, true)
+	msg, _ = queue.Take()
+	queue.Finish(msg.Id)
+	queue.Take()
+	queue.OrphanMessages(0, 10)
+
+	expected := []struct {
+		level logging.Level
+		op    string
+	}{
+		{logging.LevelInfo, singu.OpQueue},
+		{logging.LevelError, singu.OpQueue},
+		{logging.LevelInfo, singu.OpTake},
+		{logging.LevelInfo, singu.OpRequeue},
+		{logging.LevelInfo, singu.OpTake},
+		{logging.LevelInfo, singu.OpFinish},
+		{logging.LevelDebug, singu.OpTake},
+		{logging.LevelDebug, singu.OpOrphanMessages},
+	}
+	if len(logger.events) != len(expected) {
+		t.Fatalf("%s failed: expected %d events but received %d", test, len(expected), len(logger.events))
+	}
+	for i, e := range expected {
+		event := logger.events[i]
+		if event.level != e.level || event.fields[logging.FieldOperation] != e.op || event.msg != "singu: "+e.op {
+			t.Fatalf("%s failed: expected %v/%s at #%d but received %v", test, e.level, e.op, i, event)
+		}
+		if event.fields[logging.FieldQueue] != queueNameInmem || event.fields["consumer"] != "worker-1" || event.fields[logging.FieldLatency] == nil {
+			t.Fatalf("%s failed: missing fields in event #%d %v", test, i, event)
+		}
+	}
+	if e := logger.events[0]; e.fields[logging.FieldId] != queued.Id {
+		t.Fatalf("%s failed: expected id %s but received %v", test, queued.Id, e.fields)
+	}
+	if e := logger.events[1]; e.fields[logging.FieldError] != singu.ErrorQueueIsFull.Error() {
+		t.Fatalf("%s failed: expected error %v but received %v", test, singu.ErrorQueueIsFull, e.fields)
+	}
+	if e := logger.events[3]; e.fields[logging.FieldSilent] != true || e.fields[logging.FieldNumRequeues] != 0 {
+		t.Fatalf("%s failed: unexpected requeue event %v", test, e.fields)
+	}
+	if e := logger.events[4]; e.fields[logging.FieldId] != queued.Id || e.fields[logging.FieldNumRequeues] != 0 {
+		t.Fatalf("%s failed: unexpected take event %v", test, e.fields)
+	}
+	if e := logger.events[6]; e.fields[logging.FieldId] != nil {
+		t.Fatalf("%s failed: unexpected empty take event %v", test, e.fields)
+	}
+}
+
+func TestLoggedQueue_LevelAndSampling(t *testing.T) {
+	test := "TestLoggedQueue_LevelAndSampling"
+	logger := &recordingLogger{}
+	n := 200
+	backend := singu.NewInmemQueue(queueNameInmem, n, false, 0)
+	queue := logging.NewLoggedQueue(backend, logger, logging.Config{Level: logging.LevelInfo, SampleRate: 0.5})
+	for i := 0; i <= n; i++ {
+		queue.Queue(singu.NewQueueMessage([]byte("message")))
+	}
+	for msg, _ := queue.Take(); msg != nil; msg, _ = queue.Take() {
+		queue.Finish(msg.Id)
+	}
+
+	ops := map[string]map[string]bool{}
+	errors := 0
+	for _, e := range logger.events {
+		if e.level < logging.LevelInfo {
+			t.Fatalf("%s failed: unexpected event below min level %v", test, e)
+		}
+		if e.fields[logging.FieldError] != nil {
+			errors++
+			continue
+		}
+		id := e.fields[logging.FieldId].(string)
+		if ops[id] == nil {
+			ops[id] = map[string]bool{}
+		}
+		ops[id][e.fields[logging.FieldOperation].(string)] = true
+	}
+	// failed calls are always logged, sampled messages have all their events logged
+	if errors != 1 {
+		t.Fatalf("%s failed: expected 1 error event but received %d", test, errors)
+	}
+	if len(ops) < n/4 || len(ops) > n*3/4 {
+		t.Fatalf("%s failed: expected about %d sampled messages but received %d", test, n/2, len(ops))
+	}
+	for id, o := range ops {
+		if len(o) != 3 {
+			t.Fatalf("%s failed: expected 3 events for message %s but received %v", test, id, o)
+		}
+	}
+}
+
+func TestLoggedQueue_PausedWarning(t *testing.T) {
+	test := "TestLoggedQueue_PausedWarning"
+	logger := &recordingLogger{}
+	backend := singu.Wrap(singu.NewInmemQueue(queueNameInmem, 0, false, 0), func(call singu.Call, next singu.Handler) singu.Result {
+		return singu.Result{Err: fmt.Errorf("interceptor: %w", singu.ErrorQueueIsPaused)}
+	})
+	queue := logging.NewLoggedQueue(backend, logger, logging.Config{})
+	queue.Take()
+	if len(logger.events) != 1 || logger.events[0].level != logging.LevelWarn {
+		t.Fatalf("%s failed: expected 1 warning event but received %v", test, logger.events)
+	}
+}
+
+func TestLoggedQueue_StdLogger(t *testing.T) {
+	test := "TestLoggedQueue_StdLogger"
+	buf := &bytes.Buffer{}
+	logger := logging.NewStdLogger(log.New(buf, "", 0))
+	logger.Log(logging.LevelWarn, "singu: take", logging.Field{Key: "queue", Value: "orders"}, logging.Field{Key: "error", Value: "queue is paused"})
+	expected := `level=warn msg="singu: take" queue=orders error="queue is paused"`
+	if line := strings.TrimSpace(buf.String()); line != expected {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, expected, line)
+	}
+}
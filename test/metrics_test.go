@@ -0,0 +1,158 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/metrics"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstrumentedQueue_Prometheus(t *testing.T) {
+	test := "TestInstrumentedQueue_Prometheus"
+	clock := singu.NewFakeClock(time.Now())
+	backend := singu.NewInmemQueueWithClock(queueNameInmem, 2, false, 0, clock)
+	prom := metrics.NewPrometheus(nil)
+	queue := metrics.NewInstrumentedQueue(backend, prom, metrics.Config{Clock: clock})
+
+	queue.Queue(singu.NewQueueMessage([]byte("message 1")))
+	queue.Queue(singu.NewQueueMessage([]byte("message 2")))
+	if _, err := queue.Queue(singu.NewQueueMessage([]byte("message 3"))); err != singu.ErrorQueueIsFull {
+		t.Fatalf("%s failed: expected %v but received %v", test, singu.ErrorQueueIsFull, err)
+	}
+	clock.Advance(30 * time.Second)
+	msg, _ := queue.Take()
+	queue.Requeue(msg.Id, false)
+	queue.Take()
+	msg, _ = queue.Take()
+	queue.Finish(msg.Id)
+	queue.QueueSize()
+	queue.EphemeralSize()
+
+	rec := httptest.NewRecorder()
+	prom.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, expected := range []string{
+		"# TYPE singu_operations_total counter",
+		`singu_operations_total{operation="queue",queue="queue"} 3`,
+		`singu_operations_total{operation="take",queue="queue"} 3`,
+		`singu_messages_total{operation="queue",queue="queue"} 2`,
+		`singu_messages_total{operation="requeue",queue="queue"} 1`,
+		`singu_errors_total{error="queue_is_full",operation="queue",queue="queue"} 1`,
+		"# TYPE singu_operation_duration_seconds histogram",
+		`singu_operation_duration_seconds_count{operation="finish",queue="queue"} 1`,
+		`singu_queue_size{queue="queue"} 0`,
+		`singu_ephemeral_size{queue="queue"} 1`,
+		// message 1 was taken 30 seconds after being queued, then re-queued; message 2 was taken 30 seconds after being queued
+		`singu_message_age_seconds_bucket{queue="queue",le="15"} 1`,
+		`singu_message_age_seconds_bucket{queue="queue",le="60"} 3`,
+		`singu_message_requeues_bucket{queue="queue",le="0"} 2`,
+		`singu_message_requeues_bucket{queue="queue",le="1"} 3`,
+		`singu_message_requeues_count{queue="queue"} 3`,
+	} {
+		if !strings.Contains(body, expected+"\n") {
+			t.Fatalf("%s failed: expected [%s] in\n%s", test, expected, body)
+		}
+	}
+}
+
+func TestInstrumentedQueue_Expvar(t *testing.T) {
+	test := "TestInstrumentedQueue_Expvar"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	name := "singu_test_" + singu.UniqueId()
+	ev := metrics.NewExpvar(name)
+	queue := metrics.NewInstrumentedQueue(backend, ev, metrics.Config{SizeInterval: -1})
+	queue.Queue(singu.NewQueueMessage([]byte("message")))
+	queue.Take()
+	queue.Take()
+
+	// the published map is reused by instances of the same name
+	metrics.NewExpvar(name).AddCounter("reused", nil, 1)
+	vars := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &vars); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	if v := vars[`singu_operations_total{operation="take",queue="queue"}`]; v != 2.0 {
+		t.Fatalf("%s failed: expected %v but received %v", test, 2, v)
+	}
+	if v := vars[`singu_messages_total{operation="take",queue="queue"}`]; v != 1.0 {
+		t.Fatalf("%s failed: expected %v but received %v", test, 1, v)
+	}
+	if histogram, ok := vars[`singu_message_requeues{queue="queue"}`].(map[string]interface{}); !ok || histogram["count"] != 1.0 || histogram["max"] != 0.0 {
+		t.Fatalf("%s failed: unexpected histogram %v", test, vars[`singu_message_requeues{queue="queue"}`])
+	}
+	if vars["reused"] != 1.0 {
+		t.Fatalf("%s failed: expected %v but received %v", test, 1, vars["reused"])
+	}
+	if _, ok := vars[`singu_queue_size{queue="queue"}`]; ok {
+		t.Fatalf("%s failed: expected no size gauge", test)
+	}
+}
+
+// blockingSizeQueue is a queue whose QueueSize calls block until released.
+type blockingSizeQueue struct {
+	singu.IQueue
+	release chan struct{}
+}
+
+func (q *blockingSizeQueue) QueueSize() (int, error) {
+	<-q.release
+	return q.IQueue.QueueSize()
+}
+
+func TestInstrumentedQueue_SizeGauges(t *testing.T) {
+	test := "TestInstrumentedQueue_SizeGauges"
+	backend := &blockingSizeQueue{IQueue: singu.NewInmemQueue(queueNameInmem, 0, false, 0), release: make(chan struct{})}
+	prom := metrics.NewPrometheus(nil)
+	queue := metrics.NewInstrumentedQueue(backend, prom, metrics.Config{SizeInterval: time.Millisecond})
+
+	// size gauges are updated in the background, a slow size query does not hold up operations
+	time.Sleep(2 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			queue.Queue(singu.NewQueueMessage([]byte("message")))
+			time.Sleep(2 * time.Millisecond)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("%s failed: operations blocked by size update", test)
+	}
+
+	close(backend.release)
+	expected := `singu_queue_size{queue="queue"} 3` + "\n"
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(5 * time.Millisecond) {
+		queue.OrphanMessages(60, 0)
+		rec := httptest.NewRecorder()
+		prom.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		if strings.Contains(rec.Body.String(), expected) {
+			return
+		}
+	}
+	t.Fatalf("%s failed: size gauge not updated", test)
+}
+
+func TestErrorLabel(t *testing.T) {
+	test := "TestErrorLabel"
+	for _, c := range []struct {
+		err   error
+		label string
+	}{
+		{singu.ErrorQueueIsFull, "queue_is_full"},
+		{fmt.Errorf("queue [orders]: %w", singu.ErrorEphemeralIsFull), "ephemeral_is_full"},
+		{fmt.Errorf("take: %w", singu.ErrorQueueIsPaused), "queue_is_paused"},
+		{errors.New("queue is full"), "other"},
+	} {
+		if label := metrics.ErrorLabel(c.err); label != c.label {
+			t.Fatalf("%s failed: expected %s for %v but received %s", test, c.label, c.err, label)
+		}
+	}
+}
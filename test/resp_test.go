@@ -0,0 +1,235 @@
+package test
+
+import (
+	"bufio"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/resp"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// respClient is a minimal RESP client used for testing.
+type respClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newRespServer starts a RESP server serving the backend queues on a random local port.
+func newRespServer(t *testing.T, queues ...singu.IQueue) (*resp.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %e", err)
+	}
+	srv := resp.NewServer(resp.Config{PollInterval: 10 * time.Millisecond})
+	for _, queue := range queues {
+		srv.RegisterQueue(queue)
+	}
+	go srv.Serve(listener)
+	return srv, listener.Addr().String()
+}
+
+func newRespClient(t *testing.T, addr string) *respClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("error connecting to RESP server: %e", err)
+	}
+	return &respClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// do sends a command as a RESP array and returns the decoded reply: string for simple strings and errors
+// (errors are prefixed with "-"), int for integers, []byte for bulk strings, []interface{} for arrays and nil.
+func (c *respClient) do(args ...string) interface{} {
+	var sb strings.Builder
+	sb.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		sb.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := io.WriteString(c.conn, sb.String()); err != nil {
+		c.t.Fatalf("error sending command %v: %e", args, err)
+	}
+	return c.readReply()
+}
+
+func (c *respClient) readReply() interface{} {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("error reading reply: %e", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return line
+	case ':':
+		i, _ := strconv.Atoi(line[1:])
+		return i
+	case '$':
+		size, _ := strconv.Atoi(line[1:])
+		if size < 0 {
+			return nil
+		}
+		data := make([]byte, size+2)
+		io.ReadFull(c.reader, data)
+		return data[:size]
+	case '*':
+		count, _ := strconv.Atoi(line[1:])
+		if count < 0 {
+			return nil
+		}
+		result := make([]interface{}, count)
+		for i := range result {
+			result[i] = c.readReply()
+		}
+		return result
+	}
+	c.t.Fatalf("unexpected reply [%s]", line)
+	return nil
+}
+
+func (c *respClient) expect(test string, expected interface{}, args ...string) interface{} {
+	reply := c.do(args...)
+	if !reflect.DeepEqual(reply, expected) {
+		c.t.Fatalf("%s failed: %v expected %#v but received %#v", test, args, expected, reply)
+	}
+	return reply
+}
+
+func TestRespServer_PushPop(t *testing.T) {
+	test := "TestRespServer_PushPop"
+	backend := singu.NewInmemQueue(queueNameInmem, 3, false, 0)
+	srv, addr := newRespServer(t, backend)
+	defer srv.Close()
+	client := newRespClient(t, addr)
+
+	client.expect(test, "PONG", "PING")
+	client.expect(test, 2, "LPUSH", queueNameInmem, "a", "b")
+	client.expect(test, 3, "RPUSH", queueNameInmem, "c")
+	client.expect(test, "-OOM queue storage is full", "rpush", queueNameInmem, "d")
+	client.expect(test, 3, "LLEN", queueNameInmem)
+	client.expect(test, []byte("a"), "RPOP", queueNameInmem)
+	client.expect(test, []interface{}{[]byte("b"), []byte("c")}, "RPOP", queueNameInmem, "5")
+	client.expect(test, nil, "RPOP", queueNameInmem)
+	client.expect(test, 0, "SINGU.ELEN", queueNameInmem)
+	client.expect(test, 0, "LLEN", "not-exist")
+	client.expect(test, "-ERR no such queue", "LPUSH", "not-exist", "a")
+
+	// BRPOP waits for a message
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		backend.Queue(singu.NewQueueMessage([]byte("e")))
+	}()
+	client.expect(test, []interface{}{[]byte(queueNameInmem), []byte("e")}, "BRPOP", "not-exist", queueNameInmem, "1")
+	client.expect(test, nil, "BRPOP", queueNameInmem, "0.05")
+	client.expect(test, "-ERR unknown command 'GET'", "GET", queueNameInmem)
+	client.expect(test, "-ERR wrong number of arguments for 'llen' command", "LLEN")
+}
+
+func TestRespServer_ReliableConsumption(t *testing.T) {
+	test := "TestRespServer_ReliableConsumption"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv, addr := newRespServer(t, backend)
+	defer srv.Close()
+	client := newRespClient(t, addr)
+
+	client.expect(test, 2, "LPUSH", queueNameInmem, "a", "b")
+	taken := client.do("SINGU.TAKE", queueNameInmem).([]interface{})
+	if string(taken[1].([]byte)) != "a" {
+		t.Fatalf("%s failed: expected [%s] but received %#v", test, "a", taken)
+	}
+	client.expect(test, 1, "SINGU.ELEN", queueNameInmem)
+	client.expect(test, []interface{}{[]interface{}{taken[0], taken[1]}}, "SINGU.ORPHANS", queueNameInmem, "0")
+	client.expect(test, "OK", "SINGU.FINISH", queueNameInmem, string(taken[0].([]byte)))
+	client.expect(test, 0, "SINGU.ELEN", queueNameInmem)
+
+	taken = client.do("SINGU.TAKE", queueNameInmem, "1").([]interface{})
+	if string(taken[1].([]byte)) != "b" {
+		t.Fatalf("%s failed: expected [%s] but received %#v", test, "b", taken)
+	}
+	if reply := client.do("SINGU.REQUEUE", queueNameInmem, string(taken[0].([]byte))); reply == nil {
+		t.Fatalf("%s failed: expected new id but received nil", test)
+	}
+	client.expect(test, nil, "SINGU.REQUEUE", queueNameInmem, "not-exist")
+	client.expect(test, 1, "LLEN", queueNameInmem)
+	client.expect(test, 0, "SINGU.ELEN", queueNameInmem)
+}
+
+func TestRespServer_ProtocolErrors(t *testing.T) {
+	test := "TestRespServer_ProtocolErrors"
+	srv, addr := newRespServer(t)
+	defer srv.Close()
+
+	// a null array is an empty command
+	client := newRespClient(t, addr)
+	io.WriteString(client.conn, "*-1\r\n")
+	client.expect(test, "PONG", "PING")
+
+	for _, request := range []string{
+		"*-2\r\n",                             // negative count
+		"*1\r\n$4\r\nPINGxx",                  // bulk string not terminated by CRLF
+		strings.Repeat("x", 65*1024) + "\r\n", // inline command too long
+		"*1\r\n$" + strings.Repeat("9", 65*1024) + "\r\n", // bulk header too long
+	} {
+		client := newRespClient(t, addr)
+		io.WriteString(client.conn, request)
+		if reply := client.readReply(); reply != "-ERR Protocol error" {
+			t.Fatalf("%s failed: expected protocol error but received %#v", test, reply)
+		}
+		client.conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := client.reader.ReadByte(); err != io.EOF {
+			t.Fatalf("%s failed: expected connection to be closed but received %v", test, err)
+		}
+	}
+}
+
+func TestRespServer_BlockingDisconnect(t *testing.T) {
+	test := "TestRespServer_BlockingDisconnect"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv, addr := newRespServer(t, backend)
+	defer srv.Close()
+
+	// the client disconnects while blocking: the next message must not be taken for the dead connection
+	client := newRespClient(t, addr)
+	io.WriteString(client.conn, "*3\r\n$5\r\nBRPOP\r\n$"+strconv.Itoa(len(queueNameInmem))+"\r\n"+queueNameInmem+"\r\n$1\r\n0\r\n")
+	time.Sleep(50 * time.Millisecond)
+	client.conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	if numConns := srv.NumConns(); numConns != 0 {
+		t.Fatalf("%s failed: expected %d open connections but received %d", test, 0, numConns)
+	}
+	backend.Queue(singu.NewQueueMessage([]byte("message")))
+	time.Sleep(100 * time.Millisecond)
+	if queueSize, _ := backend.QueueSize(); queueSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, queueSize)
+	}
+}
+
+func TestRespServer_Auth(t *testing.T) {
+	test := "TestRespServer_Auth"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %e", err)
+	}
+	srv := resp.NewServer(resp.Config{Authenticate: func(username, password string) bool { return password == "secret" }})
+	srv.RegisterQueue(backend)
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	client := newRespClient(t, listener.Addr().String())
+	client.expect(test, "-NOAUTH Authentication required.", "RPUSH", queueNameInmem, "message")
+	client.expect(test, "-WRONGPASS invalid username-password pair", "AUTH", "wrong")
+	client.expect(test, "OK", "AUTH", "default", "secret")
+	client.expect(test, 1, "RPUSH", queueNameInmem, "message")
+
+	// without Authenticate, AUTH is an error
+	srvNoAuth, addr := newRespServer(t)
+	defer srvNoAuth.Close()
+	newRespClient(t, addr).expect(test, "-ERR AUTH called without any password configured", "AUTH", "secret")
+}
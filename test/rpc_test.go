@@ -0,0 +1,208 @@
+package test
+
+import (
+	"context"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newRpcClient starts an in-process gRPC server serving the backend queue, and returns a client connected to it.
+func newRpcClient(t *testing.T, backend singu.IQueue, opts ...grpc.ServerOption) (rpc.QueueClient, func()) {
+	listener := bufconn.Listen(1024 * 1024)
+	srv := rpc.NewServer(rpc.Config{PollInterval: 10 * time.Millisecond})
+	srv.RegisterQueue(backend)
+	grpcServer := grpc.NewServer(opts...)
+	rpc.RegisterQueueServer(grpcServer, srv)
+	go grpcServer.Serve(listener)
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	if err != nil {
+		t.Fatalf("error connecting to gRPC server: %e", err)
+	}
+	return rpc.NewQueueClient(conn), func() {
+		conn.Close()
+		grpcServer.Stop()
+	}
+}
+
+func TestRpcServer_Unary(t *testing.T) {
+	test := "TestRpcServer_Unary"
+	backend := singu.NewInmemQueue(queueNameInmem, 1, false, 0)
+	client, closeFunc := newRpcClient(t, backend)
+	defer closeFunc()
+	ctx := context.Background()
+
+	msg := singu.NewQueueMessage([]byte("content"))
+	msg.Metadata = map[string]string{"traceparent": "00-trace-span-01"}
+	queued, err := client.Queue(ctx, &rpc.QueueMessageRequest{Queue: queueNameInmem, Message: rpc.ToProto(msg)})
+	if err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	if _, err := client.Queue(ctx, &rpc.QueueMessageRequest{Queue: queueNameInmem, Message: &rpc.QueueMessage{}}); rpc.SentinelError(err) != singu.ErrorQueueIsFull {
+		t.Fatalf("%s failed: expected %v but received %v", test, singu.ErrorQueueIsFull, err)
+	}
+	if _, err := client.Take(ctx, &rpc.QueueRequest{Queue: "not-exist"}); err == nil {
+		t.Fatalf("%s failed: expected error for unknown queue", test)
+	}
+	taken, err := client.Take(ctx, &rpc.QueueRequest{Queue: queueNameInmem})
+	if err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if taken.Message == nil || taken.Message.Id != queued.Message.Id || string(taken.Message.Payload) != "content" || taken.Message.Metadata["traceparent"] != "00-trace-span-01" {
+		t.Fatalf("%s failed: expected [%s] but received %v", test, queued.Message.Id, taken.Message)
+	} else if msg := rpc.FromProto(taken.Message); msg.TakenTimestamp.IsZero() || msg.QueueTimestamp.IsZero() {
+		t.Fatalf("%s failed: expected timestamps to be set but received %#v", test, msg)
+	}
+	if empty, err := client.Take(ctx, &rpc.QueueRequest{Queue: queueNameInmem}); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if empty.Message != nil {
+		t.Fatalf("%s failed: expected nil but received %v", test, empty.Message)
+	}
+	if _, err := client.Finish(ctx, &rpc.IdRequest{Queue: queueNameInmem, Id: taken.Message.Id}); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	if info, err := client.Info(ctx, &rpc.QueueRequest{Queue: queueNameInmem}); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if info.QueueSize != 0 || info.EphemeralSize != 0 || info.QueueCapacity != 1 {
+		t.Fatalf("%s failed: unexpected queue info %v", test, info)
+	}
+}
+
+func TestRpcServer_TakeStream(t *testing.T) {
+	test := "TestRpcServer_TakeStream"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	client, closeFunc := newRpcClient(t, backend)
+	defer closeFunc()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.TakeStream(ctx, &rpc.TakeStreamRequest{Queue: queueNameInmem})
+	if err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	numMsgs := 10
+	go func() {
+		for i := 0; i < numMsgs; i++ {
+			backend.Queue(singu.NewQueueMessage([]byte("content " + strconv.Itoa(i))))
+		}
+	}()
+	for i := 0; i < numMsgs; i++ {
+		if msg, err := stream.Recv(); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		} else if string(msg.Payload) != "content "+strconv.Itoa(i) {
+			t.Fatalf("%s failed: expected [%s] but received [%s]", test, "content "+strconv.Itoa(i), string(msg.Payload))
+		}
+	}
+	// messages are finished once sent
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, ephemeralSize)
+	}
+}
+
+func TestRpcServer_Consume(t *testing.T) {
+	test := "TestRpcServer_Consume"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	client, closeFunc := newRpcClient(t, backend)
+	defer closeFunc()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	numMsgs, maxInFlight := 5, 2
+	for i := 0; i < numMsgs; i++ {
+		backend.Queue(singu.NewQueueMessage([]byte("content " + strconv.Itoa(i))))
+	}
+	stream, err := client.Consume(ctx)
+	if err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	stream.Send(&rpc.ConsumeRequest{Request: &rpc.ConsumeRequest_Subscribe{Subscribe: &rpc.ConsumeRequest_Subscription{Queue: queueNameInmem, MaxInFlight: int32(maxInFlight)}}})
+
+	// receive max-in-flight messages, no more message is pushed until acknowledged
+	var received []*rpc.QueueMessage
+	for i := 0; i < maxInFlight; i++ {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+		received = append(received, msg)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if queueSize, _ := backend.QueueSize(); queueSize != numMsgs-maxInFlight {
+		t.Fatalf("%s failed: expected %d but received %d", test, numMsgs-maxInFlight, queueSize)
+	}
+
+	// finish the first message, requeue the second one
+	stream.Send(&rpc.ConsumeRequest{Request: &rpc.ConsumeRequest_Ack_{Ack: &rpc.ConsumeRequest_Ack{Id: received[0].Id, Type: rpc.ConsumeRequest_FINISH}}})
+	stream.Send(&rpc.ConsumeRequest{Request: &rpc.ConsumeRequest_Ack_{Ack: &rpc.ConsumeRequest_Ack{Id: received[1].Id, Type: rpc.ConsumeRequest_REQUEUE}}})
+	for i := 0; i < maxInFlight; i++ {
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+	}
+
+	// disconnect, unacknowledged messages are re-queued
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	if queueSize, _ := backend.QueueSize(); queueSize != numMsgs-1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, numMsgs-1, queueSize)
+	}
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, ephemeralSize)
+	}
+}
+
+func TestRpcServer_ConsumeUnknownAck(t *testing.T) {
+	test := "TestRpcServer_ConsumeUnknownAck"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	client, closeFunc := newRpcClient(t, backend)
+	defer closeFunc()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg, _ := backend.Queue(singu.NewQueueMessage([]byte("content")))
+	stream, err := client.Consume(ctx)
+	if err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	stream.Send(&rpc.ConsumeRequest{Request: &rpc.ConsumeRequest_Subscribe{Subscribe: &rpc.ConsumeRequest_Subscription{Queue: queueNameInmem}}})
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+
+	// a message taken outside the stream can not be acknowledged on it
+	other, _ := backend.Queue(singu.NewQueueMessage([]byte("other")))
+	backend.Take()
+	stream.Send(&rpc.ConsumeRequest{Request: &rpc.ConsumeRequest_Ack_{Ack: &rpc.ConsumeRequest_Ack{Id: other.Id, Type: rpc.ConsumeRequest_FINISH}}})
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("%s failed: expected %v but received %v", test, codes.InvalidArgument, err)
+	}
+	if m, err := backend.GetById(singu.EphemeralStorage, other.Id); err != nil || m == nil {
+		t.Fatalf("%s failed: message %s must still be in ephemeral storage: %e", test, other.Id, err)
+	}
+	if m, err := backend.GetById(singu.QueueStorage, msg.Id); err != nil || m == nil {
+		t.Fatalf("%s failed: message %s must be re-queued: %e", test, msg.Id, err)
+	}
+}
+
+func TestRpcServer_Auth(t *testing.T) {
+	test := "TestRpcServer_Auth"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	client, closeFunc := newRpcClient(t, backend, rpc.AuthServerOptions([]string{"secret"})...)
+	defer closeFunc()
+
+	if _, err := client.Take(context.Background(), &rpc.QueueRequest{Queue: queueNameInmem}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("%s failed: expected %v but received %v", test, codes.Unauthenticated, err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	if _, err := client.Take(ctx, &rpc.QueueRequest{Queue: queueNameInmem}); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+}
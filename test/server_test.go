@@ -0,0 +1,167 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestServer(config server.Config, queues ...singu.IQueue) *httptest.Server {
+	srv := server.NewServer(config)
+	for _, queue := range queues {
+		srv.RegisterQueue(queue)
+	}
+	return httptest.NewServer(srv)
+}
+
+func doRequest(t *testing.T, test, method, url, token string, body interface{}, result interface{}) int {
+	var reqBody bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&reqBody).Encode(body)
+	}
+	req, _ := http.NewRequest(method, url, &reqBody)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	defer resp.Body.Close()
+	if result != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServer_QueueTakeFinishRequeue(t *testing.T) {
+	test := "TestServer_QueueTakeFinishRequeue"
+	ts := newTestServer(server.Config{}, singu.NewInmemQueue(queueNameInmem, 0, false, 0))
+	defer ts.Close()
+	url := ts.URL + "/queues/" + queueNameInmem
+
+	var queued singu.QueueMessage
+	if status := doRequest(t, test, "POST", url+"/messages", "", singu.NewQueueMessage([]byte("content")), &queued); status != http.StatusOK {
+		t.Fatalf("%s failed: expected status %d but received %d", test, http.StatusOK, status)
+	}
+	var info server.QueueInfo
+	if doRequest(t, test, "GET", url, "", nil, &info); info.QueueSize != 1 || info.EphemeralSize != 0 {
+		t.Fatalf("%s failed: unexpected queue info %#v", test, info)
+	}
+
+	var taken singu.QueueMessage
+	if status := doRequest(t, test, "POST", url+"/take", "", nil, &taken); status != http.StatusOK {
+		t.Fatalf("%s failed: expected status %d but received %d", test, http.StatusOK, status)
+	} else if taken.Id != queued.Id || string(taken.Payload) != "content" {
+		t.Fatalf("%s failed: expected [%s] but received %#v", test, queued.Id, taken)
+	}
+	if status := doRequest(t, test, "POST", url+"/take", "", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("%s failed: expected status %d but received %d", test, http.StatusNoContent, status)
+	}
+
+	var requeued singu.QueueMessage
+	if status := doRequest(t, test, "POST", url+"/ephemeral/"+taken.Id+"/requeue", "", nil, &requeued); status != http.StatusOK {
+		t.Fatalf("%s failed: expected status %d but received %d", test, http.StatusOK, status)
+	} else if requeued.NumRequeues != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, requeued.NumRequeues)
+	}
+	doRequest(t, test, "POST", url+"/take", "", nil, &taken)
+	var orphans []*singu.QueueMessage
+	if doRequest(t, test, "GET", url+"/orphans?seconds=10", "", nil, &orphans); len(orphans) != 0 {
+		t.Fatalf("%s failed: expected %d orphan messages but received %d", test, 0, len(orphans))
+	}
+	if status := doRequest(t, test, "POST", url+"/ephemeral/"+taken.Id+"/finish", "", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("%s failed: expected status %d but received %d", test, http.StatusNoContent, status)
+	}
+	if doRequest(t, test, "GET", url, "", nil, &info); info.QueueSize != 0 || info.EphemeralSize != 0 {
+		t.Fatalf("%s failed: unexpected queue info %#v", test, info)
+	}
+}
+
+func TestServer_LongPollingTake(t *testing.T) {
+	test := "TestServer_LongPollingTake"
+	queue := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	ts := newTestServer(server.Config{PollInterval: 10 * time.Millisecond}, queue)
+	defer ts.Close()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		queue.Queue(singu.NewQueueMessage([]byte("content")))
+	}()
+	var taken singu.QueueMessage
+	if status := doRequest(t, test, "POST", ts.URL+"/queues/"+queueNameInmem+"/take?wait=5s", "", nil, &taken); status != http.StatusOK {
+		t.Fatalf("%s failed: expected status %d but received %d", test, http.StatusOK, status)
+	} else if string(taken.Payload) != "content" {
+		t.Fatalf("%s failed: expected [%s] but received %#v", test, "content", taken)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	test := "TestServer_Errors"
+	ts := newTestServer(server.Config{AuthTokens: []string{"secret"}}, singu.NewInmemQueue(queueNameInmem, 1, false, 0))
+	defer ts.Close()
+	url := ts.URL + "/queues/" + queueNameInmem
+
+	testCases := []struct {
+		method, url, token string
+		status             int
+		code               server.ErrorCode
+	}{
+		{"GET", url, "", http.StatusUnauthorized, server.CodeUnauthorized},
+		{"GET", url, "wrong", http.StatusUnauthorized, server.CodeUnauthorized},
+		{"GET", ts.URL + "/queues/not-exist", "secret", http.StatusNotFound, server.CodeQueueNotFound},
+		{"DELETE", url + "/messages", "secret", http.StatusMethodNotAllowed, server.CodeMethodNotAllowed},
+		{"POST", url + "/messages", "secret", 0, ""},
+		{"POST", url + "/messages", "secret", http.StatusInsufficientStorage, server.CodeQueueIsFull},
+	}
+	for i, tc := range testCases {
+		var errResp server.ErrorResponse
+		status := doRequest(t, test, tc.method, tc.url, tc.token, singu.NewQueueMessage([]byte("content")), &errResp)
+		if tc.status != 0 && (status != tc.status || errResp.Code != tc.code) {
+			t.Fatalf("%s failed at case %d: expected [%d/%s] but received [%d/%s]", test, i, tc.status, tc.code, status, errResp.Code)
+		}
+	}
+	if server.SentinelError(server.CodeQueueIsFull) != singu.ErrorQueueIsFull {
+		t.Fatalf("%s failed: expected %v but received %v", test, singu.ErrorQueueIsFull, server.SentinelError(server.CodeQueueIsFull))
+	}
+}
+
+func TestServer_WrappedSentinelError(t *testing.T) {
+	test := "TestServer_WrappedSentinelError"
+	queue := singu.Wrap(singu.NewInmemQueue(queueNameInmem, 0, false, 0), func(call singu.Call, next singu.Handler) singu.Result {
+		return singu.Result{Err: fmt.Errorf("interceptor: %w", singu.ErrorQueueIsPaused)}
+	})
+	ts := newTestServer(server.Config{}, queue)
+	defer ts.Close()
+
+	var errResp server.ErrorResponse
+	status := doRequest(t, test, "POST", ts.URL+"/queues/"+queueNameInmem+"/messages", "", singu.NewQueueMessage([]byte("content")), &errResp)
+	if status != http.StatusLocked || errResp.Code != server.CodeQueueIsPaused {
+		t.Fatalf("%s failed: expected [%d/%s] but received [%d/%s]", test, http.StatusLocked, server.CodeQueueIsPaused, status, errResp.Code)
+	}
+}
+
+func TestServer_RequestTooLarge(t *testing.T) {
+	test := "TestServer_RequestTooLarge"
+	ts := newTestServer(server.Config{MaxBodySize: 64}, singu.NewInmemQueue(queueNameInmem, 0, false, 0))
+	defer ts.Close()
+	url := ts.URL + "/queues/" + queueNameInmem + "/messages"
+
+	var errResp server.ErrorResponse
+	status := doRequest(t, test, "POST", url, "", singu.NewQueueMessage(bytes.Repeat([]byte("x"), 64)), &errResp)
+	if status != http.StatusRequestEntityTooLarge || errResp.Code != server.CodeRequestTooLarge {
+		t.Fatalf("%s failed: expected [%d/%s] but received [%d/%s]", test, http.StatusRequestEntityTooLarge, server.CodeRequestTooLarge, status, errResp.Code)
+	}
+	var msg singu.QueueMessage
+	if status := doRequest(t, test, "POST", url, "", map[string]string{}, &msg); status != http.StatusOK {
+		t.Fatalf("%s failed: expected status %d but received %d", test, http.StatusOK, status)
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/shovel"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls the condition until it is true or the timeout elapses, returns the condition's last result.
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func TestShovel_MoveAndFilter(t *testing.T) {
+	test := "TestShovel_MoveAndFilter"
+	src := singu.NewInmemQueue("src", 0, false, 0)
+	dst := singu.NewInmemQueue("dst", 0, false, 0)
+	for i := 0; i < 10; i++ {
+		src.Queue(singu.NewQueueMessage([]byte(strconv.Itoa(i))))
+	}
+	var reported int32
+	s := shovel.New(src, dst, shovel.Config{
+		PollInterval: 10 * time.Millisecond,
+		Filter:       func(msg *singu.QueueMessage) bool { return string(msg.Payload) != "5" },
+		OnProgress:   func(shovel.Progress) { atomic.AddInt32(&reported, 1) },
+	})
+	s.Start()
+	if !waitFor(5*time.Second, func() bool { return s.Progress().Moved == 9 }) {
+		t.Fatalf("%s failed: unexpected progress %#v", test, s.Progress())
+	}
+	// messages keep being moved while the shovel runs
+	src.Queue(singu.NewQueueMessage([]byte("10")))
+	if !waitFor(5*time.Second, func() bool { return s.Progress().Moved == 10 }) {
+		t.Fatalf("%s failed: unexpected progress %#v", test, s.Progress())
+	}
+	s.Stop()
+
+	progress := s.Progress()
+	if progress.Filtered != 1 || progress.Errors != 0 || progress.SourceSize != 0 {
+		t.Fatalf("%s failed: unexpected progress %#v", test, progress)
+	}
+	if atomic.LoadInt32(&reported) != 1 {
+		t.Fatalf("%s failed: expected progress to be reported once but reported %d times", test, reported)
+	}
+	if queueSize, _ := dst.QueueSize(); queueSize != 10 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 10, queueSize)
+	}
+	if ephemeralSize, _ := src.EphemeralSize(); ephemeralSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, ephemeralSize)
+	}
+	for _, expected := range []string{"0", "1", "2", "3", "4", "6"} {
+		if msg, _ := dst.Take(); msg == nil || string(msg.Payload) != expected {
+			t.Fatalf("%s failed: expected [%s] but received %#v", test, expected, msg)
+		}
+	}
+}
+
+func TestShovel_DestinationFull(t *testing.T) {
+	test := "TestShovel_DestinationFull"
+	src := singu.NewInmemQueue("src", 0, false, 0)
+	dst := singu.NewInmemQueue("dst", 2, false, 0)
+	for i := 0; i < 3; i++ {
+		src.Queue(singu.NewQueueMessage([]byte(strconv.Itoa(i))))
+	}
+	var errors int32
+	s := shovel.New(src, dst, shovel.Config{
+		PollInterval: 10 * time.Millisecond,
+		OnError: func(msg *singu.QueueMessage, err error) {
+			if err == singu.ErrorQueueIsFull {
+				atomic.AddInt32(&errors, 1)
+			}
+		},
+	})
+	s.Start()
+	defer s.Stop()
+	if !waitFor(5*time.Second, func() bool { return atomic.LoadInt32(&errors) > 0 }) {
+		t.Fatalf("%s failed: unexpected progress %#v", test, s.Progress())
+	}
+	// the rejected message is back in the source, and is moved once the destination has room
+	if !waitFor(5*time.Second, func() bool { size, _ := src.QueueSize(); return size == 1 }) {
+		t.Fatalf("%s failed: expected rejected message to be re-queued", test)
+	}
+	dst.Take()
+	if !waitFor(5*time.Second, func() bool { return s.Progress().Moved == 3 }) {
+		t.Fatalf("%s failed: unexpected progress %#v", test, s.Progress())
+	}
+	if msg, _ := dst.Take(); msg == nil || msg.NumRequeues != 0 {
+		t.Fatalf("%s failed: unexpected message %#v", test, msg)
+	}
+}
+
+func TestShovel_RateLimit(t *testing.T) {
+	test := "TestShovel_RateLimit"
+	src := singu.NewInmemQueue("src", 0, false, 0)
+	dst := singu.NewInmemQueue("dst", 0, false, 0)
+	for i := 0; i < 6; i++ {
+		src.Queue(singu.NewQueueMessage([]byte(strconv.Itoa(i))))
+	}
+	s := shovel.New(src, dst, shovel.Config{RateLimit: 20})
+	start := time.Now()
+	s.Start()
+	if !waitFor(5*time.Second, func() bool { return s.Progress().Moved == 6 }) {
+		t.Fatalf("%s failed: unexpected progress %#v", test, s.Progress())
+	}
+	s.Stop()
+	// 20 messages/second: 6 messages take at least 5 intervals of 50ms
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatalf("%s failed: 6 messages moved in %s", test, elapsed)
+	}
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/signing"
+	"testing"
+)
+
+// Queue genuine, tampered and unsigned messages, then Take them through a SignedQueue with a quarantine. Expected:
+//	- Consumers only see genuine messages, with their signature metadata
+//	- Tampered and unsigned messages are quarantined with the reason of the failure
+func TestSignedQueue(t *testing.T) {
+	test := "TestSignedQueue"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	public, private, _ := ed25519.GenerateKey(nil)
+	producer := signing.NewSignedQueue(backend, signing.Config{
+		Keys: &signing.KeySet{Current: "ed1", Keys: map[string]signing.Key{"ed1": signing.NewEd25519(private), "hmac1": signing.NewHMAC([]byte("secret"))}},
+	})
+	quarantine := singu.NewInmemQueue("quarantine", 0, false, 0)
+	var quarantined []error
+	consumer := signing.NewSignedQueue(backend, signing.Config{
+		Keys:         &signing.KeySet{Keys: map[string]signing.Key{"ed1": signing.NewEd25519Public(public)}},
+		Quarantine:   quarantine,
+		OnQuarantine: func(msg *singu.QueueMessage, err error) { quarantined = append(quarantined, err) },
+	})
+	if _, err := consumer.Queue(singu.NewQueueMessage([]byte("message"))); err != signing.ErrorUnknownKey {
+		t.Fatalf("%s failed: expected %v but received %v", test, signing.ErrorUnknownKey, err)
+	}
+
+	msg := singu.NewQueueMessage([]byte("genuine"))
+	msg.Metadata = map[string]string{"traceparent": "00-trace"}
+	producer.Queue(msg)
+	producer.Queue(singu.NewQueueMessage([]byte("tampered payload")))
+	producer.Queue(singu.NewQueueMessage([]byte("tampered metadata")))
+	backend.Queue(singu.NewQueueMessage([]byte("unsigned")))
+	producer.Queue(singu.NewQueueMessage([]byte("genuine too")))
+	if len(msg.Metadata) != 1 {
+		t.Fatalf("%s failed: caller's message was modified %v", test, msg.Metadata)
+	}
+	stored, _ := backend.Peek(3)
+	backend.UpdatePayload(singu.QueueStorage, stored[1].Id, []byte("forged payload"))
+	forged := singu.CloneQueueMessage(*stored[2])
+	forged.Metadata["traceparent"] = "forged"
+	backend.RemoveById(singu.QueueStorage, stored[2].Id)
+	backend.Queue(&forged)
+
+	// messages failing verification are quarantined, consumers only see genuine messages
+	taken, err := consumer.Take()
+	if err != nil || string(taken.Payload) != "genuine" || taken.Metadata["traceparent"] != "00-trace" || taken.Metadata[signing.MetadataKeyId] != "ed1" {
+		t.Fatalf("%s failed: unexpected message %v / %e", test, taken, err)
+	}
+	consumer.Finish(taken.Id)
+	if taken, err = consumer.Take(); err != nil || string(taken.Payload) != "genuine too" {
+		t.Fatalf("%s failed: unexpected message %v / %e", test, taken, err)
+	}
+	consumer.Finish(taken.Id)
+	if taken, err = consumer.Take(); err != nil || taken != nil {
+		t.Fatalf("%s failed: expected no message but received %v / %e", test, taken, err)
+	}
+	if size, _ := quarantine.QueueSize(); size != 3 {
+		t.Fatalf("%s failed: expected 3 quarantined messages but received %d", test, size)
+	}
+	if size, _ := backend.EphemeralSize(); size != 0 {
+		t.Fatalf("%s failed: expected empty ephemeral storage but received %d", test, size)
+	}
+	reasons := []error{signing.ErrorInvalidSignature, signing.ErrorUnsigned, signing.ErrorInvalidSignature}
+	q, _ := quarantine.Peek(3)
+	for i, reason := range reasons {
+		if quarantined[i] != reason || q[i].Metadata[signing.MetadataQuarantineReason] != reason.Error() || q[i].Metadata[signing.MetadataQuarantineSource] != backend.Name() {
+			t.Fatalf("%s failed: expected %v for quarantined message #%d but received %v / %v", test, reason, i, quarantined[i], q[i].Metadata)
+		}
+	}
+	if _, err := consumer.UpdatePayload(singu.QueueStorage, "id", nil); err != singu.ErrorOperationNotSupported {
+		t.Fatalf("%s failed: expected %v but received %v", test, singu.ErrorOperationNotSupported, err)
+	}
+}
+
+func TestSignedQueue_HMACWithoutQuarantine(t *testing.T) {
+	test := "TestSignedQueue_HMACWithoutQuarantine"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	producer := signing.NewSignedQueue(backend, signing.Config{Keys: &signing.KeySet{Current: "k1", Keys: map[string]signing.Key{"k1": signing.NewHMAC([]byte("secret"))}}})
+	rotated := signing.NewSignedQueue(backend, signing.Config{Keys: &signing.KeySet{Current: "k2", Keys: map[string]signing.Key{
+		"k1": signing.NewHMAC([]byte("secret")),
+		"k2": signing.NewHMAC([]byte("new secret")),
+	}}})
+	producer.Queue(singu.NewQueueMessage([]byte("signed with k1")))
+	rotated.Queue(singu.NewQueueMessage([]byte("signed with k2")))
+
+	// key rotation: the rotated key set verifies messages signed with either key
+	if msg, err := rotated.Take(); err != nil || string(msg.Payload) != "signed with k1" {
+		t.Fatalf("%s failed: unexpected message %v / %e", test, msg, err)
+	}
+	msg, err := producer.Take()
+	var verifyErr *signing.VerifyError
+	if msg != nil || !errors.Is(err, signing.ErrorUnknownKey) || !errors.As(err, &verifyErr) || verifyErr.Id == "" {
+		t.Fatalf("%s failed: expected %v but received %v / %v", test, signing.ErrorUnknownKey, msg, err)
+	}
+	if size, _ := backend.EphemeralSize(); size != 2 {
+		t.Fatalf("%s failed: expected 2 messages in ephemeral storage but received %d", test, size)
+	}
+	public, _, _ := ed25519.GenerateKey(nil)
+	if _, err := signing.NewSignedQueue(backend, signing.Config{Keys: &signing.KeySet{Current: "pub", Keys: map[string]signing.Key{"pub": signing.NewEd25519Public(public)}}}).Queue(singu.NewQueueMessage(nil)); err != signing.ErrorCannotSign {
+		t.Fatalf("%s failed: expected %v but received %v", test, signing.ErrorCannotSign, err)
+	}
+}
@@ -80,7 +80,7 @@ func MyTest_QueueOne(test string, queue singu.IQueue, t *testing.T) {
 //	- Ephemeral size = 1 (or not supported)
 //	- Orphan message list (long period) must be empty
 //	- Orphan message list (short period) must contain 1 item
-func MyTest_QueueAndTakeOne(test string, queue singu.IQueue, t *testing.T) {
+func MyTest_QueueAndTakeOne(test string, queue singu.IQueue, clock *singu.FakeClock, t *testing.T) {
 	content := "Queue content"
 	msg := singu.NewQueueMessage([]byte(content))
 	var err error
@@ -127,7 +127,7 @@ func MyTest_QueueAndTakeOne(test string, queue singu.IQueue, t *testing.T) {
 			t.Fatalf("%s failed: expected %d orpham messages (in %d seconds) received %d ones", test, 0, 10, len(orphanMsgs))
 		}
 
-		time.Sleep(3 * time.Second)
+		clock.Advance(3 * time.Second)
 
 		if orphanMsgs, err := queue.OrphanMessages(2, 0); err != nil {
 			t.Fatalf("%s failed with error: %e", test, err)
@@ -154,7 +154,7 @@ func MyTest_QueueAndTakeOne(test string, queue singu.IQueue, t *testing.T) {
 //	- Queue size = 0 (or not supported)
 //	- Ephemeral size = 0 (or not supported)
 //	- Orphan message list must be empty
-func MyTest_QueueTakeAndFinishOne(test string, queue singu.IQueue, t *testing.T) {
+func MyTest_QueueTakeAndFinishOne(test string, queue singu.IQueue, clock *singu.FakeClock, t *testing.T) {
 	content := "Queue content"
 	msg := singu.NewQueueMessage([]byte(content))
 	var err error
@@ -201,7 +201,7 @@ func MyTest_QueueTakeAndFinishOne(test string, queue singu.IQueue, t *testing.T)
 			t.Fatalf("%s failed: expected %d orpham messages (in %d seconds) received %d ones", test, 0, 10, len(orphanMsgs))
 		}
 
-		time.Sleep(3 * time.Second)
+		clock.Advance(3 * time.Second)
 
 		if orphanMsgs, err := queue.OrphanMessages(2, 0); err != nil {
 			t.Fatalf("%s failed with error: %e", test, err)
@@ -436,6 +436,14 @@ func MyTest_EphemeralDisabled(test string, queue singu.IQueue, t *testing.T) {
 			t.Fatalf("%s failed: expected %d or %d but received %d", test, 0, singu.SizeNotSupported, ephemeralSize)
 		}
 	}
+
+	// ephemeral storage is always empty: there is nothing to purge nor to re-queue
+	if count, err := queue.PurgeEphemeralStorage(); err != nil || count != 0 {
+		t.Fatalf("%s failed: expected %d but received %d / %e", test, 0, count, err)
+	}
+	if count, err := queue.RequeueAllEphemeral(false); err != nil || count != 0 {
+		t.Fatalf("%s failed: expected %d but received %d / %e", test, 0, count, err)
+	}
 }
 
 // Queue <ephemeral-max-size>+1 messages, expected:
@@ -655,7 +663,7 @@ func MyTest_LongQueue(test string, queue singu.IQueue, numProducers, numConsumer
 				content := "Queue content " + strconv.Itoa(id) + "  -  " + strconv.Itoa(i)
 				msg := singu.NewQueueMessage([]byte(content))
 				if msg, err := queue.Queue(msg); err != nil {
-					t.Fatalf("%s failed with error: %e", test, err)
+					t.Errorf("%s failed with error: %e", test, err)
 				} else {
 					msgs.Store(msg.Id, msg)
 				}
@@ -725,7 +733,7 @@ func MyTest_MultiThreads(test string, queue singu.IQueue, numProducers, numConsu
 				content := "Queue content " + strconv.Itoa(id) + "  -  " + strconv.Itoa(i)
 				msg := singu.NewQueueMessage([]byte(content))
 				if msg, err := queue.Queue(msg); err != nil {
-					t.Fatalf("%s failed with error: %e", test, err)
+					t.Errorf("%s failed with error: %e", test, err)
 				} else {
 					msgsProduced.Store(msg.Id, msg)
 				}
@@ -780,7 +788,7 @@ func MyTest_MultiThreads(test string, queue singu.IQueue, numProducers, numConsu
 // Queue and Take a N messages, then call OrphanMessages with numMessages=X (X < N). Expected:
 //	- ephemeral size = N
 //	- number of returned orphan messages = X
-func MyTest_OrphanMessagesWithLimit(test string, queue singu.IQueue, t *testing.T) {
+func MyTest_OrphanMessagesWithLimit(test string, queue singu.IQueue, clock *singu.FakeClock, t *testing.T) {
 	numMsgsToQueue := 10
 	numOrphanMsgsToGet := 9
 
@@ -802,7 +810,7 @@ func MyTest_OrphanMessagesWithLimit(test string, queue singu.IQueue, t *testing.
 		t.Fatalf("%s failed: expected %d or %d but received %d", test, numMsgsToQueue, singu.SizeNotSupported, ephemeralSize)
 	}
 
-	time.Sleep(3 * time.Second)
+	clock.Advance(3 * time.Second)
 
 	orphanMsgs, err := queue.OrphanMessages(2, numOrphanMsgsToGet)
 	if err != nil {
@@ -812,3 +820,413 @@ func MyTest_OrphanMessagesWithLimit(test string, queue singu.IQueue, t *testing.
 		t.Fatalf("%s failed: expected %d but received %d", test, numOrphanMsgsToGet, len(orphanMsgs))
 	}
 }
+
+// Queue and Take a message using a queue driven by a FakeClock, then advance the clock. Expected:
+//	- Message is not orphan until the clock has been advanced past numSeconds
+//	- Message is orphan right after the clock has been advanced past numSeconds
+func MyTest_OrphanMessagesWithClock(test string, queue singu.IQueue, clock *singu.FakeClock, t *testing.T) {
+	msg := singu.NewQueueMessageWithClock([]byte("Queue content"), clock)
+	var err error
+	if msg, err = queue.Queue(msg); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if !msg.QueueTimestamp.Equal(clock.Now()) {
+		t.Fatalf("%s failed: expected queue timestamp %v but received %v", test, clock.Now(), msg.QueueTimestamp)
+	}
+	if msg2, err := queue.Take(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if msg2 == nil {
+		t.Fatalf("%s failed: expected message but received nil", test)
+	} else if !msg2.TakenTimestamp.Equal(clock.Now()) {
+		t.Fatalf("%s failed: expected taken timestamp %v but received %v", test, clock.Now(), msg2.TakenTimestamp)
+	}
+
+	clock.Advance(2 * time.Second)
+	if orphanMsgs, err := queue.OrphanMessages(2, 0); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if len(orphanMsgs) != 0 {
+		t.Fatalf("%s failed: expected %d orpham messages (in %d seconds) received %d ones", test, 0, 2, len(orphanMsgs))
+	}
+
+	clock.Advance(1 * time.Millisecond)
+	if orphanMsgs, err := queue.OrphanMessages(2, 0); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if len(orphanMsgs) != 1 {
+		t.Fatalf("%s failed: expected %d orpham messages (in %d seconds) received %d ones", test, 1, 2, len(orphanMsgs))
+	} else if orphanMsgs[0].Id != msg.Id {
+		t.Fatalf("%s failed: expected [%s] but received [%s]", test, msg.Id, orphanMsgs[0].Id)
+	}
+}
+
+// Queue N messages and Take 2 of them, then Peek and Browse both storages. Expected:
+//	- Peek returns messages in the order they would be taken
+//	- Browse returns all messages of each storage, page by page
+//	- Queue size, ephemeral size, message order and timestamps are not changed
+func MyTest_PeekAndBrowse(test string, queue singu.IQueue, t *testing.T) {
+	numMsgs := 5
+	queuedMsgs := make([]*singu.QueueMessage, 0)
+	for i := 0; i < numMsgs; i++ {
+		msg := singu.NewQueueMessage([]byte("Queue content " + strconv.Itoa(i)))
+		if msg, err := queue.Queue(msg); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		} else {
+			queuedMsgs = append(queuedMsgs, msg)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := queue.Take(); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+	}
+
+	if msgs, err := queue.Peek(2); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if len(msgs) != 2 {
+		t.Fatalf("%s failed: expected %d messages but received %d", test, 2, len(msgs))
+	} else {
+		for i, msg := range msgs {
+			if msg.Id != queuedMsgs[i+2].Id || !msg.QueueTimestamp.Equal(queuedMsgs[i+2].QueueTimestamp) || !msg.TakenTimestamp.IsZero() {
+				t.Fatalf("%s failed: expected [%s/%v] but received [%s/%v]", test, queuedMsgs[i+2].Id, queuedMsgs[i+2].QueueTimestamp, msg.Id, msg.QueueTimestamp)
+			}
+		}
+	}
+	if msgs, err := queue.Peek(0); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if len(msgs) != numMsgs-2 {
+		t.Fatalf("%s failed: expected %d messages but received %d", test, numMsgs-2, len(msgs))
+	}
+
+	var browsed []*singu.QueueMessage
+	numPages := 0
+	for cursor := ""; numPages == 0 || cursor != ""; numPages++ {
+		msgs, nextCursor, err := queue.Browse(singu.QueueStorage, cursor, 2)
+		if err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+		browsed = append(browsed, msgs...)
+		cursor = nextCursor
+	}
+	if numPages != 2 || len(browsed) != numMsgs-2 {
+		t.Fatalf("%s failed: expected %d messages in %d pages but received %d in %d", test, numMsgs-2, 2, len(browsed), numPages)
+	}
+	for i, msg := range browsed {
+		if msg.Id != queuedMsgs[i+2].Id {
+			t.Fatalf("%s failed: expected [%s] but received [%s]", test, queuedMsgs[i+2].Id, msg.Id)
+		}
+	}
+
+	if queue.IsEphemeralStorageEnabled() {
+		browsed = nil
+		numPages = 0
+		for cursor := ""; numPages == 0 || cursor != ""; numPages++ {
+			msgs, nextCursor, err := queue.Browse(singu.EphemeralStorage, cursor, 1)
+			if err != nil {
+				t.Fatalf("%s failed with error: %e", test, err)
+			}
+			browsed = append(browsed, msgs...)
+			cursor = nextCursor
+		}
+		if len(browsed) != 2 {
+			t.Fatalf("%s failed: expected %d messages but received %d", test, 2, len(browsed))
+		}
+		ids := map[string]bool{queuedMsgs[0].Id: true, queuedMsgs[1].Id: true}
+		for _, msg := range browsed {
+			if !ids[msg.Id] || msg.TakenTimestamp.IsZero() {
+				t.Fatalf("%s failed: unexpected message [%s/%v]", test, msg.Id, msg.TakenTimestamp)
+			}
+			delete(ids, msg.Id)
+		}
+	}
+
+	if queueSize, err := queue.QueueSize(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if queueSize != numMsgs-2 && queueSize != singu.SizeNotSupported {
+		t.Fatalf("%s failed: expected %d or %d but received %d", test, numMsgs-2, singu.SizeNotSupported, queueSize)
+	}
+	if msg, err := queue.Take(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if msg == nil || msg.Id != queuedMsgs[2].Id {
+		t.Fatalf("%s failed: expected [%s] but received %#v", test, queuedMsgs[2].Id, msg)
+	}
+}
+
+// Queue 3 messages and Take the first one, then Get, Update and Remove messages by id. Expected:
+//	- GetById finds messages in the storage they are in, and nil in the other storage
+//	- UpdatePayload changes message's payload but not its position
+//	- RemoveById removes message from storage, removed message is not taken afterward
+func MyTest_GetRemoveUpdateById(test string, queue singu.IQueue, t *testing.T) {
+	queuedMsgs := make([]*singu.QueueMessage, 0)
+	for i := 0; i < 3; i++ {
+		msg := singu.NewQueueMessage([]byte("Queue content " + strconv.Itoa(i)))
+		if msg, err := queue.Queue(msg); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		} else {
+			queuedMsgs = append(queuedMsgs, msg)
+		}
+	}
+	if _, err := queue.Take(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+
+	if msg, err := queue.GetById(singu.QueueStorage, queuedMsgs[1].Id); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if msg == nil || msg.Id != queuedMsgs[1].Id || !bytes.Equal(msg.Payload, queuedMsgs[1].Payload) {
+		t.Fatalf("%s failed: expected [%s] but received %#v", test, queuedMsgs[1].Id, msg)
+	}
+	if msg, err := queue.GetById(singu.QueueStorage, queuedMsgs[0].Id); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if msg != nil {
+		t.Fatalf("%s failed: expected nil but received %#v", test, msg)
+	}
+	if queue.IsEphemeralStorageEnabled() {
+		if msg, err := queue.GetById(singu.EphemeralStorage, queuedMsgs[0].Id); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		} else if msg == nil || msg.Id != queuedMsgs[0].Id || msg.TakenTimestamp.IsZero() {
+			t.Fatalf("%s failed: expected [%s] but received %#v", test, queuedMsgs[0].Id, msg)
+		}
+		if msg, err := queue.UpdatePayload(singu.EphemeralStorage, queuedMsgs[0].Id, []byte("updated 0")); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		} else if msg == nil || string(msg.Payload) != "updated 0" {
+			t.Fatalf("%s failed: expected [%s] but received %#v", test, "updated 0", msg)
+		}
+		if msg, err := queue.RemoveById(singu.EphemeralStorage, queuedMsgs[0].Id); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		} else if msg == nil || string(msg.Payload) != "updated 0" {
+			t.Fatalf("%s failed: expected [%s] but received %#v", test, "updated 0", msg)
+		}
+		if ephemeralSize, err := queue.EphemeralSize(); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		} else if ephemeralSize != 0 && ephemeralSize != singu.SizeNotSupported {
+			t.Fatalf("%s failed: expected %d or %d but received %d", test, 0, singu.SizeNotSupported, ephemeralSize)
+		}
+	}
+
+	if msg, err := queue.UpdatePayload(singu.QueueStorage, queuedMsgs[2].Id, []byte("updated 2")); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if msg == nil || msg.Id != queuedMsgs[2].Id || string(msg.Payload) != "updated 2" {
+		t.Fatalf("%s failed: expected [%s/%s] but received %#v", test, queuedMsgs[2].Id, "updated 2", msg)
+	}
+	if msg, err := queue.UpdatePayload(singu.QueueStorage, "not-exist", []byte("updated")); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if msg != nil {
+		t.Fatalf("%s failed: expected nil but received %#v", test, msg)
+	}
+	if msg, err := queue.RemoveById(singu.QueueStorage, queuedMsgs[1].Id); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if msg == nil || msg.Id != queuedMsgs[1].Id {
+		t.Fatalf("%s failed: expected [%s] but received %#v", test, queuedMsgs[1].Id, msg)
+	}
+	if queueSize, err := queue.QueueSize(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if queueSize != 1 && queueSize != singu.SizeNotSupported {
+		t.Fatalf("%s failed: expected %d or %d but received %d", test, 1, singu.SizeNotSupported, queueSize)
+	}
+
+	if msg, err := queue.Take(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if msg == nil || msg.Id != queuedMsgs[2].Id || string(msg.Payload) != "updated 2" {
+		t.Fatalf("%s failed: expected [%s/%s] but received %#v", test, queuedMsgs[2].Id, "updated 2", msg)
+	}
+	if msg, err := queue.Take(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if msg != nil {
+		t.Fatalf("%s failed: expected nil but received %#v", test, msg)
+	}
+}
+
+// Queue N messages and Take 2 of them, then call the administration operations. Expected:
+//	- RequeueAllEphemeral moves 2 messages back to queue storage, their re-queue count is increased
+//	- PurgeEphemeralStorage and PurgeQueueStorage report number of removed messages and leave storages empty
+func MyTest_PurgeAndRequeueAll(test string, queue singu.IQueue, t *testing.T) {
+	numMsgs := 5
+	for i := 0; i < numMsgs; i++ {
+		msg := singu.NewQueueMessage([]byte("Queue content " + strconv.Itoa(i)))
+		if _, err := queue.Queue(msg); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := queue.Take(); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+	}
+
+	if count, err := queue.RequeueAllEphemeral(false); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if count != 2 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 2, count)
+	}
+	if queueSize, err := queue.QueueSize(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if queueSize != numMsgs && queueSize != singu.SizeNotSupported {
+		t.Fatalf("%s failed: expected %d or %d but received %d", test, numMsgs, singu.SizeNotSupported, queueSize)
+	}
+	if ephemeralSize, err := queue.EphemeralSize(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if ephemeralSize != 0 && ephemeralSize != singu.SizeNotSupported {
+		t.Fatalf("%s failed: expected %d or %d but received %d", test, 0, singu.SizeNotSupported, ephemeralSize)
+	}
+	numRequeued := 0
+	for i := 0; i < numMsgs; i++ {
+		if msg, err := queue.Take(); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		} else if msg == nil {
+			t.Fatalf("%s failed: expected message but received nil", test)
+		} else if msg.NumRequeues == 1 {
+			numRequeued++
+		}
+	}
+	if numRequeued != 2 {
+		t.Fatalf("%s failed: expected %d re-queued messages but received %d", test, 2, numRequeued)
+	}
+
+	if count, err := queue.PurgeEphemeralStorage(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if count != numMsgs {
+		t.Fatalf("%s failed: expected %d but received %d", test, numMsgs, count)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := queue.Queue(singu.NewQueueMessage([]byte("Queue content"))); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+	}
+	if count, err := queue.PurgeQueueStorage(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if count != 3 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 3, count)
+	}
+	MyTest_Empty(test, queue, t)
+}
+
+// Queue a message and pause the queue, expected:
+//	- Take returns ErrorQueueIsPaused
+//	- Queue keeps working
+//
+// Resume the queue, expected:
+//	- Take returns queued messages
+func MyTest_PauseAndResume(test string, queue singu.IQueue, t *testing.T) {
+	if _, err := queue.Queue(singu.NewQueueMessage([]byte("Queue content"))); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	if err := queue.Pause(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	if !queue.IsPaused() {
+		t.Fatalf("%s failed: expected queue to be paused", test)
+	}
+	if msg, err := queue.Take(); err != singu.ErrorQueueIsPaused {
+		t.Fatalf("%s failed: expected %v but received %v/%#v", test, singu.ErrorQueueIsPaused, err, msg)
+	}
+	if _, err := queue.Queue(singu.NewQueueMessage([]byte("Queue content"))); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	if queueSize, err := queue.QueueSize(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	} else if queueSize != 2 && queueSize != singu.SizeNotSupported {
+		t.Fatalf("%s failed: expected %d or %d but received %d", test, 2, singu.SizeNotSupported, queueSize)
+	}
+
+	if err := queue.Resume(); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	if queue.IsPaused() {
+		t.Fatalf("%s failed: expected queue not to be paused", test)
+	}
+	for i := 0; i < 2; i++ {
+		if msg, err := queue.Take(); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		} else if msg == nil {
+			t.Fatalf("%s failed: expected message but received nil", test)
+		}
+	}
+}
+
+func MyTest_ExportImport(test string, src, dst singu.IQueue, t *testing.T) {
+	for _, content := range []string{"message 1", "message 2", "message 3"} {
+		if _, err := src.Queue(singu.NewQueueMessage([]byte(content))); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+	}
+	// queue storage: message 3, message 1 (re-queued once); ephemeral storage: message 2
+	msg1, _ := src.Take()
+	if _, err := src.Requeue(msg1.Id, false); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	src.Take()
+	queued, _, _ := src.Browse(singu.QueueStorage, "", 0)
+	taken, _, _ := src.Browse(singu.EphemeralStorage, "", 0)
+
+	buf := &bytes.Buffer{}
+	if count, err := singu.Export(src, buf); err != nil || count != 3 {
+		t.Fatalf("%s failed: expected %d messages exported but received %d/%e", test, 3, count, err)
+	}
+	if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines != 3 {
+		t.Fatalf("%s failed: expected %d lines but received %d", test, 3, lines)
+	}
+	exported := buf.String()
+	for i := 0; i < 2; i++ {
+		// importing twice does not duplicate messages
+		if count, err := singu.Import(dst, bytes.NewBufferString(exported)); err != nil || count != 3 {
+			t.Fatalf("%s failed: expected %d messages imported but received %d/%e", test, 3, count, err)
+		}
+	}
+	if queueSize, _ := dst.QueueSize(); queueSize != 2 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 2, queueSize)
+	}
+	if ephemeralSize, _ := dst.EphemeralSize(); ephemeralSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, ephemeralSize)
+	}
+	expected := map[singu.StorageType][]*singu.QueueMessage{singu.QueueStorage: queued, singu.EphemeralStorage: taken}
+	for storage, msgs := range expected {
+		for _, msg := range msgs {
+			restored, err := dst.GetById(storage, msg.Id)
+			if err != nil || restored == nil {
+				t.Fatalf("%s failed: expected message %s in %s storage but received %#v/%e", test, msg.Id, storage, restored, err)
+			}
+			if string(restored.Payload) != string(msg.Payload) || restored.NumRequeues != msg.NumRequeues ||
+				!restored.Timestamp.Equal(msg.Timestamp) || !restored.QueueTimestamp.Equal(msg.QueueTimestamp) ||
+				!restored.TakenTimestamp.Equal(msg.TakenTimestamp) {
+				t.Fatalf("%s failed: expected %#v but received %#v", test, msg, restored)
+			}
+		}
+	}
+
+	// restored queue storage can be consumed
+	for i := 0; i < 2; i++ {
+		if msg, err := dst.Take(); err != nil || msg == nil {
+			t.Fatalf("%s failed: expected message but received %#v/%e", test, msg, err)
+		}
+	}
+}
+
+// nonRestorableQueue hides IRestorable of the embedded queue.
+type nonRestorableQueue struct {
+	singu.IQueue
+}
+
+func MyTest_ImportNonRestorable(test string, src singu.IQueue, t *testing.T) {
+	src.Queue(singu.NewQueueMessage([]byte("message 1")))
+	src.Queue(singu.NewQueueMessage([]byte("message 2")))
+	msg, _ := src.Take()
+	src.Requeue(msg.Id, false)
+	src.Take()
+
+	buf := &bytes.Buffer{}
+	singu.Export(src, buf)
+	dst := nonRestorableQueue{singu.NewInmemQueue(queueNameInmem, 0, false, 0)}
+	if count, err := singu.Import(dst, buf); err != nil || count != 2 {
+		t.Fatalf("%s failed: expected %d messages imported but received %d/%e", test, 2, count, err)
+	}
+	// messages of both storages are enqueued as new messages
+	if queueSize, _ := dst.QueueSize(); queueSize != 2 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 2, queueSize)
+	}
+	for i := 0; i < 2; i++ {
+		if msg, _ := dst.Take(); msg == nil || msg.NumRequeues != 0 {
+			t.Fatalf("%s failed: unexpected message %#v", test, msg)
+		}
+	}
+
+	if _, err := singu.Import(dst, bytes.NewBufferString(`{"storage":"unknown","message":{}}`)); err == nil {
+		t.Fatalf("%s failed: expected error for invalid storage", test)
+	}
+}
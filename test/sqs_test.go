@@ -0,0 +1,245 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/sqs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sqsQuery sends a query protocol request and decodes the XML response into result, returns the response status.
+func sqsQuery(t *testing.T, ts *httptest.Server, params url.Values, result interface{}) int {
+	resp, err := http.PostForm(ts.URL+"/", params)
+	if err != nil {
+		t.Fatalf("error sending request: %e", err)
+	}
+	defer resp.Body.Close()
+	if result != nil {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if err := xml.Unmarshal(body, result); err != nil {
+			t.Fatalf("error decoding response [%s]: %e", body, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// sqsJson sends a JSON protocol request and decodes the JSON response into result, returns the response status.
+func sqsJson(t *testing.T, ts *httptest.Server, action string, params map[string]interface{}, result interface{}) int {
+	body, _ := json.Marshal(params)
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %e", err)
+	}
+	defer resp.Body.Close()
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("error decoding response: %e", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type sqsXmlMessage struct {
+	MessageId     string
+	ReceiptHandle string
+	MD5OfBody     string
+	Body          string
+	Attribute     []struct{ Name, Value string }
+}
+
+func TestSqsServer_QueryProtocol(t *testing.T) {
+	test := "TestSqsServer_QueryProtocol"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv := sqs.NewServer(sqs.Config{PollInterval: 10 * time.Millisecond})
+	srv.RegisterQueue(backend)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var queueUrl struct {
+		QueueUrl string `xml:"GetQueueUrlResult>QueueUrl"`
+	}
+	sqsQuery(t, ts, url.Values{"Action": {"GetQueueUrl"}, "QueueName": {queueNameInmem}}, &queueUrl)
+	if queueUrl.QueueUrl != ts.URL+"/"+sqs.DefaultAccountId+"/"+queueNameInmem {
+		t.Fatalf("%s failed: unexpected queue url [%s]", test, queueUrl.QueueUrl)
+	}
+
+	var sent struct {
+		MessageId        string `xml:"SendMessageResult>MessageId"`
+		MD5OfMessageBody string `xml:"SendMessageResult>MD5OfMessageBody"`
+	}
+	if status := sqsQuery(t, ts, url.Values{"Action": {"SendMessage"}, "QueueUrl": {queueUrl.QueueUrl}, "MessageBody": {"hello"}}, &sent); status != http.StatusOK {
+		t.Fatalf("%s failed: expected status %d but received %d", test, http.StatusOK, status)
+	}
+	if sent.MD5OfMessageBody != "5d41402abc4b2a76b9719d911017c592" {
+		t.Fatalf("%s failed: unexpected MD5 [%s]", test, sent.MD5OfMessageBody)
+	}
+
+	var received struct {
+		Messages []sqsXmlMessage `xml:"ReceiveMessageResult>Message"`
+	}
+	sqsQuery(t, ts, url.Values{"Action": {"ReceiveMessage"}, "QueueUrl": {queueUrl.QueueUrl}, "AttributeName.1": {"All"}}, &received)
+	if len(received.Messages) != 1 || received.Messages[0].Body != "hello" || received.Messages[0].MessageId != sent.MessageId {
+		t.Fatalf("%s failed: unexpected messages %#v", test, received.Messages)
+	}
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, ephemeralSize)
+	}
+
+	var attrs struct {
+		Attributes []struct{ Name, Value string } `xml:"GetQueueAttributesResult>Attribute"`
+	}
+	sqsQuery(t, ts, url.Values{"Action": {"GetQueueAttributes"}, "QueueUrl": {queueUrl.QueueUrl}, "AttributeName.1": {"ApproximateNumberOfMessagesNotVisible"}}, &attrs)
+	if len(attrs.Attributes) != 1 || attrs.Attributes[0].Value != "1" {
+		t.Fatalf("%s failed: unexpected attributes %#v", test, attrs.Attributes)
+	}
+
+	sqsQuery(t, ts, url.Values{"Action": {"DeleteMessage"}, "QueueUrl": {queueUrl.QueueUrl}, "ReceiptHandle": {received.Messages[0].ReceiptHandle}}, nil)
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, ephemeralSize)
+	}
+
+	var errResp struct {
+		Code string `xml:"Error>Code"`
+	}
+	if status := sqsQuery(t, ts, url.Values{"Action": {"SendMessage"}, "QueueUrl": {ts.URL + "/0/not-exist"}, "MessageBody": {"hello"}}, &errResp); status != http.StatusBadRequest || errResp.Code != "AWS.SimpleQueueService.NonExistentQueue" {
+		t.Fatalf("%s failed: unexpected error %d/%s", test, status, errResp.Code)
+	}
+}
+
+func TestSqsServer_JsonProtocol(t *testing.T) {
+	test := "TestSqsServer_JsonProtocol"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv := sqs.NewServer(sqs.Config{PollInterval: 10 * time.Millisecond})
+	srv.RegisterQueue(backend)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	queueUrl := ts.URL + "/" + sqs.DefaultAccountId + "/" + queueNameInmem
+
+	// long-polling
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		sqsJson(t, ts, "SendMessage", map[string]interface{}{"QueueUrl": queueUrl, "MessageBody": "hello"}, nil)
+	}()
+	var received struct {
+		Messages []struct {
+			MessageId, ReceiptHandle, Body string
+			Attributes                     map[string]string
+		}
+	}
+	sqsJson(t, ts, "ReceiveMessage", map[string]interface{}{"QueueUrl": queueUrl, "WaitTimeSeconds": 2, "MessageSystemAttributeNames": []string{"ApproximateReceiveCount"}}, &received)
+	if len(received.Messages) != 1 || received.Messages[0].Body != "hello" || received.Messages[0].Attributes["ApproximateReceiveCount"] != "1" {
+		t.Fatalf("%s failed: unexpected messages %#v", test, received.Messages)
+	}
+
+	// visibility timeout 0 makes the message visible again right away
+	sqsJson(t, ts, "ChangeMessageVisibility", map[string]interface{}{"QueueUrl": queueUrl, "ReceiptHandle": received.Messages[0].ReceiptHandle, "VisibilityTimeout": 0}, nil)
+	var errResp map[string]string
+	if status := sqsJson(t, ts, "ChangeMessageVisibility", map[string]interface{}{"QueueUrl": queueUrl, "ReceiptHandle": received.Messages[0].ReceiptHandle, "VisibilityTimeout": 10}, &errResp); status != http.StatusBadRequest || !strings.HasSuffix(errResp["__type"], "MessageNotInflight") {
+		t.Fatalf("%s failed: unexpected error %d/%v", test, status, errResp)
+	}
+	var attrs struct{ Attributes map[string]string }
+	sqsJson(t, ts, "GetQueueAttributes", map[string]interface{}{"QueueUrl": queueUrl, "AttributeNames": []string{"All"}}, &attrs)
+	if attrs.Attributes["ApproximateNumberOfMessages"] != "1" || attrs.Attributes["ApproximateNumberOfMessagesNotVisible"] != "0" {
+		t.Fatalf("%s failed: unexpected attributes %v", test, attrs.Attributes)
+	}
+
+	if status := sqsJson(t, ts, "CreateQueue", map[string]interface{}{"QueueName": "new"}, &errResp); status != http.StatusBadRequest || !strings.HasSuffix(errResp["__type"], "InvalidAction") {
+		t.Fatalf("%s failed: unexpected error %d/%v", test, status, errResp)
+	}
+}
+
+func TestSqsServer_VisibilityTimeout(t *testing.T) {
+	test := "TestSqsServer_VisibilityTimeout"
+	clock := singu.NewFakeClock(time.Now())
+	backend := singu.NewInmemQueueWithClock(queueNameInmem, 0, false, 0, clock)
+	srv := sqs.NewServer(sqs.Config{Clock: clock})
+	srv.RegisterQueue(backend)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	queueUrl := ts.URL + "/" + sqs.DefaultAccountId + "/" + queueNameInmem
+
+	backend.Queue(singu.NewQueueMessageWithClock([]byte("hello"), clock))
+	var received struct {
+		Messages []struct{ ReceiptHandle string }
+	}
+	sqsJson(t, ts, "ReceiveMessage", map[string]interface{}{"QueueUrl": queueUrl, "VisibilityTimeout": 10}, &received)
+	if len(received.Messages) != 1 {
+		t.Fatalf("%s failed: expected 1 message but received %d", test, len(received.Messages))
+	}
+	sqsJson(t, ts, "ChangeMessageVisibility", map[string]interface{}{"QueueUrl": queueUrl, "ReceiptHandle": received.Messages[0].ReceiptHandle, "VisibilityTimeout": 20}, nil)
+
+	// not expired yet
+	clock.Advance(15 * time.Second)
+	var none struct {
+		Messages []struct{ ReceiptHandle string }
+	}
+	sqsJson(t, ts, "ReceiveMessage", map[string]interface{}{"QueueUrl": queueUrl}, &none)
+	if len(none.Messages) != 0 {
+		t.Fatalf("%s failed: expected no message but received %d", test, len(none.Messages))
+	}
+
+	// expired: the message is re-queued and received again
+	clock.Advance(10 * time.Second)
+	var redelivered struct {
+		Messages []struct{ Attributes map[string]string }
+	}
+	sqsJson(t, ts, "ReceiveMessage", map[string]interface{}{"QueueUrl": queueUrl, "AttributeNames": []string{"ApproximateReceiveCount"}}, &redelivered)
+	if len(redelivered.Messages) != 1 || redelivered.Messages[0].Attributes["ApproximateReceiveCount"] != "2" {
+		t.Fatalf("%s failed: unexpected messages %#v", test, redelivered.Messages)
+	}
+}
+
+func TestSqsServer_StaleReceiptHandle(t *testing.T) {
+	test := "TestSqsServer_StaleReceiptHandle"
+	clock := singu.NewFakeClock(time.Now())
+	backend := singu.NewInmemQueueWithClock(queueNameInmem, 0, false, 0, clock)
+	srv := sqs.NewServer(sqs.Config{Clock: clock})
+	srv.RegisterQueue(backend)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	queueUrl := ts.URL + "/" + sqs.DefaultAccountId + "/" + queueNameInmem
+
+	backend.Queue(singu.NewQueueMessageWithClock([]byte("hello"), clock))
+	var first, second struct {
+		Messages []struct{ MessageId, ReceiptHandle string }
+	}
+	sqsJson(t, ts, "ReceiveMessage", map[string]interface{}{"QueueUrl": queueUrl, "VisibilityTimeout": 10}, &first)
+	clock.Advance(15 * time.Second)
+	sqsJson(t, ts, "ReceiveMessage", map[string]interface{}{"QueueUrl": queueUrl, "VisibilityTimeout": 10}, &second)
+	if len(first.Messages) != 1 || len(second.Messages) != 1 || first.Messages[0].MessageId != second.Messages[0].MessageId {
+		t.Fatalf("%s failed: expected the same message to be received twice, got %#v and %#v", test, first.Messages, second.Messages)
+	}
+	if first.Messages[0].ReceiptHandle == second.Messages[0].ReceiptHandle {
+		t.Fatalf("%s failed: expected different receipt handles but got %s twice", test, first.Messages[0].ReceiptHandle)
+	}
+
+	// the handle of the first receive no longer refers to the message
+	var errResp map[string]string
+	for _, action := range []string{"DeleteMessage", "ChangeMessageVisibility"} {
+		params := map[string]interface{}{"QueueUrl": queueUrl, "ReceiptHandle": first.Messages[0].ReceiptHandle, "VisibilityTimeout": 0}
+		if status := sqsJson(t, ts, action, params, &errResp); status != http.StatusBadRequest || !strings.HasSuffix(errResp["__type"], "ReceiptHandleIsInvalid") {
+			t.Fatalf("%s failed: unexpected %s error %d/%v", test, action, status, errResp)
+		}
+	}
+	if size, _ := backend.EphemeralSize(); size != 1 {
+		t.Fatalf("%s failed: expected ephemeral size 1 but received %d", test, size)
+	}
+
+	if status := sqsJson(t, ts, "DeleteMessage", map[string]interface{}{"QueueUrl": queueUrl, "ReceiptHandle": second.Messages[0].ReceiptHandle}, nil); status != http.StatusOK {
+		t.Fatalf("%s failed: unexpected DeleteMessage status %d", test, status)
+	}
+	if size, _ := backend.EphemeralSize(); size != 0 {
+		t.Fatalf("%s failed: expected ephemeral size 0 but received %d", test, size)
+	}
+}
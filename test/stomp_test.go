@@ -0,0 +1,248 @@
+package test
+
+import (
+	"bufio"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/stomp"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stompClient is a minimal STOMP client used for testing.
+type stompClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// stompFrame is a frame received by stompClient.
+type stompFrame struct {
+	command string
+	headers map[string]string
+	body    string
+}
+
+// newStompServer starts a STOMP server serving the backend queues on a random local port.
+func newStompServer(t *testing.T, config stomp.Config, queues ...singu.IQueue) (*stomp.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %e", err)
+	}
+	config.PollInterval = 10 * time.Millisecond
+	srv := stomp.NewServer(config)
+	for _, queue := range queues {
+		srv.RegisterQueue(queue)
+	}
+	go srv.Serve(listener)
+	return srv, listener.Addr().String()
+}
+
+// newStompClient connects to the server and sends a CONNECT frame with the specified headers.
+func newStompClient(t *testing.T, addr string, headers ...string) (*stompClient, *stompFrame) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("error connecting to STOMP server: %e", err)
+	}
+	client := &stompClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	client.send("CONNECT", "", append([]string{"accept-version", "1.2", "host", "localhost"}, headers...)...)
+	return client, client.receive()
+}
+
+func (c *stompClient) send(command, body string, headers ...string) {
+	var sb strings.Builder
+	sb.WriteString(command + "\n")
+	for i := 0; i+1 < len(headers); i += 2 {
+		sb.WriteString(headers[i] + ":" + headers[i+1] + "\n")
+	}
+	sb.WriteString("\n" + body + "\x00")
+	if _, err := io.WriteString(c.conn, sb.String()); err != nil {
+		c.t.Fatalf("error sending %s frame: %e", command, err)
+	}
+}
+
+// receive reads the next frame, skipping heart-beats.
+func (c *stompClient) receive() *stompFrame {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	f := &stompFrame{headers: make(map[string]string)}
+	for f.command == "" {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("error reading frame: %e", err)
+		}
+		f.command = strings.TrimRight(line, "\r\n")
+	}
+	for {
+		line, _ := c.reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line == "" {
+			break
+		}
+		if tokens := strings.SplitN(line, ":", 2); len(tokens) == 2 {
+			if _, ok := f.headers[tokens[0]]; !ok {
+				f.headers[tokens[0]] = tokens[1]
+			}
+		}
+	}
+	body, err := c.reader.ReadString(0)
+	if err != nil {
+		c.t.Fatalf("error reading frame: %e", err)
+	}
+	f.body = strings.TrimSuffix(body, "\x00")
+	return f
+}
+
+func (c *stompClient) expect(test, command string) *stompFrame {
+	f := c.receive()
+	if f.command != command {
+		c.t.Fatalf("%s failed: expected %s frame but received %#v", test, command, f)
+	}
+	return f
+}
+
+func TestStompServer_SendSubscribe(t *testing.T) {
+	test := "TestStompServer_SendSubscribe"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv, addr := newStompServer(t, stomp.Config{}, backend)
+	defer srv.Close()
+	client, connected := newStompClient(t, addr)
+	if connected.command != "CONNECTED" || connected.headers["version"] != "1.2" {
+		t.Fatalf("%s failed: unexpected frame %#v", test, connected)
+	}
+
+	client.send("SEND", "message 1", "destination", "/queue/"+queueNameInmem, "receipt", "r1")
+	if receipt := client.expect(test, "RECEIPT"); receipt.headers["receipt-id"] != "r1" {
+		t.Fatalf("%s failed: unexpected receipt %#v", test, receipt)
+	}
+	client.send("SEND", "message 2", "destination", queueNameInmem, "content-length", "9")
+	client.send("SUBSCRIBE", "", "id", "0", "destination", "/queue/"+queueNameInmem)
+	for i, expected := range []string{"message 1", "message 2"} {
+		msg := client.expect(test, "MESSAGE")
+		if msg.body != expected || msg.headers["subscription"] != "0" || msg.headers["ack"] != "" {
+			t.Fatalf("%s failed: unexpected message #%d %#v", test, i, msg)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, ephemeralSize)
+	}
+
+	client.send("SEND", "message", "destination", "/queue/not-exist")
+	client.expect(test, "ERROR")
+}
+
+func TestStompServer_ClientIndividualAck(t *testing.T) {
+	test := "TestStompServer_ClientIndividualAck"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv, addr := newStompServer(t, stomp.Config{}, backend)
+	defer srv.Close()
+	client, _ := newStompClient(t, addr)
+
+	for _, payload := range []string{"message 1", "message 2", "message 3"} {
+		backend.Queue(singu.NewQueueMessage([]byte(payload)))
+	}
+	client.send("SUBSCRIBE", "", "id", "sub", "destination", queueNameInmem, "ack", "client-individual", "prefetch-count", "2")
+	msg1, msg2 := client.expect(test, "MESSAGE"), client.expect(test, "MESSAGE")
+	time.Sleep(50 * time.Millisecond)
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 2 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 2, ephemeralSize)
+	}
+
+	// NACK re-queues the message, ACK finishes it
+	client.send("NACK", "", "id", msg1.headers["ack"])
+	client.send("ACK", "", "id", msg2.headers["ack"], "receipt", "acked")
+	client.expect(test, "RECEIPT")
+	for _, expected := range []string{"message 3", "message 1"} {
+		if msg := client.expect(test, "MESSAGE"); msg.body != expected {
+			t.Fatalf("%s failed: expected [%s] but received %#v", test, expected, msg)
+		}
+	}
+
+	// disconnect, unacknowledged messages are re-queued
+	client.send("DISCONNECT", "", "receipt", "bye")
+	client.expect(test, "RECEIPT")
+	time.Sleep(50 * time.Millisecond)
+	if queueSize, _ := backend.QueueSize(); queueSize != 2 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 2, queueSize)
+	}
+	if ephemeralSize, _ := backend.EphemeralSize(); ephemeralSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, ephemeralSize)
+	}
+}
+
+func TestStompServer_Transaction(t *testing.T) {
+	test := "TestStompServer_Transaction"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv, addr := newStompServer(t, stomp.Config{}, backend)
+	defer srv.Close()
+	client, _ := newStompClient(t, addr)
+
+	client.send("BEGIN", "", "transaction", "tx1")
+	client.send("SEND", "message", "destination", queueNameInmem, "transaction", "tx1", "receipt", "sent")
+	client.expect(test, "RECEIPT")
+	if queueSize, _ := backend.QueueSize(); queueSize != 0 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 0, queueSize)
+	}
+	client.send("COMMIT", "", "transaction", "tx1", "receipt", "committed")
+	client.expect(test, "RECEIPT")
+	if queueSize, _ := backend.QueueSize(); queueSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, queueSize)
+	}
+
+	client.send("BEGIN", "", "transaction", "tx2")
+	client.send("SEND", "message", "destination", queueNameInmem, "transaction", "tx2")
+	client.send("ABORT", "", "transaction", "tx2", "receipt", "aborted")
+	client.expect(test, "RECEIPT")
+	if queueSize, _ := backend.QueueSize(); queueSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, queueSize)
+	}
+}
+
+func TestStompServer_ConnectAndHeartBeat(t *testing.T) {
+	test := "TestStompServer_ConnectAndHeartBeat"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	config := stomp.Config{
+		HeartBeat:    50 * time.Millisecond,
+		Authenticate: func(login, passcode string) bool { return login == "user" && passcode == "secret" },
+	}
+	srv, addr := newStompServer(t, config, backend)
+	defer srv.Close()
+
+	if _, f := newStompClient(t, addr, "login", "user", "passcode", "wrong"); f.command != "ERROR" {
+		t.Fatalf("%s failed: expected ERROR frame but received %#v", test, f)
+	}
+	client, f := newStompClient(t, addr, "login", "user", "passcode", "secret", "heart-beat", "0,50")
+	if f.command != "CONNECTED" || f.headers["heart-beat"] != "50,50" {
+		t.Fatalf("%s failed: unexpected frame %#v", test, f)
+	}
+	// the server sends heart-beats (EOLs) and tolerates the client not sending any
+	client.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if b, err := client.reader.ReadByte(); err != nil || b != '\n' {
+		t.Fatalf("%s failed: expected heart-beat but received %v/%e", test, b, err)
+	}
+}
+
+func TestStompServer_ClientHeartBeats(t *testing.T) {
+	test := "TestStompServer_ClientHeartBeats"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	srv, addr := newStompServer(t, stomp.Config{HeartBeat: 100 * time.Millisecond}, backend)
+	defer srv.Close()
+
+	client, f := newStompClient(t, addr, "heart-beat", "50,0")
+	if f.command != "CONNECTED" {
+		t.Fatalf("%s failed: unexpected frame %#v", test, f)
+	}
+	// the client sends heart-beats only, for longer than the read timeout: the connection must be kept alive
+	for i := 0; i < 10; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if _, err := io.WriteString(client.conn, "\n"); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+	}
+	client.send("SEND", "message", "destination", "/queue/"+queueNameInmem, "receipt", "sent")
+	client.expect(test, "RECEIPT")
+	if queueSize, _ := backend.QueueSize(); queueSize != 1 {
+		t.Fatalf("%s failed: expected %d but received %d", test, 1, queueSize)
+	}
+}
@@ -0,0 +1,153 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/server"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseReader reads events of a Server-Sent Events stream.
+type sseReader struct {
+	t      *testing.T
+	reader *bufio.Reader
+}
+
+// next returns the data of the next event, skipping comments.
+func (r *sseReader) next() *server.StreamEvent {
+	event := &server.StreamEvent{}
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil {
+			r.t.Fatalf("error reading event: %e", err)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), event); err != nil {
+				r.t.Fatalf("error decoding event [%s]: %e", line, err)
+			}
+		}
+		if line == "\n" && event.Type != "" {
+			return event
+		}
+	}
+}
+
+func waitForSizes(t *testing.T, test string, queue singu.IQueue, queueSize, ephemeralSize int) {
+	for i := 0; i < 100; i++ {
+		qs, _ := queue.QueueSize()
+		es, _ := queue.EphemeralSize()
+		if qs == queueSize && es == ephemeralSize {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	qs, _ := queue.QueueSize()
+	es, _ := queue.EphemeralSize()
+	t.Fatalf("%s failed: expected sizes %d/%d but received %d/%d", test, queueSize, ephemeralSize, qs, es)
+}
+
+func TestServer_StreamSSE(t *testing.T) {
+	test := "TestServer_StreamSSE"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	ts := newTestServer(server.Config{PollInterval: 10 * time.Millisecond}, backend)
+	defer ts.Close()
+	url := ts.URL + "/queues/" + queueNameInmem
+
+	for _, payload := range []string{"message 1", "message 2", "message 3"} {
+		backend.Queue(singu.NewQueueMessage([]byte(payload)))
+	}
+	resp, err := http.Get(url + "/stream?max_in_flight=2")
+	if err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("%s failed: unexpected content type [%s]", test, contentType)
+	}
+	events := &sseReader{t: t, reader: bufio.NewReader(resp.Body)}
+	session := events.next()
+	if session.Type != server.StreamEventSession || session.Session == "" {
+		t.Fatalf("%s failed: unexpected event %#v", test, session)
+	}
+	msg1, msg2 := events.next(), events.next()
+	if string(msg1.Message.Payload) != "message 1" || string(msg2.Message.Payload) != "message 2" {
+		t.Fatalf("%s failed: unexpected events %#v/%#v", test, msg1, msg2)
+	}
+	// max_in_flight reached, the third message is not delivered yet
+	waitForSizes(t, test, backend, 1, 2)
+
+	ackUrl := url + "/stream/" + session.Session + "/ack"
+	if status := doRequest(t, test, "POST", ackUrl, "", server.StreamAck{Id: msg1.Message.Id, Action: server.StreamAckFinish}, nil); status != http.StatusNoContent {
+		t.Fatalf("%s failed: expected status %d but received %d", test, http.StatusNoContent, status)
+	}
+	if msg3 := events.next(); string(msg3.Message.Payload) != "message 3" {
+		t.Fatalf("%s failed: unexpected event %#v", test, msg3)
+	}
+	var errResp server.ErrorResponse
+	if status := doRequest(t, test, "POST", ackUrl, "", server.StreamAck{Id: msg1.Message.Id, Action: server.StreamAckFinish}, &errResp); status != http.StatusNotFound || errResp.Code != server.CodeMessageNotInFlight {
+		t.Fatalf("%s failed: unexpected response %d/%#v", test, status, errResp)
+	}
+
+	// connection drops, unacknowledged messages are re-queued
+	resp.Body.Close()
+	waitForSizes(t, test, backend, 2, 0)
+	if status := doRequest(t, test, "POST", ackUrl, "", server.StreamAck{Id: msg2.Message.Id, Action: server.StreamAckFinish}, &errResp); status != http.StatusNotFound || errResp.Code != server.CodeStreamNotFound {
+		t.Fatalf("%s failed: unexpected response %d/%#v", test, status, errResp)
+	}
+}
+
+func TestServer_StreamWebSocket(t *testing.T) {
+	test := "TestServer_StreamWebSocket"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	ts := newTestServer(server.Config{PollInterval: 10 * time.Millisecond, StreamMaxInFlight: 1}, backend)
+	defer ts.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/queues/"+queueNameInmem+"/stream", nil)
+	if err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	defer ws.Close()
+	receive := func() *server.StreamEvent {
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		event := &server.StreamEvent{}
+		if err := ws.ReadJSON(event); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+		return event
+	}
+	if session := receive(); session.Type != server.StreamEventSession {
+		t.Fatalf("%s failed: unexpected event %#v", test, session)
+	}
+
+	backend.Queue(singu.NewQueueMessage([]byte("message 1")))
+	backend.Queue(singu.NewQueueMessage([]byte("message 2")))
+	msg := receive()
+	if string(msg.Message.Payload) != "message 1" {
+		t.Fatalf("%s failed: unexpected event %#v", test, msg)
+	}
+
+	// requeue: the message goes back to the queue, and is delivered again after message 2
+	ws.WriteJSON(server.StreamAck{Id: msg.Message.Id, Action: server.StreamAckRequeue})
+	msg = receive()
+	if string(msg.Message.Payload) != "message 2" {
+		t.Fatalf("%s failed: unexpected event %#v", test, msg)
+	}
+	ws.WriteJSON(server.StreamAck{Id: msg.Message.Id, Action: server.StreamAckFinish})
+	msg = receive()
+	if string(msg.Message.Payload) != "message 1" || msg.Message.NumRequeues != 1 {
+		t.Fatalf("%s failed: unexpected event %#v", test, msg)
+	}
+
+	ws.WriteJSON(server.StreamAck{Id: "not-exist", Action: server.StreamAckFinish})
+	if event := receive(); event.Type != server.StreamEventError || event.Id != "not-exist" {
+		t.Fatalf("%s failed: unexpected event %#v", test, event)
+	}
+
+	// connection drops, the unacknowledged message is re-queued
+	ws.Close()
+	waitForSizes(t, test, backend, 1, 0)
+}
@@ -0,0 +1,136 @@
+package test
+
+import (
+	"context"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/tracing"
+	"sync"
+	"testing"
+)
+
+type spanContextKey struct{}
+
+// fakeSpan records what is done to it, its "trace context" is the span id.
+type fakeSpan struct {
+	id, parent string
+	name       string
+	config     tracing.SpanConfig
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (s *fakeSpan) SetAttributes(attributes ...tracing.Attribute) {
+	for _, a := range attributes {
+		s.attributes[a.Key] = a.Value
+	}
+}
+
+func (s *fakeSpan) RecordError(err error) {
+	s.err = err
+}
+
+func (s *fakeSpan) End() {
+	s.ended = true
+}
+
+type fakeTracer struct {
+	spans []*fakeSpan
+	lock  sync.Mutex
+}
+
+func (t *fakeTracer) Start(ctx context.Context, name string, config tracing.SpanConfig) (context.Context, tracing.Span) {
+	parent, _ := ctx.Value(spanContextKey{}).(string)
+	span := &fakeSpan{id: singu.UniqueId(), parent: parent, name: name, config: config, attributes: map[string]interface{}{}}
+	span.SetAttributes(config.Attributes...)
+	t.lock.Lock()
+	t.spans = append(t.spans, span)
+	t.lock.Unlock()
+	return context.WithValue(ctx, spanContextKey{}, span.id), span
+}
+
+type fakePropagator struct{}
+
+func (fakePropagator) Inject(ctx context.Context, carrier tracing.MetadataCarrier) {
+	if id, ok := ctx.Value(spanContextKey{}).(string); ok {
+		carrier.Set("traceparent", id)
+	}
+}
+
+func (fakePropagator) Extract(ctx context.Context, carrier tracing.MetadataCarrier) context.Context {
+	if id := carrier.Get("traceparent"); id != "" {
+		return context.WithValue(ctx, spanContextKey{}, id)
+	}
+	return ctx
+}
+
+// Queue a message through a TracedQueue with a caller's span, then Take, Requeue and Finish it. Expected:
+//	- Producer span is a child of the caller's span, consumer spans are children of and linked to the producer span
+//	- Trace context survives re-queue, the caller's message is not modified and empty takes create no span
+func TestTracedQueue(t *testing.T) {
+	test := "TestTracedQueue"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	tracer := &fakeTracer{}
+	queue := tracing.NewTracedQueue(backend, tracer, fakePropagator{})
+
+	// the producer span is a child of the caller's span, the caller's message is left untouched
+	ctx, _ := tracer.Start(context.Background(), "caller", tracing.SpanConfig{})
+	msg := singu.NewQueueMessage([]byte("payload"))
+	msg.Metadata = map[string]string{"key": "value"}
+	if _, err := queue.QueueWithContext(ctx, msg); err != nil {
+		t.Fatalf("%s failed with error: %e", test, err)
+	}
+	if len(msg.Metadata) != 1 {
+		t.Fatalf("%s failed: caller's message was modified %v", test, msg.Metadata)
+	}
+	caller, producer := tracer.spans[0], tracer.spans[1]
+	if producer.parent != caller.id || producer.config.Kind != tracing.SpanKindProducer || !producer.ended {
+		t.Fatalf("%s failed: unexpected producer span %#v", test, producer)
+	}
+	if producer.name != backend.Name()+" publish" || producer.attributes[tracing.AttrMessageId] == nil {
+		t.Fatalf("%s failed: unexpected producer span %#v", test, producer)
+	}
+
+	// the consumer span is a child of and linked to the producer span
+	taken, err := queue.Take()
+	if err != nil || taken == nil {
+		t.Fatalf("%s failed: %v / %e", test, taken, err)
+	}
+	if string(taken.Payload) != "payload" || taken.Metadata["key"] != "value" || taken.Metadata["traceparent"] != producer.id {
+		t.Fatalf("%s failed: unexpected message %#v", test, taken)
+	}
+	consumer := tracer.spans[2]
+	if consumer.parent != producer.id || consumer.config.Kind != tracing.SpanKindConsumer || !consumer.ended {
+		t.Fatalf("%s failed: unexpected consumer span %#v", test, consumer)
+	}
+	if len(consumer.config.Links) != 1 || consumer.config.Links[0].Value(spanContextKey{}) != producer.id || consumer.config.StartTime.IsZero() {
+		t.Fatalf("%s failed: unexpected consumer span config %#v", test, consumer.config)
+	}
+	if id := queue.Extract(context.Background(), taken).Value(spanContextKey{}); id != producer.id {
+		t.Fatalf("%s failed: expected %v but received %v", test, producer.id, id)
+	}
+
+	// trace context survives re-queue, empty takes create no span
+	queue.Requeue(taken.Id, false)
+	taken, _ = queue.Take()
+	if consumer := tracer.spans[3]; consumer.parent != producer.id || consumer.attributes[tracing.AttrMessageRequeues] != 1 {
+		t.Fatalf("%s failed: unexpected consumer span %#v", test, consumer)
+	}
+	queue.Finish(taken.Id)
+	if msg, _ := queue.Take(); msg != nil || len(tracer.spans) != 4 {
+		t.Fatalf("%s failed: expected no message and 4 spans but received %v and %d", test, msg, len(tracer.spans))
+	}
+}
+
+func TestTracedQueue_QueueError(t *testing.T) {
+	test := "TestTracedQueue_QueueError"
+	tracer := &fakeTracer{}
+	queue := tracing.NewTracedQueue(singu.NewInmemQueue(queueNameInmem, 1, false, 0), tracer, fakePropagator{})
+	queue.Queue(singu.NewQueueMessage([]byte("message 1")))
+	if _, err := queue.Queue(singu.NewQueueMessage([]byte("message 2"))); err != singu.ErrorQueueIsFull {
+		t.Fatalf("%s failed: expected %v but received %v", test, singu.ErrorQueueIsFull, err)
+	}
+	if span := tracer.spans[1]; span.parent != "" || span.err != singu.ErrorQueueIsFull || !span.ended {
+		t.Fatalf("%s failed: unexpected span %#v", test, span)
+	}
+}
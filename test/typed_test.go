@@ -0,0 +1,112 @@
+package test
+
+import (
+	"errors"
+	"github.com/btnguyen2k/singu"
+	"github.com/btnguyen2k/singu/rpc"
+	"github.com/btnguyen2k/singu/typed"
+	"github.com/golang/protobuf/proto"
+	"reflect"
+	"testing"
+)
+
+type order struct {
+	Id       string
+	Items    []string
+	Quantity int
+}
+
+// Queue, Take, Requeue and Finish a value through a TypedQueue, for the JSON and Gob codecs. Expected:
+//	- Taken values equal queued values
+//	- Take returns no value once the queue is empty
+func TestTypedQueue(t *testing.T) {
+	test := "TestTypedQueue"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	for name, codec := range map[string]typed.Codec[order]{"json": typed.JSON[order](), "gob": typed.Gob[order]()} {
+		queue := typed.New(backend, codec, typed.Config{})
+		expected := order{Id: "order-1", Items: []string{"apple", "pear"}, Quantity: 3}
+		if _, err := queue.Queue(expected); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+		v, handle, err := queue.Take()
+		if err != nil || handle == nil || !reflect.DeepEqual(v, expected) {
+			t.Fatalf("%s failed (%s): expected %v but received %v / %e", test, name, expected, v, err)
+		}
+		if err := handle.Requeue(false); err != nil {
+			t.Fatalf("%s failed with error: %e", test, err)
+		}
+		v, handle, _ = queue.Take()
+		if handle.Message.NumRequeues != 1 || !reflect.DeepEqual(v, expected) {
+			t.Fatalf("%s failed (%s): unexpected re-queued message %v", test, name, handle.Message)
+		}
+		handle.Finish()
+		if v, handle, err := queue.Take(); err != nil || handle != nil || !reflect.DeepEqual(v, order{}) {
+			t.Fatalf("%s failed (%s): expected no message but received %v / %v / %e", test, name, v, handle, err)
+		}
+		if size, _ := queue.Unwrap().EphemeralSize(); size != 0 {
+			t.Fatalf("%s failed (%s): expected empty ephemeral storage but received %d", test, name, size)
+		}
+	}
+}
+
+func TestTypedQueue_Proto(t *testing.T) {
+	test := "TestTypedQueue_Proto"
+	queue := typed.New(singu.NewInmemQueue(queueNameInmem, 0, false, 0), typed.Proto[*rpc.QueueRequest](), typed.Config{})
+	queue.Queue(&rpc.QueueRequest{Queue: "orders"})
+	v, handle, err := queue.Take()
+	if err != nil || handle == nil || v.Queue != "orders" {
+		t.Fatalf("%s failed: unexpected value %v / %e", test, v, err)
+	}
+
+	// interface types can encode but not decode
+	codec := typed.Proto[proto.Message]()
+	data, err := codec.Encode(&rpc.QueueRequest{Queue: "orders"})
+	if err != nil || len(data) == 0 {
+		t.Fatalf("%s failed: unexpected encoded data %v / %e", test, data, err)
+	}
+	if msg, err := codec.Decode(data); msg != nil || !errors.Is(err, typed.ErrorUnsupportedType) {
+		t.Fatalf("%s failed: expected %v but received %v / %v", test, typed.ErrorUnsupportedType, msg, err)
+	}
+}
+
+func TestTypedQueue_Poison(t *testing.T) {
+	test := "TestTypedQueue_Poison"
+	backend := singu.NewInmemQueue(queueNameInmem, 0, false, 0)
+	backend.Queue(singu.NewQueueMessage([]byte("not json")))
+	backend.Queue(singu.NewQueueMessage([]byte(`{"Id":"order-1"}`)))
+
+	// without poison handler, Take reports the decode error and leaves the message in ephemeral storage
+	queue := typed.New(backend, typed.JSON[order](), typed.Config{})
+	_, handle, err := queue.Take()
+	var decodeErr *typed.DecodeError
+	if handle != nil || !errors.As(err, &decodeErr) || decodeErr.Id == "" {
+		t.Fatalf("%s failed: expected DecodeError but received %v", test, err)
+	}
+	backend.Requeue(decodeErr.Id, true)
+
+	// with poison handler, poison messages are moved to the dead-letter queue
+	deadLetter := singu.NewInmemQueue("dead-letter", 0, false, 0)
+	queue = typed.New(backend, typed.JSON[order](), typed.Config{OnPoison: typed.PoisonQueue(deadLetter)})
+	v, handle, err := queue.Take()
+	if err != nil || v.Id != "order-1" {
+		t.Fatalf("%s failed: unexpected value %v / %e", test, v, err)
+	}
+	handle.Finish()
+	if _, handle, err := queue.Take(); err != nil || handle != nil {
+		t.Fatalf("%s failed: expected no message but received %v / %e", test, handle, err)
+	}
+	if poison, _ := deadLetter.Peek(1); len(poison) != 1 || string(poison[0].Payload) != "not json" || poison[0].Metadata[typed.MetadataPoisonReason] == "" {
+		t.Fatalf("%s failed: unexpected dead-letter messages %v", test, poison)
+	}
+	if size, _ := backend.EphemeralSize(); size != 0 {
+		t.Fatalf("%s failed: expected empty ephemeral storage but received %d", test, size)
+	}
+
+	// poison handler errors are returned
+	errHandler := errors.New("handler failed")
+	backend.Queue(singu.NewQueueMessage([]byte("not json")))
+	queue = typed.New(backend, typed.JSON[order](), typed.Config{OnPoison: func(msg *singu.QueueMessage, err error) error { return errHandler }})
+	if _, _, err := queue.Take(); err != errHandler {
+		t.Fatalf("%s failed: expected %v but received %v", test, errHandler, err)
+	}
+}
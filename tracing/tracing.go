@@ -0,0 +1,181 @@
+// Package tracing propagates distributed traces through singu queues: TracedQueue is an IQueue decorator that injects
+// the trace context into each message at Queue time and extracts it at Take time, creating a producer span and a
+// consumer span linked across the queue.
+//
+// The trace context travels in QueueMessage.Metadata, the payload is left untouched.
+//
+// Tracer, Span and Propagator mirror the subset of the OpenTelemetry API used by TracedQueue, so that OpenTelemetry
+// (or any other tracing library) can be plugged in with thin adapters, e.g. for OpenTelemetry:
+//	- Tracer.Start: call trace.Tracer.Start with trace.WithSpanKind, trace.WithTimestamp, trace.WithAttributes and a
+//	  trace.Link for each link (trace.SpanContextFromContext of the linked context).
+//	- Propagator: wrap a propagation.TextMapPropagator, MetadataCarrier satisfies propagation.TextMapCarrier as is.
+package tracing
+
+import (
+	"context"
+	"github.com/btnguyen2k/singu"
+	"time"
+)
+
+// SpanKind is the role of a span, values mirror OpenTelemetry's trace.SpanKind.
+type SpanKind int
+
+const (
+	// SpanKindProducer is the kind of spans created at Queue time
+	SpanKindProducer SpanKind = 4
+
+	// SpanKindConsumer is the kind of spans created at Take time
+	SpanKindConsumer SpanKind = 5
+)
+
+// Attribute is a key-value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attribute keys set by TracedQueue, following OpenTelemetry's semantic conventions for messaging systems.
+const (
+	AttrMessagingSystem      = "messaging.system"
+	AttrMessagingDestination = "messaging.destination.name"
+	AttrMessagingOperation   = "messaging.operation"
+	AttrMessageId            = "messaging.message.id"
+	AttrMessageRequeues      = "singu.message.num_requeues"
+)
+
+// SpanConfig holds the options of a new span.
+type SpanConfig struct {
+	Kind       SpanKind
+	StartTime  time.Time         // zero value means now
+	Attributes []Attribute       // initial attributes
+	Links      []context.Context // contexts carrying the span contexts the new span is linked to
+}
+
+// Span is a unit of work in a trace, it mirrors a subset of OpenTelemetry's trace.Span.
+type Span interface {
+	// SetAttributes sets attributes of the span.
+	SetAttributes(attributes ...Attribute)
+
+	// RecordError records an error and marks the span as failed.
+	RecordError(err error)
+
+	// End completes the span.
+	End()
+}
+
+// Tracer creates spans, it mirrors OpenTelemetry's trace.Tracer.
+type Tracer interface {
+	// Start creates a span as child of the span in ctx, if any, and returns a context carrying the new span.
+	Start(ctx context.Context, name string, config SpanConfig) (context.Context, Span)
+}
+
+// Propagator injects trace context into and extracts it from carriers, it mirrors OpenTelemetry's
+// propagation.TextMapPropagator.
+type Propagator interface {
+	// Inject writes the trace context of ctx to the carrier.
+	Inject(ctx context.Context, carrier MetadataCarrier)
+
+	// Extract reads trace context from the carrier and returns a copy of ctx carrying it.
+	Extract(ctx context.Context, carrier MetadataCarrier) context.Context
+}
+
+// MetadataCarrier exposes QueueMessage.Metadata as a text map carrier, it satisfies OpenTelemetry's
+// propagation.TextMapCarrier.
+type MetadataCarrier map[string]string
+
+// Get returns the value of the key, or an empty string if there is none.
+func (c MetadataCarrier) Get(key string) string {
+	return c[key]
+}
+
+// Set stores a key-value pair.
+func (c MetadataCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys lists the keys stored in the carrier.
+func (c MetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// NewTracedQueue creates a new TracedQueue that decorates the queue.
+func NewTracedQueue(queue singu.IQueue, tracer Tracer, propagator Propagator) *TracedQueue {
+	return &TracedQueue{IQueue: queue, tracer: tracer, propagator: propagator}
+}
+
+// TracedQueue is an IQueue decorator that propagates trace context through queued messages.
+//	- Queue and QueueWithContext start a producer span "<queue> publish" and inject its context into the queued
+//	  message's metadata. The caller's message is not modified.
+//	- Take starts a consumer span "<queue> receive" for each taken message, as child of the trace context extracted from
+//	  the message and linked to it. Use Extract to continue the trace while processing the message.
+//	- Other operations are passed through, messages keep their metadata when re-queued.
+type TracedQueue struct {
+	singu.IQueue
+	tracer     Tracer
+	propagator Propagator
+}
+
+func (q *TracedQueue) attributes(operation string) []Attribute {
+	return []Attribute{
+		{Key: AttrMessagingSystem, Value: "singu"},
+		{Key: AttrMessagingDestination, Value: q.Name()},
+		{Key: AttrMessagingOperation, Value: operation},
+	}
+}
+
+// Queue implements IQueue.Queue, the producer span starts a new trace. See QueueWithContext.
+func (q *TracedQueue) Queue(msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	return q.QueueWithContext(context.Background(), msg)
+}
+
+// QueueWithContext queues a message, the producer span is a child of the span in ctx.
+func (q *TracedQueue) QueueWithContext(ctx context.Context, msg *singu.QueueMessage) (*singu.QueueMessage, error) {
+	ctx, span := q.tracer.Start(ctx, q.Name()+" publish", SpanConfig{Kind: SpanKindProducer, Attributes: q.attributes("publish")})
+	defer span.End()
+	clone := singu.CloneQueueMessage(*msg)
+	if clone.Metadata == nil {
+		clone.Metadata = make(map[string]string)
+	}
+	q.propagator.Inject(ctx, clone.Metadata)
+	result, err := q.IQueue.Queue(&clone)
+	if err != nil {
+		span.RecordError(err)
+	} else if result != nil {
+		span.SetAttributes(Attribute{Key: AttrMessageId, Value: result.Id})
+	}
+	return result, err
+}
+
+// Take implements IQueue.Take
+func (q *TracedQueue) Take() (*singu.QueueMessage, error) {
+	start := time.Now()
+	msg, err := q.IQueue.Take()
+	if msg == nil {
+		// no span for empty takes nor failed ones, they carry no trace context
+		return msg, err
+	}
+	producer := q.Extract(context.Background(), msg)
+	attributes := append(q.attributes("receive"),
+		Attribute{Key: AttrMessageId, Value: msg.Id},
+		Attribute{Key: AttrMessageRequeues, Value: msg.NumRequeues})
+	_, span := q.tracer.Start(producer, q.Name()+" receive", SpanConfig{
+		Kind:       SpanKindConsumer,
+		StartTime:  start,
+		Attributes: attributes,
+		Links:      []context.Context{producer},
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+	return msg, err
+}
+
+// Extract returns a copy of ctx carrying the trace context of the message, i.e. the context of its producer span.
+func (q *TracedQueue) Extract(ctx context.Context, msg *singu.QueueMessage) context.Context {
+	return q.propagator.Extract(ctx, MetadataCarrier(msg.Metadata))
+}
@@ -0,0 +1,220 @@
+// Package typed lets applications queue and take values of their own types instead of raw payloads: TypedQueue[T]
+// wraps an IQueue and encodes values to payloads, and decodes payloads back to values, with a Codec[T].
+//
+// Built-in codecs: JSON, Gob and Proto (protocol buffers messages).
+//
+// Messages whose payload can not be decoded (poison messages) are routed to Config.OnPoison, so that consumers are only
+// handed well-formed values. See PoisonQueue to move them to a dead-letter queue.
+package typed
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btnguyen2k/singu"
+	"github.com/golang/protobuf/proto"
+	"reflect"
+)
+
+// Codec encodes values of type T to payloads and decodes them back. Implementations must be safe for concurrent use.
+type Codec[T any] interface {
+	// Encode encodes a value to a payload.
+	Encode(v T) ([]byte, error)
+
+	// Decode decodes a payload to a value.
+	Decode(data []byte) (T, error)
+}
+
+// JSON returns a Codec that encodes values with package encoding/json.
+func JSON[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+type jsonCodec[T any] struct{}
+
+// Encode implements Codec.Encode
+func (jsonCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode implements Codec.Decode
+func (jsonCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// Gob returns a Codec that encodes values with package encoding/gob. Each payload is a self-contained gob stream,
+// carrying the type information of the value.
+func Gob[T any]() Codec[T] {
+	return gobCodec[T]{}
+}
+
+type gobCodec[T any] struct{}
+
+// Encode implements Codec.Encode
+func (gobCodec[T]) Encode(v T) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+// Decode implements Codec.Decode
+func (gobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// ErrorUnsupportedType is returned when decoding with a Proto codec whose T is not a pointer to a message struct.
+var ErrorUnsupportedType = errors.New("type is not a pointer to a message struct")
+
+// Proto returns a Codec that encodes protocol buffers messages in their binary wire format. T is a pointer to a
+// generated message struct, e.g. Proto[*pb.Order](). Other types (e.g. interface proto.Message) can encode, but
+// decoding fails with ErrorUnsupportedType as the codec does not know what to decode to.
+func Proto[T proto.Message]() Codec[T] {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return protoCodec[T]{name: typ.String()}
+	}
+	return protoCodec[T]{typ: typ.Elem(), name: typ.String()}
+}
+
+type protoCodec[T proto.Message] struct {
+	typ  reflect.Type // type of the message struct, nil if T is not a pointer to a struct
+	name string       // name of T
+}
+
+// Encode implements Codec.Encode
+func (c protoCodec[T]) Encode(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+// Decode implements Codec.Decode
+func (c protoCodec[T]) Decode(data []byte) (T, error) {
+	if c.typ == nil {
+		var zero T
+		return zero, fmt.Errorf("%w: %s", ErrorUnsupportedType, c.name)
+	}
+	v := reflect.New(c.typ).Interface().(T)
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
+
+// DecodeError is returned by Take when a poison message is not handled, it wraps the codec's error. Id identifies the
+// message, which is left in ephemeral storage.
+type DecodeError struct {
+	Id  string
+	Err error
+}
+
+// Error implements error.Error
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("message %s: %s", e.Id, e.Err)
+}
+
+// Unwrap returns the wrapped error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// MetadataPoisonReason is the metadata key messages moved by PoisonQueue carry the decode error in.
+const MetadataPoisonReason = "poison-reason"
+
+// PoisonHandler handles a message whose payload can not be decoded, err is the codec's error. If the handler returns
+// nil, the message is finished; otherwise it is left in ephemeral storage and Take returns the handler's error.
+type PoisonHandler func(msg *singu.QueueMessage, err error) error
+
+// PoisonQueue returns a PoisonHandler that moves poison messages to a dead-letter queue, with the decode error in their
+// metadata (key MetadataPoisonReason).
+func PoisonQueue(deadLetter singu.IQueue) PoisonHandler {
+	return func(msg *singu.QueueMessage, err error) error {
+		clone := singu.CloneQueueMessage(*msg)
+		if clone.Metadata == nil {
+			clone.Metadata = make(map[string]string)
+		}
+		clone.Metadata[MetadataPoisonReason] = err.Error()
+		if _, err := deadLetter.Queue(&clone); err != nil {
+			return fmt.Errorf("move poison message %s: %w", msg.Id, err)
+		}
+		return nil
+	}
+}
+
+// Config holds TypedQueue's configurations.
+type Config struct {
+	// OnPoison, if supplied, handles messages whose payload can not be decoded, and Take moves on to the next message
+	// once a poison message is handled. Otherwise Take returns a DecodeError.
+	OnPoison PoisonHandler
+}
+
+// New creates a new TypedQueue of values of type T over the queue.
+func New[T any](queue singu.IQueue, codec Codec[T], config Config) *TypedQueue[T] {
+	return &TypedQueue[T]{queue: queue, codec: codec, config: config}
+}
+
+// TypedQueue queues and takes values of type T to and from an IQueue.
+type TypedQueue[T any] struct {
+	queue  singu.IQueue
+	codec  Codec[T]
+	config Config
+}
+
+// Handle refers to a message taken from a TypedQueue, to finish or re-queue it once the value is processed.
+type Handle struct {
+	queue   singu.IQueue
+	Message *singu.QueueMessage // the taken message, with its id, metadata and NumRequeues
+}
+
+// Finish finishes the message, see IQueue.Finish.
+func (h *Handle) Finish() error {
+	return h.queue.Finish(h.Message.Id)
+}
+
+// Requeue re-queues the message, see IQueue.Requeue.
+func (h *Handle) Requeue(silent bool) error {
+	_, err := h.queue.Requeue(h.Message.Id, silent)
+	return err
+}
+
+// Unwrap returns the underlying IQueue, e.g. to get its sizes or to browse it.
+func (q *TypedQueue[T]) Unwrap() singu.IQueue {
+	return q.queue
+}
+
+// Queue encodes the value and queues it, it returns the queued message.
+func (q *TypedQueue[T]) Queue(v T) (*singu.QueueMessage, error) {
+	payload, err := q.codec.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return q.queue.Queue(singu.NewQueueMessage(payload))
+}
+
+// Take takes a message and decodes its payload. The returned handle is nil if there is no message to take, otherwise
+// the message must be finished or re-queued through the handle once the value is processed. Poison messages are routed
+// to Config.OnPoison.
+func (q *TypedQueue[T]) Take() (T, *Handle, error) {
+	var zero T
+	for {
+		msg, err := q.queue.Take()
+		if err != nil || msg == nil {
+			return zero, nil, err
+		}
+		v, err := q.codec.Decode(msg.Payload)
+		if err == nil {
+			return v, &Handle{queue: q.queue, Message: msg}, nil
+		}
+		if q.config.OnPoison == nil {
+			return zero, nil, &DecodeError{Id: msg.Id, Err: err}
+		}
+		if err := q.config.OnPoison(msg, err); err != nil {
+			return zero, nil, err
+		}
+		if err := q.queue.Finish(msg.Id); err != nil {
+			return zero, nil, err
+		}
+	}
+}